@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const agentSocketEnv = "KUBED_AGENT_SOCK"
+
+func init() {
+	commands["agent"] = &command{
+		usage: "agent",
+		help:  "Hold tokens in memory and serve them over a local socket, keeping refresh tokens off disk",
+		run:   agent,
+	}
+}
+
+// agentRequest is sent to the agent as one JSON line, answered by an agentResponse
+type agentRequest struct {
+	Op            string             `json:"op"`
+	Cluster       string             `json:"cluster"`
+	Token         string             `json:"token,omitempty"`
+	ProviderToken *tokenResponse     `json:"providertoken,omitempty"`
+	Definition    *ClusterDefinition `json:"definition,omitempty"`
+}
+
+type agentResponse struct {
+	Token  string `json:"token,omitempty"`
+	CAData []byte `json:"cadata,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// agentEntry is what the agent holds for a cluster
+type agentEntry struct {
+	token         string
+	providerToken *tokenResponse
+}
+
+// agentSocket returns where the agent listens, -agent-socket or
+// KUBED_AGENT_SOCK, like SSH_AUTH_SOCK, or else a socket in the cache
+// directory, a named pipe on Windows
+func agentSocket() string {
+	if *agentSocketPath != "" {
+		return expandHome(*agentSocketPath)
+	}
+	if path := os.Getenv(agentSocketEnv); path != "" {
+		return path
+	}
+	return defaultAgentSocket()
+}
+
+func agent(ctx context.Context, args []string) error {
+	path := agentSocket()
+	// Only the user may connect, the peer is checked as well
+	listener, err := listenAgent(path)
+	if err != nil {
+		return errors.Wrap(err, "Failed in listening on agent socket")
+	}
+	defer listener.Close()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	err = serveDaemonHTTP(ctx)
+	if err != nil {
+		return err
+	}
+	log.Info("Agent listening on ", path)
+	log.Info("Use it from other shells with: export ", agentSocketEnv, "=", path)
+	entries := map[string]*agentEntry{}
+	var mutex sync.Mutex
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Info("Stopping agent")
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			err := checkPeer(conn)
+			if err != nil {
+				log.Warn("Refused agent connection ", err)
+				return
+			}
+
+			var req agentRequest
+			err = json.NewDecoder(conn).Decode(&req)
+			if err != nil {
+				return
+			}
+			// Logging in waits for the user and renewing for the issuer, other
+			// requests must not wait for them
+			switch req.Op {
+			case "login":
+				json.NewEncoder(conn).Encode(agentLogin(ctx, entries, &mutex, &req))
+				return
+			case "get":
+				json.NewEncoder(conn).Encode(agentGet(ctx, entries, &mutex, &req))
+				return
+			}
+			mutex.Lock()
+			resp := serveAgent(ctx, entries, &req)
+			mutex.Unlock()
+			json.NewEncoder(conn).Encode(resp)
+		}()
+	}
+}
+
+func serveAgent(ctx context.Context, entries map[string]*agentEntry, req *agentRequest) agentResponse {
+	switch req.Op {
+	case "put":
+		entry, ok := entries[req.Cluster]
+		if !ok {
+			entry = &agentEntry{}
+			entries[req.Cluster] = entry
+		}
+		if req.Token != "" {
+			entry.token = req.Token
+			metrics.setExpiry(req.Cluster, jwtExpiry(req.Token))
+		}
+		if req.ProviderToken != nil {
+			entry.providerToken = req.ProviderToken
+		}
+		return agentResponse{}
+
+	case "remove":
+		delete(entries, req.Cluster)
+		metrics.setExpiry(req.Cluster, time.Time{})
+		return agentResponse{}
+	}
+	return agentResponse{Error: "unknown operation " + req.Op}
+}
+
+// agentGet hands out the token of the cluster, renewing it first when it has
+// expired. The mutex is only held while the entries are read and updated.
+func agentGet(ctx context.Context, entries map[string]*agentEntry, mutex *sync.Mutex, req *agentRequest) agentResponse {
+	mutex.Lock()
+	entry, ok := entries[req.Cluster]
+	var current agentEntry
+	if ok {
+		current = *entry
+	}
+	mutex.Unlock()
+	if !ok || current.token == "" {
+		return agentResponse{Error: "no token for " + req.Cluster}
+	}
+	if !tokenExpired(current.token) {
+		return agentResponse{Token: current.token}
+	}
+
+	expired := current.token
+	err := agentRenew(ctx, req.Cluster, &current)
+	metrics.countRenewal(req.Cluster, err)
+	if err != nil {
+		return agentResponse{Error: err.Error()}
+	}
+	mutex.Lock()
+	// Unless the cluster was logged out or in again meanwhile
+	if entries[req.Cluster] == entry && entry.token == expired {
+		entry.token, entry.providerToken = current.token, current.providerToken
+	}
+	mutex.Unlock()
+	return agentResponse{Token: current.token}
+}
+
+// agentRenew gets a new JWT token with the refresh token held in memory
+func agentRenew(ctx context.Context, name string, entry *agentEntry) error {
+	if entry.providerToken == nil || entry.providerToken.RefreshToken == "" {
+		return errors.New("token of " + name + " has expired and the agent has no refresh token")
+	}
+	cluster, err := readConfig(name)
+	if err != nil {
+		return err
+	}
+	secret, err := readClientSecret(cluster.ClientSecret)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Renewing token of \"", name, "\"")
+	providerToken, err := refreshAccessToken(ctx, providerEndpoint(cluster, tokenPath), entry.providerToken.RefreshToken, cluster.ClientID, secret)
+	if err != nil {
+		return err
+	}
+	token, err := clusterJWT(ctx, cluster, providerToken.AccessToken)
+	if err != nil {
+		return err
+	}
+	entry.token, entry.providerToken = token, providerToken
+	metrics.setExpiry(name, jwtExpiry(token))
+	return nil
+}
+
+// callAgent sends a request to the agent, failing fast when none is running
+func callAgent(req agentRequest) (*agentResponse, error) {
+	conn, err := dialAgent(agentSocket(), time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	timeout := *httpTimeout
+	if req.Op == "login" {
+		timeout += *callbackTimeout + 2**httpTimeout
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	err = json.NewEncoder(conn).Encode(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp agentResponse
+	err = json.NewDecoder(bufio.NewReader(conn)).Decode(&resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// agentToken asks a running agent for the token of the cluster
+func agentToken(name string) (string, error) {
+	resp, err := callAgent(agentRequest{Op: "get", Cluster: name})
+	if err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+// agentRunning tells whether an agent answers on the socket
+func agentRunning() bool {
+	conn, err := dialAgent(agentSocket(), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+const peerHelperEnv = "KUBED_TEST_PEER_SOCKET"
+
+// TestCheckPeerHelper connects to the socket as another user for
+// TestCheckPeerRefusesOtherUser
+func TestCheckPeerHelper(t *testing.T) {
+	path := os.Getenv(peerHelperEnv)
+	if path == "" {
+		return
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(ioutil.Discard, conn)
+}
+
+func TestCheckPeer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	listener, err := listenAgent(filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		if conn, err := net.Dial("unix", filepath.Join(dir, "agent.sock")); err == nil {
+			defer conn.Close()
+			io.Copy(ioutil.Discard, conn)
+		}
+	}()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		t.Errorf("Expected a connection of the same user to be accepted, got %s", err)
+	}
+
+	// Only unix sockets tell who the peer is
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if err := checkPeer(server); err == nil {
+		t.Error("Expected a connection without peer credentials to be refused")
+	}
+}
+
+func TestCheckPeerRefusesOtherUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Connecting as another user needs root")
+	}
+	dir, err := ioutil.TempDir("", "kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The socket is open to everyone here, so that only checkPeer keeps the
+	// other user out
+	path := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	test := filepath.Join(dir, "kubed.test")
+	data, err := ioutil.ReadFile(os.Args[0])
+	if err == nil {
+		err = ioutil.WriteFile(test, data, 0755)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{dir, path} {
+		if err := os.Chmod(p, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(test, "-test.run=^TestCheckPeerHelper$")
+	cmd.Env = append(os.Environ(), peerHelperEnv+"="+path)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkPeer(conn)
+	conn.Close()
+	cmd.Wait()
+	if err == nil {
+		t.Error("Expected a connection of another user to be refused")
+	}
+}
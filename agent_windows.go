@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// checkPeer makes sure the agent only hands out tokens to processes of the
+// same user, by the user of the process at the other end of the pipe
+func checkPeer(conn net.Conn) error {
+	pipe, ok := conn.(interface{ Fd() uintptr })
+	if !ok {
+		return errors.New("not a named pipe connection")
+	}
+	var pid uint32
+	err := windows.GetNamedPipeClientProcessId(windows.Handle(pipe.Fd()), &pid)
+	if err != nil {
+		return err
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(process)
+	var token windows.Token
+	err = windows.OpenProcessToken(process, windows.TOKEN_QUERY, &token)
+	if err != nil {
+		return err
+	}
+	defer token.Close()
+
+	peer, err := token.GetTokenUser()
+	if err != nil {
+		return err
+	}
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return err
+	}
+	if !windows.EqualSid(peer.User.Sid, user.User.Sid) {
+		return errors.Errorf("peer process %d runs as %s", pid, peer.User.Sid)
+	}
+	return nil
+}
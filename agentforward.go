@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// forwardedAgent tells whether kubed runs in an SSH session with an agent
+// forwarded from the laptop of the user, like ssh-agent with "ssh -A"
+func forwardedAgent() bool {
+	return os.Getenv("SSH_CONNECTION") != "" && agentRunning()
+}
+
+// loginThroughAgent asks the agent to log in to the cluster, so the browser
+// opens where the agent runs. The agent only takes the issuer, the rest comes
+// from its own cluster of that issuer. The token and CA certificate come back
+// to be written to kubeconfig here.
+func loginThroughAgent(cluster *Cluster) (string, []byte, error) {
+	def := &ClusterDefinition{IssuerURL: cluster.IssuerURL}
+	resp, err := callAgent(agentRequest{Op: "login", Cluster: cluster.Name, Definition: def})
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.Token, resp.CAData, nil
+}
+
+// agentLogin runs the browser flow for a remote kubed and keeps the tokens
+func agentLogin(ctx context.Context, entries map[string]*agentEntry, mutex *sync.Mutex, req *agentRequest) agentResponse {
+	if req.Definition == nil {
+		return agentResponse{Error: "no cluster definition given"}
+	}
+	// The access token goes to the issuer, only those of clusters set up here
+	// are trusted with it. Everything else of the login, the headers, client
+	// secret and acr values sent along and the name the tokens are kept
+	// under, comes from that cluster, never from the remote kubed.
+	cluster, err := clusterByIssuer(req.Definition.IssuerURL)
+	if err != nil {
+		log.Warn("Refused login of remote kubed to \"", req.Cluster, "\": ", err)
+		return agentResponse{Error: err.Error()}
+	}
+
+	// The login lock of the callback port keeps this from running at the
+	// same time as a login of kubed on this machine
+	log.Info("Remote kubed asks to log in to \"", cluster.Name, "\"")
+	err = checkIssuerUp(ctx, cluster)
+	if err != nil {
+		return agentResponse{Error: err.Error()}
+	}
+	providerToken, err := authenticate(ctx, cluster)
+	if err != nil {
+		return agentResponse{Error: err.Error()}
+	}
+	token, caData, err := fetchCredentials(ctx, cluster, providerToken.AccessToken)
+	if err != nil {
+		return agentResponse{Error: err.Error()}
+	}
+
+	mutex.Lock()
+	entries[cluster.Name] = &agentEntry{token: token, providerToken: providerToken}
+	mutex.Unlock()
+	return agentResponse{Token: token, CAData: caData}
+}
+
+// clusterByIssuer returns the first cluster in the kubed config of the agent
+// with the given issuer
+func clusterByIssuer(issuerURL string) (*Cluster, error) {
+	clusters, err := readClusters()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clusters {
+		if issuerURL != "" && c.IssuerURL == issuerURL {
+			return dropStaleTunnel(&c), nil
+		}
+	}
+	return nil, errors.Errorf("issuer %s is not the issuer of any cluster known to the agent, set up a cluster of it where the agent runs first", issuerURL)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAgentLoginRefusesUnknownIssuer(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	cluster := &Cluster{Name: "lab", APIServer: "https://lab.example.org", IssuerURL: "https://issuer.example.org", ClientID: "client-id", KubeConfig: "~/.kube/config"}
+	if err := saveConfig(cluster); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := map[string]*agentEntry{}
+	var mutex sync.Mutex
+	resp := agentLogin(context.Background(), entries, &mutex, &agentRequest{
+		Op:         "login",
+		Cluster:    "lab",
+		Definition: &ClusterDefinition{Name: "lab", IssuerURL: "https://evil.example.org", ClientID: "client-id"},
+	})
+	if resp.Error == "" || resp.Token != "" {
+		t.Errorf("Expected a login for an unknown issuer to be refused, got %+v", resp)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no tokens to be kept, got %v", entries)
+	}
+}
+
+func TestAgentLoginUsesLocalClusterOfIssuer(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	var s *sandbox
+	var mutex sync.Mutex
+	var clientIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if id := r.Form.Get("client_id"); id != "" {
+			mutex.Lock()
+			clientIDs = append(clientIDs, id)
+			mutex.Unlock()
+		}
+		s.handler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	s, err := newSandbox(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldOpenURL := openURL
+	defer func() { openURL = oldOpenURL }()
+	openURL = func(u string) error {
+		go http.Get(u)
+		return nil
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	os.Setenv("KUBED_TEST_SECRET", "secret")
+	defer os.Unsetenv("KUBED_TEST_SECRET")
+
+	clusters := []*Cluster{
+		{Name: "lab", APIServer: "https://lab.example.org", IssuerURL: "https://issuer.example.org",
+			ClientID: "lab", KubeConfig: filepath.Join(dir, "config"), Port: port},
+		{Name: "sandbox", APIServer: "https://127.0.0.1:6443", IssuerURL: server.URL + "/issuer",
+			ClientID: "sandbox", ClientSecret: "env:KUBED_TEST_SECRET", ProviderURL: server.URL,
+			KubeConfig: filepath.Join(dir, "config"), Port: port},
+	}
+	for _, c := range clusters {
+		if err := saveConfig(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The remote kubed pairs the name of one cluster with the issuer of another
+	entries := map[string]*agentEntry{}
+	resp := agentLogin(context.Background(), entries, &mutex, &agentRequest{
+		Op:      "login",
+		Cluster: "lab",
+		Definition: &ClusterDefinition{Name: "lab", IssuerURL: server.URL + "/issuer",
+			ClientID: "remote", APIServer: "https://evil.example.org"},
+	})
+	if resp.Error != "" {
+		t.Fatalf("Login through the agent failed: %s", resp.Error)
+	}
+	if entries["lab"] != nil || entries["sandbox"] == nil || entries["sandbox"].token != resp.Token {
+		t.Errorf("Expected the token to be kept for the cluster of the issuer only, got %v", entries)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, id := range clientIDs {
+		if id != "sandbox" {
+			t.Errorf("Expected the provider to only see the local client ID, got %q", id)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func defaultAgentSocket() string {
+	return filepath.Join(cacheDir(), "agent.sock")
+}
+
+// listenAgent creates the socket with access for the user only. The umask
+// keeps others out from the start, changing the mode after listening would
+// leave them a moment to connect.
+func listenAgent(path string) (net.Listener, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	// A socket left behind by an agent that died is in the way
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, errors.New("Another agent is already listening on " + path)
+	}
+	os.Remove(path)
+
+	mask := syscall.Umask(0077)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
+
+func dialAgent(path string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("unix", path, timeout)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"github.com/Microsoft/go-winio"
+	"golang.org/x/sys/windows"
+)
+
+// defaultAgentSocket is a named pipe of the user, Windows has no unix
+// sockets kubed can rely on
+func defaultAgentSocket() string {
+	return `\\.\pipe\kubed-agent-` + os.Getenv("USERNAME")
+}
+
+// listenAgent creates the named pipe with access for the user only
+func listenAgent(path string) (net.Listener, error) {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+	return winio.ListenPipe(path, &winio.PipeConfig{
+		SecurityDescriptor: "D:P(A;;GA;;;" + user.User.Sid.String() + ")",
+	})
+}
+
+func dialAgent(path string, timeout time.Duration) (net.Conn, error) {
+	return winio.DialPipe(path, &timeout)
+}
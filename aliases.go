@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	commands["alias"] = &command{
+		usage: "alias [alias [cluster]]",
+		help:  "List the aliases of clusters, or define a short name for a cluster",
+		run:   aliasCommand,
+	}
+}
+
+// matches tells whether name is the name, one of the aliases or one of the
+// kubeconfig contexts of the cluster
+func (c Cluster) matches(name string) bool {
+	if c.Name == name || (c.Entries != nil && c.Entries.Context == name) {
+		return true
+	}
+	if _, ok := extraContexts(&c)[name]; ok {
+		return true
+	}
+	for _, a := range c.Aliases {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+func aliasCommand(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+		return listAliases()
+	case 1:
+		return removeAlias(args[0])
+	case 2:
+		return addAlias(args[0], args[1])
+	}
+	return withExitCode(exitUsage, errors.New("Please provide the alias and the cluster it stands for"))
+}
+
+func listAliases() error {
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		if len(c.Aliases) > 0 {
+			fmt.Printf("%s\t%s\n", c.Name, strings.Join(c.Aliases, ", "))
+		}
+	}
+	return nil
+}
+
+func addAlias(alias string, name string) error {
+	if existing, err := readConfig(alias); err == nil {
+		return withExitCode(exitUsage, errors.Errorf("%q already names cluster %q", alias, existing.Name))
+	}
+	cluster, err := readConfig(name)
+	if err != nil {
+		return err
+	}
+	err = updateCluster(cluster.Name, func(c *Cluster) {
+		c.Aliases = append(c.Aliases, alias)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("\"", alias, "\" now stands for \"", cluster.Name, "\"")
+	return nil
+}
+
+func removeAlias(alias string) error {
+	cluster, err := readConfig(alias)
+	if err != nil {
+		return err
+	}
+	if cluster.Name == alias {
+		return withExitCode(exitUsage, errors.Errorf("%q is the name of the cluster, not an alias. Rename it with kubed rename", alias))
+	}
+	err = updateCluster(cluster.Name, func(c *Cluster) {
+		var kept []string
+		for _, a := range c.Aliases {
+			if a != alias {
+				kept = append(kept, a)
+			}
+		}
+		c.Aliases = kept
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Removed alias \"", alias, "\" of \"", cluster.Name, "\"")
+	return nil
+}
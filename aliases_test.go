@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestAliases(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	for _, name := range []string{"uninett-prod-bgo-1", "uninett-test-bgo-1"} {
+		if err := saveConfig(&Cluster{Name: name, APIServer: "https://192.168.1.1:8443"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := addAlias("prod", "uninett-prod-bgo-1"); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	cluster, err := readConfig("prod")
+	if err != nil {
+		t.Fatalf("Alias was not resolved: %s", err)
+	}
+	if cluster.Name != "uninett-prod-bgo-1" {
+		t.Errorf("Alias resolved to %q", cluster.Name)
+	}
+
+	if err := addAlias("prod", "uninett-test-bgo-1"); err == nil {
+		t.Error("Expected an error reusing an alias")
+	}
+	if err := addAlias("uninett-test-bgo-1", "uninett-prod-bgo-1"); err == nil {
+		t.Error("Expected an error using a cluster name as alias")
+	}
+	if err := removeAlias("uninett-prod-bgo-1"); err == nil {
+		t.Error("Expected an error removing a cluster name")
+	}
+
+	if err := removeAlias("prod"); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if _, err := readConfig("prod"); err == nil {
+		t.Error("Alias was not removed")
+	}
+}
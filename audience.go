@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+// expectedAudiences are the audiences the API server accepts tokens for, from
+// -expected-audience or else the audience requested with token exchange
+func expectedAudiences(cluster *Cluster) []string {
+	value := cluster.ExpectedAudience
+	if value == "" && cluster.TokenExchange {
+		value = cluster.TokenAudience
+	}
+	var audiences []string
+	for _, aud := range strings.Split(value, ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			audiences = append(audiences, aud)
+		}
+	}
+	return audiences
+}
+
+// checkAudience fails the login when the aud claim of the token has none of
+// the expected audiences, which the API server would reject on the first
+// kubectl call. The API server doesn't publish its --oidc-client-id, so
+// nothing is checked unless the audience is known.
+func checkAudience(cluster *Cluster, token string) error {
+	expected := expectedAudiences(cluster)
+	if len(expected) == 0 {
+		return nil
+	}
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		log.Warn("Not checking the audience of the token of \"", cluster.Name, "\", it is no JWT ", err)
+		return nil
+	}
+	var audiences []string
+	if claims["aud"] != nil {
+		audiences = claimStrings(claims["aud"])
+	}
+	for _, aud := range audiences {
+		for _, e := range expected {
+			if aud == e {
+				return nil
+			}
+		}
+	}
+
+	got := tr("no audience")
+	if len(audiences) > 0 {
+		got = tr("audience %s", strings.Join(audiences, ", "))
+	}
+	return withHint(withExitCode(exitAuthDenied, errors.New(tr("The issuer gave a token of %q for %s, but the API server expects %s", cluster.Name, got, strings.Join(expected, tr(" or "))))),
+		"The aud claim must match the --oidc-client-id of the API server, check -client-id and -token-audience against it, or correct -expected-audience")
+}
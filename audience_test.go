@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestCheckAudience(t *testing.T) {
+	s, err := newSandbox("http://127.0.0.1:5556")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.sign(s.claims("kubed-lab", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cluster, ok := range map[*Cluster]bool{
+		{Name: "lab"}: true,
+		{Name: "lab", ExpectedAudience: "kubed-lab"}:                     true,
+		{Name: "lab", ExpectedAudience: "other, kubed-lab"}:              true,
+		{Name: "lab", TokenExchange: true, TokenAudience: "kubed-lab"}:   true,
+		{Name: "lab", ExpectedAudience: "kubernetes"}:                    false,
+		{Name: "lab", TokenExchange: true, TokenAudience: "kubernetes"}:  false,
+		{Name: "lab", ExpectedAudience: "kubed-lab", TokenAudience: "x"}: true,
+		{Name: "lab", TokenAudience: "kubernetes"}:                       true,
+	} {
+		err := checkAudience(cluster, token)
+		if (err == nil) != ok {
+			t.Errorf("Expected audience check of %+v to pass %v, got %v", cluster, ok, err)
+		}
+		if err != nil && exitCode(err) != exitAuthDenied {
+			t.Errorf("Expected a mismatch to deny the login, got exit code %d", exitCode(err))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const auditLog = "audit.log"
+
+// auditRecord is one line of the audit log, written for every change kubed
+// makes to kubeconfig, its configuration or the cached credentials
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Cluster     string    `json:"cluster,omitempty"`
+	KubeConfig  string    `json:"kubeconfig,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+func init() {
+	commands["audit"] = &command{
+		usage: "audit [cluster]",
+		help:  "Show the changes kubed made to kubeconfig, its configuration and the cached credentials",
+		run:   showAudit,
+	}
+}
+
+func auditPath() string {
+	return filepath.Join(configDir(), auditLog)
+}
+
+// credentialFingerprint identifies a token or certificate in the audit log
+// without revealing it
+func credentialFingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(secret)))[:23]
+}
+
+// audit appends a record to the audit log. Failing to do so is only warned
+// about, the change itself has been made already.
+func audit(action string, cluster string, kubeConfig string, secret string, detail string) {
+	record := auditRecord{
+		Time:        time.Now().UTC(),
+		Action:      action,
+		Cluster:     cluster,
+		KubeConfig:  kubeConfig,
+		Fingerprint: credentialFingerprint(secret),
+		Detail:      detail,
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Warn("Failed in writing audit log ", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	err = os.MkdirAll(configDir(), 0700)
+	if err != nil {
+		log.Warn("Failed in writing audit log ", err)
+		return
+	}
+	f, err := os.OpenFile(auditPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Warn("Failed in writing audit log ", err)
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		log.Warn("Failed in writing audit log ", err)
+	}
+}
+
+func readAudit(cluster string) ([]auditRecord, error) {
+	f, err := os.Open(auditPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			log.Warn("Skipping unreadable audit record ", err)
+			continue
+		}
+		if cluster == "" || r.Cluster == cluster {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+func showAudit(ctx context.Context, args []string) error {
+	cluster := ""
+	if len(args) > 0 {
+		cluster = args[0]
+	}
+	records, err := readAudit(cluster)
+	if err != nil {
+		return err
+	}
+
+	if *outputFormat == "json" {
+		if records == nil {
+			records = []auditRecord{}
+		}
+		out, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	for _, r := range records {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n", r.Time.Local().Format(time.RFC3339), r.Action, r.Cluster, r.KubeConfig, r.Fingerprint, r.Detail)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestAudit(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	audit("login", "kubed", "/home/user/.kube/config", "secret-token", "")
+	audit("switch", "other", "/home/user/.kube/config", "", "")
+
+	records, err := readAudit("kubed")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if len(records) != 1 || records[0].Action != "login" {
+		t.Fatalf("Expected the login record, got %+v", records)
+	}
+	if fp := records[0].Fingerprint; fp != credentialFingerprint("secret-token") || len(fp) != 23 {
+		t.Errorf("Unexpected fingerprint %q", fp)
+	}
+}
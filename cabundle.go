@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+// parseCABundle checks that data is a PEM bundle of one or more certificates,
+// e.g. a CA with its intermediates, and returns it in normalized form so the
+// whole chain ends up in certificate-authority-data
+func parseCABundle(data []byte) ([]byte, error) {
+	var bundle bytes.Buffer
+	rest := bytes.TrimSpace(data)
+	for n := 1; len(rest) > 0; n++ {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("CA certificate contains data that is not PEM")
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.Errorf("CA certificate contains a %s, not only certificates", block.Type)
+		}
+		_, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed in parsing certificate %d of the CA bundle", n)
+		}
+		pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes})
+		rest = bytes.TrimSpace(rest)
+	}
+	if bundle.Len() == 0 {
+		return nil, errors.New("CA certificate is empty")
+	}
+	return bundle.Bytes(), nil
+}
+
+// caFingerprint is the SHA256 fingerprint of the DER of the certificates in
+// a CA bundle, so the PEM layout of issuer and kubeconfig doesn't matter.
+// Data that is no PEM is fingerprinted as it is.
+func caFingerprint(caData []byte) string {
+	var der []byte
+	rest := caData
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		der = append(der, block.Bytes...)
+	}
+	if der == nil {
+		der = caData
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der))
+}
+
+// checkCAChange refuses a CA different from the one last written for the
+// cluster unless -accept-new-ca is given, so a substituted cluster CA doesn't
+// go unnoticed. Clusters logged in before fingerprints were kept are compared
+// with the CA in kubeconfig.
+func checkCAChange(cluster *Cluster, caData []byte) error {
+	if len(caData) == 0 {
+		if cluster.CAFingerprint != "" {
+			log.Warn("No CA certificate for ", cluster.Name, ", so it is not checked against the one with SHA256 fingerprint ", cluster.CAFingerprint)
+		}
+		return nil
+	}
+	previous := cluster.CAFingerprint
+	if previous == "" {
+		old, err := kubeconfig.ReadCAData(expandHome(cluster.KubeConfig), kubeEntries(cluster).Cluster)
+		if err != nil || len(old) == 0 {
+			return nil
+		}
+		previous = caFingerprint(old)
+	}
+
+	current := caFingerprint(caData)
+	if current == previous {
+		return nil
+	}
+	if *acceptNewCA {
+		log.Warn("Accepting new CA certificate for ", cluster.Name, " with SHA256 fingerprint ", current, ", it was ", previous)
+		return nil
+	}
+	return errors.Errorf("The CA certificate of %s changed from SHA256 fingerprint %s to %s. "+
+		"If your cluster administrators confirm the change, log in again with -accept-new-ca", cluster.Name, previous, current)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"testing"
+)
+
+func testCertPEM(t *testing.T) []byte {
+	cert, err := loopbackCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+}
+
+func TestParseCABundle(t *testing.T) {
+	root, intermediate := testCertPEM(t), testCertPEM(t)
+	chain := append(append([]byte{}, intermediate...), root...)
+
+	bundle, err := parseCABundle(chain)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if n := bytes.Count(bundle, []byte("BEGIN CERTIFICATE")); n != 2 {
+		t.Errorf("Expected 2 certificates in bundle, got %d", n)
+	}
+
+	var tests = []struct {
+		description string
+		data        []byte
+	}{
+		{"empty", []byte("\n")},
+		{"not PEM", append(append([]byte{}, root...), "garbage"...)},
+		{"private key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})},
+		{"broken certificate", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("cert")})},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if _, err := parseCABundle(test.data); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestCheckCAChange(t *testing.T) {
+	ca := testCertPEM(t)
+	normalized, err := parseCABundle(append([]byte("\n"), ca...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caFingerprint(append([]byte("\n\n"), ca...)) != caFingerprint(normalized) {
+		t.Error("Expected the fingerprint not to depend on the PEM layout")
+	}
+
+	cluster := &Cluster{Name: "kubed", CAFingerprint: caFingerprint(ca)}
+	if err := checkCAChange(cluster, normalized); err != nil {
+		t.Errorf("Expected the same CA to pass, got %s", err)
+	}
+	if err := checkCAChange(cluster, testCertPEM(t)); err == nil {
+		t.Error("Expected a changed CA to be refused")
+	}
+}
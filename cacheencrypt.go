@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	pgpArmor = "-----BEGIN PGP MESSAGE-----"
+	ageArmor = "-----BEGIN AGE ENCRYPTED FILE-----"
+)
+
+func init() {
+	commands["encrypt"] = &command{
+		usage: "encrypt gpg:RECIPIENT|age:RECIPIENT|none",
+		help:  "Encrypt the token cache and kubed config at rest with gpg or age, or store them in plain again",
+		run:   encryptCommand,
+	}
+}
+
+// validEncryption checks a cache encryption given as gpg:RECIPIENT or age:RECIPIENT
+func validEncryption(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	i := strings.Index(spec, ":")
+	if i < 0 || spec[i+1:] == "" || (spec[:i] != "gpg" && spec[:i] != "age") {
+		return errors.Errorf("Encryption %q must be given as gpg:RECIPIENT or age:RECIPIENT", spec)
+	}
+	if _, err := exec.LookPath(spec[:i]); err != nil {
+		return errors.Errorf("%s is needed to encrypt the token cache, but it is not installed", spec[:i])
+	}
+	return nil
+}
+
+func encryptCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please provide the encryption as gpg:RECIPIENT, age:RECIPIENT or none")
+	}
+	spec := args[0]
+	if spec == "none" {
+		spec = ""
+	}
+	err := validEncryption(spec)
+	if err != nil {
+		return err
+	}
+
+	// Read with the old setting, write with the new one
+	var confErr error
+	err = updateCache(ctx, func(tokens map[string]CachedToken) bool {
+		confErr = updateKubedConfig(func(conf *KubedConfig) (bool, error) {
+			conf.EncryptCache = spec
+			return true, nil
+		})
+		return confErr == nil
+	})
+	if confErr != nil {
+		return confErr
+	}
+	if err != nil {
+		return err
+	}
+	audit("encrypt-cache", "", "", "", spec)
+
+	if spec == "" {
+		log.Info("Token cache and kubed config are stored unencrypted")
+	} else {
+		log.Info("Token cache and kubed config are encrypted for ", spec)
+	}
+	return nil
+}
+
+// encryptCache encrypts the cache when configured. The tools run with the
+// terminal of kubed, so gpg-agent or age can ask for what they need.
+func encryptCache(data []byte) ([]byte, error) {
+	conf, err := readKubedConfig()
+	if err != nil {
+		return nil, err
+	}
+	return encryptFor(conf.EncryptCache, data)
+}
+
+// encryptFor encrypts the data for gpg:RECIPIENT or age:RECIPIENT, an empty
+// spec leaves it as it is
+func encryptFor(spec string, data []byte) ([]byte, error) {
+	if spec == "" {
+		return data, nil
+	}
+	i := strings.Index(spec, ":")
+	tool, recipient := spec[:i], spec[i+1:]
+	if tool == "gpg" {
+		return runCrypt(data, "gpg", "--batch", "--yes", "--armor", "--encrypt", "--recipient", recipient)
+	}
+	return runCrypt(data, "age", "--armor", "--recipient", recipient)
+}
+
+// lastDecrypted keeps the last decrypted file, the kubed config is read many
+// times in a run and each decryption may ask for a passphrase
+var lastDecrypted struct {
+	sync.Mutex
+	data, plain []byte
+}
+
+// decryptCache decrypts an encrypted cache or kubed config, recognized by its
+// armor, and returns anything else as it is
+func decryptCache(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte(pgpArmor)) && !bytes.HasPrefix(trimmed, []byte(ageArmor)) {
+		return data, nil
+	}
+
+	lastDecrypted.Lock()
+	defer lastDecrypted.Unlock()
+	if bytes.Equal(data, lastDecrypted.data) {
+		return lastDecrypted.plain, nil
+	}
+	var plain []byte
+	var err error
+	if bytes.HasPrefix(trimmed, []byte(pgpArmor)) {
+		plain, err = runCrypt(data, "gpg", "--quiet", "--decrypt")
+	} else {
+		plain, err = runCrypt(data, "age", "--decrypt", "--identity", ageIdentity())
+	}
+	if err != nil {
+		return nil, err
+	}
+	lastDecrypted.data, lastDecrypted.plain = data, plain
+	return plain, nil
+}
+
+// ageIdentity is the identity file age decrypts with, KUBED_AGE_IDENTITY or
+// the default location of age-keygen
+func ageIdentity() string {
+	if identity := os.Getenv("KUBED_AGE_IDENTITY"); identity != "" {
+		return expandHome(identity)
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "age", "keys.txt")
+}
+
+func runCrypt(data []byte, name string, args ...string) ([]byte, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(data), &out, os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed in running %s", name)
+	}
+	return out.Bytes(), nil
+}
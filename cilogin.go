@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/clientcmd/api/latest"
+)
+
+func init() {
+	commands["ci-login"] = &command{
+		usage: "ci-login -admin-context name -service-account name [-namespace ns] [-sa-token-duration 24h]",
+		help:  "Print a standalone kubeconfig with a ServiceAccount token for CI runners, created with an admin context",
+		run:   ciLogin,
+	}
+}
+
+// tokenRequest is the TokenRequest sent to and returned by the API server
+type tokenRequest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		ExpirationSeconds int64 `json:"expirationSeconds"`
+	} `json:"spec"`
+	Status struct {
+		Token               string    `json:"token"`
+		ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+	} `json:"status"`
+}
+
+// adminClient talks to the API server with the credentials of a kubeconfig context
+type adminClient struct {
+	server string
+	token  string
+	tls    *tls.Config
+	caData []byte
+	name   string
+}
+
+func ciLogin(ctx context.Context, args []string) error {
+	if *adminContext == "" || *serviceAccount == "" {
+		return withExitCode(exitUsage, errors.New("Give the admin context with -admin-context and the ServiceAccount with -service-account"))
+	}
+
+	config, err := kubeconfig.ReadConfigOrNew(expandHome(*kubeConfigFlag))
+	if err != nil {
+		return err
+	}
+	admin, ns, err := newAdminClient(ctx, config, *adminContext)
+	if err != nil {
+		return err
+	}
+	if *namespace != "" {
+		ns = *namespace
+	}
+
+	err = admin.ensureServiceAccount(ctx, ns, *serviceAccount)
+	if err != nil {
+		return err
+	}
+	token, expiry, err := admin.requestToken(ctx, ns, *serviceAccount, *saTokenDuration)
+	if err != nil {
+		return err
+	}
+	log.Info("Got token for ServiceAccount ", ns, "/", *serviceAccount, " valid until ", expiry.Local().Format(time.RFC1123))
+
+	userName := *serviceAccount + "@" + admin.name
+	standalone := api.NewConfig()
+	standalone.Clusters[admin.name] = &api.Cluster{Server: admin.server, CertificateAuthorityData: admin.caData}
+	standalone.AuthInfos[userName] = &api.AuthInfo{Token: token}
+	standalone.Contexts[admin.name] = &api.Context{Cluster: admin.name, AuthInfo: userName, Namespace: ns}
+	standalone.CurrentContext = admin.name
+
+	data, err := runtime.Encode(latest.Codec, standalone)
+	if err != nil {
+		return errors.Wrap(err, "Failed in encoding kubeconfig")
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// newAdminClient takes server, CA and credentials from the context. Contexts
+// managed by kubed get a fresh token, others must have a token or client certificate.
+func newAdminClient(ctx context.Context, config *api.Config, contextName string) (*adminClient, string, error) {
+	kctx, ok := config.Contexts[contextName]
+	if !ok {
+		return nil, "", errors.New("No context \"" + contextName + "\" in " + *kubeConfigFlag)
+	}
+	cluster, ok := config.Clusters[kctx.Cluster]
+	if !ok {
+		return nil, "", errors.New("Context \"" + contextName + "\" has no cluster")
+	}
+	user := config.AuthInfos[kctx.AuthInfo]
+	if user == nil {
+		user = api.NewAuthInfo()
+	}
+
+	admin := &adminClient{
+		server: strings.TrimRight(cluster.Server, "/"),
+		token:  user.Token,
+		tls:    &tls.Config{InsecureSkipVerify: cluster.InsecureSkipTLSVerify},
+		caData: cluster.CertificateAuthorityData,
+		name:   kctx.Cluster,
+	}
+	if len(admin.caData) == 0 && cluster.CertificateAuthority != "" {
+		data, err := ioutil.ReadFile(cluster.CertificateAuthority)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Failed in reading CA certificate")
+		}
+		admin.caData = data
+	}
+	if len(admin.caData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(admin.caData) {
+			return nil, "", errors.New("Failed in parsing CA certificate of " + kctx.Cluster)
+		}
+		admin.tls.RootCAs = pool
+	}
+
+	certData, keyData := user.ClientCertificateData, user.ClientKeyData
+	if len(certData) == 0 && user.ClientCertificate != "" {
+		var err error
+		if certData, err = ioutil.ReadFile(user.ClientCertificate); err == nil {
+			keyData, err = ioutil.ReadFile(user.ClientKey)
+		}
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Failed in reading client certificate")
+		}
+	}
+	if len(certData) > 0 {
+		cert, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Failed in loading client certificate")
+		}
+		admin.tls.Certificates = []tls.Certificate{cert}
+	}
+
+	if admin.token == "" && len(certData) == 0 {
+		token, err := currentToken(ctx, contextName, true)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "Context \""+contextName+"\" has neither token nor client certificate")
+		}
+		admin.token = token
+	}
+
+	ns := kctx.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+	return admin, ns, nil
+}
+
+func (admin *adminClient) request(req *gorequest.SuperAgent) *gorequest.SuperAgent {
+	req = req.TLSClientConfig(admin.tls)
+	if admin.token != "" {
+		req = req.Set("Authorization", "Bearer "+admin.token)
+	}
+	return req
+}
+
+// ensureServiceAccount creates the ServiceAccount unless it exists
+func (admin *adminClient) ensureServiceAccount(ctx context.Context, ns string, name string) error {
+	accounts := admin.server + "/api/v1/namespaces/" + ns + "/serviceaccounts"
+
+	resp, errs := endRequest(ctx, admin.request(gorequest.New().Get(accounts+"/"+name)), nil)
+	if len(errs) > 0 {
+		log.Warn("Failed in looking up ServiceAccount ", errs[0])
+		return errs[0]
+	}
+	if resp.StatusCode == 200 {
+		return nil
+	}
+	if resp.StatusCode != 404 {
+		log.Warn("Failed in looking up ServiceAccount, responsecode: ", resp.StatusCode)
+		return &statusError{"looking up ServiceAccount", resp.StatusCode}
+	}
+
+	log.Info("Creating ServiceAccount ", ns, "/", name)
+	account := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ServiceAccount",
+		"metadata":   map[string]string{"name": name, "namespace": ns},
+	}
+	resp, errs = endRequest(ctx, admin.request(gorequest.New().Post(accounts).Type("json").Send(account)), nil)
+	if len(errs) > 0 {
+		log.Warn("Failed in creating ServiceAccount ", errs[0])
+		return errs[0]
+	}
+	if resp.StatusCode != 201 && resp.StatusCode != 409 {
+		log.Warn("Failed in creating ServiceAccount, responsecode: ", resp.StatusCode)
+		return &statusError{"creating ServiceAccount", resp.StatusCode}
+	}
+	return nil
+}
+
+// requestToken gets a bound token for the ServiceAccount with the TokenRequest API
+func (admin *adminClient) requestToken(ctx context.Context, ns string, name string, duration time.Duration) (string, time.Time, error) {
+	var tr tokenRequest
+	tr.APIVersion = "authentication.k8s.io/v1"
+	tr.Kind = "TokenRequest"
+	tr.Spec.ExpirationSeconds = int64(duration / time.Second)
+
+	tokenURL := admin.server + "/api/v1/namespaces/" + ns + "/serviceaccounts/" + name + "/token"
+	resp, errs := endRequest(ctx, admin.request(gorequest.New().Post(tokenURL).Type("json").Send(tr)), &tr)
+	if len(errs) > 0 {
+		log.Warn("Failed in requesting ServiceAccount token ", errs[0])
+		return "", time.Time{}, errs[0]
+	}
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		log.Warn("Failed in requesting ServiceAccount token, responsecode: ", resp.StatusCode)
+		return "", time.Time{}, &statusError{"requesting ServiceAccount token", resp.StatusCode}
+	}
+	if tr.Status.Token == "" {
+		return "", time.Time{}, errors.New("API server returned no ServiceAccount token")
+	}
+	return tr.Status.Token, tr.Status.ExpirationTimestamp, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// clipboardCommands are tried in order, the first one installed is used
+func clipboardCommands(copy bool) [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		if copy {
+			return [][]string{{"pbcopy"}}
+		}
+		return [][]string{{"pbpaste"}}
+	case "windows":
+		if copy {
+			return [][]string{{"clip"}}
+		}
+		return [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}}
+	}
+
+	var cmds [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if copy {
+			cmds = append(cmds, []string{"wl-copy"})
+		} else {
+			cmds = append(cmds, []string{"wl-paste", "--no-newline"})
+		}
+	}
+	if copy {
+		return append(cmds, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	}
+	return append(cmds, []string{"xclip", "-selection", "clipboard", "-o"}, []string{"xsel", "--clipboard", "--output"})
+}
+
+func clipboardCommand(copy bool) (*exec.Cmd, error) {
+	for _, c := range clipboardCommands(copy) {
+		if _, err := exec.LookPath(c[0]); err == nil {
+			return exec.Command(c[0], c[1:]...), nil
+		}
+	}
+	return nil, errors.New("No clipboard tool found, install xclip, xsel or wl-clipboard")
+}
+
+// copyToClipboard puts text on the system clipboard
+func copyToClipboard(text string) error {
+	cmd, err := clipboardCommand(true)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// readClipboard returns the text on the system clipboard
+func readClipboard() (string, error) {
+	cmd, err := clipboardCommand(false)
+	if err != nil {
+		return "", err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
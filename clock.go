@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+// expired tells whether the expiry has passed, allowing for the clock skew tolerance
+func expired(expiry time.Time, now time.Time) bool {
+	return !expiry.IsZero() && now.After(expiry.Add(*clockSkew))
+}
+
+// serverSkew returns how far the server clock, from the Date header, is ahead of now
+func serverSkew(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	return date.Sub(now), true
+}
+
+// warnClockSkew warns when the local clock differs from a server clock by more
+// than the tolerance, as the API server would then reject fresh tokens
+func warnClockSkew(source string, skew time.Duration) {
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew <= *clockSkew {
+		return
+	}
+	log.Warn("Local clock differs by ", skew.Round(time.Second), " from ", source,
+		", tokens may be rejected as not yet valid or expired. Enable time synchronization (NTP)")
+}
+
+// checkTokenClock warns when a freshly issued token appears to be issued in the future
+func checkTokenClock(token string) {
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		return
+	}
+	issued, _ := auth.TokenTimes(claims)
+	if !issued.IsZero() {
+		warnClockSkew("the token issue time", issued.Sub(time.Now()))
+	}
+}
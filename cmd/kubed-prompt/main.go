@@ -0,0 +1,89 @@
+// kubed-prompt prints the same segment as "kubed prompt", from the state
+// kubed keeps for it. It leaves out client-go, whose initialization alone
+// takes longer than a prompt may.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/uninett/kubed/internal/segment"
+)
+
+var (
+	kubeConfigFlag = flag.String("kube-config", "~/.kube/config", "Kubeconfig to read the current context from, unless KUBECONFIG is set")
+	dataDir        = flag.String("data-dir", "", "Directory for kubed configuration and cache (default ~/.kubed or XDG directories)")
+	promptFormat   = flag.String("prompt-format", segment.DefaultFormat, "Go template of the prompt, with .Context, .Namespace, .Expiry and .Minutes")
+	promptShell    = flag.String("prompt-shell", "", "Shell the prompt is embedded in, bash or zsh, so the colors don't count as prompt width")
+	colorMode      = flag.String("color", "auto", "Color the prompt: always, never, or auto unless NO_COLOR is set")
+)
+
+func main() {
+	flag.Parse()
+	err := segment.ValidShell(*promptShell)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Without kubeconfig or context there is nothing to show, and a prompt
+	// is no place for errors
+	kubeConfig, err := ioutil.ReadFile(kubeConfigFile())
+	if err != nil {
+		return
+	}
+	clusters, _ := segment.ReadClusters(filepath.Join(cacheDir(), segment.StateFile))
+	state, err := segment.Current(kubeConfig, clusters, time.Now())
+	if err != nil || state.Context == "" {
+		return
+	}
+	color := *colorMode == "always" || (*colorMode == "auto" && os.Getenv("NO_COLOR") == "")
+	out, err := segment.Render(*promptFormat, state, *promptShell, color)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fmt.Print(out)
+}
+
+func homeDir() string {
+	if runtime.GOOS == "windows" {
+		return os.Getenv("HOMEPATH")
+	}
+	return os.Getenv("HOME")
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~") {
+		return strings.Replace(path, "~", homeDir(), 1)
+	}
+	return path
+}
+
+// kubeConfigFile is the kubeconfig kubectl uses, the first file of KUBECONFIG
+func kubeConfigFile() string {
+	if env := filepath.SplitList(os.Getenv("KUBECONFIG")); len(env) > 0 && env[0] != "" {
+		return env[0]
+	}
+	return expandHome(filepath.SplitList(*kubeConfigFlag)[0])
+}
+
+// cacheDir is the cache directory of kubed, see cacheDir of kubed
+func cacheDir() string {
+	if *dataDir != "" {
+		return expandHome(*dataDir)
+	}
+	if runtime.GOOS == "windows" && os.Getenv("APPDATA") != "" {
+		return filepath.Join(os.Getenv("APPDATA"), "kubed", "cache")
+	}
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "kubed")
+	}
+	return filepath.Join(homeDir(), ".kubed")
+}
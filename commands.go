@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a kubed subcommand, e.g. "kubed logout <cluster>"
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]*command{}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [flags]\n  %s <command> [arguments] [flags]\n\nCommands:\n", os.Args[0], os.Args[0])
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %-30s %s\n", commands[name].usage, commands[name].help)
+		}
+		fmt.Fprintf(os.Stderr, "\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	commands["help"] = &command{
+		usage: "help",
+		help:  "Show the commands and flags, like -h",
+		run: func(ctx context.Context, args []string) error {
+			flag.Usage()
+			return nil
+		},
+	}
+}
+
+// lookupCommand returns the subcommand named by the first argument, if any
+func lookupCommand() (*command, []string) {
+	if flag.NArg() == 0 {
+		return nil, nil
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		return nil, nil
+	}
+	return cmd, commandArgs(flag.Args()[1:])
+}
+
+// commandArgs parses the flags given after a subcommand, so both
+// "kubed -kube-config x logout c" and "kubed logout c -kube-config x" work,
+// and returns the positional arguments. Everything after "--" is left as is.
+func commandArgs(args []string) []string {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append([]string{"--"}, args[i+1:]...)
+			args = args[:i]
+			break
+		}
+	}
+
+	var positional []string
+	for len(args) > 0 {
+		flag.CommandLine.Parse(args)
+		args = flag.Args()
+		if len(args) > 0 {
+			positional = append(positional, args[0])
+			args = args[1:]
+		}
+	}
+	return append(positional, rest...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestLookupCommand(t *testing.T) {
+	defer func() { *assumeYes = false }()
+
+	for _, test := range []struct {
+		args     []string
+		name     string
+		expected []string
+	}{
+		{[]string{"list"}, "list", nil},
+		{[]string{"status", "lab"}, "status", []string{"lab"}},
+		{[]string{"remove", "lab", "-yes"}, "remove", []string{"lab"}},
+		{[]string{"logout", "lab", "--", "extra"}, "logout", []string{"lab", "--", "extra"}},
+		{[]string{"help"}, "help", nil},
+	} {
+		if err := flag.CommandLine.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		cmd, args := lookupCommand()
+		if cmd == nil || cmd != commands[test.name] {
+			t.Errorf("Expected %v to run %s", test.args, test.name)
+			continue
+		}
+		if !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("Expected arguments %v for %v, got %v", test.expected, test.args, args)
+		}
+	}
+	if !*assumeYes {
+		t.Error("Expected the flags after the command to be parsed")
+	}
+
+	flag.CommandLine.Parse([]string{"unknown"})
+	if cmd, _ := lookupCommand(); cmd != nil {
+		t.Error("Expected no command for an unknown name")
+	}
+}
+
+func TestCommandsOfUnknownCluster(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	cluster := &Cluster{Name: "lab", APIServer: "https://lab.example.org", IssuerURL: "https://issuer.example.org", ClientID: "kubed", KubeConfig: "~/.kube/config"}
+	if err := saveConfig(cluster); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"status", "remove"} {
+		if err := commands[name].run(context.Background(), []string{"lba"}); exitCode(err) != exitUnknownCluster {
+			t.Errorf("Expected %s of an unknown cluster to exit with %d, got %v", name, exitUnknownCluster, err)
+		}
+	}
+
+	*assumeYes = true
+	defer func() { *assumeYes = false }()
+	if err := commands["remove"].run(context.Background(), []string{"lab"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfig("lab"); err == nil {
+		t.Error("Expected the removed cluster to be gone")
+	}
+}
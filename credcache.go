@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// CachedToken holds the tokens issued by the OAuth2 Provider for a cluster,
+// kept so they can be revoked on logout
+type CachedToken struct {
+	AccessToken  string    `yaml:"accesstoken"`
+	RefreshToken string    `yaml:"refreshtoken,omitempty"`
+	Expiry       time.Time `yaml:"expiry,omitempty"`
+	JWT          string    `yaml:"jwt,omitempty"`
+	IDToken      string    `yaml:"idtoken,omitempty"`
+}
+
+func readCache() (map[string]CachedToken, error) {
+	path := kubedCachePath()
+	tokens := map[string]CachedToken{}
+
+	cacheBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	} else if err != nil {
+		log.Warn("Failed in reading kubed cache file ", err)
+		return nil, err
+	}
+	cacheBytes, err = decryptCache(cacheBytes)
+	if err != nil {
+		log.Warn("Failed in decrypting kubed cache file ", err)
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(cacheBytes, &tokens)
+	if err != nil {
+		log.Warn("Failed in parsing kubed cache file ", err)
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// updateCache applies fn to the cached tokens and saves them when it tells
+// they changed. The cache file holds the tokens of all clusters, so the
+// lock next to it is held throughout, or kubed processes renewing different
+// clusters at once would lose each other's tokens.
+func updateCache(ctx context.Context, fn func(tokens map[string]CachedToken) bool) error {
+	lock, _, err := takeLock(ctx, kubedCachePath()+".lock", "updating the token cache")
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	tokens, err := readCache()
+	if err != nil {
+		return err
+	}
+	if !fn(tokens) {
+		return nil
+	}
+	return writeCache(tokens)
+}
+
+func writeCache(tokens map[string]CachedToken) error {
+	path := kubedCachePath()
+
+	cacheBytes, err := yaml.Marshal(tokens)
+	if err != nil {
+		log.Warn("Failed in marshaling kubed cache ", err)
+		return err
+	}
+	cacheBytes, err = encryptCache(cacheBytes)
+	if err != nil {
+		log.Warn("Failed in encrypting kubed cache ", err)
+		return err
+	}
+
+	// The cache holds credentials, keep it private
+	err = replaceDataFile(path, cacheBytes, 0600)
+	if err != nil {
+		log.Warn("Failed in saving kubed cache ", err)
+		return err
+	}
+	return nil
+}
+
+func saveCachedToken(ctx context.Context, name string, tr *tokenResponse) error {
+	cached := CachedToken{
+		AccessToken:  tr.AccessToken,
+		RefreshToken: tr.RefreshToken,
+		IDToken:      tr.IDToken,
+	}
+	if tr.ExpiresIn > 0 {
+		cached.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	store, err := storeFor(name)
+	if err != nil {
+		return err
+	}
+	err = store.put(ctx, name, cached)
+	if err == nil {
+		audit("cache-tokens", name, "", tr.AccessToken, "")
+	}
+	return err
+}
+
+// readCachedToken returns the cached provider tokens of the cluster, if any
+func readCachedToken(ctx context.Context, name string) (CachedToken, bool, error) {
+	store, err := storeFor(name)
+	if err != nil {
+		return CachedToken{}, false, err
+	}
+	cached, ok, err := store.get(ctx, name)
+	registerSecrets(cached.AccessToken, cached.RefreshToken, cached.JWT, cached.IDToken)
+	return cached, ok, err
+}
+
+// saveCachedJWT keeps the JWT token for clusters kubectl gets it from kubed for
+func saveCachedJWT(ctx context.Context, name string, token string) error {
+	store, err := storeFor(name)
+	if err != nil {
+		return err
+	}
+	cached, _, err := store.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	cached.JWT = token
+	err = store.put(ctx, name, cached)
+	if err == nil {
+		audit("cache-jwt", name, "", token, "")
+	}
+	return err
+}
+
+func removeCachedToken(ctx context.Context, name string) error {
+	err := removeIssuedTokens(name)
+	if err != nil {
+		log.Warn("Failed in removing issued tokens from the cache ", err)
+	}
+	store, err := storeFor(name)
+	if err != nil {
+		return err
+	}
+	err = store.remove(ctx, name)
+	if err == nil {
+		audit("remove-tokens", name, "", "", "")
+	}
+	return err
+}
+
+// renameCachedToken moves the tokens, after the cluster itself has been renamed
+func renameCachedToken(ctx context.Context, oldName string, newName string) error {
+	// Issued tokens are cached by cluster name, the next login caches them anew
+	err := removeIssuedTokens(oldName)
+	if err != nil {
+		log.Warn("Failed in removing issued tokens from the cache ", err)
+	}
+	store, err := storeFor(newName)
+	if err != nil {
+		return err
+	}
+	cached, ok, err := store.get(ctx, oldName)
+	if err != nil || !ok {
+		return err
+	}
+	err = store.put(ctx, newName, cached)
+	if err != nil {
+		return err
+	}
+	return store.remove(ctx, oldName)
+}
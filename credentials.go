@@ -1,7 +1,8 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/parnurzeal/gorequest"
@@ -16,31 +17,52 @@ type ca struct {
 	Cert string `json:"cert"`
 }
 
-func getJWTToken(accessToken string, issuerURL string) (string, error) {
+func getJWTToken(ctx context.Context, accessToken string, cluster *Cluster) (string, error) {
 	var jwt JWTToken
 
-	resp, _, err := gorequest.New().Get(issuerURL).
-		Set("Authorization", "Bearer "+accessToken).
-		EndStruct(&jwt)
+	req, tokenURL, reqErr := cluster.IssuerAPI.tokenRequest(cluster.IssuerURL, issuerData(cluster, accessToken))
+	if reqErr == nil {
+		req, reqErr = prepareIssuerRequest(req, cluster)
+	}
+	if reqErr != nil {
+		return "", reqErr
+	}
+	start := time.Now()
+	resp, err := endRequest(ctx, req, &jwt)
+	traceHTTP(cluster.IssuerAPI.method(), tokenURL, start, resp, err)
+
+	if skew, ok := serverSkew(resp, time.Now()); ok {
+		warnClockSkew("the issuer clock", skew)
+	}
 
 	if err != nil {
 		log.Warn("Failed in fetching JWT Token ", err)
 		return "", err[0]
 	}
 
-	if resp != nil && resp.StatusCode != 201 {
+	// The kubed issuer answers 201, issuers configured with IssuerAPI may use 200
+	if resp != nil && resp.StatusCode != 201 && (cluster.IssuerAPI == nil || resp.StatusCode != 200) {
 		log.Warn("Failed in fetching JWT Token, responsecode: ", resp.StatusCode)
-		return "", errors.New("Failed in fetching JWT Token")
+		return "", &statusError{"fetching JWT Token", resp.StatusCode}
 	}
 
 	return jwt.Token, nil
 }
 
-func getCACert(issuerURL string) ([]byte, error) {
+func getCACert(ctx context.Context, cluster *Cluster) ([]byte, error) {
 	var caInstance ca
 
-	resp, _, err := gorequest.New().Get(issuerURL + "/ca").
-		EndStruct(&caInstance)
+	caURL, urlErr := cluster.IssuerAPI.caURL(cluster.IssuerURL, issuerData(cluster, ""))
+	if urlErr != nil {
+		return nil, urlErr
+	}
+	req, reqErr := prepareIssuerRequest(gorequest.New().Get(caURL), cluster)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	start := time.Now()
+	resp, err := endRequest(ctx, req, &caInstance)
+	traceHTTP("GET", caURL, start, resp, err)
 
 	if err != nil {
 		log.Warn("Failed in fetching CA certificate ", err)
@@ -49,7 +71,38 @@ func getCACert(issuerURL string) ([]byte, error) {
 
 	if resp != nil && resp.StatusCode != 200 {
 		log.Warn("Failed in fetching CA certificate, responsecode: ", resp.StatusCode)
-		return nil, errors.New("Failed in fetching CA certificate")
+		return nil, &statusError{"fetching CA certificate", resp.StatusCode}
+	}
+	bundle, parseErr := parseCABundle([]byte(caInstance.Cert))
+	if parseErr != nil {
+		log.Warn("Issuer returned an invalid CA certificate ", parseErr)
+		return nil, parseErr
 	}
-	return []byte(caInstance.Cert), nil
+	return bundle, nil
+}
+
+func issuerData(cluster *Cluster, accessToken string) issuerRequestData {
+	return issuerRequestData{AccessToken: accessToken, ClientID: cluster.ClientID, Cluster: cluster.Name, TTL: tokenTTLSeconds(cluster)}
+}
+
+// getJWTTokenWithRetry retries getJWTToken on transient failures
+func getJWTTokenWithRetry(ctx context.Context, accessToken string, cluster *Cluster) (string, error) {
+	var token string
+	err := withRetry(ctx, "fetching JWT Token", *retryAttempts, *retryBackoff, func() error {
+		var err error
+		token, err = getJWTToken(ctx, accessToken, cluster)
+		return err
+	})
+	return token, err
+}
+
+// getCACertWithRetry retries getCACert on transient failures
+func getCACertWithRetry(ctx context.Context, cluster *Cluster) ([]byte, error) {
+	var cert []byte
+	err := withRetry(ctx, "fetching CA certificate", *retryAttempts, *retryBackoff, func() error {
+		var err error
+		cert, err = getCACert(ctx, cluster)
+		return err
+	})
+	return cert, err
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+// csrRequest and csrResponse are sent to and returned by the /csr endpoint of
+// an issuer signing client certificates for clusters without OIDC
+type csrRequest struct {
+	CSR string `json:"csr"`
+}
+
+type csrResponse struct {
+	Cert string `json:"cert"`
+}
+
+// newCertificateRequest generates a key pair and a CSR for it. The issuer
+// decides the identity in the certificate, the subject only names the cluster.
+func newCertificateRequest(cluster *Cluster) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "kubed:" + cluster.Name},
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// signCertificate has the issuer sign the CSR, authenticated with the access token
+func signCertificate(ctx context.Context, cluster *Cluster, accessToken string, csr []byte) ([]byte, error) {
+	var signed csrResponse
+
+	csrURL := cluster.IssuerURL + "/csr"
+	req, reqErr := prepareIssuerRequest(gorequest.New().Post(csrURL).
+		Set("Authorization", "Bearer "+accessToken).
+		Type("json").
+		Send(csrRequest{CSR: string(csr)}), cluster)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	start := time.Now()
+	resp, err := endRequest(ctx, req, &signed)
+	traceHTTP("POST", csrURL, start, resp, err)
+
+	if err != nil {
+		log.Warn("Failed in signing client certificate ", err)
+		return nil, err[0]
+	}
+
+	if resp != nil && resp.StatusCode != 200 && resp.StatusCode != 201 {
+		log.Warn("Failed in signing client certificate, responsecode: ", resp.StatusCode)
+		return nil, &statusError{"signing client certificate", resp.StatusCode}
+	}
+	return []byte(signed.Cert), nil
+}
+
+// certificateExpiry returns when the first certificate in the PEM data expires
+func certificateExpiry(certPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return time.Time{}, errors.New("Issuer returned no client certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "Issuer returned an invalid client certificate")
+	}
+	return cert.NotAfter, nil
+}
+
+// certificateLogin writes a client certificate the issuer signed to
+// kubeconfig instead of a JWT token, for clusters that don't accept OIDC tokens
+func certificateLogin(ctx context.Context, cluster *Cluster, accessToken string) error {
+	log.Info("Requesting client certificate from ", cluster.IssuerURL)
+
+	csr, key, err := newCertificateRequest(cluster)
+	if err != nil {
+		return errors.Wrap(err, "Failed in generating client key")
+	}
+	var cert []byte
+	err = withRetry(ctx, "signing client certificate", *retryAttempts, *retryBackoff, func() error {
+		var err error
+		cert, err = signCertificate(ctx, cluster, accessToken, csr)
+		return err
+	})
+	if err != nil {
+		return withExitCode(issuerExitCode(err), errors.Wrap(err, "Failed in getting client certificate"))
+	}
+	expiry, err := certificateExpiry(cert)
+	if err != nil {
+		return err
+	}
+
+	caData, err := getCACertWithRetry(ctx, cluster)
+	if err != nil {
+		caData = fallbackCA(cluster, err)
+	}
+
+	err = nameEntries(cluster, accessToken)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	cfg := kubeConfigSetup(cluster, caData)
+	cfg.ClientCertificateData = cert
+	cfg.ClientKeyData = key
+	return writeLogin(ctx, cluster, cfg, expiry)
+}
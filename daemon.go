@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	commands["daemon"] = &command{
+		usage: "daemon [install]",
+		help:  "Keep renewing tokens before they expire, using the cached refresh tokens",
+		run:   daemon,
+	}
+}
+
+func daemon(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "install" {
+		return installDaemon(ctx)
+	}
+	if len(args) > 0 {
+		return withExitCode(exitUsage, errors.Errorf("Unknown daemon command %q, expected \"install\"", args[0]))
+	}
+
+	if *webhookURL != "" {
+		err := validWebhookURL(*webhookURL)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	}
+
+	if *daemonOnce {
+		renewDue(ctx)
+		return nil
+	}
+
+	// Started by the Windows service manager, which sends its stop requests
+	// through the service control handler instead of signals
+	if ok, err := runAsService(ctx, runDaemon); ok {
+		return err
+	}
+	return runDaemon(ctx)
+}
+
+// runDaemon renews due tokens every -daemon-interval until ctx is done
+func runDaemon(ctx context.Context) error {
+	err := serveDaemonHTTP(ctx)
+	if err != nil {
+		return err
+	}
+	log.Info("Renewing tokens expiring within ", *renewBefore, ", checking every ", *daemonInterval)
+	ticker := time.NewTicker(*daemonInterval)
+	defer ticker.Stop()
+	for {
+		renewDue(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Info("Stopping daemon")
+			return nil
+		}
+	}
+}
+
+// renewDue renews the clusters whose token expires within -renew-before
+func renewDue(ctx context.Context) {
+	clusters, err := readClusters()
+	if err != nil {
+		log.Warn("Failed in reading clusters ", err)
+		return
+	}
+
+	for i := range clusters {
+		// Stopping must not be reported as failed renewals of the rest
+		if ctx.Err() != nil {
+			return
+		}
+		c := &clusters[i]
+		metrics.setExpiry(c.Name, c.TokenExpiry)
+		if c.TokenExpiry.IsZero() || c.TokenExpiry.Sub(time.Now()) > *renewBefore {
+			continue
+		}
+		if cached, ok, _ := readCachedToken(ctx, c.Name); !ok || cached.RefreshToken == "" {
+			log.Debug("Skipping ", c.Name, ", no refresh token")
+			continue
+		}
+
+		log.Info("Renewing token of \"", c.Name, "\"")
+		err := runHooks(ctx, "pre", c)
+		if err == nil {
+			err = refreshLogin(ctx, c)
+		}
+		if err != nil && ctx.Err() != nil {
+			log.Info("Stopped renewing token of \"", c.Name, "\"")
+			return
+		}
+		if err != nil {
+			log.Warn("Failed in renewing token of \"", c.Name, "\" ", err)
+		} else if renewed, err := readConfig(c.Name); err == nil {
+			metrics.setExpiry(c.Name, renewed.TokenExpiry)
+		}
+		metrics.countRenewal(c.Name, err)
+		notifyWebhook(ctx, c.Name, err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// secretParams are URL parameters never to be logged in clear text
+var secretParams = []string{"access_token", "refresh_token", "id_token", "code", "token", "client_secret"}
+
+// correlationHeaders are response headers servers commonly use to identify a request
+var correlationHeaders = []string{"X-Request-Id", "X-Correlation-Id", "Request-Id"}
+
+func redactValues(values url.Values) url.Values {
+	for _, p := range secretParams {
+		if values.Get(p) != "" {
+			values.Set(p, "REDACTED")
+		}
+	}
+	return values
+}
+
+// redactURL masks token values in the query and fragment of a URL
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<unparsable URL>"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redactValues(u.Query()).Encode()
+	}
+	if fragment, err := url.ParseQuery(u.Fragment); err == nil && u.Fragment != "" {
+		u.Fragment = redactValues(fragment).Encode()
+	}
+	return u.String()
+}
+
+// redactHeader masks credentials in a header value, keeping the auth scheme
+func redactHeader(name string, value string) string {
+	if http.CanonicalHeaderKey(name) != "Authorization" {
+		return value
+	}
+	if i := strings.Index(value, " "); i > 0 {
+		return value[:i] + " REDACTED"
+	}
+	return "REDACTED"
+}
+
+// traceHTTP logs a finished outgoing request when -debug-http is given
+func traceHTTP(method string, rawURL string, start time.Time, resp *http.Response, errs []error) {
+	if replayer != nil {
+		replayer.check(method, rawURL)
+	}
+	if !*debugHTTP {
+		return
+	}
+
+	fields := log.Fields{
+		"method":   method,
+		"url":      redactURL(rawURL),
+		"duration": time.Since(start).String(),
+		"run":      runID,
+	}
+	if len(errs) > 0 {
+		fields["error"] = errs[0].Error()
+	}
+	if resp != nil {
+		fields["status"] = resp.StatusCode
+		for _, h := range correlationHeaders {
+			if v := resp.Header.Get(h); v != "" {
+				fields[strings.ToLower(h)] = v
+			}
+		}
+		if resp.Request != nil {
+			for name, values := range resp.Request.Header {
+				fields["header."+strings.ToLower(name)] = redactHeader(name, strings.Join(values, ", "))
+			}
+		}
+	}
+	log.WithFields(fields).Debug("HTTP request")
+}
+
+// traceRedirect logs the URLs sent to and received from the browser
+func traceRedirect(message string, rawURL string) {
+	if !*debugHTTP {
+		return
+	}
+	log.WithField("url", redactURL(rawURL)).Debug(message)
+}
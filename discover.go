@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+const clusterInfoPath = "/api/v1/namespaces/kube-public/configmaps/cluster-info"
+
+// configMap is the part of a Kubernetes ConfigMap kubed needs
+type configMap struct {
+	Data map[string]string `json:"data"`
+}
+
+// discoverCluster fetches the public cluster-info ConfigMap from the API server
+// and returns the canonical server address and CA certificate it announces.
+// The CA is not known yet, so the request can not verify the server certificate.
+func discoverCluster(ctx context.Context, apiServer string, proxyURL string) (string, []byte, error) {
+	var info configMap
+
+	req := gorequest.New().Get(strings.TrimRight(apiServer, "/") + clusterInfoPath).
+		TLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	if proxyURL != "" {
+		req = req.Proxy(proxyURL)
+	}
+	resp, errs := endRequest(ctx, req, &info)
+	if len(errs) > 0 {
+		log.Warn("Failed in fetching cluster-info ", errs[0])
+		return "", nil, errs[0]
+	}
+	if resp != nil && resp.StatusCode != 200 {
+		log.Warn("Failed in fetching cluster-info, responsecode: ", resp.StatusCode)
+		return "", nil, &statusError{"fetching cluster-info", resp.StatusCode}
+	}
+
+	config, err := kubeconfig.Decode([]byte(info.Data["kubeconfig"]))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, cluster := range config.Clusters {
+		if cluster.Server != "" && len(cluster.CertificateAuthorityData) > 0 {
+			return cluster.Server, cluster.CertificateAuthorityData, nil
+		}
+	}
+	return "", nil, errors.New("cluster-info has no cluster with server and certificate authority")
+}
+
+// applyDiscovery fills in the server address and CA of cluster from cluster-info
+func applyDiscovery(ctx context.Context, cluster *Cluster) error {
+	server, ca, err := discoverCluster(ctx, cluster.APIServer, cluster.ProxyURL)
+	if err != nil {
+		return err
+	}
+
+	if server != cluster.APIServer {
+		log.Info("Using canonical API server address ", server, " instead of ", cluster.APIServer)
+		cluster.APIServer = server
+	}
+	cluster.CAData = string(ca)
+
+	// Nothing authenticates cluster-info, let the user compare the CA with a trusted source
+	log.Warn("Discovered cluster CA with SHA256 fingerprint ", fmt.Sprintf("%x", sha256.Sum256(ca)),
+		", verify it with your cluster administrators")
+	return nil
+}
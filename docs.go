@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// environment lists the variables kubed reads, for the generated docs
+var environment = []struct {
+	name string
+	help string
+}{
+	{clientSecretEnv, "Client secret of confidential clients, when -client-secret is not given"},
+	{logLevelEnv, "Log level, when -log-level is not given"},
+	{agentSocketEnv, "Socket of the kubed agent, when -agent-socket is not given"},
+	{registryKeyEnv, "Key to verify cluster registries, when -registry-key is not given"},
+	{noUpdateCheckEnv, "Turns off the notice about new releases when set"},
+	{noColorEnv, "Turns off colors when set, unless -color always is given"},
+	{plainEnv, "Turns on plain output for screen readers when set, like -plain"},
+}
+
+func init() {
+	commands["docs"] = &command{
+		usage: "docs -man|-markdown",
+		help:  "Print the manual page or the markdown reference of the commands and flags",
+		run:   docsCommand,
+	}
+}
+
+func docsCommand(ctx context.Context, args []string) error {
+	switch {
+	case *manPage:
+		writeManPage(os.Stdout)
+	case *markdownDocs:
+		writeMarkdown(os.Stdout)
+	default:
+		return withExitCode(exitUsage, errors.New("Choose the format of the docs with -man or -markdown"))
+	}
+	return nil
+}
+
+func sortedCommands() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagDoc describes a flag like flag.PrintDefaults does
+type flagDoc struct {
+	synopsis string
+	usage    string
+}
+
+func flagDocs() []flagDoc {
+	var docs []flagDoc
+	flag.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		doc := flagDoc{synopsis: "-" + f.Name, usage: usage}
+		if name != "" {
+			doc.synopsis += " " + name
+		}
+		switch {
+		case f.DefValue == "" || f.DefValue == "false" || f.DefValue == "0" || f.DefValue == "[]":
+		case name == "string":
+			doc.usage += fmt.Sprintf(" (default %q)", f.DefValue)
+		default:
+			doc.usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		docs = append(docs, doc)
+	})
+	return docs
+}
+
+// roff escapes text for a manual page
+func roff(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func writeManPage(w io.Writer) {
+	fmt.Fprintf(w, ".TH KUBED 1 \"\" \"kubed %s\" \"User Commands\"\n", roff(version))
+	fmt.Fprintf(w, ".SH NAME\nkubed \\- log in to Kubernetes clusters with Dataporten and a JWT token issuer\n")
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B kubed\n[flags]\n.br\n.B kubed\n<command> [arguments] [flags]\n")
+	fmt.Fprintf(w, ".SH COMMANDS\n")
+	for _, name := range sortedCommands() {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(commands[name].usage), roff(commands[name].help))
+	}
+	fmt.Fprintf(w, ".SH FLAGS\n")
+	for _, f := range flagDocs() {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(f.synopsis), roff(f.usage))
+	}
+	fmt.Fprintf(w, ".SH ENVIRONMENT\n")
+	for _, e := range environment {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(e.name), roff(e.help))
+	}
+	fmt.Fprintf(w, ".SH FILES\n.TP\n.I ~/.kubed/config.yaml\nClusters and settings, see \\-data\\-dir\n")
+	fmt.Fprintf(w, ".TP\n.I ~/.kubed/tokens.yaml\nCached provider tokens\n")
+	fmt.Fprintf(w, ".TP\n.I ~/.kubed/audit.log\nChanges kubed made\n")
+}
+
+// cell escapes text for a markdown table
+func cell(s string) string {
+	return strings.Replace(s, "|", `\|`, -1)
+}
+
+func writeMarkdown(w io.Writer) {
+	fmt.Fprintf(w, "# kubed reference\n\nGenerated by `kubed docs -markdown` for kubed %s.\n\n", version)
+	fmt.Fprintf(w, "```\nkubed [flags]\nkubed <command> [arguments] [flags]\n```\n\n")
+	fmt.Fprintf(w, "## Commands\n\n| Command | Description |\n|---------|-------------|\n")
+	for _, name := range sortedCommands() {
+		fmt.Fprintf(w, "| `%s` | %s |\n", cell(commands[name].usage), cell(commands[name].help))
+	}
+	fmt.Fprintf(w, "\n## Flags\n\n| Flag | Description |\n|------|-------------|\n")
+	for _, f := range flagDocs() {
+		fmt.Fprintf(w, "| `%s` | %s |\n", cell(f.synopsis), cell(f.usage))
+	}
+	fmt.Fprintf(w, "\n## Environment\n\n| Variable | Description |\n|----------|-------------|\n")
+	for _, e := range environment {
+		fmt.Fprintf(w, "| `%s` | %s |\n", e.name, cell(e.help))
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteDocs(t *testing.T) {
+	var man, markdown bytes.Buffer
+	writeManPage(&man)
+	writeMarkdown(&markdown)
+
+	if !strings.Contains(man.String(), ".B \\-port int\n") {
+		t.Errorf("Manual page is missing the -port flag")
+	}
+	if !strings.Contains(markdown.String(), "| `logout <cluster>` |") {
+		t.Errorf("Markdown reference is missing the logout command")
+	}
+	if !strings.Contains(markdown.String(), "(default 49999)") {
+		t.Errorf("Markdown reference is missing the default of -port")
+	}
+}
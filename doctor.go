@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+	"github.com/uninett/kubed/pkg/auth"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+// diagnosis is the outcome of one doctor check, with a hint on how to fix it
+type diagnosis struct {
+	check  string
+	err    error
+	remedy string
+}
+
+func init() {
+	commands["doctor"] = &command{
+		usage: "doctor [cluster]",
+		help:  "Check the local setup and the configured clusters for common problems",
+		run:   doctor,
+	}
+}
+
+func doctor(ctx context.Context, args []string) error {
+	var results []diagnosis
+
+	clusters, err := readClusters()
+	results = append(results, diagnosis{
+		check:  "kubed config " + kubedConfPath() + " is readable and valid",
+		err:    err,
+		remedy: "Fix or remove the file and configure your clusters again with full config parameters",
+	})
+
+	if len(args) > 0 {
+		var selected []Cluster
+		for _, c := range clusters {
+			if c.matches(args[0]) {
+				selected = append(selected, c)
+			}
+		}
+		if len(selected) == 0 {
+			return fmt.Errorf("Cluster %q is not configured", args[0])
+		}
+		clusters = selected
+	}
+
+	checked := map[string]bool{expandHome(*kubeConfigFlag): true}
+	results = append(results, checkKubeConfig(expandHome(*kubeConfigFlag)))
+	if len(clusters) == 0 {
+		results = append(results, checkDiscovery(ctx, defaultProviderURL))
+		results = append(results, checkClock(ctx, defaultProviderURL))
+	}
+	results = append(results, checkBrowser())
+
+	for _, c := range clusters {
+		if filename := expandHome(c.KubeConfig); !checked[filename] {
+			checked[filename] = true
+			results = append(results, checkKubeConfig(filename))
+		}
+		if provider := providerEndpoint(&c, ""); !checked[provider] {
+			checked[provider] = true
+			results = append(results, checkDiscovery(ctx, provider))
+			results = append(results, checkClock(ctx, provider))
+		}
+		results = append(results, checkPort(c.Port))
+		results = append(results, checkIssuer(ctx, &c))
+		results = append(results, checkTokenTimes(ctx, &c))
+	}
+
+	failed := 0
+	for _, d := range results {
+		switch {
+		case d.err == nil && plainOutput():
+			fmt.Println("Passed:", d.check)
+		case d.err == nil:
+			fmt.Println("[ OK ]", d.check)
+		case plainOutput():
+			failed++
+			fmt.Printf("Failed: %s: %s. Fix: %s\n", d.check, d.err, d.remedy)
+		default:
+			failed++
+			fmt.Println("[FAIL]", d.check+":", d.err)
+			fmt.Println("       ->", d.remedy)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// checkKubeConfig verifies the kubeconfig can be written and is not readable by others
+func checkKubeConfig(filename string) diagnosis {
+	d := diagnosis{check: "kubeconfig " + filename + " is writable and private"}
+
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		// kubed creates the file and its directory on first run
+		dir := filepath.Dir(filename)
+		for {
+			if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+		tmp, err := ioutil.TempFile(dir, ".kubed")
+		if err != nil {
+			d.err = err
+			d.remedy = "Make sure you can write to " + dir + " or choose another file with -kube-config"
+			return d
+		}
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return d
+	} else if err != nil {
+		d.err = err
+		d.remedy = "Check the path given to -kube-config"
+		return d
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		d.err = err
+		d.remedy = "Make the file writable for your user, e.g. chmod u+w " + filename
+		return d
+	}
+	f.Close()
+
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		d.err = fmt.Errorf("file mode is %v, tokens can be read by other users", info.Mode().Perm())
+		d.remedy = "Restrict permissions with chmod 600 " + filename
+	}
+	return d
+}
+
+// checkDiscovery verifies the OAuth2 Provider publishes its OpenID Connect configuration
+func checkDiscovery(ctx context.Context, providerURL string) diagnosis {
+	discoveryURL := providerURL + "/.well-known/openid-configuration"
+	d := diagnosis{check: "OpenID Connect discovery at " + discoveryURL}
+
+	var discovery struct {
+		Issuer string `json:"issuer"`
+	}
+	resp, errs := endRequest(ctx, gorequest.New().Get(discoveryURL), &discovery)
+	switch {
+	case len(errs) > 0:
+		d.err = errs[0]
+		d.remedy = remedyForNetworkError(errs[0])
+	case resp != nil && resp.StatusCode != 200:
+		d.err = fmt.Errorf("responsecode %d", resp.StatusCode)
+		d.remedy = "The provider may be down, try again later"
+	case discovery.Issuer == "":
+		d.err = errors.New("response has no issuer")
+		d.remedy = "The provider returned an unexpected document, check for a captive portal or proxy"
+	}
+	return d
+}
+
+// checkIssuer verifies the JWT Token Issuer of the cluster is reachable, with
+// the requests of the login check, so its paths, headers, client certificate
+// and tunnel are used
+func checkIssuer(ctx context.Context, c *Cluster) diagnosis {
+	d := diagnosis{check: "issuer " + c.IssuerURL + " of \"" + c.Name + "\" is reachable"}
+
+	urls, err := issuerProbeURLs(c)
+	if err != nil {
+		d.err = err
+		d.remedy = "Fix -issuer-ca-path of the cluster and configure it again"
+		return d
+	}
+	for _, u := range urls {
+		err = probeIssuer(ctx, c, u)
+		if _, ok := err.(*statusError); ok {
+			d.err = err
+			d.remedy = "The issuer is having problems, contact the cluster administrators"
+			return d
+		} else if err != nil {
+			d.err = err
+			d.remedy = remedyForNetworkError(err)
+			return d
+		}
+	}
+	return d
+}
+
+// checkTokenTimes compares the credential kubectl uses for the cluster with
+// the local clock
+func checkTokenTimes(ctx context.Context, c *Cluster) diagnosis {
+	d := diagnosis{check: "token of \"" + c.Name + "\" is valid according to the local clock"}
+
+	issued, expiry, err := credentialTimes(ctx, c)
+	if err != nil {
+		d.err = err
+		d.remedy = "Run " + os.Args[0] + " -renew " + c.Name
+		return d
+	}
+
+	now := time.Now()
+	if issued.Sub(now) > *clockSkew {
+		d.err = fmt.Errorf("token was issued %s in the future", issued.Sub(now).Round(time.Second))
+		d.remedy = "Your clock is behind, enable time synchronization (NTP) or raise -clock-skew"
+		return d
+	}
+	if expired(expiry, now) {
+		d.err = fmt.Errorf("token expired at %s", expiry.Format(time.RFC1123))
+		d.remedy = "Run " + os.Args[0] + " -renew " + c.Name
+	}
+	return d
+}
+
+// credentialTimes returns when the credential kubectl uses for the cluster
+// was issued and expires: the cached token for exec credentials, the ID
+// token of the auth-provider, the client certificate, or else the token in
+// kubeconfig
+func credentialTimes(ctx context.Context, c *Cluster) (time.Time, time.Time, error) {
+	if c.ExecCredential {
+		cached, ok, err := readCachedToken(ctx, c.Name)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if !ok || cached.JWT == "" {
+			return time.Time{}, time.Time{}, errors.New("no token cached for kubectl")
+		}
+		return jwtTimes(cached.JWT)
+	}
+
+	config, err := kubeconfig.ReadConfigOrNew(expandHome(c.KubeConfig))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	user, ok := config.AuthInfos[kubeEntries(c).User]
+	switch {
+	case !ok:
+		return time.Time{}, time.Time{}, errors.New("no user found in kubeconfig")
+	case c.AuthProvider && user.AuthProvider != nil && user.AuthProvider.Config["id-token"] != "":
+		return jwtTimes(user.AuthProvider.Config["id-token"])
+	case c.ClientCertificate && len(user.ClientCertificateData) > 0:
+		block, _ := pem.Decode(user.ClientCertificateData)
+		if block == nil {
+			return time.Time{}, time.Time{}, errors.New("client certificate in kubeconfig is not PEM")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return cert.NotBefore, cert.NotAfter, nil
+	case user.Token != "":
+		return jwtTimes(user.Token)
+	}
+	return time.Time{}, time.Time{}, errors.New("no token found in kubeconfig")
+}
+
+func jwtTimes(token string) (time.Time, time.Time, error) {
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	issued, expiry := auth.TokenTimes(claims)
+	return issued, expiry, nil
+}
+
+// checkClock compares the local clock with the Date header of the OAuth2 Provider
+func checkClock(ctx context.Context, providerURL string) diagnosis {
+	d := diagnosis{check: "local clock matches the clock of the OAuth2 Provider " + providerURL}
+
+	resp, errs := endRequest(ctx, gorequest.New().Head(providerURL+authPath), nil)
+	if len(errs) > 0 {
+		d.err = errs[0]
+		d.remedy = remedyForNetworkError(errs[0])
+		return d
+	}
+	if skew, ok := serverSkew(resp, time.Now()); ok && (skew > *clockSkew || -skew > *clockSkew) {
+		d.err = fmt.Errorf("local clock is off by %s", skew.Round(time.Second))
+		d.remedy = "Enable time synchronization (NTP) or raise -clock-skew"
+	}
+	return d
+}
+
+// checkPort verifies the callback port is free
+func checkPort(port int) diagnosis {
+	d := diagnosis{check: fmt.Sprintf("callback port %d is available", port)}
+
+	l, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		d.err = err
+		d.remedy = "Stop the program using the port, or check for another running kubed"
+		return d
+	}
+	l.Close()
+	return d
+}
+
+// checkBrowser verifies a browser can be opened for authentication
+func checkBrowser() diagnosis {
+	d := diagnosis{
+		check:  "a browser can be opened",
+		remedy: "Use -manual-input to authenticate in a browser on another machine",
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+	case "darwin":
+		_, d.err = exec.LookPath("open")
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			d.err = errors.New("no graphical display found")
+			return d
+		}
+		_, d.err = exec.LookPath("xdg-open")
+	}
+	return d
+}
+
+func remedyForNetworkError(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "x509"):
+		return "The server certificate is not trusted, check the system CA certificates or for a TLS intercepting proxy"
+	case strings.Contains(msg, "no such host"):
+		return "The host name can not be resolved, check the URL and your DNS settings"
+	case strings.Contains(msg, "deadline exceeded"), strings.Contains(msg, "Timeout"):
+		return "The request timed out, check your network or raise -http-timeout"
+	}
+	return "Check your network connection and the configured URL"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckIssuerUsesIssuerRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" || (r.URL.Path != "/" && r.URL.Path != "/v1/lab/ca") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	os.Setenv("KUBED_TEST_API_KEY", "key")
+	defer os.Unsetenv("KUBED_TEST_API_KEY")
+
+	cluster := &Cluster{
+		Name:          "lab",
+		IssuerURL:     server.URL,
+		IssuerAPI:     &IssuerAPI{CAPath: "/v1/{{.Cluster}}/ca"},
+		IssuerHeaders: map[string]string{"X-Api-Key": "env:KUBED_TEST_API_KEY"},
+	}
+	if d := checkIssuer(context.Background(), cluster); d.err != nil {
+		t.Errorf("Expected the issuer to be reachable with its CA path and headers, got %s", d.err)
+	}
+
+	cluster.IssuerHeaders = nil
+	if d := checkIssuer(context.Background(), cluster); d.err == nil {
+		t.Error("Expected an issuer answering 503 to fail the check")
+	}
+}
+
+func TestCheckTokenTimesOfExecCredential(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	s, err := newSandbox("https://token.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.sign(s.claims("kubernetes", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := &Cluster{Name: "lab", KubeConfig: "~/.kube/config", ExecCredential: true}
+	if err := saveConfig(cluster); err != nil {
+		t.Fatal(err)
+	}
+	if d := checkTokenTimes(context.Background(), cluster); d.err == nil {
+		t.Error("Expected the check to fail without a cached token")
+	}
+	if err := saveCachedJWT(context.Background(), "lab", token); err != nil {
+		t.Fatal(err)
+	}
+	if d := checkTokenTimes(context.Background(), cluster); d.err != nil {
+		t.Errorf("Expected the cached token to be checked, got %s", d.err)
+	}
+}
+
+func TestCheckClockAsksProviderOfCluster(t *testing.T) {
+	var date time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", date.UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	date = time.Now()
+	if d := checkClock(context.Background(), server.URL); d.err != nil {
+		t.Errorf("Expected matching clocks to pass, got %s", d.err)
+	}
+	date = time.Now().Add(-time.Hour)
+	if d := checkClock(context.Background(), server.URL); d.err == nil {
+		t.Error("Expected a provider clock an hour behind to fail the check")
+	}
+}
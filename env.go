@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// contextFileDir holds the kubeconfig files setting nothing but the current
+// context, put first in KUBECONFIG by kubed env to pick the context of one
+// terminal without changing it for the others
+const contextFileDir = separateKubeConfigDir + "/contexts"
+
+func init() {
+	commands["env"] = &command{
+		usage: "env [-shell bash|zsh|fish|powershell] [cluster]",
+		help:  "Print the KUBECONFIG export to eval in the shell, for all clusters or only the given one in this terminal",
+		run:   envCommand,
+	}
+}
+
+func envCommand(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return withExitCode(exitUsage, errors.New("Please provide at most one cluster"))
+	}
+	shell, err := envShell(*shellFlag)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		clusters, err := readClusters()
+		if err != nil {
+			return err
+		}
+		return printEnv(os.Stdout, shell, allKubeConfigFiles(clusters), "", envCommandLine(args))
+	}
+
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	contextName := kubeEntries(cluster).Context
+	contextFile, err := writeContextFile(contextName)
+	if err != nil {
+		return err
+	}
+	files := append([]string{contextFile}, kubeConfigFiles(cluster)...)
+	return printEnv(os.Stdout, shell, files, contextName, envCommandLine(args))
+}
+
+// envCommandLine is the kubed env command to eval, for the hint printed last
+func envCommandLine(args []string) string {
+	line := []string{os.Args[0], "env"}
+	if *shellFlag != "" {
+		line = append(line, "-shell", *shellFlag)
+	}
+	return strings.Join(append(line, args...), " ")
+}
+
+// envShell is the shell kubed env prints for, by default the one in SHELL
+func envShell(shell string) (string, error) {
+	if shell == "" {
+		shell = "bash"
+		if env := os.Getenv("SHELL"); env != "" {
+			shell = filepath.Base(env)
+		} else if runtime.GOOS == "windows" {
+			shell = "powershell"
+		}
+	}
+	switch shell {
+	case "bash", "zsh", "fish", "powershell":
+		return shell, nil
+	case "sh", "dash", "ksh":
+		return "bash", nil
+	case "pwsh":
+		return "powershell", nil
+	}
+	return "", withExitCode(exitUsage, errors.Errorf("Unknown -shell %q, use bash, zsh, fish or powershell", shell))
+}
+
+// allKubeConfigFiles are the kubeconfig files of all clusters, each once, in
+// the order of the clusters
+func allKubeConfigFiles(clusters []Cluster) []string {
+	var files []string
+	seen := map[string]bool{}
+	for i := range clusters {
+		for _, f := range kubeConfigFiles(&clusters[i]) {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+// writeContextFile writes the kubeconfig file making the context current,
+// kubectl takes the current context from the first file in KUBECONFIG
+func writeContextFile(contextName string) (string, error) {
+	filename := expandHome(contextFileDir + "/" + contextName + ".yaml")
+	config := api.NewConfig()
+	config.CurrentContext = contextName
+	err := kubeconfig.WriteConfig(config, filename)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed in writing the context file")
+	}
+	return filename, nil
+}
+
+// isContextFile tells whether filename is one of the files of kubed env
+// setting the context, which kubed must not write logins to
+func isContextFile(filename string) bool {
+	return filepath.Dir(expandHome(filename)) == expandHome(contextFileDir)
+}
+
+// printEnv prints the export statements of KUBECONFIG listing the files, and
+// of KUBED_CONTEXT for prompts if a context is given, for the shell. It ends
+// with a comment how to eval commandLine.
+func printEnv(w io.Writer, shell string, files []string, contextName string, commandLine string) error {
+	vars := [][2]string{{"KUBECONFIG", strings.Join(files, string(filepath.ListSeparator))}}
+	if contextName != "" {
+		vars = append(vars, [2]string{"KUBED_CONTEXT", contextName})
+	}
+
+	for _, v := range vars {
+		var err error
+		switch shell {
+		case "fish":
+			_, err = fmt.Fprintf(w, "set -gx %s %s;\n", v[0], fishQuote(v[1]))
+		case "powershell":
+			_, err = fmt.Fprintf(w, "$Env:%s = %s\n", v[0], powershellQuote(v[1]))
+		default:
+			_, err = fmt.Fprintf(w, "export %s=%s\n", v[0], shellQuote(v[1]))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	run := "eval \"$(" + commandLine + ")\""
+	switch shell {
+	case "fish":
+		run = commandLine + " | source"
+	case "powershell":
+		run = "& " + commandLine + " | Invoke-Expression"
+	}
+	_, err := fmt.Fprintf(w, "# To configure your shell, run: %s\n", run)
+	return err
+}
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote quotes s for fish, where backslashes escape in single quotes
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+func powershellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintEnv(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	clusters := []Cluster{
+		{Name: "lab", KubeConfig: separateKubeConfig("lab")},
+		{Name: "course", KubeConfig: "~/.kube/config", ExtraKubeConfigs: []string{separateKubeConfig("lab")}},
+	}
+	if !hasSeparateKubeConfig(&clusters[0]) || hasSeparateKubeConfig(&clusters[1]) {
+		t.Error("Expected only the first cluster to have its own kubeconfig file")
+	}
+
+	var out bytes.Buffer
+	err := printEnv(&out, "bash", allKubeConfigFiles(clusters), "", "kubed env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lab := filepath.Join(dir, ".kube", "kubed", "lab.yaml")
+	expected := "export KUBECONFIG='" + lab + string(filepath.ListSeparator) + filepath.Join(dir, ".kube", "config") + "'\n" +
+		"# To configure your shell, run: eval \"$(kubed env)\"\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestPrintEnvShells(t *testing.T) {
+	files := []string{"/home/o'neil/.kube/config"}
+	for shell, expected := range map[string]string{
+		"zsh":        "export KUBECONFIG='/home/o'\\''neil/.kube/config'\nexport KUBED_CONTEXT='lab'\n",
+		"fish":       "set -gx KUBECONFIG '/home/o\\'neil/.kube/config';\nset -gx KUBED_CONTEXT 'lab';\n",
+		"powershell": "$Env:KUBECONFIG = '/home/o''neil/.kube/config'\n$Env:KUBED_CONTEXT = 'lab'\n",
+	} {
+		var out bytes.Buffer
+		err := printEnv(&out, shell, files, "lab", "kubed env lab")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out.String(), expected) {
+			t.Errorf("Expected %s exports %q, got %q", shell, expected, out.String())
+		}
+	}
+}
+
+func TestEnvShell(t *testing.T) {
+	for given, expected := range map[string]string{"bash": "bash", "pwsh": "powershell", "sh": "bash", "fish": "fish"} {
+		shell, err := envShell(given)
+		if err != nil || shell != expected {
+			t.Errorf("Expected %q for %q, got %q, %v", expected, given, shell, err)
+		}
+	}
+	_, err := envShell("tcsh")
+	if exitCode(err) != exitUsage {
+		t.Errorf("Expected an unknown shell to be a usage error, got %v", err)
+	}
+}
+
+func TestContextFile(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	filename, err := writeContextFile("lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename != filepath.Join(dir, ".kube", "kubed", "contexts", "lab.yaml") {
+		t.Errorf("Unexpected context file %q", filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "current-context: lab") {
+		t.Errorf("Expected the context file to set the current context, got %q", data)
+	}
+	if !isContextFile(filename) || isContextFile(separateKubeConfig("lab")) {
+		t.Error("Expected only the context file to be one")
+	}
+
+	cluster := &Cluster{}
+	setKubeConfigs(cluster, filename+string(filepath.ListSeparator)+"~/.kube/config")
+	if cluster.KubeConfig != "~/.kube/config" || cluster.ExtraKubeConfigs != nil {
+		t.Errorf("Expected the context file to be skipped, got %q %q", cluster.KubeConfig, cluster.ExtraKubeConfigs)
+	}
+}
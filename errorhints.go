@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// hintError carries the command or flag that fixes an error, shown after the
+// error itself by finish
+type hintError struct {
+	err  error
+	hint string
+}
+
+func (e *hintError) Error() string {
+	return e.err.Error()
+}
+
+func withHint(err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+	return &hintError{err, tr(hint)}
+}
+
+func withHintf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &hintError{err, tr(format, args...)}
+}
+
+// unwrap returns the error err wraps, looking through the errors of
+// pkg/errors as well as exitError and hintError. It returns nil at the end.
+func unwrap(err error) error {
+	switch e := err.(type) {
+	case *exitError:
+		return e.err
+	case *hintError:
+		return e.err
+	case interface {
+		Cause() error
+	}:
+		return e.Cause()
+	}
+	return nil
+}
+
+// errorKinds name the exit codes in the JSON result
+var errorKinds = map[int]string{
+	exitFailure:           "failure",
+	exitUsage:             "usage",
+	exitAuthDenied:        "auth-denied",
+	exitIssuerUnreachable: "issuer-unreachable",
+	exitKubeConfigWrite:   "kubeconfig-write",
+	exitTimeout:           "timeout",
+	exitUnknownCluster:    "unknown-cluster",
+	exitInterrupted:       "interrupted",
+}
+
+// defaultHints apply to errors of a kind when nothing more specific is known
+var defaultHints = map[int]string{
+	exitUsage:             "See kubed help for the commands and flags",
+	exitAuthDenied:        "Log in again with -prompt login, or ask your cluster administrators for access",
+	exitIssuerUnreachable: "Check the -issuer address and your network, -debug-http shows the requests kubed makes",
+	exitKubeConfigWrite:   "Check that the file given with -kube-config is writable",
+	exitTimeout:           "Try again, or give more time with -callback-timeout or -http-timeout",
+	exitUnknownCluster:    "See the configured clusters with kubed list",
+	exitInterrupted:       "Run the same command again to start over",
+}
+
+// errorHint returns the first hint in the chain of err, or the default
+// hint of its kind
+func errorHint(err error) string {
+	if err == nil {
+		return ""
+	}
+	for e := err; e != nil; e = unwrap(e) {
+		if h, ok := e.(*hintError); ok {
+			return h.hint
+		}
+	}
+	if hint, ok := defaultHints[exitCode(err)]; ok {
+		return tr(hint)
+	}
+	return ""
+}
+
+// missingFlags names the flags of the required cluster settings that are empty
+func missingFlags(cluster *Cluster) error {
+	var missing []string
+	for flag, value := range map[string]string{
+		"-name":       cluster.Name,
+		"-api-server": cluster.APIServer,
+		"-issuer":     cluster.IssuerURL,
+		"-client-id":  cluster.ClientID,
+	} {
+		if value == "" {
+			missing = append(missing, flag)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return withHintf(withExitCode(exitUsage, errors.New(tr("Please provide all the required parameters"))),
+		"Rerun with %s, refer kubed -h", strings.Join(missing, ", "))
+}
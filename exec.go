@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	commands["exec"] = &command{
+		usage: "exec <cluster> -- <command>",
+		help:  "Renew the token of the cluster if needed, then run the command with its context",
+		run:   execCommand,
+	}
+}
+
+func execCommand(ctx context.Context, args []string) error {
+	if len(args) > 1 && args[1] == "--" {
+		args = append([]string{args[0]}, args[2:]...)
+	}
+	if len(args) < 2 || args[0] == "--" {
+		return withExitCode(exitUsage, errors.New("Please provide the cluster and the command to run, e.g. kubed exec lab -- kubectl get pods"))
+	}
+	name, command := args[0], args[1:]
+
+	// Scripts must not run into a token expiring halfway, so it has to last
+	// for -valid-for too
+	_, err := validToken(ctx, name, true, *execValidFor)
+	if err != nil {
+		return err
+	}
+	cluster, err := readConfig(name)
+	if err != nil {
+		return err
+	}
+	contextName := kubeEntries(cluster).Context
+	contextFile, err := writeContextFile(contextName)
+	if err != nil {
+		return err
+	}
+	files := append([]string{contextFile}, kubeConfigFiles(cluster)...)
+
+	log.Debug("Running ", strings.Join(command, " "), " in context \"", contextName, "\"")
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"KUBECONFIG="+strings.Join(files, string(filepath.ListSeparator)),
+		"KUBED_CONTEXT="+contextName)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	code, err := exitStatus(leaveSignals(cmd.Run))
+	if err != nil {
+		return errors.Wrapf(err, "Failed in running %s", command[0])
+	}
+	// The exit status is the one of the command, for the script to check
+	if code != exitOK {
+		os.Exit(code)
+	}
+	return nil
+}
+
+// exitStatus is the exit code of a command that ran, the error is returned
+// when it couldn't be run at all
+func exitStatus(err error) (int, error) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return exitOK, err
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+		if status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return status.ExitStatus(), nil
+	}
+	return exitFailure, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExecUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"lab"}, {"lab", "--"}, {"--", "kubectl"}} {
+		err := execCommand(context.Background(), args)
+		if exitCode(err) != exitUsage {
+			t.Errorf("Expected a usage error for %q, got %v", args, err)
+		}
+	}
+}
+
+func TestTokenExpiresWithin(t *testing.T) {
+	s, err := newSandbox("http://127.0.0.1:5556")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.sign(s.claims("kubed", map[string]interface{}{"exp": time.Now().Add(3 * time.Minute).Unix()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenExpired(token) || tokenExpiresWithin(token, time.Minute) {
+		t.Error("Expected the token to last a minute more")
+	}
+	if !tokenExpiresWithin(token, 5*time.Minute) {
+		t.Error("Expected the token to expire within 5 minutes")
+	}
+}
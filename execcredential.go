@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+const execCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+func init() {
+	commands["exec-credential"] = &command{
+		usage: "exec-credential <cluster>",
+		help:  "Print the token as ExecCredential, for use as kubectl exec credential plugin",
+		run:   execCredential,
+	}
+}
+
+// ExecCredential is what kubectl expects from an exec credential plugin
+type ExecCredential struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     ExecCredentialStatus `json:"status"`
+}
+
+// ExecCredentialStatus holds the token and when kubectl should ask again
+type ExecCredentialStatus struct {
+	Token               string     `json:"token"`
+	ExpirationTimestamp *time.Time `json:"expirationTimestamp,omitempty"`
+}
+
+// execConfig is the exec stanza of a kubeconfig user running "kubed exec-credential",
+// with the agent socket in its environment if useAgent
+func execConfig(name string, useAgent bool) map[string]interface{} {
+	command, err := os.Executable()
+	if err != nil {
+		command = os.Args[0]
+	}
+
+	exec := map[string]interface{}{
+		"apiVersion": execCredentialAPIVersion,
+		"command":    command,
+		"args":       []string{"exec-credential", name},
+	}
+	if useAgent {
+		exec["env"] = []map[string]string{{"name": agentSocketEnv, "value": agentSocket()}}
+	}
+	return exec
+}
+
+func execCredential(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Give the name of the cluster to get the credential of")
+	}
+
+	// kubectl reads the credential from stdout, everything else goes to stderr
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = out }()
+	log.SetOutput(os.Stderr)
+
+	token, err := currentToken(ctx, args[0], true)
+	if err != nil {
+		return err
+	}
+
+	cred := ExecCredential{
+		APIVersion: execCredentialAPIVersion,
+		Kind:       "ExecCredential",
+		Status:     ExecCredentialStatus{Token: token},
+	}
+	if claims, err := auth.DecodeClaims(token); err == nil {
+		if _, expiry := auth.TokenTimes(claims); !expiry.IsZero() {
+			cred.Status.ExpirationTimestamp = &expiry
+		}
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
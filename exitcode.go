@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Exit codes, documented in the README so wrapper scripts can branch on them
+const (
+	exitOK                = 0
+	exitFailure           = 1
+	exitUsage             = 2
+	exitAuthDenied        = 3
+	exitIssuerUnreachable = 4
+	exitKubeConfigWrite   = 5
+	exitTimeout           = 6
+	exitUnknownCluster    = 7
+	exitInterrupted       = 130
+)
+
+// exitError tags an error with the exit code kubed should end with. exitCode
+// uses the outermost tag in the chain, see unwrap.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code, err}
+}
+
+// exitCode picks the exit code for an error returned by a command
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	for e := err; e != nil; e = unwrap(e) {
+		if tagged, ok := e.(*exitError); ok {
+			return tagged.code
+		}
+		if e == context.DeadlineExceeded {
+			return exitTimeout
+		}
+	}
+	return exitFailure
+}
+
+// issuerExitCode tells an issuer refusing the access token apart from an
+// issuer that could not be reached at all
+func issuerExitCode(err error) int {
+	if s, ok := errors.Cause(err).(*statusError); ok {
+		if s.code == 401 || s.code == 403 {
+			return exitAuthDenied
+		}
+		return exitFailure
+	}
+	return exitIssuerUnreachable
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	var tests = []struct {
+		description string
+		err         error
+		code        int
+	}{
+		{"success", nil, exitOK},
+		{"untagged error", errors.New("failed"), exitFailure},
+		{"tagged error", withExitCode(exitKubeConfigWrite, errors.New("failed")), exitKubeConfigWrite},
+		{"wrapped tagged error", errors.Wrap(withExitCode(exitAuthDenied, errors.New("denied")), "login"), exitAuthDenied},
+		{"deadline", errors.Wrap(context.DeadlineExceeded, "waiting"), exitTimeout},
+		{"issuer refused", withExitCode(issuerExitCode(&statusError{"fetching JWT Token", 403}), errors.New("refused")), exitAuthDenied},
+		{"issuer unreachable", withExitCode(issuerExitCode(errors.New("connection refused")), errors.New("refused")), exitIssuerUnreachable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if code := exitCode(test.err); code != test.code {
+				t.Errorf("Expected exit code %d, got %d", test.code, code)
+			}
+		})
+	}
+}
+
+func TestErrorHint(t *testing.T) {
+	var tests = []struct {
+		description string
+		err         error
+		hint        string
+	}{
+		{"success", nil, ""},
+		{"untagged error", errors.New("failed"), ""},
+		{"default hint", withExitCode(exitTimeout, errors.New("failed")), defaultHints[exitTimeout]},
+		{"wrapped hint", errors.Wrap(withHint(withExitCode(exitUsage, errors.New("failed")), "Use -port"), "login"), "Use -port"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if hint := errorHint(test.err); hint != test.hint {
+				t.Errorf("Expected hint %q, got %q", test.hint, hint)
+			}
+		})
+	}
+
+	if code := exitCode(errors.Wrap(withHint(withExitCode(exitUsage, errors.New("failed")), "Use -port"), "login")); code != exitUsage {
+		t.Errorf("Expected exit code %d through hint, got %d", exitUsage, code)
+	}
+}
+
+func TestInterruptedError(t *testing.T) {
+	err := errors.New("Gave up waiting for the redirect from the OAuth2 Provider: context canceled")
+	if code := exitCode(interruptedError("kubed", err)); code != exitFailure {
+		t.Errorf("Expected no change without a signal, got exit code %d", code)
+	}
+
+	interruptedFlag = 1
+	defer func() { interruptedFlag = 0 }()
+	err = interruptedError("kubed", err)
+	if code := exitCode(err); code != exitInterrupted {
+		t.Errorf("Expected exit code %d, got %d", exitInterrupted, code)
+	}
+	if hint := errorHint(err); !strings.Contains(hint, "-renew kubed") {
+		t.Errorf("Expected a hint on resuming, got %q", hint)
+	}
+}
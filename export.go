@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ClusterDefinition is the part of a cluster config that can be shared with
+// others, without any secrets or local settings
+type ClusterDefinition struct {
+	Name      string `yaml:"name"`
+	APIServer string `yaml:"apiserver"`
+	IssuerURL string `yaml:"issuer"`
+	ClientID  string `yaml:"clientid"`
+	NameSpace string `yaml:"namespace,omitempty"`
+	// RBACMapping is the file or URL of the mapping of groups to roles
+	RBACMapping string `yaml:"rbacmapping,omitempty"`
+	// TokenTTL is the lifetime to request for tokens, e.g. 8h, where -token-ttl
+	// given on import wins
+	TokenTTL string `yaml:"tokenttl,omitempty"`
+}
+
+// ClusterDefinitions is the content of an exported file
+type ClusterDefinitions struct {
+	Clusters []ClusterDefinition `yaml:"clusters"`
+}
+
+func init() {
+	commands["export"] = &command{
+		usage: "export [-cluster name]",
+		help:  "Print shareable definitions of the configured clusters",
+		run:   exportClusters,
+	}
+	commands["import"] = &command{
+		usage: "import -f file|URL",
+		help:  "Add the cluster definitions from a file or URL and offer to log in",
+		run:   importClusters,
+	}
+}
+
+func exportClusters(ctx context.Context, args []string) error {
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+
+	var defs ClusterDefinitions
+	for _, c := range clusters {
+		if *exportCluster != "" && !c.matches(*exportCluster) {
+			continue
+		}
+		defs.Clusters = append(defs.Clusters, ClusterDefinition{
+			Name:        c.Name,
+			APIServer:   c.APIServer,
+			IssuerURL:   c.IssuerURL,
+			ClientID:    c.ClientID,
+			NameSpace:   c.NameSpace,
+			RBACMapping: c.RBACMapping,
+			TokenTTL:    c.TokenTTL,
+		})
+	}
+	if len(defs.Clusters) == 0 {
+		return errors.New("No clusters to export")
+	}
+
+	out, err := yaml.Marshal(defs)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// readSource reads what from a file, an http(s) URL or stdin when source
+// is "-"
+func readSource(ctx context.Context, source string, what string) ([]byte, error) {
+	var data []byte
+	var err error
+
+	switch {
+	case source == "-":
+		data, err = ioutil.ReadAll(os.Stdin)
+	case strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://"):
+		resp, errs := endRequest(ctx, gorequest.New().Get(source), &data)
+		if len(errs) > 0 {
+			err = errs[0]
+		} else if resp != nil && resp.StatusCode != 200 {
+			err = &statusError{"fetching " + what, resp.StatusCode}
+		}
+	default:
+		data, err = ioutil.ReadFile(expandHome(source))
+	}
+	return data, err
+}
+
+// readDefinitions reads cluster definitions in YAML or JSON from a file,
+// an http(s) URL or stdin when source is "-"
+func readDefinitions(ctx context.Context, source string) (*ClusterDefinitions, error) {
+	data, err := readSource(ctx, source, "cluster definitions")
+	if err != nil {
+		log.Warn("Failed in reading cluster definitions ", err)
+		return nil, err
+	}
+
+	var defs ClusterDefinitions
+	err = yaml.Unmarshal(data, &defs)
+	if err != nil {
+		log.Warn("Failed in parsing cluster definitions ", err)
+		return nil, err
+	}
+
+	for _, d := range defs.Clusters {
+		if d.Name == "" || d.APIServer == "" || d.IssuerURL == "" || d.ClientID == "" {
+			return nil, fmt.Errorf("Cluster definition %q is missing name, apiserver, issuer or clientid", d.Name)
+		}
+	}
+	return &defs, nil
+}
+
+// clusterFromDefinition merges a definition into the saved cluster of the same
+// name, or into a new cluster using the local settings given on the command line
+func clusterFromDefinition(d ClusterDefinition) *Cluster {
+	cluster, err := readConfig(d.Name)
+	if err != nil {
+		cluster = setConfig(d.Name, "", "", "", *clientSecret, *kubeConfigFlag, *keepContext, *port,
+			"", *manualInput, *loginHint, *prompt, *acrValues, *revocationURL)
+	}
+
+	cluster.APIServer = d.APIServer
+	cluster.IssuerURL = d.IssuerURL
+	cluster.ClientID = d.ClientID
+	cluster.NameSpace = d.NameSpace
+	cluster.RBACMapping = d.RBACMapping
+	if d.TokenTTL != "" {
+		cluster.TokenTTL = d.TokenTTL
+	}
+	if flagGiven("token-ttl") {
+		cluster.TokenTTL = *tokenTTL
+	}
+	return cluster
+}
+
+func importClusters(ctx context.Context, args []string) error {
+	if *importFile == "" {
+		return errors.New("Please provide the file or URL to import with -f")
+	}
+
+	defs, err := readDefinitions(ctx, *importFile)
+	if err != nil {
+		return err
+	}
+
+	var imported []*Cluster
+	for _, d := range defs.Clusters {
+		cluster := clusterFromDefinition(d)
+		err = validCluster(cluster)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid definition of %q", d.Name)
+		}
+		err = saveConfig(cluster)
+		if err != nil {
+			return err
+		}
+		log.Info("Imported cluster \"", cluster.Name, "\"")
+		imported = append(imported, cluster)
+	}
+
+	// stdin is used up by the definitions, there is no one to ask
+	if *importFile == "-" {
+		for _, cluster := range imported {
+			log.Info("To log in run: \"", os.Args[0], " -renew ", cluster.Name, "\"")
+		}
+		return nil
+	}
+
+	if len(imported) == 0 {
+		return nil
+	}
+	question := "Log in to " + imported[0].Name + " now?"
+	if len(imported) > 1 {
+		question = fmt.Sprintf("Log in to all %d clusters now?", len(imported))
+	}
+	ok, err := confirm(ctx, question, true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		for _, cluster := range imported {
+			log.Info("To log in later run: \"", os.Args[0], " -renew ", cluster.Name, "\"")
+		}
+		return nil
+	}
+	return loginMany(ctx, imported)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+// parseNamespaces splits the comma separated namespaces of -extra-namespaces
+func parseNamespaces(value string) ([]string, error) {
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, ns := range strings.Split(value, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		err := validNamespace(ns)
+		if err != nil {
+			return nil, err
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, nil
+}
+
+// extraContexts maps the names of the contexts of the extra namespaces of the
+// cluster, the context of the cluster and the namespace joined by a dash, to
+// their namespaces
+func extraContexts(cluster *Cluster) map[string]string {
+	contexts := map[string]string{}
+	context := kubeEntries(cluster).Context
+	for _, ns := range cluster.ExtraNamespaces {
+		contexts[context+"-"+ns] = ns
+	}
+	return contexts
+}
+
+// writeExtraContexts adds the contexts of the extra namespaces to the
+// kubeconfig file, sharing the cluster and user entries of the cluster
+func writeExtraContexts(cluster *Cluster, filename string) error {
+	contexts := extraContexts(cluster)
+	if len(contexts) == 0 {
+		return nil
+	}
+	entries := kubeEntries(cluster)
+	return kubeconfig.SetContexts(filename, entries.Cluster, entries.User, contexts)
+}
+
+// staleContexts are the extra contexts of the last login that the cluster
+// doesn't have any longer
+func staleContexts(saved *Cluster, cluster *Cluster) []string {
+	current := extraContexts(cluster)
+	current[kubeEntries(cluster).Context] = ""
+	var stale []string
+	for name := range extraContexts(saved) {
+		if _, ok := current[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func TestParseNamespaces(t *testing.T) {
+	namespaces, err := parseNamespaces("course-a, course-b,,course-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(namespaces, []string{"course-a", "course-b"}) {
+		t.Errorf("Unexpected namespaces %v", namespaces)
+	}
+	if _, err := parseNamespaces("course-a,Course_B"); err == nil {
+		t.Error("Expected an error for an invalid namespace")
+	}
+}
+
+func TestExtraContexts(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+	filename := filepath.Join(dir, "config")
+
+	cluster := &Cluster{Name: "lab", APIServer: "https://192.168.1.1:8443", KubeConfig: filename, ExtraNamespaces: []string{"course-a", "course-b"}}
+	cfg := kubeConfigSetup(cluster, nil)
+	cfg.Token = "token"
+	if err := writeKubeConfig(cluster, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := kubeconfig.ReadConfigOrNew(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	context, ok := config.Contexts["lab-course-b"]
+	if !ok || context.Cluster != "lab" || context.AuthInfo != "lab" || context.Namespace != "course-b" {
+		t.Errorf("Extra context was not written: %+v", context)
+	}
+	if config.CurrentContext != "lab" {
+		t.Errorf("Expected the context of the cluster to stay current, got %q", config.CurrentContext)
+	}
+	if !cluster.matches("lab-course-a") {
+		t.Error("Expected the cluster to match its extra context")
+	}
+
+	saved := *cluster
+	cluster.ExtraNamespaces = []string{"course-b"}
+	if stale := staleContexts(&saved, cluster); !reflect.DeepEqual(stale, []string{"lab-course-a"}) {
+		t.Errorf("Expected the dropped namespace to be stale, got %v", stale)
+	}
+
+	if err := removeEntriesIn(&saved, filename); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err = kubeconfig.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Contexts) != 0 {
+		t.Errorf("Expected all contexts to be removed, got %v", config.Contexts)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fuzzyMatch tells whether the characters of pattern appear in s in order,
+// ignoring case, so "pbg" matches "prod-bgo"
+func fuzzyMatch(pattern string, s string) bool {
+	pattern = strings.ToLower(pattern)
+	s = strings.ToLower(s)
+	for _, r := range pattern {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
+
+// fuzzyFilter returns the clusters whose name matches pattern
+func fuzzyFilter(pattern string, clusters []Cluster) []Cluster {
+	var matches []Cluster
+	for _, c := range clusters {
+		if fuzzyMatch(pattern, c.Name) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// maxSuggestions is how many names "did you mean" offers at most
+const maxSuggestions = 3
+
+// unknownCluster is the error for a name no cluster has, suggesting the
+// closest names and aliases of the configured clusters
+func unknownCluster(name string, clusters []Cluster) error {
+	err := withExitCode(exitUnknownCluster, fmt.Errorf("Cluster %q not found, run with full config parameters to configure it", name))
+	suggestions := suggestNames(name, clusters)
+	if len(suggestions) == 0 {
+		return err
+	}
+	return withHintf(err, "Did you mean %s? See the configured clusters with kubed list", strings.Join(suggestions, " or "))
+}
+
+// suggestNames returns the names and aliases closest to name, those a few
+// typos away or matching it fuzzily
+func suggestNames(name string, clusters []Cluster) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	seen := map[string]bool{}
+	for _, c := range clusters {
+		for _, n := range append([]string{c.Name}, c.Aliases...) {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			d := editDistance(strings.ToLower(name), strings.ToLower(n))
+			if d <= len(n)/3+1 || fuzzyMatch(name, n) {
+				candidates = append(candidates, candidate{n, d})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	var names []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		names = append(names, strconv.Quote(candidates[i].name))
+	}
+	return names
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	row := make([]int, len(t)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur := row[j]
+			row[j] = prev + cost
+			if row[j-1]+1 < row[j] {
+				row[j] = row[j-1] + 1
+			}
+			if cur+1 < row[j] {
+				row[j] = cur + 1
+			}
+			prev = cur
+		}
+	}
+	return row[len(t)]
+}
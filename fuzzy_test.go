@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	for _, c := range []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "abc", 3},
+		{"prod", "prod", 0},
+		{"prdo", "prod", 2},
+		{"kitten", "sitting", 3},
+	} {
+		if d := editDistance(c.a, c.b); d != c.distance {
+			t.Errorf("Expected distance %d between %q and %q, got %d", c.distance, c.a, c.b, d)
+		}
+	}
+}
+
+func TestSuggestNames(t *testing.T) {
+	clusters := []Cluster{
+		{Name: "uninett-prod-bgo-1", Aliases: []string{"prod"}},
+		{Name: "uninett-test-bgo-1"},
+		{Name: "course"},
+	}
+	if s := suggestNames("prid", clusters); !reflect.DeepEqual(s, []string{`"prod"`}) {
+		t.Errorf("Unexpected suggestions %v", s)
+	}
+	if s := suggestNames("uninett-tset-bgo-1", clusters); len(s) == 0 || s[0] != `"uninett-test-bgo-1"` {
+		t.Errorf("Unexpected suggestions %v", s)
+	}
+	if s := suggestNames("other", clusters); len(s) != 0 {
+		t.Errorf("Expected no suggestions, got %v", s)
+	}
+}
+
+func TestUnknownClusterExitCode(t *testing.T) {
+	err := unknownCluster("prid", []Cluster{{Name: "prod"}})
+	if code := exitCode(err); code != exitUnknownCluster {
+		t.Errorf("Expected exit code %d, got %d", exitUnknownCluster, code)
+	}
+	if hint := errorHint(err); hint != `Did you mean "prod"? See the configured clusters with kubed list` {
+		t.Errorf("Unexpected hint %q", hint)
+	}
+}
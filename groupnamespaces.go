@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+// GroupNamespace maps the groups whose id matches Group to the namespace
+// Namespace, which may refer to submatches of Group as $1, ${2} and so on
+type GroupNamespace struct {
+	Group     string `yaml:"group"`
+	Namespace string `yaml:"namespace"`
+}
+
+// apiGroup is a group as returned by the Dataporten Groups API
+type apiGroup struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+// namespaceCandidate is a namespace the user may work in, and the group it comes from
+type namespaceCandidate struct {
+	Namespace string
+	Group     string
+}
+
+var groupNamespaceFlags stringList
+
+func init() {
+	flag.Var(&groupNamespaceFlags, "group-namespace", "Map groups to namespaces as \"REGEXP=NAMESPACE\", e.g. \"fc:fs:fs:emne:uit.no:([A-Z0-9]+):.*=course-$1\" (repeatable)")
+	commands["namespaces"] = &command{
+		usage: "namespaces <cluster>",
+		help:  "Pick the namespace of the context from the namespaces of your groups",
+		run:   namespacesCommand,
+	}
+}
+
+// parseGroupNamespaces reads -group-namespace flags, checking the expressions
+func parseGroupNamespaces(flags []string) ([]GroupNamespace, error) {
+	var mappings []GroupNamespace
+	for _, f := range flags {
+		i := strings.LastIndex(f, "=")
+		if i <= 0 || i == len(f)-1 {
+			return nil, errors.New("Group namespace must be given as \"REGEXP=NAMESPACE\", got " + f)
+		}
+		if _, err := regexp.Compile(f[:i]); err != nil {
+			return nil, errors.Wrap(err, "Invalid group expression in "+f)
+		}
+		mappings = append(mappings, GroupNamespace{Group: f[:i], Namespace: f[i+1:]})
+	}
+	return mappings, nil
+}
+
+// fetchGroups lists the groups of the user the access token was issued to
+func fetchGroups(ctx context.Context, accessToken string) ([]apiGroup, error) {
+	var groups []apiGroup
+
+	groupsURL := strings.TrimRight(*groupsAPI, "/") + "/groups/me/groups"
+	start := time.Now()
+	resp, errs := endRequest(ctx, gorequest.New().Get(groupsURL).
+		Set("Authorization", "Bearer "+accessToken), &groups)
+	traceHTTP("GET", groupsURL, start, resp, errs)
+	if len(errs) > 0 {
+		log.Warn("Failed in fetching groups ", errs[0])
+		return nil, errs[0]
+	}
+	if resp != nil && resp.StatusCode != 200 {
+		log.Warn("Failed in fetching groups, responsecode: ", resp.StatusCode)
+		return nil, &statusError{"fetching groups", resp.StatusCode}
+	}
+	return groups, nil
+}
+
+var invalidNamespaceChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// candidateNamespaces maps the groups to namespaces with the first matching
+// mapping, leaving out groups without one and namespaces already seen
+func candidateNamespaces(groups []apiGroup, mappings []GroupNamespace) []namespaceCandidate {
+	var candidates []namespaceCandidate
+	seen := map[string]bool{}
+	for _, g := range groups {
+		for _, m := range mappings {
+			re := regexp.MustCompile(m.Group)
+			match := re.FindStringSubmatchIndex(g.ID)
+			if match == nil {
+				continue
+			}
+			ns := string(re.ExpandString(nil, m.Namespace, g.ID, match))
+			ns = strings.Trim(invalidNamespaceChars.ReplaceAllString(strings.ToLower(ns), "-"), "-")
+			if ns != "" && !seen[ns] {
+				seen[ns] = true
+				name := g.DisplayName
+				if name == "" {
+					name = g.ID
+				}
+				candidates = append(candidates, namespaceCandidate{ns, name})
+			}
+			break
+		}
+	}
+	return candidates
+}
+
+func namespacesCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please provide the name of the cluster to pick a namespace for")
+	}
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	return pickNamespace(ctx, cluster)
+}
+
+// pickNamespace offers the namespaces of the user's groups and makes the
+// chosen one the namespace of the context
+func pickNamespace(ctx context.Context, cluster *Cluster) error {
+	if len(cluster.GroupNamespaces) == 0 {
+		return errors.New("No group namespaces configured for \"" + cluster.Name + "\", add them with -group-namespace")
+	}
+	cached, ok, err := readCachedToken(ctx, cluster.Name)
+	if err != nil {
+		return err
+	}
+	if !ok || cached.AccessToken == "" || expired(cached.Expiry, time.Now()) {
+		return errors.New("No valid access token for \"" + cluster.Name + "\", log in again first")
+	}
+
+	groups, err := fetchGroups(ctx, cached.AccessToken)
+	if err != nil {
+		return errors.Wrap(err, "Failed in listing your groups")
+	}
+	candidates := candidateNamespaces(groups, cluster.GroupNamespaces)
+	if len(candidates) == 0 {
+		log.Info("None of your groups map to a namespace of \"", cluster.Name, "\"")
+		return nil
+	}
+
+	err = needInteraction("Picking a namespace", "Give it with -namespace instead")
+	if err != nil {
+		return err
+	}
+	for i, c := range candidates {
+		fmt.Printf("%3d) %s\t(%s)\n", i+1, c.Namespace, c.Group)
+	}
+	fmt.Printf("Namespace [1-%d, empty to keep %q]: ", len(candidates), cluster.NameSpace)
+	answer, err := readLine(ctx, bufio.NewReader(os.Stdin))
+	if err != nil {
+		return err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return nil
+	}
+	i, err := strconv.Atoi(answer)
+	if err != nil || i < 1 || i > len(candidates) {
+		return withExitCode(exitUsage, errors.New("No namespace numbered "+answer))
+	}
+
+	return setNamespace(cluster, candidates[i-1].Namespace)
+}
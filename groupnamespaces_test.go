@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestCandidateNamespaces(t *testing.T) {
+	mappings, err := parseGroupNamespaces([]string{
+		"^fc:fs:fs:emne:uit.no:([A-Z0-9]+):.*=course-$1",
+		"^fc:adhoc:(.*)=${1}",
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	groups := []apiGroup{
+		{ID: "fc:fs:fs:emne:uit.no:INF3200:1", DisplayName: "Distributed systems"},
+		{ID: "fc:fs:fs:emne:uit.no:INF3200:2"},
+		{ID: "fc:org:uit.no"},
+		{ID: "fc:adhoc:Kube_Lab"},
+	}
+	candidates := candidateNamespaces(groups, mappings)
+	if len(candidates) != 2 {
+		t.Fatalf("Expected 2 candidates, got %+v", candidates)
+	}
+	if candidates[0].Namespace != "course-inf3200" || candidates[0].Group != "Distributed systems" {
+		t.Errorf("Unexpected first candidate %+v", candidates[0])
+	}
+	if candidates[1].Namespace != "kube-lab" {
+		t.Errorf("Expected namespace kube-lab, got %s", candidates[1].Namespace)
+	}
+
+	if _, err := parseGroupNamespaces([]string{"no-namespace"}); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	commands["group"] = &command{
+		usage: "group [name [cluster...]]",
+		help:  "List the login groups, or define which clusters a group logs in to",
+		run:   groupCommand,
+	}
+}
+
+func groupCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return listGroups()
+	}
+
+	name, members := args[0], args[1:]
+	for i, m := range members {
+		cluster, err := readConfig(m)
+		if err != nil {
+			return err
+		}
+		members[i] = cluster.Name
+	}
+
+	err := updateKubedConfig(func(conf *KubedConfig) (bool, error) {
+		if len(members) == 0 {
+			delete(conf.Groups, name)
+		} else {
+			if conf.Groups == nil {
+				conf.Groups = map[string][]string{}
+			}
+			conf.Groups[name] = members
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		log.Info("Removed group \"", name, "\"")
+	} else {
+		log.Info("Group \"", name, "\" logs in to ", strings.Join(members, ", "))
+	}
+	return nil
+}
+
+func listGroups() error {
+	conf, err := readKubedConfig()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range conf.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s\t%s\n", name, strings.Join(conf.Groups[name], ", "))
+	}
+	return nil
+}
+
+// groupClusters returns the configured clusters of a login group
+func groupClusters(name string) ([]*Cluster, error) {
+	conf, err := readKubedConfig()
+	if err != nil {
+		return nil, err
+	}
+	members, ok := conf.Groups[name]
+	if !ok {
+		return nil, errors.Errorf("No login group %q in %s, define it with \"kubed group %s <cluster>...\"", name, kubedConfPath(), name)
+	}
+
+	var clusters []*Cluster
+	for _, m := range members {
+		cluster, err := readConfig(m)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Group %q", name)
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// renameInGroups keeps the groups pointing at a renamed or, with an empty
+// newName, deleted cluster
+func renameInGroups(conf *KubedConfig, oldName string, newName string) {
+	for group, members := range conf.Groups {
+		var updated []string
+		for _, m := range members {
+			if m != oldName {
+				updated = append(updated, m)
+			} else if newName != "" {
+				updated = append(updated, newName)
+			}
+		}
+		if len(updated) == 0 {
+			delete(conf.Groups, group)
+		} else {
+			conf.Groups[group] = updated
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// clusterHealth is the state of a cluster as reported on /healthz and /readyz
+type clusterHealth struct {
+	LastRenewal *time.Time `json:"lastrenewal,omitempty"`
+	LastError   string     `json:"lasterror,omitempty"`
+	Expiry      *time.Time `json:"expiry,omitempty"`
+	Expired     bool       `json:"expired"`
+}
+
+type healthReport struct {
+	Ready    bool                     `json:"ready"`
+	Clusters map[string]clusterHealth `json:"clusters"`
+}
+
+// health reports every cluster with a known token or a renewal attempt. kubed
+// is ready while none of the tokens it looks after has expired.
+func (m *renewalMetrics) health(now time.Time) healthReport {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	report := healthReport{Ready: true, Clusters: map[string]clusterHealth{}}
+	names := map[string]bool{}
+	for cluster := range m.expiry {
+		names[cluster] = true
+	}
+	for cluster := range m.attempted {
+		names[cluster] = true
+	}
+
+	for cluster := range names {
+		h := clusterHealth{LastError: m.lastError[cluster]}
+		if t, ok := m.lastRenewal[cluster]; ok {
+			h.LastRenewal = &t
+		}
+		if t, ok := m.expiry[cluster]; ok {
+			h.Expiry = &t
+			h.Expired = expired(t, now)
+		}
+		if h.Expired {
+			report.Ready = false
+		}
+		report.Clusters[cluster] = h
+	}
+	return report
+}
+
+func writeHealth(w http.ResponseWriter, report healthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// runHooks runs the global and then the cluster hook of the given stage,
+// "pre" before logging in and "post" after a successful login or renewal
+func runHooks(ctx context.Context, stage string, cluster *Cluster) error {
+	conf, err := readKubedConfig()
+	if err != nil {
+		return err
+	}
+
+	global, own := conf.PreHook, cluster.PreHook
+	if stage == "post" {
+		global, own = conf.PostHook, cluster.PostHook
+	}
+
+	for _, hook := range []string{global, own} {
+		if hook == "" {
+			continue
+		}
+		log.Debug("Running ", stage, " hook ", hook)
+		err = runHook(ctx, hook, stage, cluster)
+		if err != nil {
+			return errors.Wrapf(err, "Failed in running %s hook %q", stage, hook)
+		}
+	}
+	return nil
+}
+
+func runHook(ctx context.Context, hook string, stage string, cluster *Cluster) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook)
+	}
+
+	expiry := ""
+	if c, err := readConfig(cluster.Name); err == nil && !c.TokenExpiry.IsZero() {
+		expiry = c.TokenExpiry.Format(time.RFC3339)
+	}
+	cmd.Env = append(os.Environ(),
+		"KUBED_HOOK="+stage,
+		"KUBED_CLUSTER="+cluster.Name,
+		"KUBED_CONTEXT="+kubeEntries(cluster).Context,
+		"KUBED_KUBECONFIG="+expandHome(cluster.KubeConfig),
+		"KUBED_EXPIRY="+expiry,
+	)
+	// Hooks may want to talk to the user, e.g. for a VPN check
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	return cmd.Run()
+}
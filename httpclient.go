@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+type requestResult struct {
+	resp gorequest.Response
+	body []byte
+	errs []error
+}
+
+// endRequest sends the request with the configured timeout, identifying
+// kubed and the run, and gives up when ctx is cancelled. The response body is decoded into v unless v is nil,
+// or stored as is when v is a *[]byte.
+func endRequest(ctx context.Context, req *gorequest.SuperAgent, v interface{}) (gorequest.Response, []error) {
+	return endRequestTimeout(ctx, req, v, *httpTimeout)
+}
+
+// endRequestTimeout is endRequest with another timeout than -http-timeout
+func endRequestTimeout(ctx context.Context, req *gorequest.SuperAgent, v interface{}, timeout time.Duration) (gorequest.Response, []error) {
+	if replayer != nil {
+		return replayer.respond(v)
+	}
+	// The body is decoded here rather than in the request's goroutine, which
+	// outlives a cancelled ctx and must not write to v after we returned
+	result := make(chan requestResult, 1)
+	go func() {
+		req = identify(req.Timeout(timeout))
+		if recorder != nil {
+			result <- recorder.end(req)
+			return
+		}
+		resp, body, errs := req.EndBytes()
+		result <- requestResult{resp, body, errs}
+	}()
+
+	select {
+	case r := <-result:
+		if len(r.errs) > 0 {
+			return r.resp, r.errs
+		}
+		return r.resp, decodeBody(r.resp, r.body, v)
+	case <-ctx.Done():
+		return nil, []error{ctx.Err()}
+	}
+}
+
+// decodeBody decodes body into v like endRequest does. The body of an error
+// status is not what v expects, often an HTML page of a proxy, it is not
+// decoded and the status is returned as statusError.
+func decodeBody(resp gorequest.Response, body []byte, v interface{}) []error {
+	if v == nil {
+		return nil
+	}
+	if err := responseStatus(resp); err != nil {
+		return []error{err}
+	}
+	switch out := v.(type) {
+	case *[]byte:
+		*out = body
+	default:
+		if err := json.Unmarshal(body, v); err != nil && len(body) > 0 {
+			return []error{err}
+		}
+	}
+	return nil
+}
+
+// responseStatus returns a statusError for responses without a 2xx status
+func responseStatus(resp gorequest.Response) error {
+	if resp == nil || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil
+	}
+	what := "request"
+	if resp.Request != nil && resp.Request.URL != nil {
+		what = "requesting " + redactURL(resp.Request.URL.String())
+	}
+	return &statusError{what, resp.StatusCode}
+}
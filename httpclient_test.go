@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+func TestEndRequestErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			w.Write([]byte(`{"token":"jwt"}`))
+			return
+		}
+		// A proxy or login page in front of the issuer
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<html><body>Forbidden</body></html>"))
+	}))
+	defer server.Close()
+
+	var out JWTToken
+	_, errs := endRequest(context.Background(), gorequest.New().Get(server.URL+"/ok"), &out)
+	if len(errs) > 0 || out.Token != "jwt" {
+		t.Errorf("Expected the body to be decoded, got %+v %v", out, errs)
+	}
+
+	_, errs = endRequest(context.Background(), gorequest.New().Get(server.URL+"/forbidden"), &out)
+	if len(errs) != 1 {
+		t.Fatalf("Expected one error for a 403, got %v", errs)
+	}
+	if se, ok := errs[0].(*statusError); !ok || se.code != http.StatusForbidden {
+		t.Errorf("Expected a statusError with 403 rather than a decoding error, got %v", errs[0])
+	}
+	if retryable(errs[0]) {
+		t.Error("Expected a 403 not to be retried")
+	}
+	if code := issuerExitCode(errs[0]); code != exitAuthDenied {
+		t.Errorf("Expected exit code %d for a 403, got %d", exitAuthDenied, code)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// daemonFlags are passed on from "daemon install" to the installed daemon
+var daemonFlags = []string{"daemon-interval", "renew-before", "webhook", "daemon-listen", "data-dir", "log-format", "log-level",
+	"log-file", "log-max-size", "log-max-age", "log-keep"}
+
+// daemonArgs returns the arguments the service manager starts kubed with
+func daemonArgs() []string {
+	args := []string{"daemon"}
+	if *daemonTimer {
+		args = append(args, "-once")
+	}
+	for _, name := range daemonFlags {
+		if f := flag.Lookup(name); f != nil && f.Value.String() != f.DefValue {
+			args = append(args, "-"+name+"="+f.Value.String())
+		}
+	}
+	return args
+}
+
+// installDaemon writes the user level unit files that run the daemon on login,
+// or with -timer run a single renewal round every -daemon-interval
+func installDaemon(ctx context.Context) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "Failed in finding the kubed executable")
+	}
+
+	switch {
+	case *installSystemd || (!*installLaunchd && runtime.GOOS == "linux"):
+		return installSystemdUnits(ctx, executable)
+	case *installLaunchd || (!*installWindows && runtime.GOOS == "darwin"):
+		return installLaunchdAgent(ctx, executable)
+	case *installWindows || runtime.GOOS == "windows":
+		return installWindowsTask(ctx, executable)
+	}
+	return withExitCode(exitUsage, errors.New("Give -systemd, -launchd or -windows-service to choose the service manager"))
+}
+
+func installSystemdUnits(ctx context.Context, executable string) error {
+	dir := filepath.Join(home, ".config", "systemd", "user")
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		dir = filepath.Join(xdg, "systemd", "user")
+	}
+	var quoted []string
+	for _, arg := range append([]string{executable}, daemonArgs()...) {
+		if strings.ContainsAny(arg, " \t\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted = append(quoted, arg)
+	}
+	command := strings.Join(quoted, " ")
+
+	units := map[string]string{}
+	unit := "kubed.service"
+	if *daemonTimer {
+		units["kubed.service"] = fmt.Sprintf(`[Unit]
+Description=Renew Kubernetes tokens with kubed
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, command)
+		units["kubed.timer"] = fmt.Sprintf(`[Unit]
+Description=Renew Kubernetes tokens with kubed every %s
+
+[Timer]
+OnStartupSec=1min
+OnUnitActiveSec=%s
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, *daemonInterval, systemdDuration(*daemonInterval))
+		unit = "kubed.timer"
+	} else {
+		units["kubed.service"] = fmt.Sprintf(`[Unit]
+Description=Renew Kubernetes tokens with kubed
+After=network-online.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+RestartSec=30
+
+[Install]
+WantedBy=default.target
+`, command)
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	for name, content := range units {
+		path := filepath.Join(dir, name)
+		err = writeFileConfirmed(ctx, path, content)
+		if err != nil {
+			return err
+		}
+		log.Info("Wrote ", path)
+	}
+
+	log.Info("Enable it with: systemctl --user daemon-reload && systemctl --user enable --now ", unit)
+	log.Info("To keep it running while you are logged out, also run: loginctl enable-linger")
+	return nil
+}
+
+func installLaunchdAgent(ctx context.Context, executable string) error {
+	const label = "no.uninett.kubed"
+	path := filepath.Join(home, "Library", "LaunchAgents", label+".plist")
+
+	var args bytes.Buffer
+	for _, arg := range append([]string{executable}, daemonArgs()...) {
+		fmt.Fprintf(&args, "\n    <string>%s</string>", xmlEscape(arg))
+	}
+	schedule := "<key>KeepAlive</key>\n  <true/>"
+	if *daemonTimer {
+		schedule = fmt.Sprintf("<key>StartInterval</key>\n  <integer>%d</integer>", int(daemonInterval.Seconds()))
+	}
+
+	plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>%s</string>
+  <key>ProgramArguments</key>
+  <array>%s
+  </array>
+  <key>RunAtLoad</key>
+  <true/>
+  %s
+  <key>StandardErrorPath</key>
+  <string>%s</string>
+</dict>
+</plist>
+`, label, args.String(), schedule, xmlEscape(filepath.Join(cacheDir(), "daemon.log")))
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	err = writeFileConfirmed(ctx, path, plist)
+	if err != nil {
+		return err
+	}
+	log.Info("Wrote ", path)
+	log.Info("Load it with: launchctl load -w ", path)
+	return nil
+}
+
+// installWindowsTask registers a scheduled task running the daemon when the
+// user logs in. Unlike a service it needs neither administrator rights nor
+// the password of the user.
+func installWindowsTask(ctx context.Context, executable string) error {
+	const task = "kubed"
+
+	if exec.Command("schtasks", "/Query", "/TN", task).Run() == nil && !*force {
+		ok, err := confirm(ctx, "Scheduled task "+task+" exists, replace it?", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("Not replacing scheduled task " + task)
+		}
+	}
+
+	// A timer task starts a single renewal round repeatedly instead
+	schedule := []string{"/SC", "ONLOGON"}
+	if *daemonTimer {
+		schedule = []string{"/SC", "MINUTE", "/MO", strconv.Itoa(int(daemonInterval.Minutes()))}
+	}
+
+	var command []string
+	for _, arg := range append([]string{executable}, daemonArgs()...) {
+		if strings.ContainsAny(arg, " \t") {
+			arg = `"` + arg + `"`
+		}
+		command = append(command, arg)
+	}
+
+	args := append([]string{"/Create", "/F", "/TN", task, "/TR", strings.Join(command, " "), "/RL", "LIMITED"}, schedule...)
+	out, err := exec.Command("schtasks", args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrap(err, "Failed in creating scheduled task: "+strings.TrimSpace(string(out)))
+	}
+
+	log.Info("Created scheduled task ", task, ", start it now with: schtasks /Run /TN ", task)
+	log.Info("Administrators can run the daemon as service instead: sc.exe create kubed binPath= \"", strings.Join(command, " "), "\"")
+	return nil
+}
+
+// writeFileConfirmed writes a file, asking first if it would replace another one
+func writeFileConfirmed(ctx context.Context, path string, content string) error {
+	if _, err := os.Stat(path); err == nil && !*force {
+		ok, err := confirm(ctx, fmt.Sprintf("%s exists, overwrite it?", path), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("Not overwriting " + path)
+		}
+	}
+	return ioutil.WriteFile(path, []byte(content), 0644)
+}
+
+// systemdDuration formats a duration the way systemd time spans are written
+func systemdDuration(d time.Duration) string {
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+// needInteraction fails fast when -non-interactive forbids asking the user
+// or opening a browser, with a hint on how to do without
+func needInteraction(what string, hint string) error {
+	if !*nonInteractive {
+		return nil
+	}
+	return withHint(withExitCode(exitUsage, fmt.Errorf("%s needs user interaction, but -non-interactive is given", what)), hint)
+}
@@ -0,0 +1,189 @@
+// Package segment renders the shell prompt segment of kubed. It is shared by
+// "kubed prompt" and the kubed-prompt binary, which leaves out client-go and
+// the rest of kubed so it starts fast enough to run for every prompt.
+package segment
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultFormat is the default template of the segment
+const DefaultFormat = "{{.Context}}{{if .Expiry}} {{.Expiry}}{{end}}"
+
+// StateFile is the name of the file in the kubed cache directory kubed
+// keeps the Clusters in, for kubed-prompt
+const StateFile = "prompt.yaml"
+
+// Colors of the segment by the time left of the token
+const (
+	Green  = "\x1b[32m"
+	Yellow = "\x1b[33m"
+	Red    = "\x1b[31m"
+	Reset  = "\x1b[0m"
+	// WarnBefore is when the segment turns yellow
+	WarnBefore = 30 * time.Minute
+)
+
+// Cluster is what the prompt knows of a cluster: the context names it goes
+// by and when its token expires
+type Cluster struct {
+	Names  []string  `yaml:"names"`
+	Expiry time.Time `yaml:"expiry"`
+}
+
+// State is what the format template gets
+type State struct {
+	Context   string
+	Namespace string
+	// Expiry is the time left of the token, like "42m", or "expired"
+	Expiry  string
+	Minutes int
+	left    time.Duration
+	known   bool
+}
+
+// Current reads the current context from the kubeconfig data and the expiry
+// of the cluster going by its name
+func Current(kubeConfig []byte, clusters []Cluster, now time.Time) (State, error) {
+	var state State
+	var config struct {
+		CurrentContext string `yaml:"current-context"`
+		Contexts       []struct {
+			Name    string `yaml:"name"`
+			Context struct {
+				Namespace string `yaml:"namespace"`
+			} `yaml:"context"`
+		} `yaml:"contexts"`
+	}
+	err := yaml.Unmarshal(kubeConfig, &config)
+	if err != nil {
+		return state, err
+	}
+	state.Context = config.CurrentContext
+	for _, c := range config.Contexts {
+		if c.Name == state.Context {
+			state.Namespace = c.Context.Namespace
+		}
+	}
+
+	for _, c := range clusters {
+		if !c.Expiry.IsZero() && hasName(c, state.Context) {
+			state.known = true
+			state.left = c.Expiry.Sub(now)
+			state.Minutes = int(state.left / time.Minute)
+			if state.left > 0 {
+				state.Expiry = formatLeft(state.left)
+			} else {
+				state.Expiry = "expired"
+			}
+		}
+	}
+	return state, nil
+}
+
+func hasName(c Cluster, name string) bool {
+	for _, n := range c.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// formatLeft is the time left like kubed list shows it
+func formatLeft(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
+
+// ValidShell checks the shell the segment is embedded in
+func ValidShell(shell string) error {
+	switch shell {
+	case "", "bash", "zsh":
+		return nil
+	}
+	return errors.Errorf("Unknown -prompt-shell %q, use bash or zsh", shell)
+}
+
+// Render expands the format for the state, colored by the time left when
+// color is set
+func Render(format string, state State, shell string, color bool) (string, error) {
+	t, err := template.New("prompt").Parse(format)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid -prompt-format")
+	}
+	var segment bytes.Buffer
+	err = t.Execute(&segment, state)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid -prompt-format")
+	}
+	if !color {
+		return segment.String(), nil
+	}
+	return Colorize(segment.String(), state, shell), nil
+}
+
+// Colorize wraps the segment in the color of the time left, with the escapes
+// marked as not taking space in the prompt of the shell
+func Colorize(segment string, state State, shell string) string {
+	if !state.known {
+		return segment
+	}
+	color := Green
+	switch {
+	case state.left <= 0:
+		color = Red
+	case state.left < WarnBefore:
+		color = Yellow
+	}
+	escape := func(code string) string {
+		switch shell {
+		case "bash":
+			return "\x01" + code + "\x02"
+		case "zsh":
+			return "%{" + code + "%}"
+		}
+		return code
+	}
+	return escape(color) + segment + escape(Reset)
+}
+
+// ReadClusters reads the clusters kubed wrote to filename
+func ReadClusters(filename string) ([]Cluster, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var clusters []Cluster
+	err = yaml.Unmarshal(data, &clusters)
+	return clusters, err
+}
+
+// WriteClusters keeps the clusters in filename for kubed-prompt. Only names
+// and expiry times go in the file, no tokens.
+func WriteClusters(filename string, clusters []Cluster) error {
+	data, err := yaml.Marshal(clusters)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
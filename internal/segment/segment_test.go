@@ -0,0 +1,39 @@
+package segment
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	now := time.Now()
+	kubeConfig := []byte(`
+current-context: course
+contexts:
+- name: course
+  context:
+    namespace: course-2019
+`)
+	clusters := []Cluster{{Names: []string{"lab", "course"}, Expiry: now.Add(20 * time.Minute)}}
+	state, err := Current(kubeConfig, clusters, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Context != "course" || state.Namespace != "course-2019" || state.Minutes != 20 {
+		t.Errorf("Unexpected prompt state %+v", state)
+	}
+
+	s, err := Render(DefaultFormat, state, "bash", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "\x01"+Yellow+"\x02course 20m\x01"+Reset+"\x02" {
+		t.Errorf("Expected yellow segment for bash, got %q", s)
+	}
+	if s := Colorize("other", State{Context: "other"}, ""); s != "other" {
+		t.Errorf("Expected no color for unknown expiry, got %q", s)
+	}
+	if _, err := Render("{{.Context", state, "", false); err == nil {
+		t.Error("Expected an error for an invalid format")
+	}
+}
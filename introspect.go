@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+// introspection is the answer of an introspection endpoint (RFC 7662). Only
+// Active is required, the rest is up to the provider.
+type introspection struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	Exp       int64       `json:"exp,omitempty"`
+	Iat       int64       `json:"iat,omitempty"`
+	Sub       string      `json:"sub,omitempty"`
+	Aud       interface{} `json:"aud,omitempty"`
+	Iss       string      `json:"iss,omitempty"`
+}
+
+// introspectToken asks the provider about an access or refresh token. Like
+// revocation, public clients identify themselves with client_id only.
+func introspectToken(ctx context.Context, introspectionURL string, token string, hint string, clientID string, clientSecret string) (*introspection, error) {
+	var result introspection
+
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", hint)
+	form.Set("client_id", clientID)
+
+	req := gorequest.New().Post(introspectionURL).Type("form")
+	if clientSecret != "" {
+		req = req.SetBasicAuth(clientID, clientSecret)
+	}
+	start := time.Now()
+	resp, err := endRequest(ctx, req.Send(form.Encode()), &result)
+	traceHTTP("POST", introspectionURL, start, resp, err)
+
+	if err != nil {
+		log.Debug("Failed in introspecting token ", err)
+		return nil, err[0]
+	}
+
+	if resp != nil && resp.StatusCode != 200 {
+		return nil, &statusError{"introspecting token", resp.StatusCode}
+	}
+	return &result, nil
+}
+
+// introspectCluster introspects the cached access token of the cluster
+func introspectCluster(ctx context.Context, cluster *Cluster) (*introspection, error) {
+	if cluster.IntrospectionURL == "" {
+		return nil, withExitCode(exitUsage, errors.Errorf("No introspection endpoint configured for %q, set it up with -introspection-url", cluster.Name))
+	}
+	cached, ok, err := readCachedToken(ctx, cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || cached.AccessToken == "" {
+		return nil, errors.Errorf("no access token for %q cached, log in to the cluster first", cluster.Name)
+	}
+	secret, err := readClientSecret(cluster.ClientSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in reading client secret")
+	}
+	return introspectToken(ctx, cluster.IntrospectionURL, cached.AccessToken, "access_token", cluster.ClientID, secret)
+}
+
+func introspectCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Give the name of the cluster to introspect the token of")
+	}
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	result, err := introspectCluster(ctx, cluster)
+	if err != nil {
+		return errors.Wrap(err, "Failed in introspecting token")
+	}
+
+	if *outputFormat == "json" {
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if !result.Active {
+		fmt.Printf("%-18s %s\n", "Active:", "no, revoked or expired at the provider")
+		return nil
+	}
+	fmt.Printf("%-18s %s\n", "Active:", "yes")
+	now := time.Now()
+	for _, field := range []struct {
+		title string
+		unix  int64
+	}{{"Issued at", result.Iat}, {"Expires", result.Exp}} {
+		if field.unix != 0 {
+			t := time.Unix(field.unix, 0)
+			fmt.Printf("%-18s %s (%s)\n", field.title+":", t.Format(time.RFC1123), formatRelative(t, now))
+		}
+	}
+	for _, field := range []struct{ title, value string }{
+		{"Subject", result.Sub}, {"Username", result.Username}, {"Client", result.ClientID},
+		{"Scope", result.Scope}, {"Token type", result.TokenType}, {"Issuer", result.Iss},
+	} {
+		if field.value != "" {
+			fmt.Printf("%-18s %s\n", field.title+":", field.value)
+		}
+	}
+	if result.Aud != nil {
+		fmt.Printf("%-18s %s\n", "Audience:", strings.Join(claimStrings(result.Aud), ", "))
+	}
+	return nil
+}
+
+// providerStatus tells what the provider says about the access token of the
+// cluster for kubed list: "active", "inactive" when revoked or expired at the
+// provider, "unknown" when it can't be asked, or "-" without an
+// introspection endpoint or a cached token
+func providerStatus(ctx context.Context, cluster *Cluster) string {
+	if cluster.IntrospectionURL == "" {
+		return "-"
+	}
+	if cached, ok, err := readCachedToken(ctx, cluster.Name); err != nil || !ok || cached.AccessToken == "" {
+		return "-"
+	}
+	result, err := introspectCluster(ctx, cluster)
+	switch {
+	case err != nil:
+		log.Warn("Failed in introspecting token of \"", cluster.Name, "\" ", err)
+		return "unknown"
+	case result.Active:
+		return "active"
+	}
+	return "inactive"
+}
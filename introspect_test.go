@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProviderStatusWithoutIntrospection(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	cluster := &Cluster{Name: "lab"}
+	if status := providerStatus(ctx, cluster); status != "-" {
+		t.Errorf("Expected no status without an introspection endpoint, got %q", status)
+	}
+	_, err := introspectCluster(ctx, cluster)
+	if exitCode(err) != exitUsage {
+		t.Errorf("Expected a usage error without an introspection endpoint, got %v", err)
+	}
+
+	cluster.IntrospectionURL = "https://auth.example.org/oauth/introspect"
+	if status := providerStatus(ctx, cluster); status != "-" {
+		t.Errorf("Expected no status without a cached token, got %q", status)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+// The tokens the issuers hand out are listed like kubelogin does, one file
+// per token under ~/.kube/cache/kubed/<issuer>/<client-id>/<cluster>.json,
+// where issuer is the host and path of the issuer URL. The files only tell
+// when the token was issued and expires, the token itself stays in the token
+// store of the cluster, encrypted if the store is.
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// issuedToken is the content of a file in the issued token cache
+type issuedToken struct {
+	Issuer   string    `json:"issuer"`
+	ClientID string    `json:"clientid"`
+	Cluster  string    `json:"cluster"`
+	IssuedAt time.Time `json:"issuedat"`
+	Expiry   time.Time `json:"expiry,omitempty"`
+}
+
+func init() {
+	commands["cache"] = &command{
+		usage: "cache [clear [cluster]]",
+		help:  "List the tokens cached in ~/.kube/cache/kubed, or clear them",
+		run:   cacheCommand,
+	}
+}
+
+func issuedCacheDir() string {
+	return filepath.Join(home, ".kube", "cache", "kubed")
+}
+
+func pathSegment(s string) string {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://")
+	s = strings.Trim(unsafePathChars.ReplaceAllString(s, "_"), "_")
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+func issuedTokenPath(cluster *Cluster) string {
+	return filepath.Join(issuedCacheDir(), pathSegment(cluster.IssuerURL), pathSegment(cluster.ClientID), pathSegment(cluster.Name)+".json")
+}
+
+// cacheIssuedToken records the JWT token the issuer of the cluster handed out
+func cacheIssuedToken(cluster *Cluster, token string) error {
+	if cluster.Ephemeral {
+		return nil
+	}
+	issued := issuedToken{
+		Issuer:   cluster.IssuerURL,
+		ClientID: cluster.ClientID,
+		Cluster:  cluster.Name,
+		IssuedAt: time.Now().UTC(),
+	}
+	if claims, err := auth.DecodeClaims(token); err == nil {
+		_, issued.Expiry = auth.TokenTimes(claims)
+	}
+	data, err := json.MarshalIndent(issued, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeDataFile(issuedTokenPath(cluster), data, 0600)
+}
+
+// readIssuedToken returns what is recorded about the JWT token of the cluster
+func readIssuedToken(cluster *Cluster) (issuedToken, bool) {
+	var issued issuedToken
+	data, err := ioutil.ReadFile(issuedTokenPath(cluster))
+	if err != nil || json.Unmarshal(data, &issued) != nil {
+		return issued, false
+	}
+	return issued, true
+}
+
+// issuedTokenFiles returns the files in the cache, of the cluster if name is given
+func issuedTokenFiles(name string) ([]string, error) {
+	pattern := "*"
+	if name != "" {
+		pattern = pathSegment(name)
+	}
+	return filepath.Glob(filepath.Join(issuedCacheDir(), "*", "*", pattern+".json"))
+}
+
+// removeIssuedTokens clears the cached JWT tokens of the cluster, or all of them
+func removeIssuedTokens(name string) error {
+	files, err := issuedTokenFiles(name)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// Leave no empty issuer and client id directories behind
+		os.Remove(filepath.Dir(f))
+		os.Remove(filepath.Dir(filepath.Dir(f)))
+	}
+	return nil
+}
+
+func cacheCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return listIssuedTokens()
+	}
+	if args[0] != "clear" || len(args) > 2 {
+		return withExitCode(exitUsage, errors.New("Unknown cache command, expected \"kubed cache\" or \"kubed cache clear [cluster]\""))
+	}
+
+	name := ""
+	if len(args) == 2 {
+		cluster, err := readConfig(args[1])
+		if err != nil {
+			return err
+		}
+		name = cluster.Name
+	}
+	err := removeIssuedTokens(name)
+	if err != nil {
+		return err
+	}
+	audit("cache-clear", name, "", "", issuedCacheDir())
+	if name == "" {
+		log.Info("Cleared the token cache in ", issuedCacheDir())
+	} else {
+		log.Info("Cleared the cached tokens of \"", name, "\"")
+	}
+	return nil
+}
+
+func listIssuedTokens() error {
+	files, err := issuedTokenFiles("")
+	if err != nil {
+		return err
+	}
+	t := newTable(os.Stdout, "CLUSTER", "ISSUER", "CLIENT ID", "ISSUED", "EXPIRES", "FILE")
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		var issued issuedToken
+		if err := json.Unmarshal(data, &issued); err != nil {
+			log.Warn("Failed in parsing cached token ", f, " ", err)
+			continue
+		}
+		t.row(issued.Cluster, issued.Issuer, issued.ClientID,
+			formatTime(issued.IssuedAt), formatExpiry(issued.Expiry, time.Now()), f)
+	}
+	return t.flush()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIssuedTokenCache(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	s, err := newSandbox("https://token.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.sign(s.claims("kubernetes", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := &Cluster{Name: "kubed", IssuerURL: "https://token.example.com/issuer", ClientID: "client-id"}
+	expected := filepath.Join(dir, ".kube", "cache", "kubed", "token.example.com_issuer", "client-id", "kubed.json")
+	if path := issuedTokenPath(cluster); path != expected {
+		t.Errorf("Expected cache file %s, got %s", expected, path)
+	}
+
+	if err := cacheIssuedToken(cluster, token); err != nil {
+		t.Fatal(err)
+	}
+	issued, ok := readIssuedToken(cluster)
+	if !ok || issued.Cluster != "kubed" || issued.Expiry.IsZero() {
+		t.Errorf("Expected the expiry of the token to be recorded, got %+v", issued)
+	}
+	if data, _ := ioutil.ReadFile(expected); strings.Contains(string(data), token) {
+		t.Errorf("Expected the token to stay in the token store, got %s", data)
+	}
+
+	other := &Cluster{Name: "other", IssuerURL: cluster.IssuerURL, ClientID: cluster.ClientID}
+	if err := cacheIssuedToken(other, token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeIssuedTokens("kubed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readIssuedToken(cluster); ok {
+		t.Errorf("Token was not removed")
+	}
+	if files, _ := issuedTokenFiles(""); len(files) != 1 {
+		t.Errorf("Expected the token of the other cluster to stay, got %v", files)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+// IssuerAPI describes how to talk to an issuer that differs from the kubed
+// issuer. Paths and body are templates, given the fields of issuerRequestData
+// escaped for where they end up: the path, the query, a JSON or a form body.
+type IssuerAPI struct {
+	TokenPath string `yaml:"tokenpath,omitempty"`
+	CAPath    string `yaml:"capath,omitempty"`
+	Method    string `yaml:"method,omitempty"`
+	Body      string `yaml:"body,omitempty"`
+}
+
+// issuerRequestData is available to the IssuerAPI templates
+type issuerRequestData struct {
+	AccessToken string
+	ClientID    string
+	Cluster     string
+	// TTL is the token lifetime requested with -token-ttl in seconds, 0 when
+	// not given
+	TTL int64
+}
+
+// newIssuerAPI returns nil when nothing differs from the kubed issuer,
+// so the field is left out of .kubedconf
+func newIssuerAPI(tokenPath string, caPath string, method string, body string) *IssuerAPI {
+	if tokenPath == "" && caPath == "" && method == "" && body == "" {
+		return nil
+	}
+	return &IssuerAPI{TokenPath: tokenPath, CAPath: caPath, Method: strings.ToUpper(method), Body: body}
+}
+
+// validIssuerAPI checks that the templates parse, before they are saved
+func validIssuerAPI(api *IssuerAPI) error {
+	if api == nil {
+		return nil
+	}
+	for _, path := range []string{api.TokenPath, api.CAPath} {
+		_, err := expandIssuerPath(path, issuerRequestData{})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := expandIssuerBody(api.Body, issuerRequestData{})
+	return err
+}
+
+// escaped has the strings of data escaped with escape
+func (data issuerRequestData) escaped(escape func(string) string) issuerRequestData {
+	data.AccessToken = escape(data.AccessToken)
+	data.ClientID = escape(data.ClientID)
+	data.Cluster = escape(data.Cluster)
+	return data
+}
+
+// expandIssuerPath expands a path template, escaping the values for the
+// path before the query and for the query after it
+func expandIssuerPath(text string, data issuerRequestData) (string, error) {
+	path, query := text, ""
+	if i := strings.Index(text, "?"); i >= 0 {
+		path, query = text[:i], text[i:]
+	}
+	path, err := expandIssuerTemplate(path, data.escaped(url.PathEscape))
+	if err != nil {
+		return "", err
+	}
+	query, err = expandIssuerTemplate(query, data.escaped(url.QueryEscape))
+	if err != nil {
+		return "", err
+	}
+	return path + query, nil
+}
+
+// expandIssuerBody expands a body template, escaping the values as JSON
+// strings in JSON bodies and as form values otherwise
+func expandIssuerBody(text string, data issuerRequestData) (string, error) {
+	if isJSONBody(text) {
+		return expandIssuerTemplate(text, data.escaped(jsonEscape))
+	}
+	return expandIssuerTemplate(text, data.escaped(url.QueryEscape))
+}
+
+func isJSONBody(text string) bool {
+	return strings.HasPrefix(strings.TrimSpace(text), "{")
+}
+
+// jsonEscape escapes s for the inside of a JSON string
+func jsonEscape(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted[1 : len(quoted)-1])
+}
+
+func expandIssuerTemplate(text string, data issuerRequestData) (string, error) {
+	t, err := template.New("issuer").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid issuer template")
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed in expanding issuer template")
+	}
+	return buf.String(), nil
+}
+
+// tokenRequest builds the request for the JWT token, by default a GET of
+// the issuer URL authenticated with the access token
+func (api *IssuerAPI) tokenRequest(issuerURL string, data issuerRequestData) (*gorequest.SuperAgent, string, error) {
+	if api == nil {
+		u := withTTL(issuerURL, data.TTL)
+		return gorequest.New().Get(u).Set("Authorization", "Bearer "+data.AccessToken), u, nil
+	}
+
+	path, err := expandIssuerPath(api.TokenPath, data)
+	if err != nil {
+		return nil, "", err
+	}
+	u := issuerURL + path
+	req := gorequest.New().CustomMethod(api.method(), u).Set("Authorization", "Bearer "+data.AccessToken)
+	if api.Body != "" {
+		body, err := expandIssuerBody(api.Body, data)
+		if err != nil {
+			return nil, "", err
+		}
+		// JSON bodies are sent as such, anything else as form
+		if isJSONBody(api.Body) {
+			req = req.Type("json")
+		} else {
+			req = req.Type("form")
+		}
+		req = req.SendString(body)
+	}
+	return req, u, nil
+}
+
+func (api *IssuerAPI) method() string {
+	if api == nil || api.Method == "" {
+		return "GET"
+	}
+	return api.Method
+}
+
+// caURL is where the issuer serves the cluster CA certificate
+func (api *IssuerAPI) caURL(issuerURL string, data issuerRequestData) (string, error) {
+	if api == nil || api.CAPath == "" {
+		return issuerURL + "/ca", nil
+	}
+	path, err := expandIssuerPath(api.CAPath, data)
+	if err != nil {
+		return "", err
+	}
+	return issuerURL + path, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestIssuerAPICAURL(t *testing.T) {
+	data := issuerRequestData{ClientID: "client-id", Cluster: "kubed"}
+
+	var tests = []struct {
+		description string
+		api         *IssuerAPI
+		expected    string
+	}{
+		{
+			description: "kubed issuer",
+			expected:    "https://token.example.com/ca",
+		},
+		{
+			description: "custom path",
+			api:         &IssuerAPI{CAPath: "/clusters/{{.Cluster}}/ca.json"},
+			expected:    "https://token.example.com/clusters/kubed/ca.json",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			u, err := test.api.caURL("https://token.example.com", data)
+			if err != nil {
+				t.Fatalf("Got unexpected error: %s", err)
+			}
+			if u != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, u)
+			}
+		})
+	}
+}
+
+func TestValidIssuerAPI(t *testing.T) {
+	if err := validIssuerAPI(&IssuerAPI{Body: `{"token":"{{.AccessToken}}"}`}); err != nil {
+		t.Errorf("Got unexpected error: %s", err)
+	}
+	if err := validIssuerAPI(&IssuerAPI{TokenPath: "/{{.Cluster"}); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
+
+func TestIssuerTemplatesEscape(t *testing.T) {
+	data := issuerRequestData{AccessToken: `a/b+c"d`, Cluster: "lab one"}
+
+	path, err := expandIssuerPath("/token/{{.Cluster}}?access_token={{.AccessToken}}", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/token/lab%20one?access_token=a%2Fb%2Bc%22d"; path != expected {
+		t.Errorf("Expected %s, got %s", expected, path)
+	}
+
+	body, err := expandIssuerBody(`{"token":"{{.AccessToken}}"}`, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"token":"a/b+c\"d"}`; body != expected {
+		t.Errorf("Expected %s, got %s", expected, body)
+	}
+
+	body, err = expandIssuerBody("token={{.AccessToken}}&cluster={{.Cluster}}", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "token=a%2Fb%2Bc%22d&cluster=lab+one"; body != expected {
+		t.Errorf("Expected %s, got %s", expected, body)
+	}
+}
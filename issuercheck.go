@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+// checkIssuerUp probes the endpoints of the issuer before the user logs in
+// with the provider, so an issuer that is down fails the login right away
+// instead of after authenticating in the browser. Any answer below 500 will
+// do, the endpoints are not meant for HEAD requests without a token. A CA
+// endpoint that is down doesn't stop the login when a CA is cached.
+func checkIssuerUp(ctx context.Context, cluster *Cluster) error {
+	if *skipIssuerCheck {
+		return nil
+	}
+	urls, err := issuerProbeURLs(cluster)
+	if err != nil {
+		return err
+	}
+	for i, u := range urls {
+		err := probeIssuer(ctx, cluster, u)
+		// After the token endpoint only the CA endpoint is probed
+		if err != nil && i > 0 && cachedCA(cluster) != nil {
+			log.Warn("CA endpoint of the issuer is down, the cached CA certificate will be used ", err)
+			continue
+		}
+		if err != nil {
+			return withExitCode(exitIssuerUnreachable, errors.Wrapf(err, "Issuer of %q is down, not logging in", cluster.Name))
+		}
+	}
+	return nil
+}
+
+// issuerProbeURLs are the health URL of the issuer if it has one, otherwise
+// the token endpoint and, for issuers serving it, the CA endpoint
+func issuerProbeURLs(cluster *Cluster) ([]string, error) {
+	if cluster.IssuerHealthURL != "" {
+		return []string{cluster.IssuerHealthURL}, nil
+	}
+	urls := []string{cluster.IssuerURL}
+	if !cluster.TokenExchange && !cluster.IssuerKubeConfig {
+		caURL, err := cluster.IssuerAPI.caURL(cluster.IssuerURL, issuerData(cluster, ""))
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, caURL)
+	}
+	return urls, nil
+}
+
+// probeIssuer sends a HEAD request to the issuer endpoint u, the health URL
+// must answer with success
+func probeIssuer(ctx context.Context, cluster *Cluster, u string) error {
+	req, err := prepareIssuerRequest(gorequest.New().Head(u), cluster)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	resp, errs := endRequest(ctx, req, nil)
+	traceHTTP("HEAD", u, start, resp, errs)
+	switch {
+	case len(errs) > 0:
+		return errs[0]
+	case resp == nil:
+		return nil
+	case u == cluster.IssuerHealthURL && resp.StatusCode >= 300:
+		return &statusError{"probing " + u, resp.StatusCode}
+	case resp.StatusCode >= 500:
+		return &statusError{"probing " + u, resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIssuerProbeURLs(t *testing.T) {
+	var tests = []struct {
+		description string
+		cluster     Cluster
+		urls        []string
+	}{
+		{"kubed issuer", Cluster{IssuerURL: "https://issuer.example.com"}, []string{"https://issuer.example.com", "https://issuer.example.com/ca"}},
+		{"token exchange", Cluster{IssuerURL: "https://sts.example.com/token", TokenExchange: true}, []string{"https://sts.example.com/token"}},
+		{"custom CA path", Cluster{IssuerURL: "https://issuer.example.com", IssuerAPI: &IssuerAPI{CAPath: "/v1/{{.Cluster}}/ca"}, Name: "lab"}, []string{"https://issuer.example.com", "https://issuer.example.com/v1/lab/ca"}},
+		{"health URL", Cluster{IssuerURL: "https://issuer.example.com", IssuerHealthURL: "https://issuer.example.com/healthz"}, []string{"https://issuer.example.com/healthz"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			urls, err := issuerProbeURLs(&test.cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(urls, test.urls) {
+				t.Errorf("Expected %v, got %v", test.urls, urls)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+// stringList collects repeated flags like -issuer-header
+type stringList []string
+
+func (h *stringList) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *stringList) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+var issuerHeaderFlags, asGroups stringList
+
+func init() {
+	flag.Var(&issuerHeaderFlags, "issuer-header", "Extra header on issuer requests as \"Name: value\", the value may be \"env:NAME\" or \"file:PATH\" (repeatable)")
+	flag.Var(&asGroups, "as-group", "Group the context impersonates, used with -as-user (repeatable)")
+}
+
+// parseHeaders turns "Name: value" flags into a header map
+func parseHeaders(headers []string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	parsed := map[string]string{}
+	for _, h := range headers {
+		i := strings.Index(h, ":")
+		if i <= 0 {
+			return nil, errors.Errorf("Header %q is not given as \"Name: value\"", h)
+		}
+		parsed[strings.TrimSpace(h[:i])] = strings.TrimSpace(h[i+1:])
+	}
+	return parsed, nil
+}
+
+// headerValue resolves values given as "env:NAME" or "file:PATH", others are used as is
+func headerValue(value string) (string, error) {
+	if strings.HasPrefix(value, "env:") || strings.HasPrefix(value, "file:") {
+		return readClientSecret(value)
+	}
+	return value, nil
+}
+
+// prepareIssuerRequest adds the extra headers and client certificate of the
+// cluster, for issuers deployed behind authenticating gateways or requiring mTLS.
+// Headers are set last, so they may replace the Authorization header when the
+// access token is sent in the body instead.
+func prepareIssuerRequest(req *gorequest.SuperAgent, cluster *Cluster) (*gorequest.SuperAgent, error) {
+	config, err := issuerTLSConfig(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		req = req.TLSClientConfig(config)
+	}
+	// While "kubed tunnel" runs, the issuer is reached through the bastion too
+	if cluster.TunnelProxy != "" {
+		req = req.Proxy(cluster.TunnelProxy)
+	}
+	for name, value := range cluster.IssuerHeaders {
+		v, err := headerValue(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed in reading value of header "+name)
+		}
+		req = req.Set(name, v)
+	}
+	return req, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// issuedEntries is a kubeconfig an issuer handed out, with the names of the
+// cluster and user of its context, to be merged into kubeconfig
+type issuedEntries struct {
+	data    []byte
+	cluster string
+	user    string
+}
+
+// getKubeConfigFragment downloads the kubeconfig an issuer hands out instead
+// of a JWT, returning it decoded and as it is
+func getKubeConfigFragment(ctx context.Context, accessToken string, cluster *Cluster) (*api.Config, []byte, error) {
+	var data []byte
+
+	req, fragmentURL, reqErr := cluster.IssuerAPI.tokenRequest(cluster.IssuerURL, issuerData(cluster, accessToken))
+	if reqErr == nil {
+		req, reqErr = prepareIssuerRequest(req, cluster)
+	}
+	if reqErr != nil {
+		return nil, nil, reqErr
+	}
+	start := time.Now()
+	resp, err := endRequest(ctx, req, &data)
+	traceHTTP(cluster.IssuerAPI.method(), fragmentURL, start, resp, err)
+
+	if err != nil {
+		log.Warn("Failed in fetching kubeconfig ", err)
+		return nil, nil, err[0]
+	}
+
+	if resp != nil && resp.StatusCode != 200 && resp.StatusCode != 201 {
+		log.Warn("Failed in fetching kubeconfig, responsecode: ", resp.StatusCode)
+		return nil, nil, &statusError{"fetching kubeconfig", resp.StatusCode}
+	}
+
+	fragment, decodeErr := kubeconfig.Decode(data)
+	if decodeErr != nil {
+		return nil, nil, errors.Wrap(decodeErr, "Issuer returned an invalid kubeconfig")
+	}
+	return fragment, data, nil
+}
+
+// fragmentContext picks the context of the fragment to use, the current
+// one or else the only one
+func fragmentContext(fragment *api.Config) (*api.Context, error) {
+	if context, ok := fragment.Contexts[fragment.CurrentContext]; ok {
+		return context, nil
+	}
+	if len(fragment.Contexts) == 1 {
+		for _, context := range fragment.Contexts {
+			return context, nil
+		}
+	}
+	return nil, errors.Errorf("Kubeconfig from issuer has %d contexts and none is current, can't tell which to use", len(fragment.Contexts))
+}
+
+// kubeConfigCredentials takes the token, CA and API server from the fragment.
+// They are written under the cluster name like any other login, so a fragment
+// naming its entries differently doesn't clash with the rest of kubeconfig.
+// The other fields of its cluster and user, like client certificates or exec
+// plugins, are merged in when kubeconfig is written.
+func kubeConfigCredentials(ctx context.Context, cluster *Cluster, accessToken string) (string, []byte, error) {
+	var fragment *api.Config
+	var data []byte
+	err := withRetry(ctx, "fetching kubeconfig", *retryAttempts, *retryBackoff, func() error {
+		var err error
+		fragment, data, err = getKubeConfigFragment(ctx, accessToken, cluster)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	context, err := fragmentContext(fragment)
+	if err != nil {
+		return "", nil, err
+	}
+	user, ok := fragment.AuthInfos[context.AuthInfo]
+	if !ok {
+		return "", nil, errors.Errorf("Kubeconfig from issuer has no user %q", context.AuthInfo)
+	}
+	if user.Token == "" && cluster.ExecCredential {
+		return "", nil, errors.Errorf("Kubeconfig from issuer has no token for user %q, which kubed exec-credential needs", context.AuthInfo)
+	}
+	cluster.issued = &issuedEntries{data: data, cluster: context.Cluster, user: context.AuthInfo}
+
+	var caData []byte
+	if c, ok := fragment.Clusters[context.Cluster]; ok && len(c.CertificateAuthorityData) > 0 {
+		caData, err = parseCABundle(c.CertificateAuthorityData)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "Kubeconfig from issuer has an invalid CA")
+		}
+	}
+	if c, ok := fragment.Clusters[context.Cluster]; ok {
+		if c.Server != "" && c.Server != cluster.APIServer {
+			log.Info("Using API server ", c.Server, " from the issuer kubeconfig")
+			cluster.APIServer = c.Server
+		}
+	}
+	if cluster.NameSpace == "" {
+		cluster.NameSpace = context.Namespace
+	}
+	return user.Token, caData, nil
+}
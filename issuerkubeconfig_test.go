@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+var kubeConfigFragment = []byte(`
+apiVersion: v1
+kind: Config
+clusters:
+- name: uni-cluster
+  cluster:
+    server: https://k8s.example.org:6443
+contexts:
+- name: uni
+  context:
+    cluster: uni-cluster
+    user: uni-user
+    namespace: research
+users:
+- name: uni-user
+  user:
+    token: issued-token
+`)
+
+func TestFragmentContext(t *testing.T) {
+	fragment, err := kubeconfig.Decode(kubeConfigFragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	context, err := fragmentContext(fragment)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if context.AuthInfo != "uni-user" || context.Namespace != "research" {
+		t.Errorf("Got wrong context %+v", context)
+	}
+
+	fragment.Contexts["other"] = context
+	if _, err := fragmentContext(fragment); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+)
+
+// issuerTLSConfig loads the client certificate presented to the issuer,
+// returning nil when the cluster has none configured
+func issuerTLSConfig(cluster *Cluster) (*tls.Config, error) {
+	if cluster.IssuerClientCert == "" && cluster.IssuerClientKey == "" {
+		return nil, nil
+	}
+	if cluster.IssuerClientCert == "" || cluster.IssuerClientKey == "" {
+		return nil, errors.New("Both -issuer-client-cert and -issuer-client-key are needed for mTLS with the issuer")
+	}
+
+	cert, err := tls.LoadX509KeyPair(expandHome(cluster.IssuerClientCert), expandHome(cluster.IssuerClientKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in loading issuer client certificate")
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
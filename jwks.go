@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // hash implementations used by the signing algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+// jwk is a public key as published in a JSON Web Key Set (RFC 7517)
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type openIDConfiguration struct {
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// jwksURL finds the key set of the issuer through OpenID Connect discovery,
+// falling back to <issuer>/jwks
+func jwksURL(ctx context.Context, issuerURL string) string {
+	issuerURL = strings.TrimRight(issuerURL, "/")
+	var conf openIDConfiguration
+	url := issuerURL + "/.well-known/openid-configuration"
+
+	start := time.Now()
+	resp, errs := endRequest(ctx, gorequest.New().Get(url), &conf)
+	traceHTTP("GET", url, start, resp, errs)
+	if len(errs) == 0 && resp != nil && resp.StatusCode == 200 && conf.JWKSURI != "" {
+		return conf.JWKSURI
+	}
+	return issuerURL + "/jwks"
+}
+
+func getJWKS(ctx context.Context, issuerURL string) (*jwks, error) {
+	var keys jwks
+	url := jwksURL(ctx, issuerURL)
+
+	start := time.Now()
+	resp, errs := endRequest(ctx, gorequest.New().Get(url), &keys)
+	traceHTTP("GET", url, start, resp, errs)
+
+	if len(errs) > 0 {
+		log.Warn("Failed in fetching JWKS ", errs[0])
+		return nil, errs[0]
+	}
+	if resp != nil && resp.StatusCode != 200 {
+		log.Warn("Failed in fetching JWKS, responsecode: ", resp.StatusCode)
+		return nil, &statusError{"fetching JWKS", resp.StatusCode}
+	}
+	return &keys, nil
+}
+
+// verifySignature checks the token signature against the keys of the issuer
+func verifySignature(ctx context.Context, token string, issuerURL string) error {
+	header, err := auth.DecodeHeader(token)
+	if err != nil {
+		return err
+	}
+	alg, _ := header["alg"].(string)
+	kid, _ := header["kid"].(string)
+
+	keys, err := getJWKS(ctx, issuerURL)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return errors.Wrap(err, "Error decoding token signature")
+	}
+
+	for _, key := range keys.Keys {
+		if kid != "" && key.Kid != kid {
+			continue
+		}
+		err = verifyWithKey(alg, key, parts[0]+"."+parts[1], signature)
+		if err == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return errors.Errorf("No key with id %q found in the issuer JWKS", kid)
+}
+
+func verifyWithKey(alg string, key jwk, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return errors.Errorf("Unsupported signing algorithm %q", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return errors.Errorf("Unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS") && key.Kty == "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return err
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return err
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		return errors.Wrap(rsa.VerifyPKCS1v15(pub, hash, digest, signature), "Invalid token signature")
+
+	case strings.HasPrefix(alg, "ES") && key.Kty == "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[key.Crv]
+		if !ok {
+			return errors.Errorf("Unsupported curve %q", key.Crv)
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return err
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return err
+		}
+		size := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, digest, r, s) {
+			return errors.New("Invalid token signature")
+		}
+		return nil
+	}
+	return errors.Errorf("Unsupported signing algorithm %q for key type %q", alg, key.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error decoding JWKS key")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+func TestVerifyWithKey(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := jwk{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+	}
+
+	signed := "header.payload"
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyWithKey("RS256", key, signed, signature); err != nil {
+		t.Errorf("Got unexpected error: %s", err)
+	}
+	if err := verifyWithKey("RS256", key, "header.tampered", signature); err == nil {
+		t.Errorf("Expected error for tampered token but got none")
+	}
+	if err := verifyWithKey("none", key, signed, signature); err == nil {
+		t.Errorf("Expected error for unsupported algorithm but got none")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// separateKubeConfigDir holds the kubeconfig files of clusters that have
+// their own, see -separate-kubeconfig
+const separateKubeConfigDir = "~/.kube/kubed"
+
+// setKubeConfigs sets the kubeconfig files of the cluster from a -kube-config
+// value, which lists the files like KUBECONFIG does, e.g.
+// "~/.kube/config:./.kube/config" on Linux. kubed reads from the first file,
+// and writes logins to all of them. The context files of kubed env are
+// skipped, they only pick the context of a terminal.
+func setKubeConfigs(cluster *Cluster, value string) {
+	var files []string
+	for _, f := range filepath.SplitList(value) {
+		if f = strings.TrimSpace(f); f != "" && !isContextFile(f) {
+			files = append(files, f)
+		}
+	}
+	cluster.KubeConfig, cluster.ExtraKubeConfigs = "", nil
+	if len(files) > 0 {
+		cluster.KubeConfig, cluster.ExtraKubeConfigs = files[0], files[1:]
+	}
+	if len(cluster.ExtraKubeConfigs) == 0 {
+		cluster.ExtraKubeConfigs = nil
+	}
+}
+
+// kubeConfigFiles are the kubeconfig files the cluster is written to, the
+// first one is read from
+func kubeConfigFiles(cluster *Cluster) []string {
+	files := []string{expandHome(cluster.KubeConfig)}
+	for _, f := range cluster.ExtraKubeConfigs {
+		if f = expandHome(f); f != files[0] {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// separateKubeConfig is the own kubeconfig file of the cluster with the name
+func separateKubeConfig(name string) string {
+	return separateKubeConfigDir + "/" + name + ".yaml"
+}
+
+// wantSeparateKubeConfig tells whether new clusters get their own kubeconfig
+// file, with -separate-kubeconfig or for all clusters in the kubed config
+func wantSeparateKubeConfig() bool {
+	if *separateKubeConfigFlag {
+		return true
+	}
+	conf, err := readKubedConfig()
+	return err == nil && conf.SeparateKubeConfigs
+}
+
+// hasSeparateKubeConfig tells whether the cluster is written to its own file
+func hasSeparateKubeConfig(cluster *Cluster) bool {
+	return expandHome(cluster.KubeConfig) == expandHome(separateKubeConfig(cluster.Name))
+}
+
+// renameSeparateKubeConfig moves the own kubeconfig file of the cluster
+// along with a new name, returning the new file
+func renameSeparateKubeConfig(cluster *Cluster, newName string) (string, error) {
+	newFile := separateKubeConfig(newName)
+	err := os.Rename(expandHome(cluster.KubeConfig), expandHome(newFile))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return newFile, err
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetKubeConfigs(t *testing.T) {
+	cluster := &Cluster{}
+	setKubeConfigs(cluster, strings.Join([]string{"/home/a/.kube/config", "", "/work/project/.kube/config"}, string(filepath.ListSeparator)))
+	if cluster.KubeConfig != "/home/a/.kube/config" {
+		t.Errorf("Expected first file to be read from, got %q", cluster.KubeConfig)
+	}
+	if !reflect.DeepEqual(cluster.ExtraKubeConfigs, []string{"/work/project/.kube/config"}) {
+		t.Errorf("Unexpected extra kubeconfigs %v", cluster.ExtraKubeConfigs)
+	}
+
+	setKubeConfigs(cluster, "/home/a/.kube/config")
+	if cluster.ExtraKubeConfigs != nil {
+		t.Errorf("Extra kubeconfigs were kept: %v", cluster.ExtraKubeConfigs)
+	}
+}
+
+func TestKubeConfigFilesSkipsDuplicates(t *testing.T) {
+	cluster := &Cluster{KubeConfig: "/a/config", ExtraKubeConfigs: []string{"/a/config", "/b/config"}}
+	files := kubeConfigFiles(cluster)
+	if !reflect.DeepEqual(files, []string{"/a/config", "/b/config"}) {
+		t.Errorf("Unexpected files %v", files)
+	}
+}
@@ -1,48 +1,220 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"io/ioutil"
-	"path/filepath"
+	"os"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 )
 
-// Cluster structure to setup kubeconfig
+// kubedConfVersion is the version of the kubed config file format written by
+// this release. Version 0 is the legacy format, a plain list of clusters.
+const kubedConfVersion = 1
+
+// KubedConfig is the content of the kubed config file. EncryptCache is
+// gpg:RECIPIENT or age:RECIPIENT to encrypt the token cache and the kubed
+// config with. Groups name clusters logged in to together, see "kubed group".
+// NoUpdateCheck turns off the notice about new kubed releases.
+// SeparateKubeConfigs gives new clusters their own kubeconfig file, like
+// -separate-kubeconfig. Naming has the naming templates of clusters that
+// don't have their own.
+type KubedConfig struct {
+	Version             int                 `yaml:"version"`
+	PreHook             string              `yaml:"prehook,omitempty"`
+	PostHook            string              `yaml:"posthook,omitempty"`
+	EncryptCache        string              `yaml:"encryptcache,omitempty"`
+	Clusters            []Cluster           `yaml:"clusters"`
+	Groups              map[string][]string `yaml:"groups,omitempty"`
+	NoUpdateCheck       bool                `yaml:"noupdatecheck,omitempty"`
+	SeparateKubeConfigs bool                `yaml:"separatekubeconfigs,omitempty"`
+	Naming              *NamingTemplates    `yaml:"naming,omitempty"`
+}
+
+// Cluster structure to setup kubeconfig. Ephemeral logins, see "kubed shell",
+// leave no tokens behind. issued is the kubeconfig the issuer handed out in
+// this login, if any, and userinfo the claims of the provider for naming.
 type Cluster struct {
-	Name        string `yaml:"name"`
-	APIServer   string `yaml:"apiserver"`
-	IssuerURL   string `yaml:"issuer"`
-	ClientID    string `yaml:"clientid"`
-	KubeConfig  string `yaml:"kubeconfig"`
-	KeepContext bool   `yaml:"keepcontext"`
-	Port        int    `yaml:"port"`
-	NameSpace   string `yaml:"namespace"`
-	ManualInput bool   `yaml:"manualinput"`
+	Name               string            `yaml:"name"`
+	APIServer          string            `yaml:"apiserver"`
+	IssuerURL          string            `yaml:"issuer"`
+	ClientID           string            `yaml:"clientid"`
+	ClientSecret       string            `yaml:"clientsecret,omitempty"`
+	KubeConfig         string            `yaml:"kubeconfig"`
+	ExtraKubeConfigs   []string          `yaml:"extrakubeconfigs,omitempty"`
+	KeepContext        bool              `yaml:"keepcontext"`
+	Port               int               `yaml:"port"`
+	NameSpace          string            `yaml:"namespace"`
+	ManualInput        bool              `yaml:"manualinput"`
+	LoginHint          string            `yaml:"loginhint,omitempty"`
+	Prompt             string            `yaml:"prompt,omitempty"`
+	ACRValues          string            `yaml:"acrvalues,omitempty"`
+	Scopes             string            `yaml:"scopes,omitempty"`
+	RevocationURL      string            `yaml:"revocationurl,omitempty"`
+	IntrospectionURL   string            `yaml:"introspectionurl,omitempty"`
+	ProviderURL        string            `yaml:"provider,omitempty"`
+	ResponseMode       string            `yaml:"responsemode,omitempty"`
+	HTTPSCallback      bool              `yaml:"httpscallback,omitempty"`
+	TokenExchange      bool              `yaml:"tokenexchange,omitempty"`
+	TokenAudience      string            `yaml:"tokenaudience,omitempty"`
+	ExpectedAudience   string            `yaml:"expectedaudience,omitempty"`
+	TokenTTL           string            `yaml:"tokenttl,omitempty"`
+	RBACMapping        string            `yaml:"rbacmapping,omitempty"`
+	IssuerAPI          *IssuerAPI        `yaml:"issuerapi,omitempty"`
+	IssuerHeaders      map[string]string `yaml:"issuerheaders,omitempty"`
+	IssuerClientCert   string            `yaml:"issuerclientcert,omitempty"`
+	IssuerClientKey    string            `yaml:"issuerclientkey,omitempty"`
+	IssuerKubeConfig   bool              `yaml:"issuerkubeconfig,omitempty"`
+	IssuerHealthURL    string            `yaml:"issuerhealthurl,omitempty"`
+	SilentReauth       bool              `yaml:"silentreauth,omitempty"`
+	SecretBackend      string            `yaml:"secretbackend,omitempty"`
+	SecretPath         string            `yaml:"secretpath,omitempty"`
+	SecretCommands     *SecretCommands   `yaml:"secretcommands,omitempty"`
+	ProxyURL           string            `yaml:"proxyurl,omitempty"`
+	Tunnel             *TunnelConfig     `yaml:"tunnel,omitempty"`
+	TunnelAddress      string            `yaml:"tunneladdress,omitempty"`
+	TunnelProxy        string            `yaml:"tunnelproxy,omitempty"`
+	AsUser             string            `yaml:"asuser,omitempty"`
+	AsGroups           []string          `yaml:"asgroups,omitempty"`
+	ClientCertificate  bool              `yaml:"clientcertificate,omitempty"`
+	GroupNamespaces    []GroupNamespace  `yaml:"groupnamespaces,omitempty"`
+	ExtraNamespaces    []string          `yaml:"extranamespaces,omitempty"`
+	Aliases            []string          `yaml:"aliases,omitempty"`
+	Naming             *NamingTemplates  `yaml:"naming,omitempty"`
+	Entries            *KubeEntries      `yaml:"entries,omitempty"`
+	CreatedAt          time.Time         `yaml:"createdat,omitempty"`
+	UpdatedAt          time.Time         `yaml:"updatedat,omitempty"`
+	LastRenewedAt      time.Time         `yaml:"lastrenewedat,omitempty"`
+	TokenExpiry        time.Time         `yaml:"tokenexpiry,omitempty"`
+	GrantedTTL         string            `yaml:"grantedttl,omitempty"`
+	CAData             string            `yaml:"cadata,omitempty"`
+	CAFingerprint      string            `yaml:"cafingerprint,omitempty"`
+	ManagedKubeConfigs []string          `yaml:"managedkubeconfigs,omitempty"`
+	AuthProvider       bool              `yaml:"authprovider,omitempty"`
+	ExecCredential     bool              `yaml:"execcredential,omitempty"`
+	PreHook            string            `yaml:"prehook,omitempty"`
+	PostHook           string            `yaml:"posthook,omitempty"`
+	Ephemeral          bool              `yaml:"-"`
+	issued             *issuedEntries
+	userinfo           *providerUserinfo
 }
 
-func readConfig(name string) (*Cluster, error) {
-	path := filepath.Join(home, kubedConf)
+// readKubedConfig reads the kubed config file, migrating it from the legacy
+// format if needed. A missing file gives an empty config.
+func readKubedConfig() (*KubedConfig, error) {
+	path := kubedConfPath()
+	conf := &KubedConfig{Version: kubedConfVersion}
+
 	confBytes, err := ioutil.ReadFile(path)
-	if err != nil {
+	if os.IsNotExist(err) {
+		return conf, nil
+	} else if err != nil {
 		log.Warn("Failed in reading kubed config file ", err)
 		return nil, err
 	}
+	confBytes, err = decryptCache(confBytes)
+	if err != nil {
+		log.Warn("Failed in decrypting kubed config file ", err)
+		return nil, err
+	}
 
+	err = yaml.Unmarshal(confBytes, conf)
+	if err == nil {
+		if conf.Version > kubedConfVersion {
+			return nil, fmt.Errorf("Kubed config file has version %d, this kubed only supports up to version %d, please upgrade kubed", conf.Version, kubedConfVersion)
+		}
+		return conf, nil
+	}
+
+	// Legacy config files are a plain list of clusters
 	var clusters []Cluster
-	err = yaml.Unmarshal(confBytes, &clusters)
-	if err != nil {
+	if yaml.Unmarshal(confBytes, &clusters) != nil {
 		log.Error("Failed in parsing config file ", err)
+		return nil, err
+	}
+	return migrateKubedConfig(confBytes, clusters)
+}
+
+// migrateKubedConfig converts a legacy config file to the current version,
+// keeping a copy of the original next to it
+func migrateKubedConfig(legacy []byte, clusters []Cluster) (*KubedConfig, error) {
+	path := kubedConfPath()
+
+	err := writeDataFile(path+".legacy", legacy, 0600)
+	if err != nil {
+		log.Warn("Failed in saving copy of legacy kubed config ", err)
+		return nil, err
+	}
+
+	conf := &KubedConfig{Version: kubedConfVersion, Clusters: clusters}
+	err = writeKubedConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Migrated kubed config to version ", kubedConfVersion, ", the old file is kept in ", path+".legacy")
+	return conf, nil
+}
+
+func writeKubedConfig(conf *KubedConfig) error {
+	path := kubedConfPath()
+	conf.Version = kubedConfVersion
+
+	confBytes, err := yaml.Marshal(conf)
+	if err != nil {
+		log.Warn("Failed in marshaling kubedconfig ", err)
+		return err
+	}
+	// Encrypted like the token cache when configured
+	confBytes, err = encryptFor(conf.EncryptCache, confBytes)
+	if err != nil {
+		log.Warn("Failed in encrypting kubedconfig ", err)
+		return err
+	}
+
+	// Issuer headers and client secrets may be given in the config itself.
+	// Replaced rather than rewritten, kubed running at the same time must not
+	// read a partly written file as a config without clusters.
+	err = replaceDataFile(path, confBytes, 0600)
+	if err != nil {
+		log.Warn("Failed in saving kubedconfig ", err)
+		return err
+	}
+	writePromptState(conf)
+	return nil
+}
+
+// readClusters returns all clusters saved in the kubed config file
+func readClusters() ([]Cluster, error) {
+	conf, err := readKubedConfig()
+	if err != nil {
+		return nil, err
+	}
+	return conf.Clusters, nil
+}
+
+func readConfig(name string) (*Cluster, error) {
+	clusters, err := readClusters()
+	if err != nil {
+		return nil, err
 	}
 
+	// A cluster name wins over an alias of another cluster
 	for _, c := range clusters {
 		if c.Name == name {
-			return &c, nil
+			return dropStaleTunnel(&c), nil
+		}
+	}
+	for _, c := range clusters {
+		if c.matches(name) {
+			return dropStaleTunnel(&c), nil
 		}
 	}
 
-	return nil, errors.New("Provided cluster not found, run with full config parameters to configure it")
+	return nil, unknownCluster(name, clusters)
 }
 
 func setConfig(
@@ -50,66 +222,135 @@ func setConfig(
 	apiserver string,
 	issuerURL string,
 	clientID string,
+	clientSecret string,
 	kubeconfig string,
 	keepContext bool,
 	port int,
 	namespace string,
-	manualInput bool) *Cluster {
-
-	return &Cluster{
-		Name:        name,
-		APIServer:   apiserver,
-		IssuerURL:   issuerURL,
-		ClientID:    clientID,
-		KubeConfig:  kubeconfig,
-		KeepContext: keepContext,
-		Port:        port,
-		NameSpace:   namespace,
-		ManualInput: manualInput,
+	manualInput bool,
+	loginHint string,
+	prompt string,
+	acrValues string,
+	revocationURL string) *Cluster {
+
+	cluster := &Cluster{
+		Name:          name,
+		APIServer:     apiserver,
+		IssuerURL:     issuerURL,
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		KeepContext:   keepContext,
+		Port:          port,
+		NameSpace:     namespace,
+		ManualInput:   manualInput,
+		LoginHint:     loginHint,
+		Prompt:        prompt,
+		ACRValues:     acrValues,
+		RevocationURL: revocationURL,
 	}
+	setKubeConfigs(cluster, kubeconfig)
+	return cluster
 }
 
-func saveConfig(cluster *Cluster) error {
-	path := filepath.Join(home, kubedConf)
-
-	var clusters []Cluster
+// updateKubedConfig applies fn to the kubed config and saves it when fn tells
+// it changed. The config holds all clusters, so the lock next to it is held
+// throughout, or kubed processes renewing different clusters at once would
+// lose each other's changes.
+func updateKubedConfig(fn func(conf *KubedConfig) (bool, error)) error {
+	lock, _, err := takeLock(context.Background(), kubedConfPath()+".lock", "updating the kubed config")
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
 
-	oldConfBytes, err := ioutil.ReadFile(path)
-	if err == nil {
-		err = yaml.Unmarshal(oldConfBytes, &clusters)
-		if err != nil {
-			log.Error("Failed in parsing config file ", err)
-			clusters = nil
-		}
+	// A config that can't be read is not replaced, that would lose all other clusters
+	conf, err := readKubedConfig()
+	if err != nil {
+		return err
 	}
+	changed, err := fn(conf)
+	if err != nil || !changed {
+		return err
+	}
+	return writeKubedConfig(conf)
+}
+
+func saveConfig(cluster *Cluster) error {
+	err := updateKubedConfig(func(conf *KubedConfig) (bool, error) {
+		now := time.Now()
+		cluster.UpdatedAt = now
 
-	found := false
-	if clusters != nil {
-		for i, c := range clusters {
+		found := false
+		for i, c := range conf.Clusters {
 			// Insert the recent config
 			if c.Name == cluster.Name {
-				clusters[i] = *cluster
+				cluster.CreatedAt = c.CreatedAt
+				cluster.LastRenewedAt = c.LastRenewedAt
+				cluster.TokenExpiry = c.TokenExpiry
+				cluster.GrantedTTL = c.GrantedTTL
+				cluster.Aliases = c.Aliases
+				cluster.CAFingerprint = c.CAFingerprint
+				cluster.TunnelAddress = c.TunnelAddress
+				cluster.TunnelProxy = c.TunnelProxy
+				cluster.ManagedKubeConfigs = c.ManagedKubeConfigs
+				cluster.Entries = c.Entries
+				conf.Clusters[i] = *cluster
 				found = true
 			}
 		}
 		if !found {
-			clusters = append(clusters, *cluster)
+			cluster.CreatedAt = now
+			conf.Clusters = append(conf.Clusters, *cluster)
 		}
-	} else {
-		clusters = append(clusters, *cluster)
+		return true, nil
+	})
+	if err == nil {
+		audit("config", cluster.Name, "", "", "")
 	}
+	return err
+}
 
-	newConfBytes, err := yaml.Marshal(clusters)
-	if err != nil {
-		log.Warn("Failed in marshaling kubedconfig ", err)
-		return err
-	}
+// updateCluster applies fn to the saved cluster with the given name
+func updateCluster(name string, fn func(c *Cluster)) error {
+	return updateKubedConfig(func(conf *KubedConfig) (bool, error) {
+		for i := range conf.Clusters {
+			if conf.Clusters[i].Name == name {
+				fn(&conf.Clusters[i])
+				if renamed := conf.Clusters[i].Name; renamed != name {
+					renameInGroups(conf, name, renamed)
+				}
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("Cluster %q not found in kubed config", name)
+	})
+}
 
-	err = ioutil.WriteFile(path, newConfBytes, 0644)
-	if err != nil {
-		log.Warn("Failed in saving kubedconfig ", err)
-		return err
-	}
+// deleteCluster removes the cluster with the given name from the kubed config
+func deleteCluster(name string) error {
+	return updateKubedConfig(func(conf *KubedConfig) (bool, error) {
+		for i := range conf.Clusters {
+			if conf.Clusters[i].Name == name {
+				conf.Clusters = append(conf.Clusters[:i], conf.Clusters[i+1:]...)
+				renameInGroups(conf, name, "")
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
 
-	return nil
+// recordRenewal saves when the token of a cluster was renewed and when it
+// expires, along with the lifetime granted and the kubeconfig entries written
+func recordRenewal(cluster *Cluster, expiry time.Time, caData []byte) error {
+	return updateCluster(cluster.Name, func(c *Cluster) {
+		c.Entries = cluster.Entries
+		c.ExtraNamespaces = cluster.ExtraNamespaces
+		c.LastRenewedAt = time.Now()
+		c.TokenExpiry = expiry
+		c.GrantedTTL = cluster.GrantedTTL
+		if len(caData) > 0 {
+			c.CAFingerprint = caFingerprint(caData)
+		}
+	})
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+var legacyKubedConf = []byte(`
+- name: kubed
+  apiserver: https://192.168.1.1:8443
+  issuer: https://token.example.com
+  clientid: client-id
+  kubeconfig: ~/.kube/config
+  keepcontext: false
+  port: 49999
+  namespace: default
+  manualinput: false
+`)
+
+// tempHome points the home and data directory to a new temporary directory,
+// the returned function restores it
+func tempHome(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kubed")
+	if err != nil {
+		t.Fatalf("Error making temp directory %s", err)
+	}
+	oldHome, oldDataDir := home, *dataDir
+	home, *dataDir = dir, dir
+	return dir, func() {
+		home, *dataDir = oldHome, oldDataDir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMigrateLegacyKubedConf(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	err := ioutil.WriteFile(kubedConfPath(), legacyKubedConf, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster, err := readConfig("kubed")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if cluster.IssuerURL != "https://token.example.com" || cluster.NameSpace != "default" {
+		t.Errorf("Cluster was not migrated correctly: %+v", cluster)
+	}
+
+	if _, err := os.Stat(kubedConfPath() + ".legacy"); err != nil {
+		t.Errorf("Legacy config was not kept: %s", err)
+	}
+
+	conf, err := readKubedConfig()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if conf.Version != kubedConfVersion {
+		t.Errorf("Expected version %d, got %d", kubedConfVersion, conf.Version)
+	}
+}
+
+func TestMigrateDataDir(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+	*dataDir = filepath.Join(dir, ".kubed")
+
+	err := ioutil.WriteFile(filepath.Join(dir, legacyConf), legacyKubedConf, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrateDataDir()
+
+	if _, err := os.Stat(filepath.Join(dir, legacyConf)); !os.IsNotExist(err) {
+		t.Errorf("Legacy config was not moved")
+	}
+	if _, err := readConfig("kubed"); err != nil {
+		t.Errorf("Got unexpected error: %s", err)
+	}
+}
+
+func TestSaveConfigKeepsCreatedAt(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	err := saveConfig(&Cluster{Name: "kubed", APIServer: "https://192.168.1.1:8443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := readConfig("kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.CreatedAt.IsZero() {
+		t.Fatal("CreatedAt was not set")
+	}
+
+	err = saveConfig(&Cluster{Name: "kubed", APIServer: "https://192.168.1.2:8443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := readConfig("kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("CreatedAt changed from %s to %s", first.CreatedAt, second.CreatedAt)
+	}
+	if second.APIServer != "https://192.168.1.2:8443" {
+		t.Errorf("Cluster was not updated")
+	}
+}
+
+func TestSaveConfigKeepsAliases(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	err := saveConfig(&Cluster{Name: "kubed", APIServer: "https://192.168.1.1:8443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updateCluster("kubed", func(c *Cluster) {
+		c.Aliases = []string{"k"}
+		c.GrantedTTL = "8h0m0s"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = saveConfig(&Cluster{Name: "kubed", APIServer: "https://192.168.1.2:8443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := readConfig("k")
+	if err != nil {
+		t.Fatalf("Alias was lost on saving the cluster again: %s", err)
+	}
+	if cluster.GrantedTTL != "8h0m0s" {
+		t.Errorf("Expected the granted lifetime to be kept, got %q", cluster.GrantedTTL)
+	}
+}
+
+func TestSaveConfigIsPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("File modes don't apply on Windows")
+	}
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	// Earlier versions wrote the config readable by others
+	if err := writeDataFile(kubedConfPath(), []byte("clusters: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := saveConfig(&Cluster{Name: "kubed", IssuerHeaders: map[string]string{"X-Api-Key": "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(kubedConfPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the kubed config to be private, got mode %v", info.Mode().Perm())
+	}
+}
+
+func TestUpdateClusterKeepsParallelUpdates(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	for i := 0; i < 10; i++ {
+		if err := saveConfig(&Cluster{Name: fmt.Sprint("cluster", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- recordRenewal(&Cluster{Name: fmt.Sprint("cluster", i)}, expiry, nil)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clusters, err := readClusters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 10 {
+		t.Fatalf("Expected 10 clusters, got %d", len(clusters))
+	}
+	for _, c := range clusters {
+		if !c.TokenExpiry.Equal(expiry) {
+			t.Errorf("Renewal of %s was lost, got expiry %v", c.Name, c.TokenExpiry)
+		}
+	}
+}
+
+func TestSaveConfigKeepsUnreadableConfig(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	broken := []byte("clusters: [\n")
+	err := writeDataFile(kubedConfPath(), broken, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saveConfig(&Cluster{Name: "kubed", APIServer: "https://192.168.1.1:8443"}) == nil {
+		t.Error("Expected saving to fail when the config can't be read")
+	}
+	data, err := ioutil.ReadFile(kubedConfPath())
+	if err != nil || string(data) != string(broken) {
+		t.Errorf("Expected the config to be left alone, got %q %v", data, err)
+	}
+}
+
+func TestRenameInGroups(t *testing.T) {
+	conf := &KubedConfig{Groups: map[string][]string{
+		"teaching": {"lab", "course"},
+		"lab":      {"lab"},
+	}}
+
+	renameInGroups(conf, "course", "course-2018")
+	if conf.Groups["teaching"][1] != "course-2018" {
+		t.Errorf("Cluster was not renamed in group: %v", conf.Groups["teaching"])
+	}
+
+	renameInGroups(conf, "lab", "")
+	if len(conf.Groups["teaching"]) != 1 {
+		t.Errorf("Cluster was not removed from group: %v", conf.Groups["teaching"])
+	}
+	if _, ok := conf.Groups["lab"]; ok {
+		t.Errorf("Empty group was not removed")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	commands["list"] = &command{
+		usage: "list",
+		help:  "List the configured clusters with their renewal and expiry times",
+		run:   list,
+	}
+	commands["status"] = &command{
+		usage: "status [cluster]",
+		help:  "Show the clusters like list, asking providers with introspection whether their tokens were revoked",
+		run:   status,
+	}
+}
+
+func list(ctx context.Context, args []string) error {
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+	return listClusters(ctx, clusters)
+}
+
+// status is list, or list of one cluster when it is named
+func status(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return withExitCode(exitUsage, errors.New("Give at most the name of the cluster to show the status of"))
+	}
+	if len(args) == 0 {
+		return list(ctx, args)
+	}
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	return listClusters(ctx, []Cluster{*cluster})
+}
+
+func listClusters(ctx context.Context, clusters []Cluster) error {
+	if *outputFormat == "json" {
+		return listJSON(ctx, clusters)
+	}
+
+	// Expiry only tells what kubed knows, the provider may have revoked the
+	// token since. Asking it takes a request per cluster, so the column is
+	// only there when a cluster has an introspection endpoint.
+	introspect := false
+	for _, c := range clusters {
+		introspect = introspect || c.IntrospectionURL != ""
+	}
+
+	header := []string{"NAME", "API SERVER", "NAMESPACE", "CREATED", "LAST RENEWED", "TOKEN EXPIRES"}
+	if introspect {
+		header = append(header, "PROVIDER")
+	}
+	t := newTable(os.Stdout, header...)
+	for i := range clusters {
+		c := &clusters[i]
+		row := []string{c.Name, c.APIServer, c.NameSpace,
+			formatTime(c.CreatedAt), formatTime(c.LastRenewedAt), formatExpiry(c.TokenExpiry, time.Now())}
+		if introspect {
+			row = append(row, providerStatus(ctx, c))
+		}
+		t.row(row...)
+	}
+	return t.flush()
+}
+
+// clusterStatus is a cluster as listed with -output json
+type clusterStatus struct {
+	Name          string     `json:"name"`
+	APIServer     string     `json:"apiserver"`
+	NameSpace     string     `json:"namespace,omitempty"`
+	KubeConfig    string     `json:"kubeconfig"`
+	CreatedAt     *time.Time `json:"createdat,omitempty"`
+	LastRenewedAt *time.Time `json:"lastrenewedat,omitempty"`
+	TokenExpiry   *time.Time `json:"tokenexpiry,omitempty"`
+	Expired       bool       `json:"expired"`
+	Provider      string     `json:"provider,omitempty"`
+	GrantedTTL    string     `json:"grantedttl,omitempty"`
+}
+
+func listJSON(ctx context.Context, clusters []Cluster) error {
+	optional := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	statuses := make([]clusterStatus, 0, len(clusters))
+	for i := range clusters {
+		c := &clusters[i]
+		provider := ""
+		if c.IntrospectionURL != "" {
+			provider = providerStatus(ctx, c)
+		}
+		statuses = append(statuses, clusterStatus{
+			Name:          c.Name,
+			APIServer:     c.APIServer,
+			NameSpace:     c.NameSpace,
+			KubeConfig:    expandHome(c.KubeConfig),
+			CreatedAt:     optional(c.CreatedAt),
+			LastRenewedAt: optional(c.LastRenewedAt),
+			TokenExpiry:   optional(c.TokenExpiry),
+			Expired:       expired(c.TokenExpiry, time.Now()),
+			Provider:      provider,
+			GrantedTTL:    c.GrantedTTL,
+		})
+	}
+
+	out, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// formatExpiry shows how long a token is still valid, or how long ago it expired
+func formatExpiry(expiry time.Time, now time.Time) string {
+	if expiry.IsZero() {
+		return "-"
+	}
+	left := expiry.Sub(now)
+	if left < 0 {
+		return "expired " + formatDuration(-left) + " ago"
+	}
+	return "in " + formatDuration(left)
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
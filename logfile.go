@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// rotatingFile is a log file that is moved to <path>.1 when it grows past
+// maxSize or gets older than maxAge, keeping keep rotated files, so a daemon
+// running for months doesn't fill the disk
+type rotatingFile struct {
+	mutex   sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	keep    int
+	now     func() time.Time
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// logToFile sends the logs to a rotating file instead of the terminal
+func logToFile(path string, maxSize int64, maxAge time.Duration, keep int) error {
+	if maxSize <= 0 {
+		return errors.New("-log-max-size must be positive")
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, keep: keep, now: time.Now}
+	err := f.open()
+	if err != nil {
+		return errors.Wrap(err, "Failed in opening log file")
+	}
+	// Escape codes only get in the way in files
+	if text := textFormatter(); text != nil && *colorMode != "always" {
+		text.ForceColors, text.DisableColors = false, true
+	}
+	log.SetOutput(f)
+	return nil
+}
+
+func (f *rotatingFile) open() error {
+	file, info, err := openLogFile(f.path)
+	if err != nil {
+		return err
+	}
+	// A file kept from an earlier run, e.g. of a daemon restarted by systemd
+	// or launchd, is as old as its last write, not as the process
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	if info.Size() > 0 {
+		f.opened = info.ModTime()
+	}
+	return nil
+}
+
+func openLogFile(path string) (*os.File, os.FileInfo, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || (f.maxAge > 0 && f.now().Sub(f.opened) >= f.maxAge)) {
+		err := f.rotate()
+		if err != nil {
+			// Losing rotation is better than losing the logs
+			fmt.Fprintln(os.Stderr, "Failed in rotating log file", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts <path>.N to <path>.N+1, dropping the oldest, and starts a new
+// file. When the new file can't be opened, the logs go on to the old one.
+func (f *rotatingFile) rotate() error {
+	// Windows doesn't rename files that are open
+	if runtime.GOOS == "windows" {
+		f.file.Close()
+	}
+	rotated := f.path
+	if f.keep <= 0 {
+		os.Remove(f.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", f.path, f.keep))
+		for i := f.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		os.Rename(f.path, f.path+".1")
+		rotated = f.path + ".1"
+	}
+
+	file, _, err := openLogFile(f.path)
+	if err != nil {
+		if runtime.GOOS == "windows" {
+			if old, _, oldErr := openLogFile(rotated); oldErr == nil {
+				f.file = old
+			}
+		}
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		f.file.Close()
+	}
+	f.file, f.size, f.opened = file, 0, f.now()
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	path := filepath.Join(dir, "logs", "kubed.log")
+	f := &rotatingFile{path: path, maxSize: 10, maxAge: time.Hour, keep: 2, now: func() time.Time { return now }}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { f.file.Close() }()
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A new file after an hour, even though it is small
+	now = now.Add(time.Hour)
+	f.Write([]byte("fourth\n"))
+
+	for file, content := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %q in %s, got %q (%v)", content, file, data, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("More rotated files were kept than -log-keep")
+	}
+}
+
+func TestRotatingFileAgeOfKeptFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A log left by an earlier run that was last written two hours ago
+	now := time.Now()
+	path := filepath.Join(dir, "kubed.log")
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &rotatingFile{path: path, maxSize: 1024, maxAge: time.Hour, keep: 1, now: func() time.Time { return now }}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { f.file.Close() }()
+	f.Write([]byte("new\n"))
+
+	for file, content := range map[string]string{path: "new\n", path + ".1": "old\n"} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %q in %s, got %q (%v)", content, file, data, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	colorable "github.com/mattn/go-colorable"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	logLevelEnv = "KUBED_LOG_LEVEL"
+	// noColorEnv turns off colors when set, see https://no-color.org
+	noColorEnv = "NO_COLOR"
+)
+
+// useColor tells whether output to f is colored: -color always or never
+// decide, auto colors terminals unless NO_COLOR is set
+func useColor(mode string, f *os.File) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return os.Getenv(noColorEnv) == "" && terminal.IsTerminal(int(f.Fd()))
+}
+
+// setupLogging configures format, level and colors of the logs from the
+// command line, falling back to KUBED_LOG_LEVEL and info level
+func setupLogging(format string, level string, color string) error {
+	switch color {
+	case "auto", "always", "never":
+	default:
+		return fmt.Errorf("Unsupported color mode %q, use always, never or auto", color)
+	}
+
+	if level == "" {
+		level = os.Getenv(logLevelEnv)
+	}
+	if level == "" {
+		level = "info"
+	}
+
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(lvl)
+
+	switch format {
+	case "text":
+		if plainOutput() {
+			setFormatter(plainFormatter{})
+			log.SetOutput(os.Stdout)
+			return nil
+		}
+		colored := useColor(color, os.Stdout)
+		setFormatter(&log.TextFormatter{ForceColors: colored, DisableColors: !colored})
+		log.SetOutput(colorable.NewColorableStdout())
+	case "json":
+		setFormatter(&log.JSONFormatter{})
+		log.SetOutput(os.Stdout)
+	default:
+		return fmt.Errorf("Unsupported log format %q, use text or json", format)
+	}
+	return nil
+}
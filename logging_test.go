@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUseColor(t *testing.T) {
+	f, err := ioutil.TempFile("", "kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if !useColor("always", f) {
+		t.Error("Expected colors with -color always")
+	}
+	if useColor("never", f) {
+		t.Error("Expected no colors with -color never")
+	}
+	if useColor("auto", f) {
+		t.Error("Expected no colors for a file with -color auto")
+	}
+}
+
+func TestSetupLoggingRejectsUnknownColor(t *testing.T) {
+	if err := setupLogging("text", "info", "sometimes"); err == nil {
+		t.Error("Expected an error for an unknown color mode")
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/browser"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+// login authenticates the user with the OAuth2 Provider, fetches a JWT token
+// from the issuer of the cluster and writes it to kubeconfig
+func login(ctx context.Context, cluster *Cluster) error {
+	// Fix Home Path for Kubeconfig
+	cluster.KubeConfig = expandHome(cluster.KubeConfig)
+
+	// Ask before the browser dance, not after
+	err := confirmOverwrite(ctx, cluster)
+	if err != nil {
+		return err
+	}
+
+	err = runHooks(ctx, "pre", cluster)
+	if err != nil {
+		return err
+	}
+	return signIn(ctx, cluster)
+}
+
+// loginAgain logs in when renewing with the refresh token failed. The pre
+// hook isn't run, the renewal did already.
+func loginAgain(ctx context.Context, cluster *Cluster) error {
+	cluster.KubeConfig = expandHome(cluster.KubeConfig)
+	err := confirmOverwrite(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return signIn(ctx, cluster)
+}
+
+// signIn does the login after the questions and the pre hook
+func signIn(ctx context.Context, cluster *Cluster) error {
+	// Over SSH, the agent forwarded from the laptop does the browser dance there
+	if forwardedAgent() {
+		log.Info("Logging in through the kubed agent at ", agentSocket())
+		token, caData, err := loginThroughAgent(cluster)
+		if err != nil {
+			return err
+		}
+		return saveLogin(ctx, cluster, token, caData)
+	}
+
+	err := checkIssuerUp(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	providerToken, err := authenticate(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return completeLogin(ctx, cluster, providerToken, providerToken.stored)
+}
+
+// authenticate lets the user log in with the OAuth2 Provider and returns its tokens
+func authenticate(ctx context.Context, cluster *Cluster) (*tokenResponse, error) {
+	// Confidential clients use authorization code flow and redeem the code with their secret
+	secret, err := readClientSecret(cluster.ClientSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in reading client secret")
+	}
+	responseType, param := responseTypeFor(secret)
+
+	err = validPrompt(cluster.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	err = validResponseMode(cluster.ResponseMode)
+	if err != nil {
+		return nil, err
+	}
+
+	// One browser flow at a time on the callback port
+	lock, finished, err := lockLogin(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.unlock()
+	if finished != nil {
+		return finished, nil
+	}
+
+	if wantSilentReauth(ctx, cluster) {
+		providerToken, err := reauthenticate(ctx, cluster, responseType, param, secret)
+		if err != nil {
+			return nil, err
+		}
+		if providerToken != nil {
+			finishLogin(ctx, lock, cluster, providerToken)
+			return providerToken, nil
+		}
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in generating nonce")
+	}
+	dataportenAuthURL := authorizationURL(cluster, responseType, nonce)
+
+	err = needInteraction("Logging in with Dataporten", "Log in once from an interactive shell with \""+os.Args[0]+" -renew "+cluster.Name+"\"")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(tr("Requesting Access Token from Dataporten"))
+	traceRedirect("Authorization request", dataportenAuthURL)
+	var callback url.Values
+
+	if *useClipboard {
+		err = copyToClipboard(dataportenAuthURL)
+		if err != nil {
+			log.Warn("Failed in copying authorization URL to the clipboard ", err)
+		} else {
+			log.Info(tr("Authorization URL copied to the clipboard"))
+		}
+	}
+
+	// Manually fetch token if browser is unavailable from console:
+	if cluster.ManualInput {
+		fmt.Println(tr("Open a browser and navigate to %s", dataportenAuthURL))
+		if *showQR && !plainOutput() {
+			fmt.Println(tr("Or scan this code to log in on your phone:"))
+			err = printQR(os.Stdout, dataportenAuthURL)
+			if err != nil {
+				log.Warn("Failed in showing QR code ", err)
+			}
+		}
+		fmt.Println(tr("After authentication, you are redirected to an invalid URL. Copy/paste this url below:"))
+		if *useClipboard {
+			fmt.Println(tr("Or copy it and press Enter to read it from the clipboard."))
+		}
+		fmt.Print(tr("Redirected URL: "))
+		tokenURLString := ""
+		tokenURLString, err = readLine(ctx, bufio.NewReader(os.Stdin))
+		if err != nil {
+			return nil, errors.Wrap(err, tr("Something disastrous happened while getting input from console, please run kubed again"))
+		}
+		if *useClipboard && strings.TrimSpace(tokenURLString) == "" {
+			tokenURLString, err = readClipboard()
+			if err != nil {
+				return nil, errors.Wrap(err, "Failed in reading the redirected URL from the clipboard")
+			}
+		}
+		traceRedirect("Redirect received", tokenURLString)
+		callback = url.Values{}
+		for _, p := range []string{param, "id_token"} {
+			callback.Set(p, parseRedirectURL(tokenURLString, p))
+		}
+		registerSecrets(callback.Get(param), callback.Get("id_token"))
+		// Open browser to authenticate user and get access token otherwise:
+	} else {
+		go func(dataportenAuthURL string) {
+			err := openBrowser(dataportenAuthURL)
+			if err != nil {
+				log.Warn(tr("Failed in opening browser, open %s yourself or rerun with -manual-input", redactURL(dataportenAuthURL)), " ", err)
+			}
+		}(dataportenAuthURL)
+
+		callback, err = getToken(ctx, cluster.Port, param, cluster.HTTPSCallback)
+	}
+
+	var providerToken *tokenResponse
+	if err == nil {
+		providerToken, err = callbackToken(ctx, cluster, callback, param, secret)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, tr("Error in getting access token"))
+	}
+	err = checkNonce(providerToken, nonce, secret)
+	if err != nil {
+		return nil, err
+	}
+	finishLogin(ctx, lock, cluster, providerToken)
+	return providerToken, nil
+}
+
+// finishLogin keeps the provider tokens while the login lock is still held,
+// so that those waiting for it find them in the token store
+func finishLogin(ctx context.Context, lock *processLock, cluster *Cluster, providerToken *tokenResponse) {
+	if cluster.Ephemeral {
+		return
+	}
+	saveMu.Lock()
+	err := keepProviderToken(ctx, cluster, providerToken)
+	saveMu.Unlock()
+	if err != nil {
+		log.Warn("Failed in caching access token, logout will not be able to revoke it ", err)
+		return
+	}
+	providerToken.stored = true
+	lock.recordLogin(cluster)
+}
+
+// openURL opens a URL in the browser, tests follow the redirects instead
+var openURL = browser.OpenURL
+
+// openBrowser opens the URL in the browser of the user, except in replays
+func openBrowser(url string) error {
+	if replayer != nil {
+		return nil
+	}
+	return openURL(url)
+}
+
+// completeLogin trades the access token of the OAuth2 Provider for a JWT token
+// and writes it to kubeconfig, both when logging in and when renewing. stored
+// tells that the provider tokens are kept for the cluster already.
+func completeLogin(ctx context.Context, cluster *Cluster, providerToken *tokenResponse, stored bool) error {
+	token := providerToken.AccessToken
+
+	// Keep the provider tokens, so they can be revoked on logout and used for
+	// renewal. With an agent running they stay in its memory instead of on disk.
+	useAgent := agentRunning() && !cluster.Ephemeral
+	var err error
+	if !stored && !cluster.Ephemeral {
+		saveMu.Lock()
+		err = keepProviderToken(ctx, cluster, providerToken)
+		saveMu.Unlock()
+		if err != nil {
+			log.Warn("Failed in caching access token, logout will not be able to revoke it ", err)
+		}
+	}
+
+	if cluster.ClientCertificate {
+		saveMu.Lock()
+		defer saveMu.Unlock()
+		return certificateLogin(ctx, cluster, token)
+	}
+
+	jwtToken, caData, err := fetchCredentials(ctx, cluster, token)
+	if err != nil {
+		return err
+	}
+	if needUserinfo(cluster, jwtToken) {
+		cluster.userinfo = fetchUserinfo(ctx, cluster, token)
+	}
+
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	if useAgent {
+		_, err = callAgent(agentRequest{Op: "put", Cluster: cluster.Name, Token: jwtToken})
+		if err != nil {
+			log.Warn("Failed in handing JWT token to the agent ", err)
+		}
+	}
+	return saveLogin(ctx, cluster, jwtToken, caData)
+}
+
+// keepProviderToken saves the provider tokens in the agent when one is
+// running, in the token store otherwise. saveMu must be held.
+func keepProviderToken(ctx context.Context, cluster *Cluster, providerToken *tokenResponse) error {
+	var err error
+	if agentRunning() {
+		_, err = callAgent(agentRequest{Op: "put", Cluster: cluster.Name, ProviderToken: providerToken})
+	} else {
+		err = saveCachedToken(ctx, cluster.Name, providerToken)
+	}
+	return err
+}
+
+// fetchCredentials gets the JWT token and the CA certificate from the issuer
+func fetchCredentials(ctx context.Context, cluster *Cluster, accessToken string) (string, []byte, error) {
+	log.Info("Requesting JWT Token from ", cluster.IssuerURL)
+	registerSecrets(accessToken)
+
+	var token string
+	var caData []byte
+	var err error
+	if cluster.IssuerKubeConfig {
+		token, caData, err = kubeConfigCredentials(ctx, cluster, accessToken)
+	} else {
+		token, err = clusterJWT(ctx, cluster, accessToken)
+	}
+	if err != nil {
+		return "", nil, withExitCode(issuerExitCode(err), errors.Wrap(err, "Failed in getting JWT token"))
+	}
+	registerSecrets(token)
+	checkTokenClock(token)
+	err = auth.CheckACR(token, cluster.ACRValues)
+	if err != nil {
+		return "", nil, withExitCode(exitAuthDenied, err)
+	}
+	if cluster.IssuerKubeConfig && caData != nil {
+		return token, caData, nil
+	}
+	// Token services don't serve the cluster CA like the kubed issuer does
+	if !cluster.TokenExchange && !cluster.IssuerKubeConfig {
+		caData, err = getCACertWithRetry(ctx, cluster)
+		if err == nil {
+			return token, caData, nil
+		}
+		return token, fallbackCA(cluster, err), nil
+	}
+	return token, fallbackCA(cluster, nil), nil
+}
+
+// fallbackCA is the CA certificate to use when the issuer provides none, so a
+// flaky CA endpoint doesn't block renewing the token. failed is the error of
+// the CA endpoint, nil for issuers that don't serve the CA.
+func fallbackCA(cluster *Cluster, failed error) []byte {
+	caData := cachedCA(cluster)
+	switch {
+	case caData == nil:
+		log.Warn("No custom CA certificate provided, assuming running with standard certificate")
+	case failed != nil:
+		usedCache("CA certificate", failed)
+	case cluster.CAData != "":
+		log.Info("Issuer provided no CA certificate, using the one discovered from cluster-info")
+	default:
+		log.Info("Issuer provided no CA certificate, keeping the one from the last login in kubeconfig")
+	}
+	return caData
+}
+
+// cachedCA is the CA certificate discovered from cluster-info, or else the
+// one written to kubeconfig at the last login
+func cachedCA(cluster *Cluster) []byte {
+	if cluster.CAData != "" {
+		return []byte(cluster.CAData)
+	}
+	cached, err := kubeconfig.ReadCAData(expandHome(cluster.KubeConfig), kubeEntries(cluster).Cluster)
+	if err != nil || len(cached) == 0 {
+		return nil
+	}
+	return cached
+}
+
+// saveLogin writes the token to kubeconfig and records the renewal
+func saveLogin(ctx context.Context, cluster *Cluster, token string, caData []byte) error {
+	// Before anything is written, so kubeconfig keeps the last working token
+	err := checkAudience(cluster, token)
+	if err != nil {
+		return err
+	}
+	err = nameEntries(cluster, token)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	cfg := kubeConfigSetup(cluster, caData)
+	cfg.Token = token
+	if cluster.AuthProvider {
+		cfg.OIDCConfig = oidcConfig(ctx, cluster)
+	}
+	if token != "" {
+		err = cacheIssuedToken(cluster, token)
+		if err != nil {
+			log.Warn("Failed in caching the issued token ", err)
+		}
+	}
+	// kubectl gets the token from "kubed exec-credential", which reads it from the cache
+	if cluster.ExecCredential {
+		cfg.Token = ""
+		err := saveCachedJWT(ctx, cluster.Name, token)
+		if err != nil {
+			return errors.Wrap(err, "Failed in caching JWT token")
+		}
+	}
+
+	var expiry time.Time
+	if claims, err := auth.DecodeClaims(token); err == nil {
+		_, expiry = auth.TokenTimes(claims)
+	}
+	cluster.GrantedTTL = ""
+	if granted := grantedTTL(cluster, token); granted > 0 {
+		cluster.GrantedTTL = granted.String()
+	}
+	return writeLogin(ctx, cluster, cfg, expiry)
+}
+
+// kubeConfigSetup has the kubeconfig entries of the cluster, without credentials
+func kubeConfigSetup(cluster *Cluster, caData []byte) *kubeconfig.KubeConfigSetup {
+	entries := kubeEntries(cluster)
+	cfg := new(kubeconfig.KubeConfigSetup)
+	cfg.CertificateAuthorityData = caData
+	cfg.ClusterName = entries.Cluster
+	cfg.UserName = entries.User
+	cfg.ContextName = entries.Context
+	cfg.ClusterServerAddress = apiServerAddress(cluster)
+	cfg.KubeConfigFile = cluster.KubeConfig
+	cfg.KeepContext = cluster.KeepContext
+	cfg.NameSpace = cluster.NameSpace
+	cfg.Impersonate = cluster.AsUser
+	return cfg
+}
+
+// writeLogin writes the credentials to kubeconfig and records the renewal,
+// with expiry the time the credentials expire
+func writeLogin(ctx context.Context, cluster *Cluster, cfg *kubeconfig.KubeConfigSetup, expiry time.Time) error {
+	caData := cfg.CertificateAuthorityData
+	err := checkCAChange(cluster, caData)
+	if err != nil {
+		return err
+	}
+
+	files := kubeConfigFiles(cluster)
+	removeRenamedEntries(cluster, files)
+	for _, filename := range files {
+		fileCfg := *cfg
+		fileCfg.KubeConfigFile = filename
+		err = writeKubeConfig(cluster, &fileCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Ephemeral kubeconfigs are gone soon, .kubedconf must not refer to them
+	if !cluster.Ephemeral {
+		err = recordRenewal(cluster, expiry, caData)
+		if err != nil {
+			log.Warn("Failed in recording renewal time ", err)
+		}
+	}
+
+	err = runHooks(ctx, "post", cluster)
+	if err != nil {
+		log.Warn(err)
+	}
+
+	log.Info(tr("Kubernetes configuration has been saved in \"%s\" with context \"%s\"", strings.Join(files, "\", \""), cfg.ContextName))
+	log.Info(tr("To renew JWT token for this cluster run: \"%s -renew %s\"", os.Args[0], cluster.Name))
+	return nil
+}
+
+// removeRenamedEntries removes the entries of the last login that the naming
+// templates now give other names, and the contexts of dropped extra namespaces
+func removeRenamedEntries(cluster *Cluster, files []string) {
+	if cluster.Ephemeral {
+		return
+	}
+	saved, err := readConfig(cluster.Name)
+	if err != nil || saved.Name != cluster.Name {
+		return
+	}
+	for _, filename := range files {
+		err = kubeconfig.RemoveContexts(filename, staleContexts(saved, cluster))
+		if err != nil {
+			log.Warn("Failed in removing the contexts of the last login from ", filename, " ", err)
+		}
+	}
+
+	old, current := kubeEntries(saved), kubeEntries(cluster)
+	if old == current {
+		return
+	}
+	var stale KubeEntries
+	if old.Cluster != current.Cluster {
+		stale.Cluster = old.Cluster
+	}
+	if old.User != current.User {
+		stale.User = old.User
+	}
+	if old.Context != current.Context {
+		stale.Context = old.Context
+	}
+	for _, filename := range files {
+		err = kubeconfig.RemoveNamedEntries(filename, stale.Cluster, stale.User, stale.Context)
+		if err != nil {
+			log.Warn("Failed in removing the entries of the last login from ", filename, " ", err)
+		}
+	}
+}
+
+// writeKubeConfig writes the entries of the cluster to the kubeconfig file of cfg
+func writeKubeConfig(cluster *Cluster, cfg *kubeconfig.KubeConfigSetup) error {
+	filename := cfg.KubeConfigFile
+	err := kubeconfig.SetupKubeConfig(cfg)
+	if err == nil && cluster.issued != nil {
+		// The exec plugin of kubed wins over the credentials of the issuer
+		user := cluster.issued.user
+		if cluster.ExecCredential {
+			user = ""
+		}
+		err = kubeconfig.MergeEntries(filename, cluster.issued.data, cluster.issued.cluster, user, cfg.ClusterName, cfg.UserName)
+	}
+	if err == nil {
+		err = writeExtraContexts(cluster, filename)
+	}
+	if err != nil {
+		return withExitCode(exitKubeConfigWrite, errors.Wrap(err, "Failed in setting the kubeconfig"))
+	}
+	credential := cfg.Token
+	if cfg.ClientCertificateData != nil {
+		credential = string(cfg.ClientCertificateData)
+	}
+	audit("login", cluster.Name, filename, credential, "")
+	if cluster.ExecCredential && !kubeconfig.IsExecUser(filename, cfg.UserName) {
+		err = kubeconfig.SetExecUser(filename, cfg.UserName, execConfig(cluster.Name, *execAgent))
+		if err != nil {
+			return withExitCode(exitKubeConfigWrite, errors.Wrap(err, "Failed in setting the kubeconfig"))
+		}
+	}
+
+	err = kubeconfig.SetClusterField(filename, cfg.ClusterName, "proxy-url", cluster.ProxyURL)
+	if err != nil {
+		return withExitCode(exitKubeConfigWrite, errors.Wrap(err, "Failed in setting the proxy of the cluster"))
+	}
+	// client-go only knows of impersonating a user, kubectl of groups as well
+	err = kubeconfig.SetUserField(filename, cfg.UserName, "as-groups", cluster.AsGroups)
+	if err != nil {
+		return withExitCode(exitKubeConfigWrite, errors.Wrap(err, "Failed in setting the impersonated groups"))
+	}
+
+	if !cluster.Ephemeral {
+		err = markManaged(cluster.Name, filename)
+		if err != nil {
+			log.Warn("Failed in marking kubeconfig entries as managed by kubed ", err)
+		}
+	}
+	return nil
+}
+
+// oidcConfig is the auth-provider configuration older kubectl versions use to
+// refresh the token themselves. kubectl refreshes the ID token of the provider
+// with the refresh token kubed cached, so both come from the provider and
+// idp-issuer-url is the issuer named in the ID token. Without an ID token
+// there is nothing kubectl could refresh, and nil is returned.
+func oidcConfig(ctx context.Context, cluster *Cluster) map[string]string {
+	cached, ok, err := readCachedToken(ctx, cluster.Name)
+	if err != nil || !ok || cached.IDToken == "" {
+		log.Warn("No ID token from the provider, writing the token of \"", cluster.Name, "\" instead of the oidc auth-provider")
+		return nil
+	}
+
+	issuer := *oidcIssuer
+	if claims, err := auth.DecodeClaims(cached.IDToken); err == nil {
+		if iss, ok := claims["iss"].(string); ok && iss != "" {
+			issuer = iss
+		}
+	}
+	config := map[string]string{
+		"idp-issuer-url": issuer,
+		"client-id":      cluster.ClientID,
+		"id-token":       cached.IDToken,
+	}
+	if cached.RefreshToken != "" {
+		config["refresh-token"] = cached.RefreshToken
+	} else {
+		log.Warn("No refresh token available, kubectl will not be able to refresh the token of \"", cluster.Name, "\"")
+	}
+	// The client secret is not written to kubeconfig, providers that need it
+	// for refreshing leave renewal to kubed
+	return config
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// loginReuseAge is how long the provider tokens of a finished login are
+// reused by kubed processes that waited for it
+const loginReuseAge = time.Minute
+
+// finishedLogin is what the login lock file holds after a successful login.
+// The tokens themselves are only kept in the token store.
+type finishedLogin struct {
+	Time     time.Time `json:"time"`
+	Cluster  string    `json:"cluster"`
+	ClientID string    `json:"clientid"`
+}
+
+// loginLockPath is the lock file of logins listening on the callback port.
+// Logins on the same port would fight over it and over the user.
+func loginLockPath(port int) string {
+	return filepath.Join(cacheDir(), "locks", fmt.Sprintf("login-%d.lock", port))
+}
+
+// lockLogin takes the login lock of the callback port of the cluster. If
+// another kubed logged in to the same cluster while waiting, its provider
+// tokens are read from the token store to be reused instead of starting
+// another browser flow.
+func lockLogin(ctx context.Context, cluster *Cluster) (*processLock, *tokenResponse, error) {
+	lock, waited, err := takeLock(ctx, loginLockPath(cluster.Port), fmt.Sprintf("logging in on callback port %d", cluster.Port))
+	if err != nil {
+		return nil, nil, err
+	}
+	if waited && lock.finishedLogin(cluster, time.Now()) {
+		if token := storedProviderToken(ctx, cluster); token != nil {
+			log.Info("Another kubed just logged in to \"", cluster.Name, "\", reusing its tokens")
+			return lock, token, nil
+		}
+	}
+	lock.recordLogin(nil)
+	return lock, nil, nil
+}
+
+// storedProviderToken returns the provider tokens the token store has for
+// the cluster. The agent doesn't hand out provider tokens, a login kept there
+// is not reused.
+func storedProviderToken(ctx context.Context, cluster *Cluster) *tokenResponse {
+	if agentRunning() {
+		return nil
+	}
+	cached, ok, err := readCachedToken(ctx, cluster.Name)
+	if err != nil || !ok || cached.AccessToken == "" {
+		return nil
+	}
+	return &tokenResponse{AccessToken: cached.AccessToken, RefreshToken: cached.RefreshToken, stored: true}
+}
+
+// finishedLogin tells whether a login to the cluster finished moments ago
+func (l *processLock) finishedLogin(cluster *Cluster, now time.Time) bool {
+	if _, err := l.file.Seek(0, 0); err != nil {
+		return false
+	}
+	data, err := ioutil.ReadAll(l.file)
+	if err != nil || len(data) == 0 {
+		return false
+	}
+	var finished finishedLogin
+	if json.Unmarshal(data, &finished) != nil || now.Sub(finished.Time) > loginReuseAge {
+		return false
+	}
+	return finished.Cluster == cluster.Name && finished.ClientID == cluster.ClientID
+}
+
+// recordLogin marks a successful login to the cluster for those waiting for
+// the lock, a nil cluster clears the mark. The provider tokens must be in
+// the token store already, see keepProviderToken.
+func (l *processLock) recordLogin(cluster *Cluster) {
+	var data []byte
+	if cluster != nil {
+		data, _ = json.Marshal(finishedLogin{Time: time.Now(), Cluster: cluster.Name, ClientID: cluster.ClientID})
+	}
+	if l.file.Truncate(0) == nil {
+		l.file.WriteAt(data, 0)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginLock(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	cluster := &Cluster{Name: "kubed", ClientID: "client-id", Port: 49999}
+	lock, finished, err := lockLogin(context.Background(), cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished != nil {
+		t.Fatal("Expected no finished login without waiting")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, _, err := lockLogin(ctx, &Cluster{Name: "other", Port: 49999}); err != context.DeadlineExceeded {
+		t.Errorf("Expected waiting for the held lock to time out, got %v", err)
+	}
+	if _, _, err := lockLogin(ctx, &Cluster{Name: "other", Port: 49998}); err != nil {
+		t.Errorf("Expected the lock of another port to be free, got %v", err)
+	}
+
+	finishLogin(context.Background(), lock, cluster, &tokenResponse{AccessToken: "access-token", RefreshToken: "refresh-token"})
+	if !lock.finishedLogin(cluster, time.Now()) {
+		t.Error("Expected the login to be marked as finished")
+	}
+	if lock.finishedLogin(&Cluster{Name: "other", ClientID: "client-id"}, time.Now()) {
+		t.Error("Expected logins to another cluster to be ignored")
+	}
+	if lock.finishedLogin(cluster, time.Now().Add(2*loginReuseAge)) {
+		t.Error("Expected old logins to be ignored")
+	}
+	data, err := ioutil.ReadFile(loginLockPath(cluster.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "access-token") || strings.Contains(string(data), "refresh-token") {
+		t.Errorf("Expected no tokens in the lock file, got %s", data)
+	}
+
+	done := make(chan *tokenResponse)
+	go func() {
+		waiting, token, err := lockLogin(context.Background(), cluster)
+		if err != nil {
+			t.Error(err)
+			close(done)
+			return
+		}
+		waiting.unlock()
+		done <- token
+	}()
+	time.Sleep(200 * time.Millisecond)
+	lock.unlock()
+	if token := <-done; token == nil || token.AccessToken != "access-token" {
+		t.Errorf("Expected the waiting login to reuse the tokens, got %+v", token)
+	}
+}
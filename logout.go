@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func init() {
+	commands["logout"] = &command{
+		usage: "logout <cluster>",
+		help:  "Revoke the tokens of a cluster and remove them from kubeconfig and cache",
+		run:   logout,
+	}
+}
+
+func logout(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please provide the name of the cluster to log out from")
+	}
+
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+
+	cached, found, err := readCachedToken(ctx, cluster.Name)
+	if err != nil {
+		return err
+	}
+
+	// Revoke at the provider first, so the tokens are useless even if copies exist
+	if found && cluster.RevocationURL != "" {
+		secret, err := readClientSecret(cluster.ClientSecret)
+		if err != nil {
+			return err
+		}
+		if cached.RefreshToken != "" {
+			err = revokeToken(ctx, cluster.RevocationURL, cached.RefreshToken, "refresh_token", cluster.ClientID, secret)
+			if err != nil {
+				log.Warn("Refresh token could not be revoked, it is only removed locally")
+			}
+		}
+		err = revokeToken(ctx, cluster.RevocationURL, cached.AccessToken, "access_token", cluster.ClientID, secret)
+		if err != nil {
+			log.Warn("Access token could not be revoked, it is only removed locally")
+		}
+	} else if found {
+		log.Info("No revocation endpoint configured for \"", cluster.Name, "\", tokens are only removed locally")
+	}
+
+	for _, kubeConfigFile := range kubeConfigFiles(cluster) {
+		err = kubeconfig.RemoveToken(kubeConfigFile, kubeEntries(cluster).User)
+		if err != nil {
+			return err
+		}
+		audit("logout", cluster.Name, kubeConfigFile, "", "")
+	}
+
+	err = removeCachedToken(ctx, cluster.Name)
+	if err != nil {
+		return err
+	}
+	if agentRunning() {
+		_, err = callAgent(agentRequest{Op: "remove", Cluster: cluster.Name})
+		if err != nil {
+			log.Warn("Failed in removing tokens from the agent ", err)
+		}
+	}
+
+	log.Info("Logged out from \"", cluster.Name, "\", run \"", os.Args[0], " -renew ", cluster.Name, "\" to log in again")
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func TestLogout(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+		dir, cleanup := tempHome(t)
+
+		var mutex sync.Mutex
+		revoked := map[string]string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			mutex.Lock()
+			revoked[r.Form.Get("token_type_hint")] = r.Form.Get("token")
+			mutex.Unlock()
+			w.WriteHeader(status)
+		}))
+
+		filename := filepath.Join(dir, "config")
+		cluster := &Cluster{Name: "kubed", APIServer: "https://192.168.1.1:8443", ClientID: "kubed", KubeConfig: filename, RevocationURL: server.URL}
+		err := kubeconfig.SetupKubeConfig(&kubeconfig.KubeConfigSetup{
+			ClusterName:          cluster.Name,
+			ClusterServerAddress: cluster.APIServer,
+			Token:                "jwt",
+			KubeConfigFile:       filename,
+		})
+		if err == nil {
+			err = saveConfig(cluster)
+		}
+		if err == nil {
+			err = saveCachedToken(context.Background(), "kubed", &tokenResponse{AccessToken: "access", RefreshToken: "refresh"})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := logout(context.Background(), []string{"kubed"}); err != nil {
+			t.Errorf("Logout with revocation answering %d failed: %s", status, err)
+		}
+		if revoked["access_token"] != "access" || revoked["refresh_token"] != "refresh" {
+			t.Errorf("Expected the access and refresh token to be revoked, got %v", revoked)
+		}
+		// Tokens the provider failed to revoke are still removed locally
+		if token, err := kubeconfig.ReadToken(filename, "kubed"); err == nil {
+			t.Errorf("Expected the token to be removed from kubeconfig with revocation answering %d, got %q", status, token)
+		}
+		if _, found, err := readCachedToken(context.Background(), "kubed"); err != nil || found {
+			t.Errorf("Expected the cached tokens to be removed with revocation answering %d, got %v", status, err)
+		}
+
+		server.Close()
+		cleanup()
+	}
+}
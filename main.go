@@ -2,46 +2,156 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
-	colorable "github.com/mattn/go-colorable"
-	"github.com/pkg/browser"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/internal/segment"
 )
 
-const authURL = "https://auth.dataporten.no/oauth/authorization"
-const kubedConf = ".kubedconf"
+const defaultProviderURL = "https://auth.dataporten.no"
+const authPath = "/oauth/authorization"
+const tokenPath = "/oauth/token"
+
+// dataportenScopes are the scopes of the Dataporten client kubed asks for
+// without -scopes: the issuers read the user, the Groups API the groups
+const dataportenScopes = "userid userid-feide profile email groups"
 
 var (
-	kubeconfig  = flag.String("kube-config", "~/.kube/config", "Absolute path to the kubeconfig config to manage settings")
-	apiserver   = flag.String("api-server", "", "Address of Kubernetes API server (Required)")
-	issuerURL   = flag.String("issuer", "", "Address of JWT Token Issuer (Required)")
-	clusterName = flag.String("name", "", "Name of this Kubernetes cluster, used for context as well (Required)")
-	showVersion = flag.Bool("version", false, "Prints version information and exits")
-	keepContext = flag.Bool("keep-context", false, "Keep the current context or switch to newly created one")
-	port        = flag.Int("port", 49999, "Port number where Oauth2 Provider will redirect Kubed")
-	renew       = flag.String("renew", "", "Name of the cluster to renew JWT token for")
-	clientID    = flag.String("client-id", "", "Client ID for Kubed app (Required)")
-	namespace   = flag.String("namespace", "", "Default namespace to use (optional)")
-	manualInput = flag.Bool("manual-input", false, "Input authentication token manually (no local browser)")
-	version     = "none"
-	reqErr      error
-	home        = ""
+	kubeConfigFlag         = flag.String("kube-config", "~/.kube/config", "Absolute path to the kubeconfig config to manage settings, several files separated as in KUBECONFIG are all written to")
+	apiserver              = flag.String("api-server", "", "Address of Kubernetes API server (Required)")
+	issuerURL              = flag.String("issuer", "", "Address of JWT Token Issuer (Required)")
+	clusterName            = flag.String("name", "", "Name of this Kubernetes cluster, used for context as well (Required)")
+	showVersion            = flag.Bool("version", false, "Prints version information and exits")
+	keepContext            = flag.Bool("keep-context", false, "Keep the current context or switch to newly created one")
+	port                   = flag.Int("port", 49999, "Port number where Oauth2 Provider will redirect Kubed")
+	renew                  = flag.String("renew", "", "Name of the cluster to renew JWT token for")
+	clientID               = flag.String("client-id", "", "Client ID for Kubed app (Required)")
+	clientSecret           = flag.String("client-secret", "", "Client secret for confidential clients as \"env:NAME\", \"file:PATH\" or \"prompt\" (optional)")
+	namespace              = flag.String("namespace", "", "Default namespace to use (optional)")
+	manualInput            = flag.Bool("manual-input", false, "Input authentication token manually (no local browser)")
+	loginHint              = flag.String("login-hint", "", "Username or email to suggest to the OAuth2 Provider (optional)")
+	prompt                 = flag.String("prompt", "", "Prompt passed to the OAuth2 Provider, e.g. login, select_account or consent (optional)")
+	acrValues              = flag.String("acr-values", "", "Space separated authentication context classes to require, e.g. for MFA (optional)")
+	scopes                 = flag.String("scopes", "", "Space separated scopes registered for the client, openid is added (default the Dataporten scopes kubed uses)")
+	revocationURL          = flag.String("revocation-url", "", "Token revocation endpoint of the OAuth2 Provider, used by logout (optional)")
+	logFormat              = flag.String("log-format", "text", "Log format, text or json")
+	logLevel               = flag.String("log-level", "", "Log level: debug, info, warning or error (default from KUBED_LOG_LEVEL or info)")
+	debugHTTP              = flag.Bool("debug-http", false, "Log requests to the OAuth2 Provider and JWT Token Issuer, with tokens redacted")
+	retryAttempts          = flag.Int("retry-attempts", 3, "Number of attempts for requests to the JWT Token Issuer")
+	retryBackoff           = flag.Duration("retry-backoff", time.Second, "Wait before the first retry, doubled for each following retry")
+	httpTimeout            = flag.Duration("http-timeout", 30*time.Second, "Timeout for each request to the OAuth2 Provider and JWT Token Issuer")
+	callbackTimeout        = flag.Duration("callback-timeout", 5*time.Minute, "How long to wait for the browser authentication to complete")
+	clockSkew              = flag.Duration("clock-skew", time.Minute, "Tolerated difference between the local clock and server clocks")
+	dataDir                = flag.String("data-dir", "", "Directory for kubed configuration and cache (default ~/.kubed or XDG directories)")
+	exportCluster          = flag.String("cluster", "", "Name of the cluster to export (all clusters if empty) or to proxy to")
+	importFile             = flag.String("f", "", "File or URL with cluster definitions to import, - for stdin")
+	registryURL            = flag.String("from", "", "URL of a cluster registry to log in from, with the cluster name as fragment")
+	registryKey            = flag.String("registry-key", "", "Base64 encoded Ed25519 public key to verify cluster registries (default from KUBED_REGISTRY_KEY)")
+	registryInsecure       = flag.Bool("registry-insecure", false, "Use cluster registries without verifying their signature")
+	discover               = flag.Bool("discover", false, "Discover CA and canonical address from the cluster-info ConfigMap of the API server")
+	force                  = flag.Bool("force", false, "Overwrite kubeconfig entries that were not created by kubed")
+	assumeYes              = flag.Bool("yes", false, "Answer yes to all questions")
+	pruneDays              = flag.Int("prune-days", 30, "Prune clusters whose token expired more than this many days ago")
+	checkReachable         = flag.Bool("check-reachable", false, "Also prune clusters whose API server is unreachable")
+	readStdin              = flag.Bool("stdin", false, "Read the token from standard input instead of kubeconfig")
+	verifyToken            = flag.Bool("verify", false, "Verify the token signature against the issuer JWKS")
+	renewIfExpired         = flag.Bool("renew-if-expired", false, "Log in again before printing the token if it has expired")
+	outputFormat           = flag.String("output", "text", "Output format of login, renew, status and list: text or json")
+	quiet                  = flag.Bool("quiet", false, "Only print errors and results, no informational logs")
+	nonInteractive         = flag.Bool("non-interactive", false, "Never prompt or open a browser, fail instead")
+	notifyWithin           = flag.Duration("notify-within", time.Hour, "Notify about tokens expiring within this duration")
+	preHook                = flag.String("pre-hook", "", "Command to run before logging in to the cluster")
+	postHook               = flag.String("post-hook", "", "Command to run after logging in to or renewing the cluster")
+	daemonInterval         = flag.Duration("daemon-interval", 5*time.Minute, "How often the daemon checks for tokens to renew")
+	renewBefore            = flag.Duration("renew-before", 15*time.Minute, "The daemon renews tokens expiring within this duration")
+	webhookURL             = flag.String("webhook", "", "HTTPS URL the daemon posts renewal successes and failures to")
+	daemonOnce             = flag.Bool("once", false, "Let the daemon renew due tokens once and exit")
+	daemonTimer            = flag.Bool("timer", false, "Install a timer running a single renewal round instead of a long running daemon")
+	installSystemd         = flag.Bool("systemd", false, "Install the daemon as systemd user service")
+	installLaunchd         = flag.Bool("launchd", false, "Install the daemon as launchd agent")
+	installWindows         = flag.Bool("windows-service", false, "Install the daemon as Windows scheduled task, started when you log in")
+	agentSocketPath        = flag.String("agent-socket", "", "Socket of the kubed agent, defaults to KUBED_AGENT_SOCK or agent.sock in the cache directory")
+	listenAddr             = flag.String("listen", "127.0.0.1:8001", "Address the proxy and dev-sandbox listen on")
+	showQR                 = flag.Bool("qr", true, "Show the authorization URL as QR code when entering the redirect manually")
+	useClipboard           = flag.Bool("clipboard", false, "Copy the authorization URL to the clipboard, and read the redirected URL from it in manual mode")
+	authProvider           = flag.Bool("auth-provider", false, "Write an oidc auth-provider user entry, so kubectl refreshes the token itself")
+	oidcIssuer             = flag.String("oidc-issuer", "https://auth.dataporten.no", "OpenID Connect issuer kubectl refreshes tokens with, used with -auth-provider when the ID token names none")
+	useExecCredential      = flag.Bool("exec-credential", false, "Let kubectl get the token from kubed as exec credential plugin instead of embedding it")
+	execAgent              = flag.Bool("exec-agent", false, "Let the exec credential plugin use the kubed agent socket")
+	responseMode           = flag.String("response-mode", "", "How the provider returns the response: query, fragment or form_post")
+	httpsCallback          = flag.Bool("https-callback", false, "Receive the redirect on https://127.0.0.1:<port> with a temporary self-signed certificate")
+	tokenExchange          = flag.Bool("token-exchange", false, "Get the JWT by OAuth2 token exchange (RFC 8693), with -issuer as the token endpoint")
+	tokenAudience          = flag.String("token-audience", "", "Audience to request the exchanged token for (optional)")
+	issuerTokenPath        = flag.String("issuer-token-path", "", "Path below -issuer to get the JWT token from, a template given .AccessToken, .ClientID and .Cluster (optional)")
+	issuerCAPath           = flag.String("issuer-ca-path", "", "Path below -issuer to get the CA certificate from, a template like -issuer-token-path (default \"/ca\")")
+	issuerMethod           = flag.String("issuer-method", "", "HTTP method of the JWT token request (default GET)")
+	issuerBody             = flag.String("issuer-body", "", "Body template of the JWT token request, sent as JSON when it starts with { and as form otherwise (optional)")
+	issuerClientCert       = flag.String("issuer-client-cert", "", "Client certificate (PEM) to present to issuers requiring mTLS, used with -issuer-client-key")
+	issuerClientKey        = flag.String("issuer-client-key", "", "Private key (PEM) of -issuer-client-cert")
+	issuerKubeConfig       = flag.Bool("issuer-kubeconfig", false, "The issuer returns a complete kubeconfig, take token, CA and API server from it")
+	acceptNewCA            = flag.Bool("accept-new-ca", false, "Accept a CA certificate different from the one written for the cluster before")
+	parallelLogins         = flag.Int("parallel", 4, "Number of issuers to get tokens from at once when logging in to several clusters")
+	loginGroup             = flag.String("group", "", "Login group to log in to all clusters of, defined with \"kubed group\"")
+	secretBackend          = flag.String("secret-backend", "", "Where to keep the tokens of the cluster: file (default), vault, pass or command")
+	secretPathFlag         = flag.String("secret-path", "", "Path of the tokens in the secret backend, a template given .Cluster, e.g. secret/kubed/{{.Cluster}}")
+	secretReadCommand      = flag.String("secret-read-command", "", "Shell command printing the tokens stored at $KUBED_SECRET_PATH, used with -secret-backend command")
+	secretWriteCommand     = flag.String("secret-write-command", "", "Shell command storing the tokens read from stdin at $KUBED_SECRET_PATH")
+	secretRemoveCommand    = flag.String("secret-remove-command", "", "Shell command removing the tokens at $KUBED_SECRET_PATH (optional)")
+	proxyURL               = flag.String("proxy-url", "", "Proxy to reach the API server through, e.g. socks5://localhost:1080, written as proxy-url to kubeconfig")
+	tunnelHost             = flag.String("tunnel-host", "", "SSH bastion as host[:port] that \"kubed tunnel\" reaches the API server through")
+	tunnelUser             = flag.String("tunnel-user", "", "User on the SSH bastion (default $USER)")
+	tunnelKey              = flag.String("tunnel-key", "", "SSH private key for the bastion, keys in ssh-agent are used as well")
+	tunnelPort             = flag.Int("tunnel-port", 0, "Local port of the tunnel (default any free port)")
+	asUser                 = flag.String("as-user", "", "User the context impersonates, e.g. to test RBAC as a less privileged identity")
+	clientCertificate      = flag.Bool("client-cert", false, "Have the issuer sign a client certificate instead of issuing a JWT, for clusters without OIDC")
+	adminContext           = flag.String("admin-context", "", "Context in kubeconfig with the rights to create ServiceAccounts and tokens, used by ci-login")
+	serviceAccount         = flag.String("service-account", "", "ServiceAccount ci-login creates or reuses and requests a token for")
+	saTokenDuration        = flag.Duration("sa-token-duration", 24*time.Hour, "Requested lifetime of the ServiceAccount token of ci-login")
+	groupsAPI              = flag.String("groups-api", "https://groups-api.dataporten.no", "Groups API listing the groups mapped to namespaces with -group-namespace")
+	daemonListen           = flag.String("daemon-listen", "", "Address the daemon and agent serve /metrics, /healthz and /readyz on, e.g. 127.0.0.1:9464 (optional)")
+	releaseURL             = flag.String("release-url", "https://api.github.com/repos/UNINETT/kubed/releases/latest", "Release endpoint self-update checks for new versions")
+	checkOnly              = flag.Bool("check-only", false, "Only report whether a newer release exists, without updating")
+	manPage                = flag.Bool("man", false, "Print the manual page, used with docs")
+	markdownDocs           = flag.Bool("markdown", false, "Print the markdown reference, used with docs")
+	providerURL            = flag.String("provider-url", "", "Address of the OAuth2 Provider (default https://auth.dataporten.no)")
+	promptFormat           = flag.String("prompt-format", segment.DefaultFormat, "Go template of kubed prompt, with .Context, .Namespace, .Expiry and .Minutes")
+	promptShell            = flag.String("prompt-shell", "", "Shell kubed prompt is embedded in, bash or zsh, so the colors don't count as prompt width")
+	colorMode              = flag.String("color", "auto", "Color the output: always, never, or auto for terminals unless NO_COLOR is set")
+	logFile                = flag.String("log-file", "", "Write the logs to this file instead of the terminal, rotating it by -log-max-size and -log-max-age")
+	logMaxSize             = flag.Int("log-max-size", 10, "Size in MB at which -log-file is rotated")
+	logMaxAge              = flag.Duration("log-max-age", 24*time.Hour, "Age at which -log-file is rotated, 0 to only rotate by size")
+	logKeep                = flag.Int("log-keep", 5, "Number of rotated log files to keep")
+	issuerHealthURL        = flag.String("issuer-health-url", "", "Health endpoint of the issuer, checked instead of the token and CA endpoints before logging in (optional)")
+	skipIssuerCheck        = flag.Bool("skip-issuer-check", false, "Don't check that the issuer is up before logging in")
+	allowHTTP              = flag.Bool("allow-http", false, "Allow plain http for -api-server, -issuer and the other service URLs, e.g. in development")
+	clusterTemplate        = flag.String("cluster-template", "", "Go template naming the kubeconfig cluster entry, given .Name, .IssuerHost, .Username, .Namespace and .Claims (default the cluster name)")
+	userTemplate           = flag.String("user-template", "", "Go template naming the kubeconfig user entry, like -cluster-template")
+	contextTemplate        = flag.String("context-template", "", "Go template naming the kubeconfig context, like -cluster-template")
+	extraNamespaces        = flag.String("extra-namespaces", "", "Comma separated namespaces to add contexts for, named after the context and the namespace, e.g. name-ns1")
+	separateKubeConfigFlag = flag.Bool("separate-kubeconfig", false, "Give a new cluster its own kubeconfig file in ~/.kube/kubed/<name>.yaml, see kubed env")
+	shellFlag              = flag.String("shell", "", "Shell to print the exports of kubed env for: bash, zsh, fish or powershell, by default the one in SHELL")
+	execValidFor           = flag.Duration("valid-for", 5*time.Minute, "kubed exec renews tokens expiring within this duration before running the command")
+	silentReauth           = flag.Bool("silent-reauth", false, "Without a refresh token, renew through the session with the OAuth2 Provider with prompt=none before logging in again")
+	introspectionURL       = flag.String("introspection-url", "", "Token introspection endpoint of the OAuth2 Provider, used by kubed token introspect and list (optional)")
+	expectedAudience       = flag.String("expected-audience", "", "Audiences the API server accepts, comma separated, to check the token against before writing kubeconfig (optional)")
+	rbacMappingFlag        = flag.String("rbac-mapping", "", "File or http(s) URL of the mapping of groups to roles from the cluster administrators, shown after login (optional)")
+	bundleFile             = flag.String("bundle", "kubed-bundle.yaml", "File kubed record writes the support bundle to")
+	injectFailures         = flag.String("inject", "", "Failures kubed replay injects into the recorded exchanges, e.g. 2=503,4=error")
+	lang                   = flag.String("lang", "", "Language of the messages, en or nb. Defaults to the locale from LC_ALL, LC_MESSAGES or LANG")
+	plain                  = flag.Bool("plain", false, "Plain output for screen readers: no colors, QR codes or drawing, a line per message")
+	tokenTTL               = flag.String("token-ttl", "", "Lifetime to request for the tokens of the cluster, e.g. 8h, where the issuer supports it")
+	version                = "none"
+	home                   = ""
 )
 
 func init() {
-	log.SetFormatter(&log.TextFormatter{ForceColors: true})
-	log.SetOutput(colorable.NewColorableStdout())
-	flag.Parse()
-	if *showVersion {
-		fmt.Println("kubed version", version)
-		os.Exit(0)
-	}
-
 	// Set the home path based on OS
 	if runtime.GOOS == "windows" {
 		home = os.Getenv("HOMEPATH")
@@ -50,18 +160,148 @@ func init() {
 	}
 }
 
+// expandHome replaces a leading ~ in path with the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~") {
+		return strings.Replace(path, "~", home, 1)
+	}
+	return path
+}
+
+// readLine reads a line from the console, giving up when ctx is cancelled
+func readLine(ctx context.Context, r *bufio.Reader) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	lines := make(chan result, 1)
+	go func() {
+		line, err := r.ReadString('\n')
+		lines <- result{line, err}
+	}()
+
+	select {
+	case l := <-lines:
+		return l.line, l.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
 func main() {
+	if isPlugin() {
+		os.Args = append(os.Args[:1], pluginArgs(os.Args[1:])...)
+	}
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("kubed version", version)
+		os.Exit(0)
+	}
+	if plainOutput() {
+		*colorMode = "never"
+	}
+	err := setLanguage(*lang)
+	if err != nil {
+		finish("", withExitCode(exitUsage, err))
+	}
+	err = startSupportMode()
+	if err != nil {
+		finish("", err)
+	}
+
+	err = setupLogging(*logFormat, *logLevel, *colorMode)
+	if err != nil {
+		finish("", withHint(withExitCode(exitUsage, err), "Use -log-format text or json, -log-level debug, info, warning or error, and -color always, never or auto"))
+	}
+	err = validOutputFormat(*outputFormat)
+	if err != nil {
+		finish("", withExitCode(exitUsage, err))
+	}
+	setupOutput(*outputFormat)
+	if *logFile != "" {
+		err = logToFile(expandHome(*logFile), int64(*logMaxSize)<<20, *logMaxAge, *logKeep)
+		if err != nil {
+			finish("", withHint(withExitCode(exitUsage, err), "Check that the directory of -log-file exists and is writable"))
+		}
+	}
+	if *quiet {
+		log.SetLevel(log.ErrorLevel)
+	}
+	if *debugHTTP && log.GetLevel() < log.DebugLevel {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	migrateDataDir()
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	if cmd, args := lookupCommand(); cmd != nil {
+		err := cmd.run(ctx, args)
+		if err != nil {
+			finish("", err)
+		}
+		return
+	}
 
 	if len(os.Args) < 3 {
-		log.Fatal("Please provide parameters to run Kubed, refer ", os.Args[0], " -h")
+		finish("", withExitCode(exitUsage, errors.New("Please provide parameters to run Kubed, refer "+os.Args[0]+" -h")))
 	}
 
 	var cluster *Cluster
-	var err error
 	if *renew != "" {
 		cluster, err = readConfig(*renew)
 		if err != nil {
-			log.Fatal(err)
+			finish(*renew, err)
+		}
+
+		// An explicit -kube-config, e.g. from kubectl --kubeconfig, wins over the saved one
+		if flagGiven("kube-config") {
+			setKubeConfigs(cluster, *kubeConfigFlag)
+		}
+
+		// Namespaces change between semesters, -namespace moves the context
+		// along with the renewal, and later renewals keep it
+		if flagGiven("namespace") && *namespace != "" && *namespace != cluster.NameSpace {
+			err = validNamespace(*namespace)
+			if err != nil {
+				finish(*renew, withExitCode(exitUsage, err))
+			}
+			cluster.NameSpace = *namespace
+			err = updateCluster(cluster.Name, func(c *Cluster) { c.NameSpace = *namespace })
+			if err != nil {
+				finish(*renew, errors.Wrap(err, "Failed in saving kubedconfig"))
+			}
+		}
+		// The contexts of namespaces no longer given are removed on login
+		if flagGiven("extra-namespaces") {
+			cluster.ExtraNamespaces, err = parseNamespaces(*extraNamespaces)
+			if err != nil {
+				finish(*renew, withExitCode(exitUsage, err))
+			}
+		}
+
+		// Allow forcing account selection or re-login for this renewal only
+		if *loginHint != "" {
+			cluster.LoginHint = *loginHint
+		}
+		if *prompt != "" {
+			cluster.Prompt = *prompt
+		}
+		if *silentReauth {
+			cluster.SilentReauth = true
+		}
+		// The lifetime depends on the machine, later renewals keep it
+		if flagGiven("token-ttl") {
+			err = validTokenTTL(*tokenTTL)
+			if err != nil {
+				finish(*renew, withExitCode(exitUsage, err))
+			}
+			cluster.TokenTTL = *tokenTTL
+			err = updateCluster(cluster.Name, func(c *Cluster) { c.TokenTTL = *tokenTTL })
+			if err != nil {
+				finish(*renew, errors.Wrap(err, "Failed in saving kubedconfig"))
+			}
 		}
 	} else {
 		cluster = setConfig(
@@ -69,96 +309,114 @@ func main() {
 			*apiserver,
 			*issuerURL,
 			*clientID,
-			*kubeconfig,
+			*clientSecret,
+			*kubeConfigFlag,
 			*keepContext,
 			*port,
 			*namespace,
-			*manualInput)
+			*manualInput,
+			*loginHint,
+			*prompt,
+			*acrValues,
+			*revocationURL)
 
-		// Check if we have all the required parameters
-		if cluster.Name == "" || cluster.IssuerURL == "" || cluster.APIServer == "" || cluster.ClientID == "" {
-			log.Fatal("Please provide all the required parameter, refer ", os.Args[0], " -h")
+		// Its own kubeconfig file, unless -kube-config names another
+		if wantSeparateKubeConfig() && !flagGiven("kube-config") {
+			setKubeConfigs(cluster, separateKubeConfig(cluster.Name))
 		}
+		cluster.Scopes = *scopes
+		cluster.ResponseMode = *responseMode
+		cluster.HTTPSCallback = *httpsCallback
+		cluster.TokenExchange = *tokenExchange
+		cluster.TokenAudience = *tokenAudience
+		cluster.ExpectedAudience = *expectedAudience
+		cluster.TokenTTL = *tokenTTL
+		cluster.RBACMapping = *rbacMappingFlag
+		cluster.IssuerKubeConfig = *issuerKubeConfig
+		cluster.SilentReauth = *silentReauth
+		cluster.IntrospectionURL = *introspectionURL
+		cluster.SecretBackend = *secretBackend
+		cluster.SecretPath = *secretPathFlag
+		cluster.ProxyURL = *proxyURL
+		cluster.ProviderURL = *providerURL
+		cluster.IssuerHealthURL = *issuerHealthURL
+		cluster.AsUser = *asUser
+		cluster.ClientCertificate = *clientCertificate
+		cluster.AsGroups = asGroups
+		cluster.Tunnel = newTunnelConfig(*tunnelHost, *tunnelUser, *tunnelKey, *tunnelPort)
+		cluster.SecretCommands = newSecretCommands(*secretReadCommand, *secretWriteCommand, *secretRemoveCommand)
+		cluster.IssuerAPI = newIssuerAPI(*issuerTokenPath, *issuerCAPath, *issuerMethod, *issuerBody)
+		cluster.Naming = newNamingTemplates(*clusterTemplate, *userTemplate, *contextTemplate)
+		cluster.AuthProvider = *authProvider
+		cluster.ExecCredential = *useExecCredential
+		cluster.PreHook = *preHook
+		cluster.PostHook = *postHook
 
-		// Save the current cluster config, so we can reuse it during token renewal
-		err = saveConfig(cluster)
+		// Check if we have all the required parameters, and that they make sense
+		err = validCluster(cluster)
 		if err != nil {
-			log.Fatal("Failed in saving kubedconfig ", err)
+			finish(cluster.Name, err)
 		}
-	}
-
-	// Fix Home Path for Kubeconfig
-	if strings.HasPrefix(cluster.KubeConfig, "~") {
-		cluster.KubeConfig = strings.Replace(cluster.KubeConfig, "~", home, 1)
-	}
 
-	log.Info("Requesting Access Token from Dataporten")
-	err = nil
-	token := ""
-
-	// Manually fetch token if browser is unavailable from console:
-	if cluster.ManualInput {
-		fmt.Println("Open a browser and navigate to " + authURL + "?response_type=token&client_id=" + cluster.ClientID)
-		fmt.Println("After authentication, you are redirected to an invalid URL. Copy/paste this url below:")
-		fmt.Print("Redirected URL: ")
-		tokenURLString := ""
-		tokenURLString, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		err = validSecretBackend(cluster.SecretBackend, cluster.SecretPath, cluster.SecretCommands)
 		if err != nil {
-			log.Fatal("Something disastrous happened while getting input from console, please run kubed again ", err)
-		}
-		hashAt := strings.Index(tokenURLString, "#")
-		fullHash := tokenURLString[hashAt+1 : len(tokenURLString)]
-		hashes := strings.Split(fullHash, "&")
-		for _, hash := range hashes {
-			keyValue := strings.Split(hash, "=")
-			if keyValue[0] == "access_token" {
-				token = keyValue[1]
-			}
+			finish(cluster.Name, withExitCode(exitUsage, err))
 		}
-		// Open browser to authenticate user and get access token otherwise:
-	} else {
-		go func(dataportenAuthURL string) {
-			err = browser.OpenURL(dataportenAuthURL)
+		cluster.IssuerHeaders, err = parseHeaders(issuerHeaderFlags)
+		if err != nil {
+			finish(cluster.Name, withExitCode(exitUsage, err))
+		}
+		cluster.GroupNamespaces, err = parseGroupNamespaces(groupNamespaceFlags)
+		if err != nil {
+			finish(cluster.Name, withExitCode(exitUsage, err))
+		}
+		cluster.ExtraNamespaces, err = parseNamespaces(*extraNamespaces)
+		if err != nil {
+			finish(cluster.Name, withExitCode(exitUsage, err))
+		}
+		cluster.IssuerClientCert, cluster.IssuerClientKey = *issuerClientCert, *issuerClientKey
+		_, err = issuerTLSConfig(cluster)
+		if err != nil {
+			finish(cluster.Name, withExitCode(exitUsage, err))
+		}
+
+		if *discover {
+			err = applyDiscovery(ctx, cluster)
 			if err != nil {
-				log.Fatal("Failed in opening browser ", err)
+				finish(cluster.Name, errors.Wrap(err, "Failed in discovering cluster from cluster-info"))
 			}
-		}(authURL + "?response_type=token&client_id=" + cluster.ClientID)
-
-		token, err = getToken(cluster.Port)
-	}
+		}
 
-	if err != nil {
-		log.Fatal("Error in getting access token", err)
-	}
-	if reqErr != nil {
-		log.Fatal("Error in getting access token ", reqErr)
-		os.Exit(1)
+		// Save the current cluster config, so we can reuse it during token renewal
+		err = saveConfig(cluster)
+		if err != nil {
+			finish(cluster.Name, errors.Wrap(err, "Failed in saving kubedconfig"))
+		}
 	}
 
-	log.Info("Requesting JWT Token from ", cluster.IssuerURL)
-
-	cfg := new(KubeConfigSetup)
-	cfg.Token, err = getJWTToken(token, cluster.IssuerURL)
-	if err != nil {
-		log.Fatal("Failed in getting JWT token ", err)
-		os.Exit(1)
+	// A renewal asking for a prompt or another account needs the browser,
+	// others try the refresh token first
+	if *renew != "" && *prompt == "" && *loginHint == "" {
+		err = renewLogin(ctx, cluster)
+	} else {
+		err = login(ctx, cluster)
 	}
-	cfg.CertificateAuthorityData, err = getCACert(cluster.IssuerURL)
-	if err != nil {
-		log.Warn("No custom CA certificate provided, assuming running with standard certificate")
+	if err == nil {
+		showGroups(ctx, cluster)
 	}
-
-	cfg.ClusterName = cluster.Name
-	cfg.ClusterServerAddress = cluster.APIServer
-	cfg.kubeConfigFile = cluster.KubeConfig
-	cfg.KeepContext = cluster.KeepContext
-	cfg.NameSpace = cluster.NameSpace
-
-	err = SetupKubeConfig(cfg)
-	if err != nil {
-		log.Fatal("Failed in setting the kubeconfig ", err)
+	if err == nil && len(cluster.GroupNamespaces) > 0 && cluster.NameSpace == "" && !*nonInteractive {
+		err = pickNamespace(ctx, cluster)
 	}
+	finish(cluster.Name, err)
+}
 
-	log.Info("Kubernetes configuration has been saved in \"", cluster.KubeConfig, "\" with context \"", cluster.Name, "\"")
-	log.Info("To renew JWT token for this cluster run: \"", os.Args[0], " -renew ", cluster.Name, "\"")
+// flagGiven tells whether the flag was given on the command line
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
 }
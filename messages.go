@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// catalogs translate the messages users see in the console and the browser,
+// keyed by the English message. Messages without a translation stay English.
+var catalogs = map[string]map[string]string{
+	"nb": norwegianMessages,
+}
+
+// languageAliases map languages to the catalog read instead, Norwegian users
+// with nynorsk or plain "no" locales read bokmål
+var languageAliases = map[string]string{
+	"no": "nb",
+	"nn": "nb",
+}
+
+// messageLanguage is the language of the messages, "en" or a catalog
+var messageLanguage = "en"
+
+// setLanguage selects the language of the messages from -lang or else the
+// locale of the environment, in the order of POSIX: LC_ALL, LC_MESSAGES and
+// LANG. Only -lang fails for languages kubed has no messages in.
+func setLanguage(lang string) error {
+	if lang != "" {
+		l, ok := parseLocale(lang)
+		if !ok {
+			return fmt.Errorf("Unsupported language %q, use one of %s", lang, strings.Join(languages(), ", "))
+		}
+		messageLanguage = l
+		return nil
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(env); value != "" {
+			messageLanguage, _ = parseLocale(value)
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseLocale finds the language of a locale like "nb_NO.UTF-8", "en" for
+// the locales kubed has no messages in
+func parseLocale(locale string) (string, bool) {
+	l := strings.ToLower(locale)
+	if i := strings.IndexAny(l, "_-.@"); i >= 0 {
+		l = l[:i]
+	}
+	if alias, ok := languageAliases[l]; ok {
+		l = alias
+	}
+	if _, ok := catalogs[l]; ok || l == "en" {
+		return l, true
+	}
+	return "en", false
+}
+
+func languages() []string {
+	l := []string{"en"}
+	for lang := range catalogs {
+		l = append(l, lang)
+	}
+	sort.Strings(l[1:])
+	return l
+}
+
+// tr translates a message to the selected language. Given args, the message
+// is a format for them, as with fmt.Sprintf.
+func tr(message string, args ...interface{}) string {
+	if translated, ok := catalogs[messageLanguage][message]; ok {
+		message = translated
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
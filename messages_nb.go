@@ -0,0 +1,57 @@
+package main
+
+// norwegianMessages are the messages in Norwegian bokmål
+var norwegianMessages = map[string]string{
+	// Logging in
+	"Requesting Access Token from Dataporten":                                                "Ber Dataporten om tilgangstoken",
+	"Authorization URL copied to the clipboard":                                              "Innloggingsadressen er kopiert til utklippstavlen",
+	"Open a browser and navigate to %s":                                                      "Åpne en nettleser og gå til %s",
+	"Or scan this code to log in on your phone:":                                             "Eller skann denne koden for å logge inn på telefonen:",
+	"After authentication, you are redirected to an invalid URL. Copy/paste this url below:": "Etter innloggingen blir du sendt videre til en ugyldig adresse. Kopier og lim inn adressen nedenfor:",
+	"Or copy it and press Enter to read it from the clipboard.":                              "Eller kopier den og trykk Enter for å lese den fra utklippstavlen.",
+	"Redirected URL: ": "Adressen du ble sendt til: ",
+	"Failed in opening browser, open %s yourself or rerun with -manual-input":                                                                 "Klarte ikke å åpne nettleseren, åpne %s selv eller kjør på nytt med -manual-input",
+	"Press Enter to renew the login to %q through your session with the provider: ":                                                           "Trykk Enter for å fornye innloggingen til %q gjennom økten din hos leverandøren: ",
+	"Renewing through the session with the OAuth2 Provider":                                                                                   "Fornyer gjennom økten hos OAuth2-leverandøren",
+	"The OAuth2 Provider needs you to log in again":                                                                                           "OAuth2-leverandøren krever at du logger inn på nytt",
+	"Kubernetes configuration has been saved in \"%s\" with context \"%s\"":                                                                   "Kubernetes-konfigurasjonen er lagret i \"%s\" med konteksten \"%s\"",
+	"To renew JWT token for this cluster run: \"%s -renew %s\"":                                                                               "Forny JWT-tokenet for denne klyngen med: \"%s -renew %s\"",
+	"The token has no groups claim, RBAC can only match your user":                                                                            "Tokenet har ingen grupper, RBAC kan bare gi tilgang til brukeren din",
+	"Groups in the token: %s":                                                                                                                 "Grupper i tokenet: %s",
+	"None of your groups give roles on %q by the RBAC mapping, kubectl will be forbidden. Ask the cluster administrators to bind one of them": "Ingen av gruppene dine gir roller på %q etter RBAC-oversikten, så kubectl blir nektet tilgang. Be klyngeadministratorene om å gi en av dem tilgang",
+
+	// The page the browser shows after the redirect
+	"Processing response":                                      "Behandler svaret",
+	"Kubed has successfully processed response.":               "Kubed har behandlet svaret.",
+	"Please close this window and return to the command line.": "Lukk dette vinduet og gå tilbake til kommandolinjen.",
+
+	// Questions
+	"[y/N]": "[j/N]",
+	"[Y/n]": "[J/n]",
+	"y":     "j",
+	"yes":   "ja",
+
+	// Errors
+	"Please provide all the required parameters":                                             "Oppgi alle de påkrevde parameterne",
+	"Error in getting access token":                                                          "Feil ved henting av tilgangstoken",
+	"The OAuth2 Provider refused the request: %s %s":                                         "OAuth2-leverandøren avviste forespørselen: %s %s",
+	"Failed in listening for the redirect from the OAuth2 Provider":                          "Klarte ikke å lytte etter videresendingen fra OAuth2-leverandøren",
+	"Gave up waiting for the redirect from the OAuth2 Provider":                              "Ga opp å vente på videresendingen fra OAuth2-leverandøren",
+	"Something disastrous happened while getting input from console, please run kubed again": "Noe gikk alvorlig galt under lesing fra konsollen, kjør kubed på nytt",
+	"The issuer gave a token of %q for %s, but the API server expects %s":                    "Utstederen ga et token for %q %s, men API-serveren forventer %s",
+	"no audience": "uten målgruppe",
+	"audience %s": "med målgruppen %s",
+	" or ":        " eller ",
+
+	// Hints
+	"See kubed help for the commands and flags":                                                                                                       "Se kubed help for kommandoene og flaggene",
+	"Log in again with -prompt login, or ask your cluster administrators for access":                                                                  "Logg inn på nytt med -prompt login, eller be klyngeadministratorene om tilgang",
+	"Check the -issuer address and your network, -debug-http shows the requests kubed makes":                                                          "Sjekk adressen i -issuer og nettverket ditt, -debug-http viser forespørslene kubed gjør",
+	"Check that the file given with -kube-config is writable":                                                                                         "Sjekk at du kan skrive til filen gitt med -kube-config",
+	"Try again, or give more time with -callback-timeout or -http-timeout":                                                                            "Prøv igjen, eller gi mer tid med -callback-timeout eller -http-timeout",
+	"See the configured clusters with kubed list":                                                                                                     "Se de konfigurerte klyngene med kubed list",
+	"Run the same command again to start over":                                                                                                        "Kjør den samme kommandoen igjen for å begynne på nytt",
+	"Rerun with %s, refer kubed -h":                                                                                                                   "Kjør på nytt med %s, se kubed -h",
+	"Port %d is busy, perhaps another kubed is logging in. Wait for it, or rerun with a -port registered as redirect URI of the client":               "Port %d er opptatt, kanskje en annen kubed holder på å logge inn. Vent på den, eller kjør på nytt med en -port som er registrert som redirect URI for klienten",
+	"The aud claim must match the --oidc-client-id of the API server, check -client-id and -token-audience against it, or correct -expected-audience": "Målgruppen (aud) må stemme med --oidc-client-id på API-serveren, sjekk -client-id og -token-audience mot den, eller rett -expected-audience",
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseLocale(t *testing.T) {
+	for locale, expected := range map[string]string{
+		"nb_NO.UTF-8": "nb",
+		"nn_NO":       "nb",
+		"no":          "nb",
+		"NB-no":       "nb",
+		"en_US.UTF-8": "en",
+		"C":           "en",
+		"de_DE":       "en",
+	} {
+		if lang, _ := parseLocale(locale); lang != expected {
+			t.Errorf("Expected %q for locale %q, got %q", expected, locale, lang)
+		}
+	}
+}
+
+func TestSetLanguage(t *testing.T) {
+	defer func() { messageLanguage = "en" }()
+
+	for env, value := range map[string]string{"LC_ALL": "", "LC_MESSAGES": "", "LANG": "nb_NO.UTF-8"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, value)
+	}
+	if err := setLanguage(""); err != nil || messageLanguage != "nb" {
+		t.Errorf("Expected nb from LANG, got %q %v", messageLanguage, err)
+	}
+	if tr("Groups in the token: %s", "students") != "Grupper i tokenet: students" {
+		t.Errorf("Expected the Norwegian message, got %q", tr("Groups in the token: %s", "students"))
+	}
+	if tr("Not in the catalog") != "Not in the catalog" {
+		t.Error("Expected messages without translation to stay English")
+	}
+
+	if err := setLanguage("en"); err != nil || messageLanguage != "en" {
+		t.Errorf("Expected -lang to win over LANG, got %q %v", messageLanguage, err)
+	}
+	if err := setLanguage("de"); err == nil {
+		t.Error("Expected -lang de to be unsupported")
+	}
+}
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// TestCatalogFormats makes sure the translations take the arguments of the
+// English messages, in the same order
+func TestCatalogFormats(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for message, translated := range catalog {
+			expected := strings.Join(formatVerb.FindAllString(message, -1), " ")
+			got := strings.Join(formatVerb.FindAllString(translated, -1), " ")
+			if expected != got {
+				t.Errorf("The %s translation of %q has the verbs %q, expected %q", lang, message, got, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// renewalMetrics counts the renewals of the daemon or agent per cluster, and
+// keeps the token expiry, exposed in the Prometheus text format on /metrics
+type renewalMetrics struct {
+	mutex     sync.Mutex
+	attempted map[string]int
+	succeeded map[string]int
+	failed    map[string]int
+	expiry    map[string]time.Time
+	// lastRenewal and lastError are reported on /healthz and /readyz
+	lastRenewal map[string]time.Time
+	lastError   map[string]string
+}
+
+var metrics = newRenewalMetrics()
+
+func newRenewalMetrics() *renewalMetrics {
+	return &renewalMetrics{
+		attempted:   map[string]int{},
+		succeeded:   map[string]int{},
+		failed:      map[string]int{},
+		expiry:      map[string]time.Time{},
+		lastRenewal: map[string]time.Time{},
+		lastError:   map[string]string{},
+	}
+}
+
+// countRenewal counts a renewal attempt of the cluster and its outcome
+func (m *renewalMetrics) countRenewal(cluster string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.attempted[cluster]++
+	if err != nil {
+		m.failed[cluster]++
+		m.lastError[cluster] = err.Error()
+	} else {
+		m.succeeded[cluster]++
+		m.lastRenewal[cluster] = time.Now()
+		delete(m.lastError, cluster)
+	}
+}
+
+// setExpiry records when the token of the cluster expires, zero if unknown
+func (m *renewalMetrics) setExpiry(cluster string, expiry time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if expiry.IsZero() {
+		delete(m.expiry, cluster)
+		return
+	}
+	m.expiry[cluster] = expiry
+}
+
+func (m *renewalMetrics) write(w io.Writer, now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	counters := []struct {
+		name   string
+		help   string
+		values map[string]int
+	}{
+		{"kubed_renewals_attempted_total", "Token renewals attempted.", m.attempted},
+		{"kubed_renewals_succeeded_total", "Token renewals that succeeded.", m.succeeded},
+		{"kubed_renewals_failed_total", "Token renewals that failed.", m.failed},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		// Every cluster that was attempted has all three series, failures start at 0
+		for _, cluster := range sortedKeys(m.attempted) {
+			fmt.Fprintf(w, "%s{cluster=%q} %d\n", c.name, cluster, c.values[cluster])
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP kubed_token_expiry_seconds Seconds until the token expires, negative once expired.\n")
+	fmt.Fprintf(w, "# TYPE kubed_token_expiry_seconds gauge\n")
+	var clusters []string
+	for cluster := range m.expiry {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		fmt.Fprintf(w, "kubed_token_expiry_seconds{cluster=%q} %d\n", cluster, int64(m.expiry[cluster].Sub(now)/time.Second))
+	}
+}
+
+func sortedKeys(values map[string]int) []string {
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serveDaemonHTTP serves /metrics, /healthz and /readyz on -daemon-listen, if given, until ctx is done
+func serveDaemonHTTP(ctx context.Context) error {
+	if *daemonListen == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", *daemonListen)
+	if err != nil {
+		return withHint(errors.Wrap(err, "Failed in listening on "+*daemonListen),
+			"Give another address with -daemon-listen")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.write(w, time.Now())
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, metrics.health(time.Now()), true)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		health := metrics.health(time.Now())
+		writeHealth(w, health, health.Ready)
+	})
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	go srv.Serve(listener)
+
+	log.Info("Serving metrics and health on http://", listener.Addr())
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenewalMetrics(t *testing.T) {
+	m := newRenewalMetrics()
+	now := time.Now()
+	m.countRenewal("lab", nil)
+	m.countRenewal("lab", errors.New("refused"))
+	m.countRenewal("course", nil)
+	m.setExpiry("lab", now.Add(90*time.Second))
+
+	var out bytes.Buffer
+	m.write(&out, now)
+	for _, line := range []string{
+		`kubed_renewals_attempted_total{cluster="lab"} 2`,
+		`kubed_renewals_failed_total{cluster="lab"} 1`,
+		`kubed_renewals_failed_total{cluster="course"} 0`,
+		`kubed_token_expiry_seconds{cluster="lab"} 90`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Expected %q in metrics:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	m := newRenewalMetrics()
+	now := time.Now()
+	m.countRenewal("lab", nil)
+	m.setExpiry("lab", now.Add(time.Hour))
+	if health := m.health(now); !health.Ready || health.Clusters["lab"].LastRenewal == nil {
+		t.Errorf("Expected ready with last renewal, got %+v", health)
+	}
+
+	m.countRenewal("course", errors.New("refused"))
+	m.setExpiry("course", now.Add(-time.Hour))
+	health := m.health(now)
+	if health.Ready {
+		t.Errorf("Expected not ready with an expired token")
+	}
+	if c := health.Clusters["course"]; !c.Expired || c.LastError != "refused" || c.LastRenewal != nil {
+		t.Errorf("Unexpected health of course %+v", c)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func init() {
+	commands["migrate"] = &command{
+		usage: "migrate [cluster] [-exec-agent]",
+		help:  "Switch kubeconfig users from embedded tokens to kubed as exec credential plugin",
+		run:   migrate,
+	}
+}
+
+func migrate(ctx context.Context, args []string) error {
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for i := range clusters {
+		c := &clusters[i]
+		if len(args) > 0 && !c.matches(args[0]) {
+			continue
+		}
+		if c.ExecCredential {
+			log.Info("\"", c.Name, "\" already uses kubed as exec credential plugin")
+			continue
+		}
+		err = migrateCluster(ctx, c)
+		if err != nil {
+			return err
+		}
+		log.Info("Migrated \"", c.Name, "\" to kubed as exec credential plugin")
+		migrated++
+	}
+
+	if len(args) > 0 && migrated == 0 {
+		return errors.Errorf("Cluster %q not found or already migrated", args[0])
+	}
+	return nil
+}
+
+// migrateCluster moves the token from kubeconfig to the cache and replaces
+// the managed user entries with the exec form, keeping the contexts as they are
+func migrateCluster(ctx context.Context, c *Cluster) error {
+	files := c.ManagedKubeConfigs
+	if len(files) == 0 {
+		files = []string{expandHome(c.KubeConfig)}
+	}
+
+	token, err := kubeconfig.ReadToken(files[0], kubeEntries(c).User)
+	if err != nil {
+		return err
+	}
+	err = saveCachedJWT(ctx, c.Name, token)
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range files {
+		err = kubeconfig.SetExecUser(filename, kubeEntries(c).User, execConfig(c.Name, *execAgent))
+		if err != nil {
+			return err
+		}
+	}
+
+	return updateCluster(c.Name, func(saved *Cluster) {
+		saved.ExecCredential = true
+	})
+}
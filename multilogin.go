@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// saveMu serializes writing kubeconfig, .kubedconf and the token cache while
+// logging in to several clusters at once
+var saveMu sync.Mutex
+
+// loginResult is the outcome of logging in to one of several clusters
+type loginResult struct {
+	cluster *Cluster
+	err     error
+}
+
+// sessionKey groups clusters that can share one login with the provider: the
+// same provider and client, asked for the same, called back the same way
+func sessionKey(c *Cluster) string {
+	return strings.Join([]string{c.ProviderURL, c.ClientID, c.ClientSecret, c.ACRValues, c.Scopes, c.LoginHint, c.Prompt,
+		c.ResponseMode, strconv.Itoa(c.Port), strconv.FormatBool(c.HTTPSCallback), strconv.FormatBool(c.ManualInput)}, "\x00")
+}
+
+// loginMany logs in to all clusters with one authentication per provider
+// session, fetching the JWT tokens from the issuers in parallel
+func loginMany(ctx context.Context, clusters []*Cluster) error {
+	if len(clusters) == 1 {
+		return login(ctx, clusters[0])
+	}
+
+	// Questions and pre hooks one at a time, before any browser is opened
+	var keys []string
+	sessions := map[string][]*Cluster{}
+	for _, cluster := range clusters {
+		cluster.KubeConfig = expandHome(cluster.KubeConfig)
+		err := confirmOverwrite(ctx, cluster)
+		if err != nil {
+			return err
+		}
+		err = runHooks(ctx, "pre", cluster)
+		if err != nil {
+			return err
+		}
+		key := sessionKey(cluster)
+		if _, ok := sessions[key]; !ok {
+			keys = append(keys, key)
+		}
+		sessions[key] = append(sessions[key], cluster)
+	}
+
+	results := make([]loginResult, 0, len(clusters))
+	for _, key := range keys {
+		results = append(results, loginSession(ctx, sessions[key])...)
+	}
+	return reportLogins(results)
+}
+
+// loginSession authenticates once for the clusters and completes the logins
+// with a bounded number of workers
+func loginSession(ctx context.Context, clusters []*Cluster) []loginResult {
+	results := make([]loginResult, len(clusters))
+	for i, cluster := range clusters {
+		results[i].cluster = cluster
+	}
+
+	// The agent does the browser dance for each cluster on the other end
+	if forwardedAgent() {
+		for i, cluster := range clusters {
+			token, caData, err := loginThroughAgent(cluster)
+			if err == nil {
+				err = saveLogin(ctx, cluster, token, caData)
+			}
+			results[i].err = err
+		}
+		return results
+	}
+
+	// Clusters whose issuer is down fail now, not after the browser dance
+	var up []int
+	for i, cluster := range clusters {
+		results[i].err = checkIssuerUp(ctx, cluster)
+		if results[i].err == nil {
+			up = append(up, i)
+		}
+	}
+	if len(up) == 0 {
+		return results
+	}
+
+	providerToken, err := authenticate(ctx, clusters[up[0]])
+	if err != nil {
+		for _, i := range up {
+			results[i].err = err
+		}
+		return results
+	}
+
+	// The provider tokens are only kept for the cluster authenticated with,
+	// the others keep their own copy
+	stored := providerToken.stored
+	workers := *parallelLogins
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, i := range up {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i].err = completeLogin(ctx, clusters[i], providerToken, i == up[0] && stored)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// reportLogins logs the outcome for every cluster, failing if any login failed
+func reportLogins(results []loginResult) error {
+	failed := 0
+	var firstErr error
+	for _, r := range results {
+		if r.err != nil {
+			log.Warn("Failed in logging in to \"", r.cluster.Name, "\": ", r.err)
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			failed++
+			continue
+		}
+		log.Info("Logged in to \"", r.cluster.Name, "\"")
+	}
+	if failed > 0 {
+		return withExitCode(exitCode(firstErr), errors.Errorf("Failed in logging in to %d of %d clusters", failed, len(results)))
+	}
+	return nil
+}
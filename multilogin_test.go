@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestSessionKey(t *testing.T) {
+	base := Cluster{ProviderURL: "https://auth.example.org", ClientID: "kubed", Port: 49999}
+	same := base
+	same.Name, same.IssuerURL = "other", "https://issuer.example.org"
+	if sessionKey(&base) != sessionKey(&same) {
+		t.Error("Expected clusters differing only in cluster settings to share a login")
+	}
+
+	for what, change := range map[string]func(c *Cluster){
+		"provider":      func(c *Cluster) { c.ProviderURL = "https://auth.example.com" },
+		"client":        func(c *Cluster) { c.ClientID = "other" },
+		"scopes":        func(c *Cluster) { c.Scopes = "openid" },
+		"callback port": func(c *Cluster) { c.Port = 50000 },
+		"https":         func(c *Cluster) { c.HTTPSCallback = true },
+		"response mode": func(c *Cluster) { c.ResponseMode = "form_post" },
+		"manual input":  func(c *Cluster) { c.ManualInput = true },
+	} {
+		other := base
+		change(&other)
+		if sessionKey(&base) == sessionKey(&other) {
+			t.Errorf("Expected clusters with another %s not to share a login", what)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+// NamingTemplates name the kubeconfig entries kubed writes for a cluster, to
+// follow the naming conventions of an organization. Each is a Go template
+// given the fields of namingData, empty ones keep the cluster name.
+type NamingTemplates struct {
+	Cluster string `yaml:"cluster,omitempty"`
+	User    string `yaml:"user,omitempty"`
+	Context string `yaml:"context,omitempty"`
+}
+
+// KubeEntries are the names of the kubeconfig entries of a cluster, as
+// written at the last login
+type KubeEntries struct {
+	Cluster string `yaml:"cluster"`
+	User    string `yaml:"user"`
+	Context string `yaml:"context"`
+}
+
+// namingData is available to the naming templates
+type namingData struct {
+	Name       string
+	IssuerHost string
+	Username   string
+	Namespace  string
+	Claims     map[string]interface{}
+}
+
+// usernameClaims are tried in order for the Username of namingData
+var usernameClaims = []string{"preferred_username", "email", "sub"}
+
+// newNamingTemplates returns nil when the cluster name is used for all
+// entries, so the field is left out of the kubed config
+func newNamingTemplates(cluster string, user string, context string) *NamingTemplates {
+	if cluster == "" && user == "" && context == "" {
+		return nil
+	}
+	return &NamingTemplates{Cluster: cluster, User: user, Context: context}
+}
+
+// validNamingTemplates checks that the templates parse, before they are saved
+func validNamingTemplates(t *NamingTemplates) error {
+	if t == nil {
+		return nil
+	}
+	for _, text := range []string{t.Cluster, t.User, t.Context} {
+		_, err := template.New("naming").Parse(text)
+		if err != nil {
+			return errors.Wrap(err, "Invalid naming template")
+		}
+	}
+	return nil
+}
+
+// namingTemplates are the templates of the cluster, falling back to the
+// global ones of the kubed config for those it doesn't set
+func namingTemplates(cluster *Cluster) NamingTemplates {
+	var templates NamingTemplates
+	if conf, err := readKubedConfig(); err == nil && conf.Naming != nil {
+		templates = *conf.Naming
+	}
+	if own := cluster.Naming; own != nil {
+		if own.Cluster != "" {
+			templates.Cluster = own.Cluster
+		}
+		if own.User != "" {
+			templates.User = own.User
+		}
+		if own.Context != "" {
+			templates.Context = own.Context
+		}
+	}
+	return templates
+}
+
+// nameEntries expands the naming templates for a login with the given
+// token, and keeps the names in cluster.Entries for writing kubeconfig
+func nameEntries(cluster *Cluster, token string) error {
+	templates := namingTemplates(cluster)
+	if templates == (NamingTemplates{}) {
+		cluster.Entries = nil
+		return nil
+	}
+
+	data := namingData{Name: cluster.Name, Namespace: cluster.NameSpace}
+	if u, err := url.Parse(cluster.IssuerURL); err == nil {
+		data.IssuerHost = u.Hostname()
+	}
+	if claims, err := auth.DecodeClaims(token); err == nil {
+		data.Claims = claims
+		data.Username = claimedUsername(claims)
+	}
+	// Tokens without a username get it from the userinfo of the provider
+	if info := cluster.userinfo; data.Username == "" && info != nil {
+		if info.err != nil && cluster.Entries != nil {
+			usedCache("kubeconfig entry names", info.err)
+			return nil
+		}
+		data.Username = claimedUsername(info.claims)
+		if data.Claims == nil {
+			data.Claims = info.claims
+		}
+	}
+
+	var entries KubeEntries
+	for _, e := range []struct {
+		text string
+		name *string
+	}{
+		{templates.Cluster, &entries.Cluster},
+		{templates.User, &entries.User},
+		{templates.Context, &entries.Context},
+	} {
+		name, err := expandName(e.text, data)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = cluster.Name
+		}
+		*e.name = name
+	}
+	cluster.Entries = &entries
+	return nil
+}
+
+// claimedUsername is the first of usernameClaims set in claims
+func claimedUsername(claims map[string]interface{}) string {
+	for _, claim := range usernameClaims {
+		if s, ok := claims[claim].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func expandName(text string, data namingData) (string, error) {
+	t, err := template.New("naming").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid naming template")
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed in expanding naming template")
+	}
+	// Claims the token doesn't have expand to nothing
+	name := strings.TrimSpace(strings.Replace(buf.String(), "<no value>", "", -1))
+	if strings.ContainsAny(name, " \t\n") {
+		return "", fmt.Errorf("Naming template %q gives %q, kubeconfig names can't hold spaces", text, name)
+	}
+	return name, nil
+}
+
+// kubeEntries are the names of the kubeconfig entries of the cluster, the
+// cluster name unless naming templates gave others
+func kubeEntries(cluster *Cluster) KubeEntries {
+	if cluster.Entries != nil {
+		return *cluster.Entries
+	}
+	return KubeEntries{Cluster: cluster.Name, User: cluster.Name, Context: cluster.Name}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNameEntries(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	s, err := newSandbox("https://token.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.sign(s.claims("kubernetes", map[string]interface{}{"preferred_username": "alice"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := &Cluster{Name: "lab", IssuerURL: "https://token.example.com", NameSpace: "course"}
+	if err := nameEntries(cluster, token); err != nil {
+		t.Fatal(err)
+	}
+	if cluster.Entries != nil || kubeEntries(cluster).Context != "lab" {
+		t.Errorf("Expected the cluster name without templates, got %+v", kubeEntries(cluster))
+	}
+
+	err = writeKubedConfig(&KubedConfig{Version: kubedConfVersion, Naming: &NamingTemplates{
+		User:    "{{.Username}}@{{.IssuerHost}}",
+		Context: "{{.Name}}-global",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster.Naming = &NamingTemplates{Context: "{{.Name}}-{{.Namespace}}{{.Claims.missing}}"}
+	if err := nameEntries(cluster, token); err != nil {
+		t.Fatal(err)
+	}
+	expected := KubeEntries{Cluster: "lab", User: "alice@token.example.com", Context: "lab-course"}
+	if entries := kubeEntries(cluster); entries != expected {
+		t.Errorf("Expected %+v, got %+v", expected, entries)
+	}
+	if !cluster.matches("lab-course") {
+		t.Error("Expected the cluster to match its context name")
+	}
+
+	cluster.Naming = &NamingTemplates{Context: "{{.Name}} {{.Namespace}}"}
+	if err := nameEntries(cluster, token); err == nil {
+		t.Error("Expected an error for a name with spaces")
+	}
+}
+
+func TestNameEntriesFromUserinfo(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	fromCache.parts = nil
+
+	// Opaque tokens carry no username
+	cluster := &Cluster{
+		Name:     "lab",
+		Naming:   &NamingTemplates{User: "{{.Username}}"},
+		userinfo: &providerUserinfo{claims: map[string]interface{}{"preferred_username": "alice"}},
+	}
+	if err := nameEntries(cluster, "opaque"); err != nil {
+		t.Fatal(err)
+	}
+	if cluster.Entries == nil || cluster.Entries.User != "alice" {
+		t.Fatalf("Expected the user name from userinfo, got %+v", cluster.Entries)
+	}
+
+	last := *cluster.Entries
+	cluster.userinfo = &providerUserinfo{err: &statusError{"fetching userinfo", 503}}
+	if err := nameEntries(cluster, "opaque"); err != nil {
+		t.Fatal(err)
+	}
+	if *cluster.Entries != last {
+		t.Errorf("Expected the names of the last login, got %+v", cluster.Entries)
+	}
+	if parts := fromCache.list(); len(parts) != 1 || parts[0] != "kubeconfig entry names" {
+		t.Errorf("Expected the names to be reported as cached, got %v", parts)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	commands["notify"] = &command{
+		usage: "notify [-notify-within D]",
+		help:  "Show a desktop notification for tokens about to expire, run it from cron or a timer",
+		run:   notifyExpiry,
+	}
+}
+
+func notifyExpiry(ctx context.Context, args []string) error {
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range clusters {
+		if c.TokenExpiry.IsZero() || c.TokenExpiry.Before(now) || c.TokenExpiry.Sub(now) > *notifyWithin {
+			continue
+		}
+		message := fmt.Sprintf("Token of %s expires %s. Renew it with: %s -renew %s",
+			c.Name, formatExpiry(c.TokenExpiry, now), os.Args[0], c.Name)
+		log.Info(message)
+		err = desktopNotify("kubed: "+c.Name+" expires soon", message)
+		if err != nil {
+			return errors.Wrap(err, "Failed in showing desktop notification")
+		}
+	}
+	return nil
+}
+
+// desktopNotify shows a notification with the tools that come with the desktop
+func desktopNotify(title string, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		quote := func(s string) string { return "'" + strings.Replace(s, "'", "''", -1) + "'" }
+		script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode(` + quote(title) + `)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode(` + quote(message) + `)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('kubed').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+	default:
+		cmd = exec.Command("notify-send", "--app-name=kubed", title, message)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return errors.Wrap(err, strings.TrimSpace(string(out)))
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// result is what login and renew report with -output json
+type result struct {
+	Cluster     string     `json:"cluster,omitempty"`
+	Context     string     `json:"context,omitempty"`
+	KubeConfig  string     `json:"kubeconfig,omitempty"`
+	KubeConfigs []string   `json:"kubeconfigs,omitempty"`
+	Expiry      *time.Time `json:"expiry,omitempty"`
+	Warnings    []string   `json:"warnings,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	ErrorKind   string     `json:"errorkind,omitempty"`
+	Hint        string     `json:"hint,omitempty"`
+	Cached      []string   `json:"cached,omitempty"`
+	ExitCode    int        `json:"exitcode"`
+}
+
+// warningHook collects the warnings logged during a run for the JSON result
+type warningHook struct {
+	warnings []string
+}
+
+func (h *warningHook) Levels() []log.Level {
+	return []log.Level{log.WarnLevel}
+}
+
+func (h *warningHook) Fire(entry *log.Entry) error {
+	h.warnings = append(h.warnings, redactTokens(entry.Message))
+	return nil
+}
+
+var warnings = &warningHook{}
+
+// cacheReport collects the parts of the credentials kept from the last login
+// because an endpoint of the issuer or provider failed
+type cacheReport struct {
+	sync.Mutex
+	parts []string
+}
+
+var fromCache = &cacheReport{}
+
+// usedCache records that part was taken from the last login after err
+func usedCache(part string, err error) {
+	log.Warn("Failed in getting the ", part, ", keeping the one of the last login ", err)
+	fromCache.Lock()
+	defer fromCache.Unlock()
+	for _, p := range fromCache.parts {
+		if p == part {
+			return
+		}
+	}
+	fromCache.parts = append(fromCache.parts, part)
+}
+
+func (c *cacheReport) list() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.parts...)
+}
+
+func validOutputFormat(format string) error {
+	switch format {
+	case "text", "json":
+		return nil
+	}
+	return fmt.Errorf("Unsupported output format %q, use text or json", format)
+}
+
+// setupOutput keeps stdout for the JSON result, the logs go to stderr instead
+func setupOutput(format string) {
+	if format != "json" {
+		return
+	}
+	log.SetOutput(os.Stderr)
+	log.AddHook(warnings)
+}
+
+// finish reports the outcome of a run and exits with the matching exit code
+func finish(clusterName string, err error) {
+	err = interruptedError(clusterName, err)
+	code := exitCode(err)
+
+	if *outputFormat != "json" {
+		if hint := errorHint(err); hint != "" {
+			log.WithField("hint", hint).Error(err)
+		} else if err != nil {
+			log.Error(err)
+		} else {
+			if parts := fromCache.list(); len(parts) > 0 {
+				log.Warn("Token renewed with parts of the last login: ", strings.Join(parts, ", "))
+			}
+			noticeUpdate()
+		}
+		os.Exit(code)
+	}
+
+	res := result{Cluster: clusterName, Warnings: warnings.warnings, Cached: fromCache.list(), ExitCode: code}
+	if err != nil {
+		res.Error = redactTokens(err.Error())
+		res.ErrorKind = errorKinds[code]
+		res.Hint = redactTokens(errorHint(err))
+	} else if cluster, err := readConfig(clusterName); err == nil {
+		res.Context = kubeEntries(cluster).Context
+		res.KubeConfigs = kubeConfigFiles(cluster)
+		res.KubeConfig = res.KubeConfigs[0]
+		if !cluster.TokenExpiry.IsZero() {
+			res.Expiry = &cluster.TokenExpiry
+		}
+	}
+
+	out, _ := json.MarshalIndent(res, "", "  ")
+	fmt.Println(string(out))
+	os.Exit(code)
+}
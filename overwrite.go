@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+// isManaged tells whether kubed wrote the entries of cluster in filename
+func isManaged(cluster *Cluster, filename string) bool {
+	for _, f := range cluster.ManagedKubeConfigs {
+		if f == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// confirm asks a yes/no question on the console, -yes answers yes
+func confirm(ctx context.Context, question string, defaultYes bool) (bool, error) {
+	if *assumeYes {
+		return true, nil
+	}
+	err := needInteraction(fmt.Sprintf("Answering %q", question), "Use -yes to answer yes")
+	if err != nil {
+		return false, err
+	}
+
+	options := tr("[y/N]")
+	if defaultYes {
+		options = tr("[Y/n]")
+	}
+	fmt.Printf("%s %s ", question, options)
+	answer, err := readLine(ctx, bufio.NewReader(os.Stdin))
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "":
+		return defaultYes, nil
+	case "y", "yes", tr("y"), tr("yes"):
+		return true, nil
+	}
+	return false, nil
+}
+
+// confirmOverwrite makes sure kubed doesn't silently replace kubeconfig entries
+// with the name of the cluster that someone else created
+func confirmOverwrite(ctx context.Context, cluster *Cluster) error {
+	for _, filename := range kubeConfigFiles(cluster) {
+		err := confirmOverwriteIn(ctx, cluster, filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func confirmOverwriteIn(ctx context.Context, cluster *Cluster, filename string) error {
+	if *force || isManaged(cluster, filename) {
+		return nil
+	}
+
+	config, err := kubeconfig.ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+
+	var existing []string
+	entries := kubeEntries(cluster)
+	if c, ok := config.Clusters[entries.Cluster]; ok {
+		// Entries by kubed versions without the marker look exactly like ours
+		context, hasContext := config.Contexts[entries.Context]
+		if hasContext && context.Cluster == entries.Cluster && context.AuthInfo == entries.User && c.Server == apiServerAddress(cluster) {
+			return nil
+		}
+		existing = append(existing, fmt.Sprintf("cluster %q", entries.Cluster))
+	}
+	if _, ok := config.AuthInfos[entries.User]; ok {
+		existing = append(existing, fmt.Sprintf("user %q", entries.User))
+	}
+	if _, ok := config.Contexts[entries.Context]; ok {
+		existing = append(existing, fmt.Sprintf("context %q", entries.Context))
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+
+	question := fmt.Sprintf("%s has a %s that was not created by kubed. Overwrite?",
+		filename, strings.Join(existing, ", "))
+	ok, err := confirm(ctx, question, false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("Not overwriting existing entries, choose another -name or use -force")
+	}
+	return nil
+}
+
+// markManaged records that kubed wrote the entries of the cluster in filename
+func markManaged(name string, filename string) error {
+	return updateCluster(name, func(c *Cluster) {
+		if !isManaged(c, filename) {
+			c.ManagedKubeConfigs = append(c.ManagedKubeConfigs, filename)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	kubedConf   = "config.yaml"
+	kubedCache  = "tokens.yaml"
+	legacyConf  = ".kubedconf"
+	legacyCache = ".kubedcache"
+)
+
+// configDir is where kubed keeps its configuration: -data-dir if given,
+// %APPDATA%\kubed on Windows, $XDG_CONFIG_HOME/kubed or ~/.kubed otherwise
+func configDir() string {
+	if *dataDir != "" {
+		return expandHome(*dataDir)
+	}
+	if runtime.GOOS == "windows" && os.Getenv("APPDATA") != "" {
+		return filepath.Join(os.Getenv("APPDATA"), "kubed")
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "kubed")
+	}
+	return filepath.Join(home, ".kubed")
+}
+
+// cacheDir is where kubed keeps cached credentials: -data-dir if given,
+// %APPDATA%\kubed\cache on Windows, $XDG_CACHE_HOME/kubed or ~/.kubed otherwise
+func cacheDir() string {
+	if *dataDir != "" {
+		return expandHome(*dataDir)
+	}
+	if runtime.GOOS == "windows" && os.Getenv("APPDATA") != "" {
+		return filepath.Join(os.Getenv("APPDATA"), "kubed", "cache")
+	}
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "kubed")
+	}
+	return filepath.Join(home, ".kubed")
+}
+
+func kubedConfPath() string {
+	return filepath.Join(configDir(), kubedConf)
+}
+
+func kubedCachePath() string {
+	return filepath.Join(cacheDir(), kubedCache)
+}
+
+// writeDataFile writes data to filename, creating its directory if needed.
+// A file that exists gets perm as well, as earlier versions wrote some
+// files readable by others.
+func writeDataFile(filename string, data []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename, data, perm)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(filename, perm)
+}
+
+// replaceDataFile writes data to a temporary file next to filename and
+// renames it into place, so readers never see a partly written file
+func replaceDataFile(filename string, data []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = tmp.Chmod(perm)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// migrateDataDir moves the dotfiles of earlier kubed versions from the home
+// directory to their new locations
+func migrateDataDir() {
+	moves := map[string]string{
+		filepath.Join(home, legacyConf):  kubedConfPath(),
+		filepath.Join(home, legacyCache): kubedCachePath(),
+	}
+
+	for from, to := range moves {
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		if _, err := os.Stat(to); err == nil {
+			log.Warn("Both ", from, " and ", to, " exist, using ", to)
+			continue
+		}
+
+		data, err := ioutil.ReadFile(from)
+		if err == nil {
+			err = writeDataFile(to, data, 0600)
+		}
+		if err == nil {
+			err = os.Remove(from)
+		}
+		if err != nil {
+			log.Warn("Failed in moving ", from, " to ", to, " ", err)
+			continue
+		}
+		log.Info("Moved ", from, " to ", to)
+	}
+}
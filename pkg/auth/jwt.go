@@ -0,0 +1,106 @@
+// Package auth reads the claims of the JWT tokens kubed gets from providers
+// and issuers, and checks them against what the login asked for.
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DecodeClaims returns the claims of a JWT without verifying its signature,
+// verification is left to the Kubernetes API server
+func DecodeClaims(token string) (map[string]interface{}, error) {
+	return decodeSegment(token, 1, "payload")
+}
+
+// DecodeHeader returns the header of a JWT, naming the signing algorithm and key
+func DecodeHeader(token string) (map[string]interface{}, error) {
+	return decodeSegment(token, 0, "header")
+}
+
+func decodeSegment(token string, i int, what string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Token is not a JWT")
+	}
+
+	segment, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[i], "="))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error decoding token "+what)
+	}
+
+	var values map[string]interface{}
+	err = json.Unmarshal(segment, &values)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing token "+what)
+	}
+	return values, nil
+}
+
+// CheckNonce verifies that an ID token returned by the provider was issued
+// for this login, guarding against replayed or injected tokens. When a nonce
+// was sent, a response without ID token is refused as well.
+func CheckNonce(idToken string, nonce string) error {
+	if nonce == "" {
+		return nil
+	}
+	if idToken == "" {
+		return errors.New("The provider returned no ID token to check the nonce of, it may not support OpenID Connect. Please log in again")
+	}
+
+	claims, err := DecodeClaims(idToken)
+	if err != nil {
+		return errors.Wrap(err, "Failed in reading ID token")
+	}
+
+	got, _ := claims["nonce"].(string)
+	if got == "" {
+		return errors.New("ID token has no nonce, it may have been replayed. Please log in again")
+	}
+	if subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return errors.New("ID token nonce does not match the login request, it may have been replayed or injected. Please log in again")
+	}
+	return nil
+}
+
+// CheckACR verifies that the acr claim of the token is one of the space
+// separated acrValues that were requested
+func CheckACR(token string, acrValues string) error {
+	if acrValues == "" {
+		return nil
+	}
+
+	claims, err := DecodeClaims(token)
+	if err != nil {
+		return err
+	}
+
+	acr, _ := claims["acr"].(string)
+	for _, v := range strings.Fields(acrValues) {
+		if acr == v {
+			return nil
+		}
+	}
+
+	if acr == "" {
+		return fmt.Errorf("Token has no acr claim, but one of %q is required. Make sure multi-factor authentication is enabled for your account", acrValues)
+	}
+	return fmt.Errorf("Token was issued with acr %q, but one of %q is required. Complete the multi-factor authentication step and try again", acr, acrValues)
+}
+
+// TokenTimes returns the issued at and expiry times of a token, zero when missing
+func TokenTimes(claims map[string]interface{}) (issued time.Time, expiry time.Time) {
+	if iat, ok := claims["iat"].(float64); ok {
+		issued = time.Unix(int64(iat), 0)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		expiry = time.Unix(int64(exp), 0)
+	}
+	return issued, expiry
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// fakeJWT builds an unsigned token carrying the given claims
+func fakeJWT(claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	return header + "." + payload + ".signature"
+}
+
+func TestDecodeClaims(t *testing.T) {
+	claims, err := DecodeClaims(fakeJWT(`{"sub":"kubed","exp":1500000000}`))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if claims["sub"] != "kubed" {
+		t.Errorf("Expected sub claim kubed, got %v", claims["sub"])
+	}
+
+	if _, err := DecodeClaims("not-a-jwt"); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
+
+func TestCheckNonce(t *testing.T) {
+	var tests = []struct {
+		description string
+		idToken     string
+		err         bool
+	}{
+		{
+			description: "no id token",
+			err:         true,
+		},
+		{
+			description: "matching nonce",
+			idToken:     fakeJWT(`{"nonce":"n-0S6_WzA2Mj"}`),
+		},
+		{
+			description: "wrong nonce",
+			idToken:     fakeJWT(`{"nonce":"other"}`),
+			err:         true,
+		},
+		{
+			description: "missing nonce",
+			idToken:     fakeJWT(`{}`),
+			err:         true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := CheckNonce(test.idToken, "n-0S6_WzA2Mj")
+			if err != nil && !test.err {
+				t.Errorf("Got unexpected error: %s", err)
+			}
+			if err == nil && test.err {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestCheckACR(t *testing.T) {
+	var tests = []struct {
+		description string
+		claims      string
+		acrValues   string
+		err         bool
+	}{
+		{
+			description: "no acr requested",
+			claims:      `{}`,
+		},
+		{
+			description: "matching acr",
+			claims:      `{"acr":"mfa"}`,
+			acrValues:   "pwd mfa",
+		},
+		{
+			description: "wrong acr",
+			claims:      `{"acr":"pwd"}`,
+			acrValues:   "mfa",
+			err:         true,
+		},
+		{
+			description: "missing acr",
+			claims:      `{}`,
+			acrValues:   "mfa",
+			err:         true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := CheckACR(fakeJWT(test.claims), test.acrValues)
+			if err != nil && !test.err {
+				t.Errorf("Got unexpected error: %s", err)
+			}
+			if err == nil && test.err {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+// Package kubeconfig reads and writes the entries kubed manages in kubeconfig
+// files, keeping the fields the client-go version it is built with doesn't know of.
+package kubeconfig
+
+// Reference Implementation from Minikube
+
+import (
+	"io/ioutil"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/clientcmd/api/latest"
+)
+
+// KubeConfigSetup structure
+type KubeConfigSetup struct {
+	// The name of the cluster for this context
+	ClusterName string
+
+	// UserName and ContextName name the user and context, by default ClusterName
+	UserName    string
+	ContextName string
+
+	// ClusterServerAddress is the address of of the kubernetes cluster
+	ClusterServerAddress string
+
+	// CertificateAuthority is the path to a cert file for the certificate authority.
+	CertificateAuthorityData []byte
+
+	// ClientToken is the path to a client key file for TLS.
+	Token string
+
+	// Should the current context be kept when setting up this one
+	KeepContext bool
+
+	// KubeConfigFile is the path where the kube config is stored
+	KubeConfigFile string
+
+	// NameSpace is the default namespace used with kubectl. May be blank.
+	NameSpace string
+
+	// OIDCConfig, when set, is written as oidc auth-provider instead of the token
+	OIDCConfig map[string]string
+
+	// Impersonate is the user to act as, e.g. for testing RBAC. May be blank.
+	Impersonate string
+
+	// ClientCertificateData and ClientKeyData, when set, are written instead of the token
+	ClientCertificateData []byte
+	ClientKeyData         []byte
+}
+
+// SetupKubeConfig reads config from disk, adds the minikube settings, and writes it back.
+// activeContext is true when minikube is the CurrentContext
+// If no CurrentContext is set, the given name will be used.
+func SetupKubeConfig(cfg *KubeConfigSetup) error {
+	// read existing config or create new if does not exist
+	config, err := ReadConfigOrNew(cfg.KubeConfigFile)
+	if err != nil {
+		return err
+	}
+
+	// Entries of the same name are updated in place, so the fields kubed
+	// doesn't set, like extensions, stay as they are
+	clusterName := cfg.ClusterName
+	cluster, ok := config.Clusters[clusterName]
+	if !ok {
+		cluster = api.NewCluster()
+		config.Clusters[clusterName] = cluster
+	}
+	cluster.Server = cfg.ClusterServerAddress
+	cluster.CertificateAuthorityData = cfg.CertificateAuthorityData
+	if cfg.CertificateAuthorityData != nil {
+		// client-go refuses a CA file or skipping verification next to CA data
+		cluster.CertificateAuthority = ""
+		cluster.InsecureSkipTLSVerify = false
+	}
+
+	// user, the credentials kubed writes replace any others
+	userName := cfg.userName()
+	user, ok := config.AuthInfos[userName]
+	if !ok {
+		user = api.NewAuthInfo()
+		config.AuthInfos[userName] = user
+	}
+	*user = api.AuthInfo{Impersonate: cfg.Impersonate}
+	if cfg.OIDCConfig != nil {
+		user.AuthProvider = &api.AuthProviderConfig{Name: "oidc", Config: cfg.OIDCConfig}
+	} else if cfg.ClientCertificateData != nil {
+		user.ClientCertificateData = cfg.ClientCertificateData
+		user.ClientKeyData = cfg.ClientKeyData
+	} else {
+		user.Token = cfg.Token
+	}
+
+	// context
+	contextName := cfg.contextName()
+	context, ok := config.Contexts[contextName]
+	if !ok {
+		context = api.NewContext()
+		config.Contexts[contextName] = context
+	}
+	context.Cluster = clusterName
+	context.AuthInfo = userName
+	if cfg.NameSpace != "" {
+		context.Namespace = cfg.NameSpace
+	}
+
+	// Only set current context to minikube if the user has not used the keepContext flag
+	if !cfg.KeepContext {
+		config.CurrentContext = contextName
+	}
+
+	// write back to disk
+	if err := WriteConfig(config, cfg.KubeConfigFile); err != nil {
+		return err
+	}
+	// client-go doesn't know of exec, so it was kept from the file. It would
+	// conflict with the credentials written, like they do in SetExecUser.
+	return setEntryField(cfg.KubeConfigFile, "users", userName, "exec", nil)
+}
+
+func (cfg *KubeConfigSetup) userName() string {
+	if cfg.UserName != "" {
+		return cfg.UserName
+	}
+	return cfg.ClusterName
+}
+
+func (cfg *KubeConfigSetup) contextName() string {
+	if cfg.ContextName != "" {
+		return cfg.ContextName
+	}
+	return cfg.ClusterName
+}
+
+// RemoveToken clears the token of the given user in the kubeconfig file,
+// keeping the cluster and context so the user can log in again later.
+func RemoveToken(filename string, userName string) error {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+
+	user, ok := config.AuthInfos[userName]
+	if !ok {
+		return nil
+	}
+	if user.AuthProvider != nil {
+		delete(user.AuthProvider.Config, "id-token")
+		delete(user.AuthProvider.Config, "refresh-token")
+	} else if user.Token == "" {
+		return nil
+	}
+	user.Token = ""
+
+	return WriteConfig(config, filename)
+}
+
+// ReadToken returns the token of the given user in the kubeconfig file
+func ReadToken(filename string, userName string) (string, error) {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return "", err
+	}
+
+	user, ok := config.AuthInfos[userName]
+	if ok && user.Token == "" && user.AuthProvider != nil && user.AuthProvider.Config["id-token"] != "" {
+		return user.AuthProvider.Config["id-token"], nil
+	}
+	if !ok || user.Token == "" {
+		return "", errors.Errorf("no token for %q found in %s, log in to the cluster first", userName, filename)
+	}
+	return user.Token, nil
+}
+
+// ReadCAData returns the CA certificate of the given cluster in the kubeconfig file
+func ReadCAData(filename string, clusterName string) ([]byte, error) {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster, ok := config.Clusters[clusterName]
+	if !ok {
+		return nil, errors.Errorf("cluster %q not found in %s, log in to the cluster first", clusterName, filename)
+	}
+	return cluster.CertificateAuthorityData, nil
+}
+
+// SetCurrentContext makes the given context the current one in the kubeconfig file
+func SetCurrentContext(filename string, contextName string) error {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := config.Contexts[contextName]; !ok {
+		return errors.Errorf("context %q not found in %s, log in to the cluster first", contextName, filename)
+	}
+	config.CurrentContext = contextName
+
+	return WriteConfig(config, filename)
+}
+
+// SetContexts adds or updates contexts sharing the given cluster and user,
+// each with the namespace it maps to. The current context stays as it is.
+func SetContexts(filename string, clusterName string, userName string, namespaces map[string]string) error {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+
+	for contextName, namespace := range namespaces {
+		context, ok := config.Contexts[contextName]
+		if !ok {
+			context = api.NewContext()
+			config.Contexts[contextName] = context
+		}
+		context.Cluster = clusterName
+		context.AuthInfo = userName
+		context.Namespace = namespace
+	}
+
+	return WriteConfig(config, filename)
+}
+
+// RemoveContexts deletes the given contexts. If one of them was the current
+// context, no context is current afterwards.
+func RemoveContexts(filename string, contextNames []string) error {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range contextNames {
+		delete(config.Contexts, name)
+		if config.CurrentContext == name {
+			config.CurrentContext = ""
+		}
+	}
+
+	return WriteConfig(config, filename)
+}
+
+// SetContextNamespace changes the default namespace of the context
+func SetContextNamespace(filename string, contextName string, namespace string) error {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+
+	context, ok := config.Contexts[contextName]
+	if !ok {
+		return errors.Errorf("context %q not found in %s, log in to the cluster first", contextName, filename)
+	}
+	context.Namespace = namespace
+
+	return WriteConfig(config, filename)
+}
+
+// RenameEntries renames the cluster, user and context kubed created under
+// oldName, updating all references to them.
+func RenameEntries(filename string, oldName string, newName string) error {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+
+	_, clusterExists := config.Clusters[newName]
+	_, userExists := config.AuthInfos[newName]
+	_, contextExists := config.Contexts[newName]
+	if clusterExists || userExists || contextExists {
+		return errors.Errorf("%s already has an entry named %q", filename, newName)
+	}
+
+	if cluster, ok := config.Clusters[oldName]; ok {
+		delete(config.Clusters, oldName)
+		config.Clusters[newName] = cluster
+	}
+	if user, ok := config.AuthInfos[oldName]; ok {
+		delete(config.AuthInfos, oldName)
+		config.AuthInfos[newName] = user
+	}
+	if context, ok := config.Contexts[oldName]; ok {
+		delete(config.Contexts, oldName)
+		config.Contexts[newName] = context
+	}
+	for _, context := range config.Contexts {
+		if context.Cluster == oldName {
+			context.Cluster = newName
+		}
+		if context.AuthInfo == oldName {
+			context.AuthInfo = newName
+		}
+	}
+	if config.CurrentContext == oldName {
+		config.CurrentContext = newName
+	}
+
+	return WriteConfig(config, filename)
+}
+
+// RemoveEntries deletes the cluster, user and context with the given name.
+// If it was the current context, no context is current afterwards.
+func RemoveEntries(filename string, name string) error {
+	return RemoveNamedEntries(filename, name, name, name)
+}
+
+// RemoveNamedEntries deletes the cluster, user and context of the given
+// names, like RemoveEntries for entries not sharing one name
+func RemoveNamedEntries(filename string, clusterName string, userName string, contextName string) error {
+	config, err := ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+
+	delete(config.Clusters, clusterName)
+	delete(config.AuthInfos, userName)
+	delete(config.Contexts, contextName)
+	if config.CurrentContext == contextName {
+		config.CurrentContext = ""
+	}
+
+	return WriteConfig(config, filename)
+}
+
+// ReadConfigOrNew retrieves Kubernetes client configuration from a file.
+// If no files exists, an empty configuration is returned.
+func ReadConfigOrNew(filename string) (*api.Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return api.NewConfig(), nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Error reading file %q", filename)
+	}
+
+	// decode config, empty if no bytes
+	config, err := Decode(data)
+	if err != nil {
+		return nil, errors.Errorf("could not read config: %v", err)
+	}
+
+	// initialize nil maps
+	if config.AuthInfos == nil {
+		config.AuthInfos = map[string]*api.AuthInfo{}
+	}
+	if config.Clusters == nil {
+		config.Clusters = map[string]*api.Cluster{}
+	}
+	if config.Contexts == nil {
+		config.Contexts = map[string]*api.Context{}
+	}
+
+	return config, nil
+}
+
+// WriteConfig encodes the configuration and writes it to the given file.
+// If the file exists, it's contents will be overwritten.
+func WriteConfig(config *api.Config, filename string) error {
+	if config == nil {
+		log.Errorf("could not write to '%s': config can't be nil", filename)
+	}
+
+	// encode config to YAML, client-go fails on the extensions it decoded
+	// itself, they are taken from the file instead
+	dropExtensions(config)
+	data, err := runtime.Encode(latest.Codec, config)
+	if err != nil {
+		return errors.Errorf("could not write to '%s': failed to encode config: %v", filename, err)
+	}
+	data, err = keepUnknownFields(filename, data)
+	if err != nil {
+		return errors.Wrapf(err, "could not keep the fields of '%s' unknown to kubed", filename)
+	}
+
+	return writeFile(filename, data)
+}
+
+func dropExtensions(config *api.Config) {
+	config.Extensions = nil
+	config.Preferences.Extensions = nil
+	for _, cluster := range config.Clusters {
+		cluster.Extensions = nil
+	}
+	for _, user := range config.AuthInfos {
+		user.Extensions = nil
+	}
+	for _, context := range config.Contexts {
+		context.Extensions = nil
+	}
+}
+
+// Decode reads a Config object from bytes.
+// Returns empty config if no bytes.
+func Decode(data []byte) (*api.Config, error) {
+	// if no data, return empty config
+	if len(data) == 0 {
+		return api.NewConfig(), nil
+	}
+
+	config, _, err := latest.Codec.Decode(data, nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error decoding config from data: %s", string(data))
+	}
+
+	return config.(*api.Config), nil
+}
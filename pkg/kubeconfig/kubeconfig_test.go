@@ -1,7 +1,7 @@
 // Reference Implementation taken from Minikube
 // https://github.com/kubernetes/minikube/blob/master/pkg/minikube/kubeconfig/config_test.go
 
-package main
+package kubeconfig
 
 import (
 	"io/ioutil"
@@ -40,7 +40,7 @@ func TestSetupKubeConfig(t *testing.T) {
 		ClusterServerAddress:     "192.168.1.1:8080",
 		CertificateAuthorityData: []byte("testing.crt"),
 		Token:                    "test-token",
-		kubeConfigFile:           "/tmp/.kube/config",
+		KubeConfigFile:           "/tmp/.kube/config",
 		KeepContext:              false,
 	}
 
@@ -71,7 +71,7 @@ func TestSetupKubeConfig(t *testing.T) {
 				ClusterServerAddress:     "192.168.1.1:8080",
 				CertificateAuthorityData: []byte("testing.crt"),
 				Token:                    "test-token",
-				kubeConfigFile:           "/tmp/.kube/config",
+				KubeConfigFile:           "/tmp/.kube/config",
 				KeepContext:              true,
 			},
 			existingCfg: fakeKubeCfg,
@@ -86,7 +86,7 @@ func TestSetupKubeConfig(t *testing.T) {
 				t.Fatalf("Error making temp directory %s", err)
 			}
 			if len(test.existingCfg) != 0 {
-				ioutil.WriteFile(test.cfg.kubeConfigFile, test.existingCfg, 0600)
+				ioutil.WriteFile(test.cfg.KubeConfigFile, test.existingCfg, 0600)
 			}
 			err = SetupKubeConfig(test.cfg)
 			if err != nil && !test.err {
@@ -95,7 +95,7 @@ func TestSetupKubeConfig(t *testing.T) {
 			if err == nil && test.err {
 				t.Errorf("Expected error but got none")
 			}
-			config, err := ReadConfigOrNew(test.cfg.kubeConfigFile)
+			config, err := ReadConfigOrNew(test.cfg.KubeConfigFile)
 			if err != nil {
 				t.Errorf("Error reading kubeconfig file: %s", err)
 			}
@@ -162,6 +162,117 @@ func TestNewConfig(t *testing.T) {
 	}
 }
 
+func TestRenameEntries(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+
+	err := RenameEntries(tmp, "kubed", "renamed")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	config, err := ReadConfigOrNew(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Clusters["renamed"]; !ok {
+		t.Errorf("Cluster was not renamed")
+	}
+	if _, ok := config.AuthInfos["renamed"]; !ok {
+		t.Errorf("User was not renamed")
+	}
+	context, ok := config.Contexts["renamed"]
+	if !ok {
+		t.Fatalf("Context was not renamed")
+	}
+	if context.Cluster != "renamed" || context.AuthInfo != "renamed" {
+		t.Errorf("Context still refers to cluster %q and user %q", context.Cluster, context.AuthInfo)
+	}
+	if config.CurrentContext != "renamed" {
+		t.Errorf("Current context was not renamed")
+	}
+
+	if err := RenameEntries(tmp, "renamed", "renamed"); err == nil {
+		t.Errorf("Expected error when the new name exists")
+	}
+}
+
+func TestSetupKubeConfigAuthProvider(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+
+	err := SetupKubeConfig(&KubeConfigSetup{
+		ClusterName:          "test",
+		ClusterServerAddress: "192.168.1.1:8080",
+		Token:                "test-token",
+		KubeConfigFile:       tmp,
+		OIDCConfig:           map[string]string{"id-token": "test-token", "client-id": "client-id"},
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	token, err := ReadToken(tmp, "test")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if token != "test-token" {
+		t.Errorf("Expected the id-token of the auth-provider, got %q", token)
+	}
+
+	err = RemoveToken(tmp, "test")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if _, err := ReadToken(tmp, "test"); err == nil {
+		t.Errorf("Expected error after removing the token")
+	}
+}
+
+func TestSetupKubeConfigNamedEntries(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+
+	err := SetupKubeConfig(&KubeConfigSetup{
+		ClusterName:          "test",
+		UserName:             "alice@test",
+		ContextName:          "test-default",
+		ClusterServerAddress: "192.168.1.1:8080",
+		Token:                "test-token",
+		KubeConfigFile:       tmp,
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	config, err := ReadConfigOrNew(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	context, ok := config.Contexts["test-default"]
+	if !ok || context.Cluster != "test" || context.AuthInfo != "alice@test" {
+		t.Errorf("Context does not refer to the named entries: %+v", context)
+	}
+	if config.CurrentContext != "test-default" {
+		t.Errorf("Expected the named context to be current, got %q", config.CurrentContext)
+	}
+
+	err = RemoveNamedEntries(tmp, "test", "alice@test", "test-default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err = ReadConfigOrNew(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.AuthInfos["alice@test"]; ok || config.CurrentContext != "" {
+		t.Errorf("Named entries were not removed")
+	}
+	if _, ok := config.Contexts["kubed"]; !ok {
+		t.Errorf("Other entries were removed")
+	}
+}
+
 // tempFile creates a temporary with the provided bytes as its contents.
 // The caller is responsible for deleting file after use.
 func tempFile(t *testing.T, data []byte) string {
@@ -289,3 +400,43 @@ func configEquals(a, b *api.Config) bool {
 	}
 	return true
 }
+
+func TestWriteFileKeepsOriginalOnBrokenData(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+
+	err := writeFile(tmp, []byte("clusters: [broken"))
+	if err == nil {
+		t.Fatal("Expected an error writing broken kubeconfig")
+	}
+	data, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(fakeKubeCfg) {
+		t.Errorf("Original kubeconfig was changed to:\n%s", data)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(tmp), "."+filepath.Base(tmp)+".*"))
+	if len(leftovers) > 0 {
+		t.Errorf("Temporary files were left behind: %v", leftovers)
+	}
+}
+
+func TestWriteFileFollowsSymlink(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+	link := tmp + ".link"
+	if err := os.Symlink(tmp, link); err != nil {
+		t.Skip("Symlinks not supported: ", err)
+	}
+	defer os.Remove(link)
+
+	err := SetCurrentContext(link, "kubed")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Symlink was replaced by a file")
+	}
+}
@@ -0,0 +1,351 @@
+package kubeconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The client-go version kubed is built with drops the kubeconfig fields it
+// doesn't know of, like exec users. knownFields lists what it does know, so
+// everything else can be kept as it is in the file.
+var knownFields = map[string]map[string]bool{
+	"": set("kind", "apiVersion", "preferences", "clusters", "users", "contexts", "current-context", "extensions"),
+	"clusters": set("server", "api-version", "insecure-skip-tls-verify", "certificate-authority",
+		"certificate-authority-data", "extensions"),
+	"users": set("client-certificate", "client-certificate-data", "client-key", "client-key-data",
+		"token", "tokenFile", "as", "username", "password", "auth-provider", "extensions"),
+	"contexts": set("cluster", "user", "namespace", "extensions"),
+}
+
+// keptFields are known to client-go, but what they hold may not survive its
+// decoding unharmed. kubed never sets them, so they are taken from the file.
+var keptFields = set("extensions", "preferences")
+
+// innerKey is the key holding the entry itself in the named lists of kubeconfig
+var innerKey = map[string]string{"clusters": "cluster", "users": "user", "contexts": "context"}
+
+func set(values ...string) map[string]bool {
+	m := map[string]bool{}
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
+
+type rawConfig map[interface{}]interface{}
+
+func readRawConfig(filename string) (rawConfig, error) {
+	raw, _, err := readRawFile(filename)
+	return raw, err
+}
+
+// readRawFile also returns the file as it is, to keep its layout when writing
+func readRawFile(filename string) (rawConfig, []byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return rawConfig{}, nil, nil
+	} else if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error reading file %q", filename)
+	}
+	raw, err := parseRawConfig(data)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error parsing file %q", filename)
+	}
+	return raw, data, nil
+}
+
+// writeRawConfig writes the config in the layout the file already has
+func writeRawConfig(filename string, raw rawConfig) error {
+	_, layout, err := readRawFile(filename)
+	if err != nil {
+		return err
+	}
+	data, err := raw.marshal(layout)
+	if err != nil {
+		return err
+	}
+	return writeFile(filename, data)
+}
+
+// parseRawConfig decodes into a plain map, so nested maps are plain maps as well
+func parseRawConfig(data []byte) (rawConfig, error) {
+	raw := map[interface{}]interface{}{}
+	err := yaml.Unmarshal(data, &raw)
+	if raw == nil {
+		raw = map[interface{}]interface{}{}
+	}
+	return rawConfig(raw), err
+}
+
+// entries returns the inner maps of a named list of kubeconfig by name
+func (raw rawConfig) entries(list string) map[string]map[interface{}]interface{} {
+	entries := map[string]map[interface{}]interface{}{}
+	items, _ := raw[list].([]interface{})
+	for _, item := range items {
+		entry, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := entry["name"].(string)
+		inner, ok := entry[innerKey[list]].(map[interface{}]interface{})
+		if !ok {
+			inner = map[interface{}]interface{}{}
+			entry[innerKey[list]] = inner
+		}
+		entries[name] = inner
+	}
+	return entries
+}
+
+// names returns the names in a named list of kubeconfig, in file order
+func (raw rawConfig) names(list string) []string {
+	var names []string
+	items, _ := raw[list].([]interface{})
+	for _, item := range items {
+		if entry, ok := item.(map[interface{}]interface{}); ok {
+			name, _ := entry["name"].(string)
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// marshal encodes the config with the sections and the entries of the named
+// lists in the order they have in layout, a kubeconfig file as it was read.
+// client-go sorts both, which makes kubed rearrange files written by hand.
+// What is new goes last, sorted.
+func (raw rawConfig) marshal(layout []byte) ([]byte, error) {
+	var order yaml.MapSlice
+	if err := yaml.Unmarshal(layout, &order); err != nil {
+		return nil, err
+	}
+	old, err := parseRawConfig(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []interface{}
+	placed := map[interface{}]bool{}
+	for _, item := range order {
+		if _, ok := raw[item.Key]; ok && !placed[item.Key] {
+			keys = append(keys, item.Key)
+			placed[item.Key] = true
+		}
+	}
+	var added []string
+	for k := range raw {
+		if key, ok := k.(string); ok && !placed[k] {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+	for _, key := range added {
+		keys = append(keys, key)
+	}
+
+	result := yaml.MapSlice{}
+	for _, key := range keys {
+		value := raw[key]
+		if list, ok := key.(string); ok && innerKey[list] != "" {
+			value = orderEntries(value, old.names(list))
+		}
+		result = append(result, yaml.MapItem{Key: key, Value: value})
+	}
+	return yaml.Marshal(result)
+}
+
+// orderEntries sorts the entries of a named list as in names, keeping new
+// ones after them in the order they have
+func orderEntries(value interface{}, names []string) interface{} {
+	items, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	position := map[string]int{}
+	for i, name := range names {
+		position[name] = i
+	}
+	index := func(item interface{}) int {
+		entry, _ := item.(map[interface{}]interface{})
+		name, _ := entry["name"].(string)
+		if i, ok := position[name]; ok {
+			return i
+		}
+		return len(names)
+	}
+	sorted := append([]interface{}{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return index(sorted[i]) < index(sorted[j])
+	})
+	return sorted
+}
+
+// keepUnknownFields copies the fields client-go doesn't know of from the
+// kubeconfig file as it is on disk to the newly encoded config
+func keepUnknownFields(filename string, data []byte) ([]byte, error) {
+	old, layout, err := readRawFile(filename)
+	if err != nil || len(old) == 0 {
+		return data, err
+	}
+	updated, err := parseRawConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	copyUnknown(old, updated, knownFields[""])
+	for list := range innerKey {
+		oldEntries := old.entries(list)
+		for name, inner := range updated.entries(list) {
+			if oldInner, ok := oldEntries[name]; ok {
+				copyUnknown(oldInner, inner, knownFields[list])
+			}
+		}
+	}
+	return updated.marshal(layout)
+}
+
+func copyUnknown(from map[interface{}]interface{}, to map[interface{}]interface{}, known map[string]bool) {
+	for k, v := range from {
+		key, _ := k.(string)
+		if _, exists := to[k]; (!exists && !known[key]) || keptFields[key] {
+			to[k] = v
+		}
+	}
+}
+
+// SetExecUser makes the user get its credentials from an exec plugin
+func SetExecUser(filename string, userName string, exec map[string]interface{}) error {
+	raw, err := readRawConfig(filename)
+	if err != nil {
+		return err
+	}
+	user, ok := raw.entries("users")[userName]
+	if !ok {
+		return errors.Errorf("user %q not found in %s", userName, filename)
+	}
+	// Other credentials would conflict, impersonation stays
+	for k := range user {
+		if k != "as" && k != "as-groups" {
+			delete(user, k)
+		}
+	}
+	user["exec"] = exec
+
+	return writeRawConfig(filename, raw)
+}
+
+// SetClusterField sets a field client-go doesn't know of, like proxy-url, in
+// the cluster entry, removing it for an empty value. The file is only written
+// when the field changes.
+func SetClusterField(filename string, clusterName string, key string, value string) error {
+	var v interface{}
+	if value != "" {
+		v = value
+	}
+	return setEntryField(filename, "clusters", clusterName, key, v)
+}
+
+// SetUserField sets a field client-go doesn't know of, like as-groups, in the
+// user entry, removing it for an empty list
+func SetUserField(filename string, userName string, key string, values []string) error {
+	var v interface{}
+	if len(values) > 0 {
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = value
+		}
+		v = list
+	}
+	return setEntryField(filename, "users", userName, key, v)
+}
+
+func setEntryField(filename string, list string, name string, key string, value interface{}) error {
+	raw, err := readRawConfig(filename)
+	if err != nil {
+		return err
+	}
+	entry, ok := raw.entries(list)[name]
+	if !ok {
+		return errors.Errorf("%s %q not found in %s", innerKey[list], name, filename)
+	}
+	if reflect.DeepEqual(entry[key], value) {
+		return nil
+	}
+	if value == nil {
+		delete(entry, key)
+	} else {
+		entry[key] = value
+	}
+
+	return writeRawConfig(filename, raw)
+}
+
+// IsExecUser tells whether the user gets its credentials from an exec plugin
+func IsExecUser(filename string, userName string) bool {
+	raw, err := readRawConfig(filename)
+	if err != nil {
+		return false
+	}
+	_, ok := raw.entries("users")[userName]["exec"]
+	return ok
+}
+
+// fragmentOwned are the fields kubed itself writes from the fragment, or that
+// are its own choice, so they are not copied by MergeEntries
+var fragmentOwned = map[string]map[string]bool{
+	"clusters": set("server", "certificate-authority", "certificate-authority-data"),
+	"users":    set("as", "as-groups"),
+}
+
+// MergeEntries copies the cluster and user entries of a kubeconfig fragment,
+// with all their fields, like client certificates and exec plugins, to the
+// entries of the given names in the file. The user gets only the credentials
+// of the fragment, the cluster keeps its own fields next to those of the
+// fragment. An empty fromUser leaves the user as it is.
+func MergeEntries(filename string, fragment []byte, fromCluster string, fromUser string, clusterName string, userName string) error {
+	from, err := parseRawConfig(fragment)
+	if err != nil {
+		return errors.Wrap(err, "Error parsing kubeconfig fragment")
+	}
+	raw, err := readRawConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	if source, ok := from.entries("clusters")[fromCluster]; ok {
+		cluster, ok := raw.entries("clusters")[clusterName]
+		if !ok {
+			return errors.Errorf("cluster %q not found in %s", clusterName, filename)
+		}
+		mergeFields(source, cluster, fragmentOwned["clusters"], false)
+	}
+	if source, ok := from.entries("users")[fromUser]; ok && fromUser != "" {
+		user, ok := raw.entries("users")[userName]
+		if !ok {
+			return errors.Errorf("user %q not found in %s", userName, filename)
+		}
+		mergeFields(source, user, fragmentOwned["users"], true)
+	}
+
+	return writeRawConfig(filename, raw)
+}
+
+// mergeFields copies all but the owned fields, with replace dropping the
+// other fields of to first
+func mergeFields(from map[interface{}]interface{}, to map[interface{}]interface{}, owned map[string]bool, replace bool) {
+	for k := range to {
+		if key, _ := k.(string); replace && !owned[key] {
+			delete(to, k)
+		}
+	}
+	for k, v := range from {
+		if key, _ := k.(string); !owned[key] {
+			to[k] = v
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package kubeconfig
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestKeepUnknownFields(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+
+	err := SetExecUser(tmp, "kubed", map[string]interface{}{
+		"apiVersion": "client.authentication.k8s.io/v1beta1",
+		"command":    "kubed",
+		"args":       []string{"exec-credential", "kubed"},
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	// Writing another cluster goes through client-go, which doesn't know exec
+	err = SetupKubeConfig(&KubeConfigSetup{
+		ClusterName:          "test",
+		ClusterServerAddress: "192.168.1.1:8080",
+		Token:                "test-token",
+		KubeConfigFile:       tmp,
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	if !IsExecUser(tmp, "kubed") {
+		t.Errorf("Exec user was lost when writing kubeconfig")
+	}
+	if IsExecUser(tmp, "test") {
+		t.Errorf("Exec was copied to another user")
+	}
+	if token, err := ReadToken(tmp, "test"); err != nil || token != "test-token" {
+		t.Errorf("Expected token of new user, got %q (%v)", token, err)
+	}
+}
+
+func TestSetupKubeConfigDropsExec(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+
+	err := SetExecUser(tmp, "kubed", map[string]interface{}{
+		"apiVersion": "client.authentication.k8s.io/v1beta1",
+		"command":    "kubed",
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	// Going back to a token, like with ExecCredential turned off
+	err = SetupKubeConfig(&KubeConfigSetup{
+		ClusterName:          "kubed",
+		ClusterServerAddress: "192.168.1.1:8080",
+		Token:                "test-token",
+		KubeConfigFile:       tmp,
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	if IsExecUser(tmp, "kubed") {
+		t.Errorf("Expected exec to be dropped when writing a token")
+	}
+	if token, err := ReadToken(tmp, "kubed"); err != nil || token != "test-token" {
+		t.Errorf("Expected the token written, got %q (%v)", token, err)
+	}
+}
+
+func TestSetClusterField(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+
+	err := SetClusterField(tmp, "kubed", "proxy-url", "socks5://localhost:1080")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	// A token renewal must not lose the proxy
+	err = SetupKubeConfig(&KubeConfigSetup{
+		ClusterName:          "kubed",
+		ClusterServerAddress: "192.168.1.1:8080",
+		Token:                "new-token",
+		KubeConfigFile:       tmp,
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	raw, err := readRawConfig(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy := raw.entries("clusters")["kubed"]["proxy-url"]; proxy != "socks5://localhost:1080" {
+		t.Errorf("Expected proxy-url to be kept, got %v", proxy)
+	}
+
+	err = SetClusterField(tmp, "kubed", "proxy-url", "")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	raw, _ = readRawConfig(tmp)
+	if _, ok := raw.entries("clusters")["kubed"]["proxy-url"]; ok {
+		t.Errorf("proxy-url was not removed")
+	}
+}
+
+var handWrittenKubeCfg = []byte(`
+current-context: zeta
+kind: Config
+apiVersion: v1
+users:
+- name: zeta
+  user:
+    username: admin
+    password: secret
+- name: kubed
+  user:
+    token: old-token
+clusters:
+- name: zeta
+  cluster:
+    server: https://zeta.example.org
+    extensions:
+    - name: vendor
+      extension:
+        region: north
+- name: kubed
+  cluster:
+    server: https://old.example.org
+    insecure-skip-tls-verify: true
+contexts:
+- name: zeta
+  context:
+    cluster: zeta
+    user: zeta
+    namespace: team
+- name: kubed
+  context:
+    cluster: kubed
+    user: kubed
+    namespace: course
+    extensions:
+    - name: vendor
+      extension:
+        color: red
+`)
+
+func TestSetupKubeConfigMerges(t *testing.T) {
+	tmp := tempFile(t, handWrittenKubeCfg)
+	defer os.Remove(tmp)
+
+	err := SetupKubeConfig(&KubeConfigSetup{
+		ClusterName:              "kubed",
+		ClusterServerAddress:     "https://new.example.org",
+		CertificateAuthorityData: []byte("ca"),
+		Token:                    "new-token",
+		KeepContext:              true,
+		KubeConfigFile:           tmp,
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	raw, data, err := readRawFile(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := raw.names("users"); !reflect.DeepEqual(names, []string{"zeta", "kubed"}) {
+		t.Errorf("Order of users changed to %v", names)
+	}
+	var order yaml.MapSlice
+	if err := yaml.Unmarshal(data, &order); err != nil {
+		t.Fatal(err)
+	}
+	if order[0].Key != "current-context" || order[3].Key != "users" {
+		t.Errorf("Order of sections changed:\n%s", data)
+	}
+
+	if raw.entries("clusters")["zeta"]["extensions"] == nil {
+		t.Errorf("Extensions of other cluster were lost:\n%s", data)
+	}
+	if raw.entries("contexts")["kubed"]["extensions"] == nil {
+		t.Errorf("Extensions of updated context were lost:\n%s", data)
+	}
+	if ns := raw.entries("contexts")["kubed"]["namespace"]; ns != "course" {
+		t.Errorf("Expected namespace to be kept, got %v", ns)
+	}
+	if _, ok := raw.entries("clusters")["kubed"]["insecure-skip-tls-verify"]; ok {
+		t.Errorf("insecure-skip-tls-verify was kept next to CA data")
+	}
+	if token, err := ReadToken(tmp, "kubed"); err != nil || token != "new-token" {
+		t.Errorf("Expected new token, got %q (%v)", token, err)
+	}
+	if pw := raw.entries("users")["zeta"]["password"]; pw != "secret" {
+		t.Errorf("Other user was changed:\n%s", data)
+	}
+}
+
+func TestMergeEntries(t *testing.T) {
+	tmp := tempFile(t, fakeKubeCfg)
+	defer os.Remove(tmp)
+
+	err := SetupKubeConfig(&KubeConfigSetup{
+		ClusterName:          "lab",
+		ClusterServerAddress: "https://127.0.0.1:6443",
+		Token:                "test-token",
+		Impersonate:          "admin",
+		KubeConfigFile:       tmp,
+	})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	fragment := []byte(`
+clusters:
+- name: issued
+  cluster:
+    server: https://lab.example.com:6443
+    tls-server-name: lab.example.com
+users:
+- name: issued-user
+  user:
+    as: someone-else
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: issuer-plugin
+`)
+	err = MergeEntries(tmp, fragment, "issued", "issued-user", "lab", "lab")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+
+	raw, err := readRawConfig(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, user := raw.entries("clusters")["lab"], raw.entries("users")["lab"]
+	if cluster["server"] != "https://127.0.0.1:6443" || cluster["tls-server-name"] != "lab.example.com" {
+		t.Errorf("Expected the server of kubed and the fields of the fragment, got %v", cluster)
+	}
+	if _, ok := user["token"]; ok {
+		t.Errorf("Expected the token to be replaced by the credentials of the fragment, got %v", user)
+	}
+	if !IsExecUser(tmp, "lab") || user["as"] != "admin" {
+		t.Errorf("Expected the exec plugin of the fragment and the impersonation of kubed, got %v", user)
+	}
+}
@@ -0,0 +1,83 @@
+package kubeconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// writeFile replaces the kubeconfig file with data. The data goes to a
+// temporary file next to it first, which is synced and checked to parse as a
+// kubeconfig before it is renamed over the original. A crash or a broken
+// encoding leaves the original as it was.
+func writeFile(filename string, data []byte) error {
+	// Replace the file a symlink points to, not the symlink
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+
+	// create parent dir if doesn't exist
+	dir := filepath.Dir(filename)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrapf(err, "Error creating directory: %s", dir)
+		}
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".")
+	if err != nil {
+		return errors.Wrapf(err, "Error writing file %s", filename)
+	}
+	defer os.Remove(tmp.Name())
+
+	// write with restricted permissions
+	err = tmp.Chmod(0600)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Error writing file %s", filename)
+	}
+
+	if err := checkWritten(tmp.Name()); err != nil {
+		return errors.Wrapf(err, "Not replacing %s, the new kubeconfig is broken", filename)
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return errors.Wrapf(err, "Error replacing file %s", filename)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// checkWritten reads back what reached the disk, and makes sure client-go and
+// kubed can both parse it
+func checkWritten(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := Decode(data); err != nil {
+		return err
+	}
+	_, err = parseRawConfig(data)
+	return err
+}
+
+// syncDir makes the rename durable. Not all platforms can sync directories,
+// the file itself is synced already, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// plainEnv turns on plain output like -plain, for users who always want it
+const plainEnv = "KUBED_PLAIN"
+
+// plainOutput tells whether the output is for screen readers: one line per
+// message or record, no colors and nothing drawn with characters
+func plainOutput() bool {
+	return *plain || os.Getenv(plainEnv) != ""
+}
+
+// plainFormatter writes a log entry as "level: message", followed by its
+// fields as "name: value", leaving out the time and the quoting of the text
+// formatter
+type plainFormatter struct{}
+
+func (plainFormatter) Format(entry *log.Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: %s", entry.Level, entry.Message)
+	names := make([]string, 0, len(entry.Data))
+	for name := range entry.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, ". %s: %v", name, entry.Data[name])
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// table prints rows under a header, as aligned columns or, with plain
+// output, as a line per row naming each value
+type table struct {
+	header []string
+	w      io.Writer
+	tw     *tabwriter.Writer
+}
+
+func newTable(w io.Writer, header ...string) *table {
+	t := &table{header: header, w: w}
+	if !plainOutput() {
+		t.tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(t.tw, strings.Join(header, "\t"))
+	}
+	return t
+}
+
+func (t *table) row(values ...string) {
+	if t.tw != nil {
+		fmt.Fprintln(t.tw, strings.Join(values, "\t"))
+		return
+	}
+	fields := make([]string, len(values))
+	for i, value := range values {
+		if value == "-" {
+			value = "none"
+		}
+		fields[i] = strings.ToLower(t.header[i]) + ": " + value
+	}
+	fmt.Fprintln(t.w, strings.Join(fields, ", "))
+}
+
+func (t *table) flush() error {
+	if t.tw != nil {
+		return t.tw.Flush()
+	}
+	return nil
+}
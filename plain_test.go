@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestPlainFormatter(t *testing.T) {
+	entry := &log.Entry{
+		Level:   log.ErrorLevel,
+		Message: "Error in getting access token",
+		Data:    log.Fields{"hint": "Log in again with -prompt login"},
+	}
+	out, err := plainFormatter{}.Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "error: Error in getting access token. hint: Log in again with -prompt login\n"
+	if string(out) != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestTable(t *testing.T) {
+	defer func(p bool) { *plain = p }(*plain)
+
+	for _, c := range []struct {
+		plain    bool
+		expected string
+	}{
+		{false, "NAME  TOKEN EXPIRES\nlab   in 3h0m\nprod  -\n"},
+		{true, "name: lab, token expires: in 3h0m\nname: prod, token expires: none\n"},
+	} {
+		*plain = c.plain
+		var buf bytes.Buffer
+		table := newTable(&buf, "NAME", "TOKEN EXPIRES")
+		table.row("lab", "in 3h0m")
+		table.row("prod", "-")
+		if err := table.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.expected {
+			t.Errorf("Expected %q with -plain=%v, got %q", c.expected, c.plain, buf.String())
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isPlugin tells whether kubed was started by kubectl as "kubectl kubed"
+func isPlugin() bool {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	return name == "kubectl-kubed"
+}
+
+// pluginArgs maps the arguments of "kubectl kubed login|renew|status" to
+// those of kubed, following the kubectl conventions of --kubeconfig and
+// --context, the latter naming the cluster
+func pluginArgs(args []string) []string {
+	var rest []string
+	kubeConfig, context := "", ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		for _, name := range []string{"--kubeconfig", "--context"} {
+			value, matched := "", false
+			if arg == name && i+1 < len(args) {
+				value, matched = args[i+1], true
+				i++
+			} else if strings.HasPrefix(arg, name+"=") {
+				value, matched = strings.TrimPrefix(arg, name+"="), true
+			}
+			if !matched {
+				continue
+			}
+			if name == "--kubeconfig" {
+				kubeConfig = value
+			} else {
+				context = value
+			}
+			arg = ""
+		}
+		if arg != "" {
+			rest = append(rest, arg)
+		}
+	}
+
+	// kubectl uses the first file in KUBECONFIG, the context file of kubed
+	// env only sets the current context
+	if kubeConfig == "" && os.Getenv("KUBECONFIG") != "" {
+		for _, f := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+			if f != "" && !isContextFile(f) {
+				kubeConfig = f
+				break
+			}
+		}
+	}
+
+	var mapped []string
+	if kubeConfig != "" {
+		mapped = append(mapped, "-kube-config", kubeConfig)
+	}
+	if len(rest) == 0 {
+		return mapped
+	}
+
+	switch rest[0] {
+	case "renew":
+		name := context
+		if len(rest) > 1 && !strings.HasPrefix(rest[1], "-") {
+			name, rest = rest[1], rest[1:]
+		}
+		return append(append(mapped, "-renew", name), rest[1:]...)
+	case "status", "login":
+		mapped = append(mapped, rest[0])
+		if context != "" && (len(rest) == 1 || strings.HasPrefix(rest[1], "-")) {
+			mapped = append(mapped, context)
+		}
+		return append(mapped, rest[1:]...)
+	}
+	return append(mapped, rest...)
+}
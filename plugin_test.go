@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPluginArgs(t *testing.T) {
+	os.Unsetenv("KUBECONFIG")
+
+	var tests = []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"renew", "test-cluster"}, []string{"-renew", "test-cluster"}},
+		{[]string{"renew", "--context", "test-cluster"}, []string{"-renew", "test-cluster"}},
+		{[]string{"--kubeconfig=/tmp/config", "renew", "test-cluster", "-prompt", "login"},
+			[]string{"-kube-config", "/tmp/config", "-renew", "test-cluster", "-prompt", "login"}},
+		{[]string{"status"}, []string{"status"}},
+		{[]string{"--context", "test-cluster", "status"}, []string{"status", "test-cluster"}},
+		{[]string{"--context", "test-cluster", "login", "-from", "https://example.com/registry.yaml"},
+			[]string{"login", "test-cluster", "-from", "https://example.com/registry.yaml"}},
+		{[]string{"doctor", "test-cluster"}, []string{"doctor", "test-cluster"}},
+	}
+
+	for _, test := range tests {
+		if mapped := pluginArgs(test.args); !reflect.DeepEqual(mapped, test.expected) {
+			t.Errorf("Expected %v for %v, got %v", test.expected, test.args, mapped)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uninett/kubed/internal/segment"
+)
+
+func init() {
+	commands["prompt"] = &command{
+		usage: "prompt",
+		help:  "Print the current context and the time left of its token, for PS1 or starship",
+		run:   promptCommand,
+	}
+}
+
+// promptKubeConfig is the kubeconfig kubectl uses: the first file of
+// KUBECONFIG, or the one given with -kube-config
+func promptKubeConfig() string {
+	if env := filepath.SplitList(os.Getenv("KUBECONFIG")); len(env) > 0 && env[0] != "" {
+		return env[0]
+	}
+	return expandHome(filepath.SplitList(*kubeConfigFlag)[0])
+}
+
+// promptClusters are the context names and expiry of the clusters
+func promptClusters(clusters []Cluster) []segment.Cluster {
+	var result []segment.Cluster
+	for _, c := range clusters {
+		names := append([]string{c.Name}, c.Aliases...)
+		if c.Entries != nil {
+			names = append(names, c.Entries.Context)
+		}
+		for name := range extraContexts(&c) {
+			names = append(names, name)
+		}
+		result = append(result, segment.Cluster{Names: names, Expiry: c.TokenExpiry})
+	}
+	return result
+}
+
+// writePromptState keeps the clusters for kubed-prompt whenever the kubed
+// config is written, it never decrypts the config or starts client-go
+func writePromptState(conf *KubedConfig) {
+	err := segment.WriteClusters(filepath.Join(cacheDir(), segment.StateFile), promptClusters(conf.Clusters))
+	if err != nil {
+		log.Warn("Failed in writing the state of kubed-prompt ", err)
+	}
+}
+
+// currentPromptState only reads the current context from kubeconfig and the
+// recorded expiry from the kubed config, no tokens are decoded and nothing is
+// asked over the network
+func currentPromptState(kubeConfigFile string, now time.Time) (segment.State, error) {
+	data, err := ioutil.ReadFile(kubeConfigFile)
+	if err != nil {
+		return segment.State{}, err
+	}
+	clusters, err := readClusters()
+	if err != nil {
+		return segment.State{}, err
+	}
+	return segment.Current(data, promptClusters(clusters), now)
+}
+
+func promptCommand(ctx context.Context, args []string) error {
+	err := segment.ValidShell(*promptShell)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+
+	// Without kubeconfig or context there is nothing to show, and a prompt
+	// is no place for errors
+	state, err := currentPromptState(promptKubeConfig(), time.Now())
+	if err != nil || state.Context == "" {
+		return nil
+	}
+	// The prompt is printed into a pipe of the shell, auto colors it anyway
+	color := *colorMode == "always" || (*colorMode == "auto" && os.Getenv(noColorEnv) == "")
+	out, err := segment.Render(*promptFormat, state, *promptShell, color)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	fmt.Print(out)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uninett/kubed/internal/segment"
+)
+
+func TestPromptState(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	now := time.Now()
+	if err := saveConfig(&Cluster{Name: "course", TokenExpiry: now.Add(20 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "config")
+	err := ioutil.WriteFile(filename, []byte(`
+current-context: course
+contexts:
+- name: course
+  context:
+    cluster: course
+    namespace: course-2019
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := currentPromptState(filename, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Context != "course" || state.Namespace != "course-2019" || state.Minutes != 20 {
+		t.Errorf("Unexpected prompt state %+v", state)
+	}
+
+	// kubed-prompt reads the same from the state kubed keeps for it
+	clusters, err := segment.ReadClusters(filepath.Join(dir, segment.StateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lean, err := segment.Current(data, clusters, now); err != nil || lean != state {
+		t.Errorf("Expected the prompt state %+v from the state file, got %+v %v", state, lean, err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func init() {
+	commands["proxy"] = &command{
+		usage: "proxy -cluster name [-listen addr]",
+		help:  "Forward requests to the API server, adding a fresh token for tools without kubeconfig",
+		run:   proxy,
+	}
+}
+
+func proxy(ctx context.Context, args []string) error {
+	if *exportCluster == "" {
+		return withExitCode(exitUsage, errors.New("Give the cluster to proxy to with -cluster"))
+	}
+	cluster, err := readConfig(*exportCluster)
+	if err != nil {
+		return err
+	}
+	target, err := url.Parse(cluster.APIServer)
+	if err != nil {
+		return errors.Wrap(err, "Invalid API server address")
+	}
+
+	transport, err := clusterTransport(cluster)
+	if err != nil {
+		return err
+	}
+
+	var mutex sync.Mutex
+	token := ""
+	rp := httputil.NewSingleHostReverseProxy(target)
+	rp.Transport = transport
+	director := rp.Director
+	rp.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Web pages may only reach the proxy by its own address, anything
+		// else is DNS rebinding or a cross-site request acting as the user
+		if !proxyHostAllowed(r.Host, *listenAddr) || !proxyOriginAllowed(r.Header.Get("Origin"), *listenAddr) {
+			http.Error(w, "Host or Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		// The lock is not held while renewing, renewedToken takes the refresh
+		// lock of the cluster. A login would open a browser from the
+		// background, the client is told to have the user log in instead.
+		mutex.Lock()
+		t := token
+		mutex.Unlock()
+		if t == "" || tokenExpired(t) {
+			var err error
+			t, err = renewedToken(ctx, cluster.Name, true, 0, false)
+			if err != nil && exitCode(err) == exitAuthDenied {
+				log.Warn(err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err != nil || t == "" {
+				log.Warn("Failed in getting token for \"", cluster.Name, "\" ", err)
+				http.Error(w, "kubed failed in getting a token for "+cluster.Name, http.StatusBadGateway)
+				return
+			}
+			mutex.Lock()
+			token = t
+			mutex.Unlock()
+		}
+		r.Header.Set("Authorization", "Bearer "+t)
+		rp.ServeHTTP(w, r)
+	}
+
+	srv := &http.Server{Addr: *listenAddr, Handler: http.HandlerFunc(handler)}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("Proxying http://", *listenAddr, " to ", cluster.APIServer, " as \"", cluster.Name, "\"")
+	err = srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// proxyHostAllowed tells whether a request Host names the listen address.
+// Loopback names also match a loopback or unspecified listen address.
+func proxyHostAllowed(host string, listen string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, "80"
+	}
+	listenName, listenPort, err := net.SplitHostPort(listen)
+	if err != nil || port != listenPort {
+		return false
+	}
+	if strings.EqualFold(name, listenName) {
+		return true
+	}
+	ip := net.ParseIP(listenName)
+	return isLoopback(name) && (listenName == "" || isLoopback(listenName) || ip != nil && ip.IsUnspecified())
+}
+
+// proxyOriginAllowed tells whether the Origin of a request, if any, is the
+// proxy itself
+func proxyOriginAllowed(origin string, listen string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != "http" {
+		return false
+	}
+	return proxyHostAllowed(u.Host, listen)
+}
+
+// isLoopback tells whether a host name or address is this machine
+func isLoopback(name string) bool {
+	if strings.EqualFold(name, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(name, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// validProxyURL checks a -proxy-url, kubectl knows of http, https and socks5 proxies
+func validProxyURL(proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return errors.New("Invalid proxy URL " + proxyURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+		return errors.New("Proxy URL must start with http://, https:// or socks5://")
+	}
+	return nil
+}
+
+// clusterTransport trusts the CA certificate kubed wrote to kubeconfig for the
+// cluster, and goes through its proxy if it has one
+func clusterTransport(cluster *Cluster) (*http.Transport, error) {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if cluster.ProxyURL != "" {
+		u, err := url.Parse(cluster.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	caData, err := kubeconfig.ReadCAData(expandHome(cluster.KubeConfig), kubeEntries(cluster).Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if len(caData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, errors.New("Failed in parsing CA certificate of " + cluster.Name)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return transport, nil
+}
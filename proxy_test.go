@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProxyHostAllowed(t *testing.T) {
+	for _, test := range []struct {
+		host    string
+		listen  string
+		allowed bool
+	}{
+		{"127.0.0.1:8001", "127.0.0.1:8001", true},
+		{"localhost:8001", "127.0.0.1:8001", true},
+		{"[::1]:8001", "127.0.0.1:8001", true},
+		{"localhost:8001", ":8001", true},
+		{"127.0.0.1:8002", "127.0.0.1:8001", false},
+		{"attacker.example.com:8001", "127.0.0.1:8001", false},
+		{"attacker.example.com:8001", "0.0.0.0:8001", false},
+		{"127.0.0.1", "127.0.0.1:8001", false},
+	} {
+		if allowed := proxyHostAllowed(test.host, test.listen); allowed != test.allowed {
+			t.Errorf("Expected %v for host %q on %q, got %v", test.allowed, test.host, test.listen, allowed)
+		}
+	}
+
+	if !proxyOriginAllowed("", "127.0.0.1:8001") || !proxyOriginAllowed("http://localhost:8001", "127.0.0.1:8001") {
+		t.Error("Expected requests without Origin or from the proxy itself to be allowed")
+	}
+	if proxyOriginAllowed("https://attacker.example.com", "127.0.0.1:8001") {
+		t.Error("Expected requests from other sites to be refused")
+	}
+}
+
+func TestProxyTokenDoesNotLogIn(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	s, err := newSandbox("https://token.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := s.claims("kubernetes", nil)
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	token, err := s.sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := &Cluster{Name: "lab", IssuerURL: "https://token.example.com", KubeConfig: "~/.kube/config", ExecCredential: true}
+	if err := saveConfig(cluster); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCachedJWT(context.Background(), "lab", token); err != nil {
+		t.Fatal(err)
+	}
+
+	oldOpenURL := openURL
+	defer func() { openURL = oldOpenURL }()
+	openURL = func(u string) error {
+		t.Errorf("Expected the proxy not to open a browser, got %s", u)
+		return nil
+	}
+	// The expired token has no refresh token to renew it with
+	_, err = renewedToken(context.Background(), "lab", true, 0, false)
+	if exitCode(err) != exitAuthDenied {
+		t.Errorf("Expected renewing to be denied without logging in, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func init() {
+	commands["prune"] = &command{
+		usage: "prune [-prune-days N] [-check-reachable]",
+		help:  "Offer to remove clusters with long expired tokens or unreachable API servers",
+		run:   prune,
+	}
+	commands["remove"] = &command{
+		usage: "remove <cluster>",
+		help:  "Remove a cluster with its kubeconfig entries, cached tokens and kubed config",
+		run:   remove,
+	}
+}
+
+func remove(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return withExitCode(exitUsage, errors.New("Please provide the name of the cluster to remove"))
+	}
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	ok, err := confirm(ctx, fmt.Sprintf("Remove %s?", cluster.Name), false)
+	if err != nil || !ok {
+		return err
+	}
+	err = removeCluster(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	log.Info("Removed cluster \"", cluster.Name, "\"")
+	return nil
+}
+
+func prune(ctx context.Context, args []string) error {
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -*pruneDays)
+	for i := range clusters {
+		c := &clusters[i]
+
+		var reasons []string
+		if expiry := clusterExpiry(c); !expiry.IsZero() && expiry.Before(cutoff) {
+			reasons = append(reasons, formatExpiry(expiry, time.Now()))
+		}
+		if *checkReachable {
+			if err := reachable(ctx, c.APIServer, c.ProxyURL); err != nil {
+				reasons = append(reasons, "API server unreachable: "+err.Error())
+			}
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		ok, err := confirm(ctx, fmt.Sprintf("Remove %s (%s)?", c.Name, strings.Join(reasons, ", ")), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		err = removeCluster(ctx, c)
+		if err != nil {
+			return err
+		}
+		log.Info("Removed cluster \"", c.Name, "\"")
+	}
+	return nil
+}
+
+// clusterExpiry returns the recorded token expiry, or reads it from kubeconfig
+// for clusters set up before expiry was recorded
+func clusterExpiry(c *Cluster) time.Time {
+	if !c.TokenExpiry.IsZero() {
+		return c.TokenExpiry
+	}
+	token, err := kubeconfig.ReadToken(expandHome(c.KubeConfig), kubeEntries(c).User)
+	if err != nil {
+		return time.Time{}
+	}
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		return time.Time{}
+	}
+	_, expiry := auth.TokenTimes(claims)
+	return expiry
+}
+
+// reachable checks that the API server answers at all, any status code will do
+func reachable(ctx context.Context, apiServer string, proxyURL string) error {
+	req := gorequest.New().Get(strings.TrimRight(apiServer, "/") + "/version").
+		TLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	if proxyURL != "" {
+		req = req.Proxy(proxyURL)
+	}
+	_, errs := endRequest(ctx, req, nil)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// removeCluster deletes everything kubed keeps about a cluster: the entries in
+// the kubeconfig files it manages, the cached tokens and the kubed config
+func removeCluster(ctx context.Context, c *Cluster) error {
+	for _, filename := range c.ManagedKubeConfigs {
+		err := removeEntriesIn(c, filename)
+		if err != nil {
+			return err
+		}
+		audit("remove", c.Name, filename, "", "")
+	}
+	if len(c.ManagedKubeConfigs) == 0 {
+		err := removeEntriesIn(c, expandHome(c.KubeConfig))
+		if err != nil {
+			return err
+		}
+		audit("remove", c.Name, expandHome(c.KubeConfig), "", "")
+	}
+
+	// Nothing else is in the own kubeconfig file of the cluster
+	if hasSeparateKubeConfig(c) {
+		err := os.Remove(expandHome(c.KubeConfig))
+		if err != nil && !os.IsNotExist(err) {
+			log.Warn("Failed in removing ", expandHome(c.KubeConfig), " ", err)
+		}
+	}
+
+	err := removeCachedToken(ctx, c.Name)
+	if err != nil {
+		return err
+	}
+	return deleteCluster(c.Name)
+}
+
+// removeEntriesIn deletes the cluster, user and contexts of the cluster from
+// the kubeconfig file
+func removeEntriesIn(c *Cluster, filename string) error {
+	entries := kubeEntries(c)
+	err := kubeconfig.RemoveNamedEntries(filename, entries.Cluster, entries.User, entries.Context)
+	if err != nil {
+		return err
+	}
+	var contexts []string
+	for name := range extraContexts(c) {
+		contexts = append(contexts, name)
+	}
+	if len(contexts) == 0 {
+		return nil
+	}
+	return kubeconfig.RemoveContexts(filename, contexts)
+}
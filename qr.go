@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// printQR renders content as QR code in the terminal, two modules per character.
+// Light modules are drawn as blocks, so the code scans on the usual dark background.
+func printQR(w io.Writer, content string) error {
+	qr, err := qrcode.New(content, qrcode.Low)
+	if err != nil {
+		return err
+	}
+	bitmap := qr.Bitmap()
+
+	var buf bytes.Buffer
+	for y := 0; y < len(bitmap); y += 2 {
+		for x := range bitmap[y] {
+			top := !bitmap[y][x]
+			bottom := y+1 < len(bitmap) && !bitmap[y+1][x]
+			switch {
+			case top && bottom:
+				buf.WriteString("█")
+			case top:
+				buf.WriteString("▀")
+			case bottom:
+				buf.WriteString("▄")
+			default:
+				buf.WriteString(" ")
+			}
+		}
+		buf.WriteString("\n")
+	}
+	_, err = fmt.Fprint(w, buf.String())
+	return err
+}
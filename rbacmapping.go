@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uninett/kubed/pkg/auth"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// rbacMapping is the file cluster administrators hand out to tell what the
+// groups of the users give on the cluster, e.g.
+//
+//	groups:
+//	  fc:org:uninett.no: [view]
+//	  fc:adhoc:course-*: [edit in the namespace of the course]
+//
+// A group ending with "*" matches all groups starting with the rest.
+type rbacMapping struct {
+	Groups map[string][]string `yaml:"groups"`
+}
+
+func readRBACMapping(ctx context.Context, source string) (*rbacMapping, error) {
+	data, err := readSource(ctx, source, "RBAC mapping")
+	if err != nil {
+		return nil, err
+	}
+	var mapping rbacMapping
+	err = yaml.Unmarshal(data, &mapping)
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+// roles maps each of the groups to the roles it gives, leaving out the
+// groups that give none
+func (m *rbacMapping) roles(groups []string) map[string][]string {
+	mapped := map[string][]string{}
+	for _, group := range groups {
+		var roles []string
+		for pattern, r := range m.Groups {
+			if pattern == group || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(group, strings.TrimSuffix(pattern, "*"))) {
+				roles = append(roles, r...)
+			}
+		}
+		if len(roles) > 0 {
+			sort.Strings(roles)
+			mapped[group] = roles
+		}
+	}
+	return mapped
+}
+
+// showGroups tells after a login which groups the token has, which is what
+// RBAC bindings match besides the user, and what they give on the cluster
+// when it has an RBAC mapping. Tokens that work but are forbidden everything
+// mostly lack a group.
+func showGroups(ctx context.Context, cluster *Cluster) {
+	_, token, err := clusterToken(ctx, cluster.Name)
+	if err != nil {
+		log.Debug("Not showing groups, no token ", err)
+		return
+	}
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		return
+	}
+	if claims["groups"] == nil {
+		log.Info(tr("The token has no groups claim, RBAC can only match your user"))
+		return
+	}
+	groups := claimStrings(claims["groups"])
+	log.Info(tr("Groups in the token: %s", strings.Join(groups, ", ")))
+	if cluster.RBACMapping == "" {
+		return
+	}
+
+	mapping, err := readRBACMapping(ctx, cluster.RBACMapping)
+	if err != nil {
+		log.Warn("Failed in reading RBAC mapping ", err)
+		return
+	}
+	mapped := mapping.roles(groups)
+	if len(mapped) == 0 {
+		log.Warn(tr("None of your groups give roles on %q by the RBAC mapping, kubectl will be forbidden. Ask the cluster administrators to bind one of them", cluster.Name))
+		return
+	}
+	for _, group := range groups {
+		if roles, ok := mapped[group]; ok {
+			log.Info("  ", group, ": ", strings.Join(roles, ", "))
+		}
+	}
+}
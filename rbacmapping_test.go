@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRBACMapping(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "rbac.yaml")
+	err := ioutil.WriteFile(filename, []byte(`groups:
+  fc:org:uninett.no: [view]
+  fc:adhoc:course-*: [edit in the course namespace]
+  fc:adhoc:course-inf1000: [admin in inf1000]
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := readRBACMapping(context.Background(), filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapped := mapping.roles([]string{"fc:org:uninett.no", "fc:adhoc:course-inf1000", "fc:adhoc:other"})
+	expected := map[string][]string{
+		"fc:org:uninett.no":       {"view"},
+		"fc:adhoc:course-inf1000": {"admin in inf1000", "edit in the course namespace"},
+	}
+	if !reflect.DeepEqual(mapped, expected) {
+		t.Errorf("Expected %v, got %v", expected, mapped)
+	}
+	if len(mapping.roles([]string{"fc:adhoc:other"})) != 0 {
+		t.Error("Expected no roles for an unmapped group")
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// recordEnv names the bundle a kubed started by "kubed record" writes to
+const recordEnv = "KUBED_RECORD"
+
+// supportBundle is the sanitized transcript of a kubed run for support
+// tickets: the settings of the clusters, the HTTP exchanges and the log.
+// Tokens keep their claims but lose their signatures, other secrets are
+// replaced with "REDACTED".
+type supportBundle struct {
+	Version   string                 `yaml:"version"`
+	Platform  string                 `yaml:"platform"`
+	Args      []string               `yaml:"args"`
+	Started   time.Time              `yaml:"started"`
+	ExitCode  *int                   `yaml:"exitcode,omitempty"`
+	Clusters  []Cluster              `yaml:"clusters,omitempty"`
+	Tokens    map[string]bundleToken `yaml:"tokens,omitempty"`
+	Nonces    []string               `yaml:"nonces,omitempty"`
+	Exchanges []exchange             `yaml:"exchanges,omitempty"`
+	Log       []bundleLogEntry       `yaml:"log,omitempty"`
+}
+
+// bundleToken tells which provider tokens were cached for a cluster, so a
+// replay takes the same way, e.g. renewing with the refresh token
+type bundleToken struct {
+	Refresh bool `yaml:"refresh,omitempty"`
+	JWT     bool `yaml:"jwt,omitempty"`
+}
+
+// exchange is an HTTP request of the run with its response. Request bodies
+// are not recorded, the URL tells what was asked for.
+type exchange struct {
+	Method   string            `yaml:"method,omitempty"`
+	URL      string            `yaml:"url,omitempty"`
+	Status   int               `yaml:"status,omitempty"`
+	Header   map[string]string `yaml:"header,omitempty"`
+	Body     string            `yaml:"body,omitempty"`
+	Error    string            `yaml:"error,omitempty"`
+	Duration string            `yaml:"duration,omitempty"`
+}
+
+type bundleLogEntry struct {
+	Time    time.Time         `yaml:"time"`
+	Level   string            `yaml:"level"`
+	Message string            `yaml:"message"`
+	Fields  map[string]string `yaml:"fields,omitempty"`
+}
+
+// bundleHeaders are the response headers kept in the bundle
+var bundleHeaders = append([]string{"Content-Type", "Date", "Location", "WWW-Authenticate"}, correlationHeaders...)
+
+// secretFlags are the flags whose values are left out of the bundle
+var secretFlags = map[string]bool{"client-secret": true, "webhook": true, "issuer-header": true}
+
+var (
+	jwtPattern     = regexp.MustCompile(`(eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.)[A-Za-z0-9_-]+`)
+	privateKeyData = regexp.MustCompile(`(?s)(client-key-data"?:\s*"?)[A-Za-z0-9+/=]+|-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// sanitize strips the signatures of JWTs, which keeps their claims for
+// reading but makes them useless, and redacts the other credentials
+func sanitize(s string) string {
+	s = redactKnownSecrets(s)
+	s = jwtPattern.ReplaceAllString(s, "${1}REDACTED")
+	s = privateKeyData.ReplaceAllString(s, "${1}REDACTED")
+	// The first pattern would redact the JWTs as a whole
+	for _, p := range tokenPatterns[1:] {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// sanitizeBody redacts the credentials in a JSON body by key, and otherwise
+// falls back to sanitize
+func sanitizeBody(body []byte) string {
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil {
+		return sanitize(string(body))
+	}
+	out, err := json.Marshal(sanitizeJSON(v, ""))
+	if err != nil {
+		return sanitize(string(body))
+	}
+	return string(out)
+}
+
+func sanitizeJSON(v interface{}, key string) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, e := range value {
+			value[k] = sanitizeJSON(e, k)
+		}
+	case []interface{}:
+		for i, e := range value {
+			value[i] = sanitizeJSON(e, key)
+		}
+	case string:
+		if jwtPattern.MatchString(value) {
+			return sanitize(value)
+		}
+		for _, p := range secretParams {
+			if key == p {
+				return "REDACTED"
+			}
+		}
+		return sanitize(value)
+	}
+	return v
+}
+
+// sanitizeArgs redacts the values of secretFlags and credentials in the
+// arguments, given as -flag value or -flag=value
+func sanitizeArgs(args []string) []string {
+	sanitized := make([]string, len(args))
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if j := strings.Index(name, "="); j > 0 && strings.HasPrefix(arg, "-") && secretFlags[name[:j]] {
+			arg = arg[:len(arg)-len(name)+j+1] + "REDACTED"
+		} else if i > 0 && strings.HasPrefix(args[i-1], "-") && secretFlags[strings.TrimLeft(args[i-1], "-")] {
+			arg = "REDACTED"
+		}
+		sanitized[i] = sanitize(arg)
+	}
+	return sanitized
+}
+
+// sanitizeCluster leaves out secrets, hooks and the places of secrets and
+// keys, which don't exist where the bundle is replayed, and points the
+// kubeconfig files into the home directory
+func sanitizeCluster(c Cluster) Cluster {
+	if c.ClientSecret != "" {
+		c.ClientSecret = "REDACTED"
+	}
+	c.SecretBackend, c.SecretPath, c.SecretCommands = "", "", nil
+	c.IssuerClientCert, c.IssuerClientKey = "", ""
+	c.PreHook, c.PostHook = "", ""
+	headers := map[string]string{}
+	for name := range c.IssuerHeaders {
+		headers[name] = "REDACTED"
+	}
+	if len(headers) > 0 {
+		c.IssuerHeaders = headers
+	}
+	c.KubeConfig = "~/.kube/" + filepath.Base(c.KubeConfig)
+	for i, f := range c.ExtraKubeConfigs {
+		c.ExtraKubeConfigs[i] = "~/.kube/" + filepath.Base(f)
+	}
+	c.ManagedKubeConfigs = nil
+	return c
+}
+
+// bundleRecorder writes the bundle of this run as it goes, so it is complete
+// whichever way kubed exits
+type bundleRecorder struct {
+	mu       sync.Mutex
+	filename string
+	bundle   supportBundle
+}
+
+var recorder *bundleRecorder
+
+// startRecording records this run to filename, with the settings of all
+// clusters as they are now. Everything down to debug logs and HTTP traces
+// goes into the bundle.
+func startRecording(filename string) error {
+	r := &bundleRecorder{filename: filename, bundle: supportBundle{
+		Version:  version,
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+		Args:     sanitizeArgs(os.Args[1:]),
+		Started:  time.Now(),
+		Tokens:   map[string]bundleToken{},
+	}}
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+	// Recording starts before the run has a context to cancel
+	ctx := context.Background()
+	for _, c := range clusters {
+		r.bundle.Clusters = append(r.bundle.Clusters, sanitizeCluster(c))
+		if cached, ok, _ := readCachedToken(ctx, c.Name); ok {
+			r.bundle.Tokens[c.Name] = bundleToken{Refresh: cached.RefreshToken != "", JWT: cached.JWT != ""}
+		}
+	}
+
+	*logLevel, *quiet, *debugHTTP = "debug", false, true
+	*parallelLogins = 1
+	recorder = r
+	log.AddHook(r)
+	return r.write()
+}
+
+func (r *bundleRecorder) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (r *bundleRecorder) Fire(entry *log.Entry) error {
+	e := bundleLogEntry{Time: entry.Time, Level: entry.Level.String(), Message: sanitize(entry.Message)}
+	for k, v := range entry.Data {
+		if e.Fields == nil {
+			e.Fields = map[string]string{}
+		}
+		e.Fields[k] = sanitize(fmt.Sprint(v))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bundle.Log = append(r.bundle.Log, e)
+	return r.writeLocked()
+}
+
+// end sends the request like endRequest does and records the exchange,
+// leaving the body to endRequest to decode
+func (r *bundleRecorder) end(req *gorequest.SuperAgent) requestResult {
+	start := time.Now()
+	resp, body, errs := req.EndBytes()
+
+	e := exchange{Duration: time.Since(start).String()}
+	if len(errs) > 0 {
+		e.Error = sanitize(errs[0].Error())
+	}
+	if resp != nil {
+		e.Status = resp.StatusCode
+		if resp.Request != nil {
+			e.Method, e.URL = resp.Request.Method, redactURL(resp.Request.URL.String())
+		}
+		for _, h := range bundleHeaders {
+			if value := resp.Header.Get(h); value != "" {
+				if e.Header == nil {
+					e.Header = map[string]string{}
+				}
+				e.Header[h] = sanitize(value)
+			}
+		}
+		e.Body = sanitizeBody(body)
+	}
+
+	r.mu.Lock()
+	r.bundle.Exchanges = append(r.bundle.Exchanges, e)
+	err := r.writeLocked()
+	r.mu.Unlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed in writing the support bundle", err)
+	}
+	return requestResult{resp, body, errs}
+}
+
+// nonce keeps the nonces of the run, they only bind its ID tokens and are
+// needed to replay them
+func (r *bundleRecorder) nonce(n string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bundle.Nonces = append(r.bundle.Nonces, n)
+	r.writeLocked()
+}
+
+func (r *bundleRecorder) write() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.writeLocked()
+}
+
+func (r *bundleRecorder) writeLocked() error {
+	return writeBundle(r.filename, &r.bundle)
+}
+
+func writeBundle(filename string, bundle *supportBundle) error {
+	data, err := yaml.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	// Secrets seen after an entry was recorded are scrubbed from it as well
+	return ioutil.WriteFile(filename, []byte(redactKnownSecrets(string(data))), 0600)
+}
+
+func readBundle(filename string) (*supportBundle, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var bundle supportBundle
+	err = yaml.Unmarshal(data, &bundle)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in parsing support bundle")
+	}
+	return &bundle, nil
+}
+
+func init() {
+	commands["record"] = &command{
+		usage: "record [-bundle file] -- <arguments>",
+		help:  "Run kubed with the arguments, recording a sanitized transcript to attach to support tickets",
+		run:   recordCommand,
+	}
+}
+
+func recordCommand(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return withExitCode(exitUsage, errors.New("Please provide the arguments of the kubed run to record, e.g. kubed record -- -renew lab"))
+	}
+	filename, err := filepath.Abs(expandHome(*bundleFile))
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), recordEnv+"="+filename)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	code, err := exitStatus(leaveSignals(cmd.Run))
+	if err != nil {
+		return errors.Wrap(err, "Failed in running kubed to record")
+	}
+
+	bundle, err := readBundle(filename)
+	if err != nil {
+		return errors.Wrap(err, "Failed in reading the recorded bundle")
+	}
+	bundle.ExitCode = &code
+	err = writeBundle(filename, bundle)
+	if err != nil {
+		return err
+	}
+	log.Info("Recorded the run to ", filename, ", look it through and attach it to the support ticket")
+	os.Exit(code)
+	return nil
+}
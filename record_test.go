@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+func TestSanitize(t *testing.T) {
+	s, err := newSandbox("http://127.0.0.1:5556")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.sign(s.claims("kubed", map[string]interface{}{"groups": []string{"students"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := sanitizeBody([]byte(`{"token":"` + token + `","access_token":"opaque","refresh_token":"r1","expires_in":3600}`))
+	for _, secret := range []string{"opaque", "r1", strings.Split(token, ".")[2]} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Expected %q to be redacted from %s", secret, body)
+		}
+	}
+	if !strings.Contains(body, "3600") {
+		t.Errorf("Expected the rest of the body to be kept, got %s", body)
+	}
+
+	stripped := sanitize("token: " + token)
+	claims, err := auth.DecodeClaims(strings.TrimPrefix(stripped, "token: "))
+	if err != nil || claims["aud"] != "kubed" {
+		t.Errorf("Expected the claims to survive sanitizing, got %v %v", claims, err)
+	}
+	if out := sanitize("client-key-data: c2VjcmV0\nAuthorization: Bearer abc"); strings.Contains(out, "c2VjcmV0") || strings.Contains(out, "abc") {
+		t.Errorf("Expected the key and bearer token to be redacted, got %q", out)
+	}
+}
+
+func TestSanitizeArgs(t *testing.T) {
+	args := sanitizeArgs([]string{"-name", "lab", "-client-secret", "s3cret", "--client-secret=s3cret", "-issuer-header", "X-Api-Key: k", "-renew", "lab"})
+	expected := []string{"-name", "lab", "-client-secret", "REDACTED", "--client-secret=REDACTED", "-issuer-header", "REDACTED", "-renew", "lab"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %q, got %q", expected, args)
+	}
+}
+
+func TestSanitizeCluster(t *testing.T) {
+	c := sanitizeCluster(Cluster{
+		Name:          "lab",
+		ClientSecret:  "file:/home/user/secret",
+		KubeConfig:    "/home/user/.kube/config",
+		IssuerHeaders: map[string]string{"X-Api-Key": "k"},
+		PreHook:       "vpn up",
+	})
+	if c.ClientSecret != "REDACTED" || c.IssuerHeaders["X-Api-Key"] != "REDACTED" || c.PreHook != "" {
+		t.Errorf("Expected the secrets and hooks to be left out, got %+v", c)
+	}
+	if c.KubeConfig != "~/.kube/config" {
+		t.Errorf("Expected the kubeconfig in the home directory, got %q", c.KubeConfig)
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "bundle.yaml")
+	code := exitIssuerUnreachable
+	bundle := &supportBundle{
+		Version:   "1.0",
+		Args:      []string{"-renew", "lab"},
+		Clusters:  []Cluster{{Name: "lab", KubeConfig: "~/.kube/config"}},
+		Exchanges: []exchange{{Method: "HEAD", URL: "https://issuer.example.org", Status: 503}},
+		ExitCode:  &code,
+	}
+	err := writeBundle(filename, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := readBundle(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Exchanges[0].Status != 503 || *read.ExitCode != code || read.Clusters[0].Name != "lab" {
+		t.Errorf("Expected the bundle to survive writing, got %+v", read)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// tokenPatterns match credentials wherever they end up in a log line: JWTs,
+// bearer tokens in headers, and tokens in the query or fragment of URLs
+var tokenPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), "REDACTED"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}REDACTED"},
+	// JSON logs escape & as \u0026
+	{regexp.MustCompile(`((?:[?&#]|\\u0026)(?:access_token|refresh_token|id_token|client_secret|code|token)=)[^&\s"'#\\]+`), "${1}REDACTED"},
+}
+
+// minSecretLength keeps short values, which could be any word, from being
+// registered as secrets
+const minSecretLength = 8
+
+// knownSecrets are the credentials this run has seen. Opaque tokens, like
+// those of Dataporten, and client secrets match no pattern, so they are
+// scrubbed literally. JWTs are left to the patterns, support bundles keep
+// their claims.
+var knownSecrets struct {
+	sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// registerSecrets adds credentials to be scrubbed from logs and bundles
+func registerSecrets(secrets ...string) {
+	knownSecrets.Lock()
+	defer knownSecrets.Unlock()
+	if knownSecrets.values == nil {
+		knownSecrets.values = map[string]bool{}
+	}
+	added := false
+	for _, s := range secrets {
+		jwt := tokenPatterns[0].pattern.FindString(s) == s
+		if len(s) >= minSecretLength && !jwt && !knownSecrets.values[s] {
+			knownSecrets.values[s] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// Longer secrets first, so one containing another is scrubbed whole
+	var values []string
+	for s := range knownSecrets.values {
+		values = append(values, s)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	var pairs []string
+	for _, s := range values {
+		pairs = append(pairs, s, "REDACTED")
+	}
+	knownSecrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// redactKnownSecrets masks the registered credentials
+func redactKnownSecrets(s string) string {
+	knownSecrets.RLock()
+	defer knownSecrets.RUnlock()
+	if knownSecrets.replacer == nil {
+		return s
+	}
+	return knownSecrets.replacer.Replace(s)
+}
+
+// redactTokens masks the registered credentials and everything looking like one
+func redactTokens(s string) string {
+	s = redactKnownSecrets(s)
+	for _, p := range tokenPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// redactingFormatter scrubs credentials from the formatted entries, so no
+// log path, error message or field can leak a token at any level
+type redactingFormatter struct {
+	log.Formatter
+}
+
+func (f redactingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	data, err := f.Formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(redactTokens(string(data))), nil
+}
+
+// setFormatter formats the logs with f, with credentials redacted
+func setFormatter(f log.Formatter) {
+	log.SetFormatter(redactingFormatter{f})
+}
+
+// textFormatter is the text formatter in use, if any
+func textFormatter() *log.TextFormatter {
+	f := log.StandardLogger().Formatter
+	if r, ok := f.(redactingFormatter); ok {
+		f = r.Formatter
+	}
+	text, _ := f.(*log.TextFormatter)
+	return text
+}
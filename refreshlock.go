@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// refreshLockWait is how long to wait for another kubed renewing the
+	// token, which may include a login in the browser
+	refreshLockWait = 3 * time.Minute
+	// refreshFailureTTL is how long a failed renewal is handed to the calls
+	// that waited for it, instead of each of them trying again
+	refreshFailureTTL = 10 * time.Second
+)
+
+// processLock keeps parallel kubed processes from doing the same thing at
+// once, like the exec credential calls of kubectl running many requests
+// renewing the same token. The refresh lock file also holds the outcome of
+// the last failed renewal.
+type processLock struct {
+	file *os.File
+}
+
+type refreshFailure struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+func refreshLockPath(name string) string {
+	return filepath.Join(cacheDir(), "locks", name+".lock")
+}
+
+// lockRefresh takes the refresh lock of the cluster, waiting for whoever
+// holds it
+func lockRefresh(ctx context.Context, name string) (*processLock, error) {
+	lock, _, err := takeLock(ctx, refreshLockPath(name), fmt.Sprintf("renewing the token of %q", name))
+	return lock, err
+}
+
+// takeLock takes the lock file, waiting at most refreshLockWait for another
+// kubed doing what, and tells whether it had to wait
+func takeLock(ctx context.Context, filename string, what string) (*processLock, bool, error) {
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return nil, false, err
+	}
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+
+	deadline := time.Now().Add(refreshLockWait)
+	waited := false
+	for {
+		err = tryLockFile(file)
+		if err == nil {
+			return &processLock{file}, waited, nil
+		}
+		if !waited {
+			log.Info("Waiting for another kubed ", what)
+			waited = true
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, waited, withExitCode(exitTimeout, errors.Errorf("Another kubed has been %s for %s, remove %s if no kubed is running", what, refreshLockWait, filename))
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, waited, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// recentFailure returns the error of a renewal that failed moments ago
+func (l *processLock) recentFailure(now time.Time) error {
+	if _, err := l.file.Seek(0, 0); err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadAll(l.file)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var failure refreshFailure
+	if json.Unmarshal(data, &failure) != nil || now.Sub(failure.Time) > refreshFailureTTL {
+		return nil
+	}
+	return errors.New("Renewing the token failed moments ago: " + failure.Error)
+}
+
+// record keeps the outcome of a renewal for those waiting for the lock
+func (l *processLock) record(err error) {
+	var data []byte
+	if err != nil {
+		data, _ = json.Marshal(refreshFailure{Time: time.Now(), Error: err.Error()})
+	}
+	if l.file.Truncate(0) == nil {
+		l.file.WriteAt(data, 0)
+	}
+}
+
+func (l *processLock) unlock() {
+	unlockFile(l.file)
+	l.file.Close()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefreshLock(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	lock, err := lockRefresh(context.Background(), "kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := lockRefresh(ctx, "kubed"); err != context.DeadlineExceeded {
+		t.Errorf("Expected waiting for the held lock to time out, got %v", err)
+	}
+
+	lock.record(errors.New("invalid_grant"))
+	lock.unlock()
+
+	lock, err = lockRefresh(context.Background(), "kubed")
+	if err != nil {
+		t.Fatalf("Lock was not released: %s", err)
+	}
+	defer lock.unlock()
+	if err := lock.recentFailure(time.Now()); err == nil {
+		t.Error("Expected the recorded failure")
+	}
+	if err := lock.recentFailure(time.Now().Add(time.Minute)); err != nil {
+		t.Errorf("Expected old failure to be ignored, got %s", err)
+	}
+}
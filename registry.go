@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"golang.org/x/crypto/ed25519"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const registryKeyEnv = "KUBED_REGISTRY_KEY"
+
+func init() {
+	commands["login"] = &command{
+		usage: "login [cluster...] [-group name] [-from URL#name]",
+		help:  "Log in to configured clusters or a login group, or to one published in a cluster registry",
+		run:   loginCommand,
+	}
+}
+
+func loginCommand(ctx context.Context, args []string) error {
+	var cluster *Cluster
+	var err error
+
+	switch {
+	case *registryURL != "":
+		cluster, err = clusterFromRegistry(ctx, *registryURL)
+		if err != nil {
+			return err
+		}
+		err = validCluster(cluster)
+		if err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("Invalid cluster %q in the registry: %s", cluster.Name, err))
+		}
+		err = saveConfig(cluster)
+		if err != nil {
+			return err
+		}
+	case *loginGroup != "":
+		clusters, err := groupClusters(*loginGroup)
+		if err != nil {
+			return err
+		}
+		return loginMany(ctx, clusters)
+	case len(args) > 0:
+		var clusters []*Cluster
+		for _, name := range args {
+			cluster, err = readConfig(name)
+			if err != nil {
+				return err
+			}
+			clusters = append(clusters, cluster)
+		}
+		return loginMany(ctx, clusters)
+	default:
+		return errors.New("Please provide the name of the cluster or a registry URL with -from")
+	}
+
+	return login(ctx, cluster)
+}
+
+// fetchRegistry downloads the document at rawURL together with its detached
+// signature at rawURL.sig, and verifies the signature with the registry key
+func fetchRegistry(ctx context.Context, rawURL string) ([]byte, error) {
+	keyString := *registryKey
+	if keyString == "" {
+		keyString = os.Getenv(registryKeyEnv)
+	}
+	if keyString == "" && !*registryInsecure {
+		return nil, errors.New("No key to verify the cluster registry, provide one with -registry-key or " + registryKeyEnv)
+	}
+
+	var doc []byte
+	resp, errs := endRequest(ctx, gorequest.New().Get(rawURL), &doc)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	} else if resp != nil && resp.StatusCode != 200 {
+		return nil, &statusError{"fetching cluster registry", resp.StatusCode}
+	}
+
+	if *registryInsecure {
+		log.Warn("Using cluster registry ", rawURL, " without verifying its signature")
+		return doc, nil
+	}
+
+	var sig []byte
+	resp, errs = endRequest(ctx, gorequest.New().Get(rawURL+".sig"), &sig)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	} else if resp != nil && resp.StatusCode != 200 {
+		return nil, &statusError{"fetching cluster registry signature", resp.StatusCode}
+	}
+
+	err := verifyEd25519(keyString, doc, sig, "Cluster registry")
+	if err != nil {
+		return nil, errors.New(err.Error() + ", refusing to use " + rawURL)
+	}
+	return doc, nil
+}
+
+// verifyEd25519 checks the base64 encoded Ed25519 signature of doc with the
+// base64 encoded public key, naming what was signed in the errors
+func verifyEd25519(keyString string, doc []byte, encodedSig []byte, what string) error {
+	key, err := base64.StdEncoding.DecodeString(keyString)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New(what + " key must be a base64 encoded Ed25519 public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSig)))
+	if err != nil {
+		return errors.New(what + " signature is not base64 encoded")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), doc, sig) {
+		return errors.New(what + " signature is not valid")
+	}
+	return nil
+}
+
+// clusterFromRegistry returns the cluster selected by the fragment of rawURL,
+// e.g. https://example.org/clusters.json#prod. The fragment may be left out
+// when the registry only has one cluster.
+func clusterFromRegistry(ctx context.Context, rawURL string) (*Cluster, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	name := u.Fragment
+	u.Fragment = ""
+
+	doc, err := fetchRegistry(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var defs ClusterDefinitions
+	err = yaml.Unmarshal(doc, &defs)
+	if err != nil {
+		log.Warn("Failed in parsing cluster registry ", err)
+		return nil, err
+	}
+
+	var names []string
+	for _, d := range defs.Clusters {
+		if d.Name == name || (name == "" && len(defs.Clusters) == 1) {
+			if d.APIServer == "" || d.IssuerURL == "" || d.ClientID == "" {
+				return nil, fmt.Errorf("Cluster definition %q is missing apiserver, issuer or clientid", d.Name)
+			}
+			return clusterFromDefinition(d), nil
+		}
+		names = append(names, d.Name)
+	}
+	return nil, fmt.Errorf("Cluster %q not found in registry, available clusters: %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const testRegistry = `clusters:
+- name: lab
+  apiserver: https://lab.example.org:6443
+  issuer: https://issuer.example.org
+  clientid: kubed
+`
+
+func TestClusterFromRegistrySignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(key ed25519.PrivateKey, doc string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(doc)))
+	}
+
+	var doc, sig string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/clusters.yaml":
+			w.Write([]byte(doc))
+		case "/clusters.yaml.sig":
+			if sig == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(sig))
+		}
+	}))
+	defer server.Close()
+
+	*registryKey = base64.StdEncoding.EncodeToString(public)
+	defer func() { *registryKey = "" }()
+
+	doc, sig = testRegistry, sign(private, testRegistry)
+	cluster, err := clusterFromRegistry(context.Background(), server.URL+"/clusters.yaml#lab")
+	if err != nil {
+		t.Fatalf("Expected the signed registry to be used, got %s", err)
+	}
+	if cluster.APIServer != "https://lab.example.org:6443" {
+		t.Errorf("Expected the API server of the registry, got %q", cluster.APIServer)
+	}
+
+	for _, c := range []struct {
+		what     string
+		doc, sig string
+	}{
+		{"signed with another key", testRegistry, sign(otherKey, testRegistry)},
+		{"changed after signing", testRegistry + "- name: evil\n", sign(private, testRegistry)},
+		{"with a garbled signature", testRegistry, "not base64"},
+		{"without signature", testRegistry, ""},
+	} {
+		doc, sig = c.doc, c.sig
+		if _, err := clusterFromRegistry(context.Background(), server.URL+"/clusters.yaml#lab"); err == nil {
+			t.Errorf("Expected a registry %s to be refused", c.what)
+		}
+	}
+}
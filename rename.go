@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func init() {
+	commands["rename"] = &command{
+		usage: "rename <old> <new>",
+		help:  "Rename a cluster in kubeconfig and kubed config",
+		run:   rename,
+	}
+}
+
+func rename(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errors.New("Please provide the current and the new name of the cluster")
+	}
+	oldName, newName := args[0], args[1]
+	// The new name ends up in kubeconfig entries and file names like a new one
+	err := validClusterName(newName)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+
+	cluster, err := readConfig(oldName)
+	if err != nil {
+		return err
+	}
+	oldName = cluster.Name
+	if _, err := readConfig(newName); err == nil {
+		return fmt.Errorf("Cluster %q already exists", newName)
+	}
+
+	// Entries named by templates get their new names at the next login
+	for _, filename := range kubeConfigFiles(cluster) {
+		if cluster.Entries != nil {
+			break
+		}
+		err = kubeconfig.RenameEntries(filename, oldName, newName)
+		if err == nil {
+			err = renameExtraContexts(cluster, filename, newName)
+		}
+		if err != nil {
+			return err
+		}
+		audit("rename", newName, filename, "", "from "+oldName)
+	}
+
+	// An own kubeconfig file is named after the cluster as well
+	var newFile string
+	if hasSeparateKubeConfig(cluster) {
+		newFile, err = renameSeparateKubeConfig(cluster, newName)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = updateCluster(oldName, func(c *Cluster) {
+		c.Name = newName
+		if newFile != "" {
+			for i, f := range c.ManagedKubeConfigs {
+				if f == expandHome(c.KubeConfig) {
+					c.ManagedKubeConfigs[i] = expandHome(newFile)
+				}
+			}
+			c.KubeConfig = newFile
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = renameCachedToken(ctx, oldName, newName)
+	if err != nil {
+		log.Warn("Failed in renaming cached tokens ", err)
+	}
+
+	log.Info("Renamed cluster \"", oldName, "\" to \"", newName, "\"")
+	return nil
+}
+
+// renameExtraContexts moves the contexts of the extra namespaces of the
+// cluster to the new name of the cluster
+func renameExtraContexts(cluster *Cluster, filename string, newName string) error {
+	var old []string
+	for name := range extraContexts(cluster) {
+		old = append(old, name)
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	err := kubeconfig.RemoveContexts(filename, old)
+	if err != nil {
+		return err
+	}
+	renamed := *cluster
+	renamed.Name = newName
+	return writeExtraContexts(&renamed, filename)
+}
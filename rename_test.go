@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRenameRefusesInvalidName(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	if err := saveConfig(&Cluster{Name: "lab", APIServer: "https://192.168.1.1:8443"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../lab", "lab/one", "-lab", ""} {
+		if err := rename(context.Background(), []string{"lab", name}); err == nil {
+			t.Errorf("Expected renaming to %q to be refused", name)
+		}
+	}
+	if _, err := readConfig("lab"); err != nil {
+		t.Errorf("Cluster was renamed despite the invalid name: %s", err)
+	}
+}
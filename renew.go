@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// renewLogin renews the token of the cluster for -renew, with the refresh
+// token if there is one and by logging in again otherwise. Like validToken it
+// holds the refresh lock, so it doesn't race kubectl renewing the token.
+func renewLogin(ctx context.Context, cluster *Cluster) error {
+	lock, err := lockRefresh(ctx, cluster.Name)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	if err := lock.recentFailure(time.Now()); err != nil {
+		return err
+	}
+	if err := runHooks(ctx, "pre", cluster); err != nil {
+		return err
+	}
+
+	err = refreshLogin(ctx, cluster)
+	if err != nil {
+		log.Debug("Renewing with refresh token failed, logging in again ", err)
+		err = loginAgain(ctx, cluster)
+	}
+	lock.record(err)
+	return err
+}
+
+// refreshLogin renews the token of the cluster with the cached refresh token,
+// without user interaction. The caller runs the pre hook, once for the login
+// it falls back to as well.
+func refreshLogin(ctx context.Context, cluster *Cluster) error {
+	cached, ok, err := readCachedToken(ctx, cluster.Name)
+	if err != nil {
+		return err
+	}
+	if !ok || cached.RefreshToken == "" {
+		return errors.New("No refresh token cached, log in with " + "\"kubed -renew " + cluster.Name + "\" and a client secret first")
+	}
+
+	secret, err := readClientSecret(cluster.ClientSecret)
+	if err != nil {
+		return errors.Wrap(err, "Failed in reading client secret")
+	}
+
+	providerToken, err := refreshAccessToken(ctx, providerEndpoint(cluster, tokenPath), cached.RefreshToken, cluster.ClientID, secret)
+	if _, denied := errors.Cause(err).(*statusError); denied {
+		return withExitCode(exitAuthDenied, errors.Wrap(err, "Failed in refreshing access token"))
+	} else if err != nil {
+		return errors.Wrap(err, "Failed in refreshing access token")
+	}
+
+	cluster.KubeConfig = expandHome(cluster.KubeConfig)
+	return completeLogin(ctx, cluster, providerToken, false)
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+const (
+	// replayEnv names the bundle a kubed started by "kubed replay" answers
+	// its requests from, replayDirEnv the directory it runs in
+	replayEnv    = "KUBED_REPLAY"
+	replayDirEnv = "KUBED_REPLAY_DIR"
+	injectEnv    = "KUBED_REPLAY_INJECT"
+
+	// replayedCallback stands in for the code or token of the browser
+	// redirect, which the bundle doesn't have
+	replayedCallback = "REDACTED"
+)
+
+// replayFlags are the flags a replayed bundle may give. Bundles come from
+// users, so flags that run commands, like hooks and secret commands, or take
+// paths outside the replay directory, like -kube-config and -log-file, are
+// not replayed.
+var replayFlags = map[string]bool{
+	"name": true, "api-server": true, "issuer": true, "client-id": true, "renew": true,
+	"namespace": true, "keep-context": true, "port": true, "manual-input": true,
+	"login-hint": true, "prompt": true, "acr-values": true, "scopes": true, "revocation-url": true,
+	"introspection-url": true, "provider-url": true, "response-mode": true, "https-callback": true,
+	"token-exchange": true, "token-audience": true, "expected-audience": true, "token-ttl": true,
+	"issuer-token-path": true, "issuer-ca-path": true, "issuer-method": true, "issuer-body": true,
+	"issuer-kubeconfig": true, "issuer-health-url": true, "skip-issuer-check": true, "allow-http": true,
+	"auth-provider": true, "oidc-issuer": true, "exec-credential": true, "silent-reauth": true,
+	"as-user": true, "extra-namespaces": true, "separate-kubeconfig": true, "accept-new-ca": true,
+	"cluster-template": true, "user-template": true, "context-template": true,
+	"discover": true, "verify": true, "renew-if-expired": true, "valid-for": true,
+	"retry-attempts": true, "retry-backoff": true, "http-timeout": true, "callback-timeout": true,
+	"clock-skew": true, "cluster": true, "group": true, "parallel": true, "force": true, "yes": true,
+	"output": true, "quiet": true, "non-interactive": true, "log-format": true, "log-level": true,
+	"debug-http": true, "color": true, "plain": true, "lang": true, "qr": true,
+}
+
+// replayCommands are the subcommands a replayed bundle may run, the others
+// run commands, listen or write outside the replay directory
+var replayCommands = map[string]bool{
+	"list": true, "token": true, "logout": true, "doctor": true, "switch": true, "set-namespace": true,
+	"namespaces": true, "env": true, "exec-credential": true, "rename": true, "prune": true,
+}
+
+// validReplayArgs refuses to replay arguments outside replayFlags and
+// replayCommands, before anything of the bundle runs
+func validReplayArgs(args []string) error {
+	subcommand := true
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return errors.New("The bundle passes arguments after --, which kubed replay doesn't run")
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if _, ok := commands[arg]; ok && subcommand && !replayCommands[arg] {
+				return errors.Errorf("The bundle runs kubed %s, which kubed replay doesn't run", arg)
+			}
+			subcommand = false
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		hasValue := strings.Contains(name, "=")
+		if hasValue {
+			name = name[:strings.Index(name, "=")]
+		}
+		if !replayFlags[name] {
+			return errors.Errorf("The bundle gives -%s, which kubed replay doesn't replay", name)
+		}
+		// The value of a flag that isn't boolean is the next argument
+		if f := flag.CommandLine.Lookup(name); f != nil && !hasValue {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				i++
+			}
+		}
+	}
+	return nil
+}
+
+// bundleReplayer answers the requests of a run from the exchanges of a
+// bundle, in the order they were recorded
+type bundleReplayer struct {
+	mu     sync.Mutex
+	bundle *supportBundle
+	next   int
+	nonces int
+	// last is the exchange answered last, which traceHTTP compares with
+	// the request it was for
+	last   *exchange
+	inject map[int]string
+}
+
+var replayer *bundleReplayer
+
+// startReplay reads the bundle and sets up dir as home and data directory,
+// with the clusters and cached tokens of the recorded run, so nothing of the
+// user running the replay is touched
+func startReplay(filename string, dir string, inject string) error {
+	bundle, err := readBundle(filename)
+	if err != nil {
+		return err
+	}
+	injected, err := parseInjections(inject)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	// Checked again here, the bundle may not come through kubed replay
+	err = validReplayArgs(os.Args[1:])
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	// Bundles from users may not have been sanitized by kubed record
+	clusters := make([]Cluster, len(bundle.Clusters))
+	for i, c := range bundle.Clusters {
+		clusters[i] = sanitizeCluster(c)
+		clusters[i].Tunnel, clusters[i].TunnelAddress, clusters[i].TunnelProxy, clusters[i].ProxyURL = nil, "", "", ""
+	}
+
+	home, *dataDir = dir, filepath.Join(dir, ".kubed")
+	*kubeConfigFlag, *logFile = "~/.kube/config", ""
+	*parallelLogins = 1
+	err = writeKubedConfig(&KubedConfig{Version: kubedConfVersion, Clusters: clusters})
+	if err != nil {
+		return err
+	}
+	tokens := map[string]CachedToken{}
+	for name, t := range bundle.Tokens {
+		cached := CachedToken{AccessToken: "REDACTED"}
+		if t.Refresh {
+			cached.RefreshToken = "REDACTED"
+		}
+		if t.JWT {
+			cached.JWT = "REDACTED"
+		}
+		tokens[name] = cached
+	}
+	err = writeCache(tokens)
+	if err != nil {
+		return err
+	}
+	replayer = &bundleReplayer{bundle: bundle, inject: injected}
+	return nil
+}
+
+// parseInjections parses the failures of -inject, e.g. "2=503,4=error" to
+// let the second exchange answer 503 and the fourth fail like the network
+func parseInjections(value string) (map[int]string, error) {
+	injected := map[int]string{}
+	for _, spec := range strings.Split(value, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		parts := strings.SplitN(spec, "=", 2)
+		n, err := strconv.Atoi(parts[0])
+		if len(parts) != 2 || err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid -inject %q, use exchange=status or exchange=error, e.g. 2=503", spec)
+		}
+		if _, err := strconv.Atoi(parts[1]); err != nil && parts[1] != "error" {
+			return nil, fmt.Errorf("Invalid -inject %q, use exchange=status or exchange=error, e.g. 2=503", spec)
+		}
+		injected[n] = parts[1]
+	}
+	return injected, nil
+}
+
+// respond answers the next request with the next recorded exchange, or with
+// the failure injected for it
+func (r *bundleReplayer) respond(v interface{}) (gorequest.Response, []error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next >= len(r.bundle.Exchanges) {
+		r.last = nil
+		return nil, []error{errors.New("The replayed bundle has no more exchanges, the run asks for more than was recorded")}
+	}
+	e := r.bundle.Exchanges[r.next]
+	r.next++
+	r.last = &e
+
+	if failure, ok := r.inject[r.next]; ok {
+		if status, err := strconv.Atoi(failure); err == nil {
+			e.Status, e.Body, e.Error = status, "", ""
+		} else {
+			e.Error = "injected network error"
+		}
+		log.Debug("Injecting ", failure, " into exchange ", r.next)
+	}
+	if e.Error != "" {
+		return nil, []error{errors.New(e.Error)}
+	}
+
+	resp := &http.Response{
+		StatusCode: e.Status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(e.Body)),
+		Request:    &http.Request{Method: e.Method},
+	}
+	resp.Request.URL, _ = url.Parse(e.URL)
+	for name, value := range e.Header {
+		resp.Header.Set(name, value)
+	}
+	if v == nil {
+		return gorequest.Response(resp), nil
+	}
+	if err := responseStatus(gorequest.Response(resp)); err != nil {
+		return gorequest.Response(resp), []error{err}
+	}
+	switch out := v.(type) {
+	case *[]byte:
+		*out = []byte(e.Body)
+	default:
+		if e.Body != "" {
+			if err := json.Unmarshal([]byte(e.Body), v); err != nil {
+				return gorequest.Response(resp), []error{err}
+			}
+		}
+	}
+	return gorequest.Response(resp), nil
+}
+
+// check warns when the run sent another request than the recorded one at
+// this point, after which the replay tells little
+func (r *bundleReplayer) check(method string, rawURL string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil || r.last.Method == "" {
+		return
+	}
+	if r.last.Method != method || r.last.URL != redactURL(rawURL) {
+		log.Warn("Replay diverges at exchange ", r.next, ": recorded ", r.last.Method, " ", r.last.URL, ", now ", method, " ", redactURL(rawURL))
+	}
+}
+
+// nonce gives the nonces of the recorded run in order, so its ID tokens
+// pass the nonce check
+func (r *bundleReplayer) nonce() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nonces >= len(r.bundle.Nonces) {
+		return ""
+	}
+	r.nonces++
+	return r.bundle.Nonces[r.nonces-1]
+}
+
+// startSupportMode starts recording or replaying when kubed was started by
+// "kubed record" or "kubed replay"
+func startSupportMode() error {
+	if filename := os.Getenv(recordEnv); filename != "" {
+		return errors.Wrap(startRecording(filename), "Failed in starting to record")
+	}
+	if filename := os.Getenv(replayEnv); filename != "" {
+		return errors.Wrap(startReplay(filename, os.Getenv(replayDirEnv), os.Getenv(injectEnv)), "Failed in starting the replay")
+	}
+	return nil
+}
+
+func init() {
+	commands["replay"] = &command{
+		usage: "replay [-inject n=status|error,...] <bundle>",
+		help:  "Run the recorded arguments of a support bundle again, answering the requests from it",
+		run:   replayCommand,
+	}
+}
+
+func replayCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return withExitCode(exitUsage, errors.New("Please provide the support bundle to replay"))
+	}
+	bundle, err := readBundle(args[0])
+	if err != nil {
+		return err
+	}
+	_, err = parseInjections(*injectFailures)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	err = validReplayArgs(bundle.Args)
+	if err != nil {
+		return withHint(withExitCode(exitUsage, err), "Look at the args of the bundle and run the part that can be replayed yourself")
+	}
+	filename, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "kubed-replay")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	log.Info("Replaying kubed ", strings.Join(bundle.Args, " "), " recorded with kubed ", bundle.Version, " on ", bundle.Platform)
+	cmd := exec.Command(os.Args[0], bundle.Args...)
+	cmd.Env = []string{replayEnv + "=" + filename, replayDirEnv + "=" + dir, injectEnv + "=" + *injectFailures}
+	for _, env := range os.Environ() {
+		// The agent and kubeconfig of the maintainer have nothing to do with
+		// the recorded run
+		if !strings.HasPrefix(env, agentSocketEnv+"=") && !strings.HasPrefix(env, "SSH_CONNECTION=") && !strings.HasPrefix(env, "KUBECONFIG=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	code, err := exitStatus(leaveSignals(cmd.Run))
+	if err != nil {
+		return errors.Wrap(err, "Failed in running kubed to replay")
+	}
+
+	if bundle.ExitCode != nil && *bundle.ExitCode != code {
+		log.Warn("The replay exited with ", code, ", the recorded run with ", *bundle.ExitCode)
+	} else {
+		log.Info("The replay exited with ", code, " like the recorded run")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseInjections(t *testing.T) {
+	injected, err := parseInjections("2=503, 4=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if injected[2] != "503" || injected[4] != "error" || len(injected) != 2 {
+		t.Errorf("Unexpected injections %v", injected)
+	}
+	for _, invalid := range []string{"0=503", "x=503", "2", "2=slow"} {
+		if _, err := parseInjections(invalid); err == nil {
+			t.Errorf("Expected -inject %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestReplayResponses(t *testing.T) {
+	r := &bundleReplayer{
+		bundle: &supportBundle{
+			Nonces: []string{"n-1"},
+			Exchanges: []exchange{
+				{Method: "POST", URL: "https://auth.example.org/oauth/token", Status: 200, Body: `{"access_token":"REDACTED","expires_in":3600}`},
+				{Method: "GET", URL: "https://issuer.example.org", Status: 200},
+				{Error: "dial tcp: connection refused"},
+			},
+		},
+		inject: map[int]string{2: "503"},
+	}
+
+	var tr tokenResponse
+	resp, errs := r.respond(&tr)
+	if len(errs) > 0 || resp.StatusCode != 200 || tr.AccessToken != "REDACTED" || tr.ExpiresIn != 3600 {
+		t.Errorf("Expected the recorded token response, got %v %+v", errs, tr)
+	}
+	resp, errs = r.respond(nil)
+	if len(errs) > 0 || resp.StatusCode != 503 {
+		t.Errorf("Expected the injected 503, got %v %v", errs, resp)
+	}
+	if _, errs = r.respond(nil); len(errs) != 1 || errs[0].Error() != "dial tcp: connection refused" {
+		t.Errorf("Expected the recorded error, got %v", errs)
+	}
+	if _, errs = r.respond(nil); len(errs) != 1 {
+		t.Error("Expected an error when the bundle has no more exchanges")
+	}
+
+	if r.nonce() != "n-1" || r.nonce() != "" {
+		t.Error("Expected the recorded nonce once")
+	}
+}
+
+func TestValidReplayArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"-renew", "lab"},
+		{"-renew=lab", "-debug-http", "-output", "json"},
+		{"-name", "lab", "-api-server", "https://api.example.org", "-issuer", "https://issuer.example.org", "-client-id", "kubed"},
+		{"logout", "lab"},
+		{"-log-level", "debug", "token", "print", "lab"},
+	} {
+		if err := validReplayArgs(args); err != nil {
+			t.Errorf("Expected %q to be replayed, got %v", args, err)
+		}
+	}
+	for _, args := range [][]string{
+		{"-renew", "lab", "-pre-hook", "rm -rf ~"},
+		{"-renew", "lab", "-secret-backend", "command", "-secret-read-command", "sh"},
+		{"-kube-config", "/etc/kubernetes/admin.conf", "-renew", "lab"},
+		{"exec", "lab", "--", "sh", "-c", "id"},
+		{"self-update"},
+		{"-quiet", "shell", "lab"},
+	} {
+		if err := validReplayArgs(args); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
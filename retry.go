@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// statusError is returned when a server answers with an unexpected status code
+type statusError struct {
+	what string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Failed in %s, responsecode: %d", e.what, e.code)
+}
+
+// retryable tells whether a failed request may succeed when tried again,
+// which is the case for network errors and server side (5xx) errors
+func retryable(err error) bool {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	if se, ok := err.(*statusError); ok {
+		return se.code >= 500
+	}
+	return true
+}
+
+// withRetry calls fn up to attempts times, doubling the wait between attempts
+func withRetry(ctx context.Context, what string, attempts int, backoff time.Duration, fn func() error) error {
+	var err error
+	for i := 1; ; i++ {
+		err = fn()
+		if err == nil || i >= attempts || !retryable(err) {
+			return err
+		}
+		log.Warn("Failed in ", what, ", retrying in ", backoff, " (attempt ", i, " of ", attempts, ")")
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWithRetry(t *testing.T) {
+	var tests = []struct {
+		description string
+		errs        []error
+		calls       int
+		err         bool
+	}{
+		{
+			description: "success on first attempt",
+			errs:        []error{nil},
+			calls:       1,
+		},
+		{
+			description: "success after network error",
+			errs:        []error{errors.New("connection refused"), nil},
+			calls:       2,
+		},
+		{
+			description: "server errors until attempts are exhausted",
+			errs:        []error{&statusError{"test", 502}, &statusError{"test", 503}, &statusError{"test", 500}},
+			calls:       3,
+			err:         true,
+		},
+		{
+			description: "client error is not retried",
+			errs:        []error{&statusError{"test", 401}, nil},
+			calls:       1,
+			err:         true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			calls := 0
+			err := withRetry(context.Background(), "test", 3, 0, func() error {
+				calls++
+				return test.errs[calls-1]
+			})
+			if calls != test.calls {
+				t.Errorf("Expected %d calls, got %d", test.calls, calls)
+			}
+			if err != nil && !test.err {
+				t.Errorf("Got unexpected error: %s", err)
+			}
+			if err == nil && test.err {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
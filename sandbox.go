@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// sandboxSeed derives the keys of the sandbox, so tokens and CA stay the same
+// across runs and can be checked into test fixtures. Signatures are made
+// deterministic as well, see sandboxSigner.
+const sandboxSeed = "kubed dev-sandbox"
+
+const sandboxTokenLifetime = time.Hour
+
+// sandboxMaxTokenTTL is the longest lifetime the sandbox issuer grants
+const sandboxMaxTokenTTL = 12 * time.Hour
+
+// sandboxIntrospectPath is the introspection endpoint of the sandbox provider
+const sandboxIntrospectPath = "/oauth/introspect"
+
+func init() {
+	commands["dev-sandbox"] = &command{
+		usage: "dev-sandbox [-listen addr]",
+		help:  "Run a fake OAuth2 Provider and JWT Token Issuer with fixed keys, for development and tests",
+		run:   devSandbox,
+	}
+}
+
+// sandbox is an OAuth2 Provider and a kubed JWT Token Issuer in one, that
+// authenticates everyone right away
+type sandbox struct {
+	url   string
+	key   *ecdsa.PrivateKey
+	caPEM []byte
+
+	mutex         sync.Mutex
+	serial        int
+	codes         map[string]string // authorization code to nonce
+	accessTokens  map[string]bool
+	refreshTokens map[string]bool
+}
+
+// sandboxKey derives a P-256 key from the seed
+func sandboxKey() *ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	seed := sha256.Sum256([]byte(sandboxSeed))
+	d := new(big.Int).SetBytes(seed[:])
+	d.Mod(d, new(big.Int).Sub(curve.Params().N, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+	return key
+}
+
+func newSandbox(baseURL string) (*sandbox, error) {
+	s := &sandbox{
+		url:           strings.TrimRight(baseURL, "/"),
+		key:           sandboxKey(),
+		codes:         map[string]string{},
+		accessTokens:  map[string]bool{},
+		refreshTokens: map[string]bool{},
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubed sandbox CA"},
+		NotBefore:             time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2037, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &s.key.PublicKey, sandboxSigner{s.key})
+	if err != nil {
+		return nil, err
+	}
+	s.caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return s, nil
+}
+
+func (s *sandbox) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(authPath, s.authorize)
+	mux.HandleFunc(tokenPath, s.token)
+	mux.HandleFunc(sandboxIntrospectPath, s.introspect)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 s.url,
+			"authorization_endpoint": s.url + authPath,
+			"token_endpoint":         s.url + tokenPath,
+			"jwks_uri":               s.url + "/issuer/jwks",
+			"introspection_endpoint": s.url + sandboxIntrospectPath,
+			"userinfo_endpoint":      s.url + userinfoPath,
+		})
+	})
+	mux.HandleFunc("/groups/me/groups", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []apiGroup{{ID: "fc:adhoc:sandbox", DisplayName: "Sandbox"}})
+	}))
+	mux.HandleFunc(userinfoPath, s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"sub": "sandbox-user", "email": "sandbox@example.org"})
+	}))
+	mux.HandleFunc("/issuer", s.authenticated(s.issue))
+	mux.HandleFunc("/issuer/ca", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ca{Cert: string(s.caPEM)})
+	})
+	mux.HandleFunc("/issuer/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, jwks{Keys: []jwk{{
+			Kid: "sandbox",
+			Kty: "EC",
+			Alg: "ES256",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(padded(s.key.X.Bytes(), 32)),
+			Y:   base64.RawURLEncoding.EncodeToString(padded(s.key.Y.Bytes(), 32)),
+		}}})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func padded(b []byte, size int) []byte {
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func (s *sandbox) newToken(kind string) string {
+	s.serial++
+	return fmt.Sprintf("sandbox-%s-%d", kind, s.serial)
+}
+
+// authorize logs everyone in and redirects back right away, with a code or
+// an access and ID token as the response type asks
+func (s *sandbox) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect := q.Get("redirect_uri")
+	if redirect == "" {
+		redirect = redirectURI(49999, false)
+	}
+
+	s.mutex.Lock()
+	params := url.Values{}
+	if q.Get("response_type") == "code" {
+		code := s.newToken("code")
+		s.codes[code] = q.Get("nonce")
+		params.Set("code", code)
+	} else {
+		access := s.newToken("access")
+		s.accessTokens[access] = true
+		params.Set("access_token", access)
+		params.Set("token_type", "Bearer")
+		params.Set("expires_in", fmt.Sprint(int(sandboxTokenLifetime/time.Second)))
+		if strings.Contains(q.Get("response_type"), "id_token") && q.Get("nonce") != "" {
+			idToken, err := s.sign(s.claims(q.Get("client_id"), map[string]interface{}{"nonce": q.Get("nonce")}))
+			if err != nil {
+				s.mutex.Unlock()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			params.Set("id_token", idToken)
+		}
+	}
+	s.mutex.Unlock()
+	if state := q.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+
+	switch q.Get("response_mode") {
+	case "form_post":
+		fmt.Fprintf(w, `<html><body onload="document.forms[0].submit()"><form method="post" action="%s">`, html.EscapeString(redirect))
+		for name := range params {
+			fmt.Fprintf(w, `<input type="hidden" name="%s" value="%s">`, html.EscapeString(name), html.EscapeString(params.Get(name)))
+		}
+		fmt.Fprint(w, `</form></body></html>`)
+		return
+	case "query":
+		redirect += "?" + params.Encode()
+	case "fragment":
+		redirect += "#" + params.Encode()
+	default:
+		if q.Get("response_type") == "code" {
+			redirect += "?" + params.Encode()
+		} else {
+			redirect += "#" + params.Encode()
+		}
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// introspect tells whether an access or refresh token was issued by the
+// sandbox (RFC 7662)
+func (s *sandbox) introspect(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token := r.Form.Get("token")
+	if !s.accessTokens[token] && !s.refreshTokens[token] {
+		writeJSON(w, http.StatusOK, introspection{Active: false})
+		return
+	}
+	writeJSON(w, http.StatusOK, introspection{Active: true, ClientID: r.Form.Get("client_id"), Sub: "sandbox-user", Iss: s.url})
+}
+
+// token exchanges authorization codes and refresh tokens
+func (s *sandbox) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var nonce string
+	switch r.Form.Get("grant_type") {
+	case "authorization_code":
+		n, ok := s.codes[r.Form.Get("code")]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		delete(s.codes, r.Form.Get("code"))
+		nonce = n
+	case "refresh_token":
+		if !s.refreshTokens[r.Form.Get("refresh_token")] {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	tr := tokenResponse{
+		AccessToken:  s.newToken("access"),
+		TokenType:    "Bearer",
+		ExpiresIn:    int(sandboxTokenLifetime / time.Second),
+		RefreshToken: s.newToken("refresh"),
+	}
+	s.accessTokens[tr.AccessToken] = true
+	s.refreshTokens[tr.RefreshToken] = true
+	if nonce != "" {
+		idToken, err := s.sign(s.claims(r.Form.Get("client_id"), map[string]interface{}{"nonce": nonce}))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tr.IDToken = idToken
+	}
+	writeJSON(w, http.StatusOK, tr)
+}
+
+// authenticated only lets requests with an access token of the sandbox through
+func (s *sandbox) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mutex.Lock()
+		ok := s.accessTokens[token]
+		s.mutex.Unlock()
+		if !ok {
+			http.Error(w, "unknown access token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// issue hands out a JWT for the cluster, like the kubed issuer
+func (s *sandbox) issue(w http.ResponseWriter, r *http.Request) {
+	claims := s.claims("kubernetes", map[string]interface{}{"groups": []string{"sandbox"}})
+	// Like real issuers, the sandbox caps the lifetime asked for with ttl
+	if ttl, err := strconv.ParseInt(r.URL.Query().Get("ttl"), 10, 64); err == nil && ttl > 0 {
+		if limit := int64(sandboxMaxTokenTTL / time.Second); ttl > limit {
+			ttl = limit
+		}
+		claims["exp"] = claims["iat"].(int64) + ttl
+	}
+	token, err := s.sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, JWTToken{Token: token})
+}
+
+func (s *sandbox) claims(audience string, extra map[string]interface{}) map[string]interface{} {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   s.url,
+		"sub":   "sandbox-user",
+		"email": "sandbox@example.org",
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(sandboxTokenLifetime).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return claims
+}
+
+// sign makes an ES256 JWT of the claims
+func (s *sandbox) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "typ": "JWT", "kid": "sandbox"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	r, sig := deterministicSign(s.key, digest[:])
+	signature := append(padded(r.Bytes(), 32), padded(sig.Bytes(), 32)...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// sandboxSigner signs the CA certificate of the sandbox deterministically,
+// ignoring the random source it is given
+type sandboxSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s sandboxSigner) Public() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s sandboxSigner) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	r, sig := deterministicSign(s.key, digest)
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sig})
+}
+
+// deterministicSign makes an ECDSA signature of the SHA-256 digest with the
+// nonce of RFC 6979, so the same input always gives the same signature
+func deterministicSign(key *ecdsa.PrivateKey, digest []byte) (*big.Int, *big.Int) {
+	curve := key.Curve
+	n := curve.Params().N
+	z := new(big.Int).SetBytes(digest)
+	x := padded(key.D.Bytes(), 32)
+	h := padded(new(big.Int).Mod(z, n).Bytes(), 32)
+
+	mac := func(k []byte, parts ...[]byte) []byte {
+		m := hmac.New(sha256.New, k)
+		for _, p := range parts {
+			m.Write(p)
+		}
+		return m.Sum(nil)
+	}
+	v := bytes.Repeat([]byte{1}, 32)
+	k := make([]byte, 32)
+	k = mac(k, v, []byte{0}, x, h)
+	v = mac(k, v)
+	k = mac(k, v, []byte{1}, x, h)
+	v = mac(k, v)
+	for {
+		v = mac(k, v)
+		nonce := new(big.Int).SetBytes(v)
+		if nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+			px, _ := curve.ScalarBaseMult(padded(nonce.Bytes(), 32))
+			r := new(big.Int).Mod(px, n)
+			s := new(big.Int).Mul(r, key.D)
+			s.Add(s, z)
+			s.Mul(s, new(big.Int).ModInverse(nonce, n))
+			s.Mod(s, n)
+			if r.Sign() > 0 && s.Sign() > 0 {
+				return r, s
+			}
+		}
+		k = mac(k, v, []byte{0})
+		v = mac(k, v)
+	}
+}
+
+func devSandbox(ctx context.Context, args []string) error {
+	listener, err := net.Listen("tcp", *listenAddr)
+	if err != nil {
+		return withHint(errors.Wrap(err, "Failed in listening on "+*listenAddr), "Give another address with -listen")
+	}
+	baseURL := "http://" + listener.Addr().String()
+	s, err := newSandbox(baseURL)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: s.handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("Sandbox provider and issuer listening on ", baseURL)
+	log.Info("Log in to it with: ", "kubed -name sandbox -api-server https://127.0.0.1:6443 -client-id sandbox -provider-url ", baseURL,
+		" -issuer ", baseURL, "/issuer -groups-api ", baseURL, " -introspection-url ", baseURL, sandboxIntrospectPath)
+	err = srv.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
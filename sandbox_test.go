@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uninett/kubed/pkg/auth"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func TestSandboxKeyIsDeterministic(t *testing.T) {
+	if sandboxKey().D.Cmp(sandboxKey().D) != 0 {
+		t.Error("Sandbox key changed between calls")
+	}
+	first, err := newSandbox("http://127.0.0.1:8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newSandbox("http://127.0.0.1:8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first.caPEM) != string(second.caPEM) {
+		t.Error("Sandbox CA changed between runs")
+	}
+	claims := first.claims("kubernetes", map[string]interface{}{"iat": 1, "exp": 2})
+	a, _ := first.sign(claims)
+	b, _ := second.sign(claims)
+	if a != b {
+		t.Error("Sandbox token changed between runs")
+	}
+}
+
+func TestLoginWithSandbox(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	var s *sandbox
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	s, err := newSandbox(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The browser follows the redirects of the sandbox to the callback
+	oldOpenURL := openURL
+	defer func() { openURL = oldOpenURL }()
+	openURL = func(u string) error {
+		go http.Get(u)
+		return nil
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	os.Setenv("KUBED_TEST_SECRET", "secret")
+	defer os.Unsetenv("KUBED_TEST_SECRET")
+
+	cluster := &Cluster{
+		Name:         "sandbox",
+		APIServer:    "https://127.0.0.1:6443",
+		IssuerURL:    server.URL + "/issuer",
+		ClientID:     "sandbox",
+		ClientSecret: "env:KUBED_TEST_SECRET",
+		ProviderURL:  server.URL,
+		KubeConfig:   filepath.Join(dir, "config"),
+		Port:         port,
+	}
+	if err := saveConfig(cluster); err != nil {
+		t.Fatal(err)
+	}
+	if err := login(context.Background(), cluster); err != nil {
+		t.Fatalf("Login against the sandbox failed: %s", err)
+	}
+
+	token, err := kubeconfig.ReadToken(cluster.KubeConfig, "sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.DecodeClaims(token)
+	if err != nil || claims["iss"] != server.URL {
+		t.Errorf("Expected a token of the sandbox in kubeconfig, got %v %v", claims, err)
+	}
+	caData, err := kubeconfig.ReadCAData(cluster.KubeConfig, "sandbox")
+	if err != nil || string(caData) != string(s.caPEM) {
+		t.Errorf("Expected the sandbox CA in kubeconfig, got %v", err)
+	}
+	cached, ok, err := readCachedToken(context.Background(), "sandbox")
+	if err != nil || !ok || cached.RefreshToken == "" {
+		t.Errorf("Expected the refresh token to be cached, got %+v %v", cached, err)
+	}
+}
+
+func TestLoginManyKeepsTokensOfEachCluster(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	var s *sandbox
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	s, err := newSandbox(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldOpenURL := openURL
+	defer func() { openURL = oldOpenURL }()
+	openURL = func(u string) error {
+		go http.Get(u)
+		return nil
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	os.Setenv("KUBED_TEST_SECRET", "secret")
+	defer os.Unsetenv("KUBED_TEST_SECRET")
+
+	// The clusters share one login with the provider
+	var clusters []*Cluster
+	for _, name := range []string{"sandbox", "sandbox-2", "sandbox-3"} {
+		cluster := &Cluster{
+			Name:         name,
+			APIServer:    "https://127.0.0.1:6443",
+			IssuerURL:    server.URL + "/issuer",
+			ClientID:     "sandbox",
+			ClientSecret: "env:KUBED_TEST_SECRET",
+			ProviderURL:  server.URL,
+			KubeConfig:   filepath.Join(dir, "config"),
+			Port:         port,
+		}
+		if err := saveConfig(cluster); err != nil {
+			t.Fatal(err)
+		}
+		clusters = append(clusters, cluster)
+	}
+	if err := loginMany(context.Background(), clusters); err != nil {
+		t.Fatalf("Login to several clusters against the sandbox failed: %s", err)
+	}
+
+	for _, cluster := range clusters {
+		cached, ok, err := readCachedToken(context.Background(), cluster.Name)
+		if err != nil || !ok || cached.RefreshToken == "" {
+			t.Errorf("Expected the refresh token to be cached for %q, got %+v %v", cluster.Name, cached, err)
+		}
+	}
+}
+
+func TestSandboxFlow(t *testing.T) {
+	var s *sandbox
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	s, err := newSandbox(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(server.URL + authPath + "?response_type=code&nonce=n-1&redirect_uri=" +
+		url.QueryEscape("http://localhost:49999/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("No code in redirect to %s", location)
+	}
+
+	resp, err = http.PostForm(server.URL+tokenPath, url.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {code},
+		"client_id":  {"sandbox"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tr tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.AccessToken == "" || tr.RefreshToken == "" || tr.IDToken == "" {
+		t.Fatalf("Incomplete token response: %+v", tr)
+	}
+
+	for token, active := range map[string]bool{tr.AccessToken: true, "unknown": false} {
+		resp, err = http.PostForm(server.URL+sandboxIntrospectPath, url.Values{"token": {token}, "client_id": {"sandbox"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result introspection
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Active != active {
+			t.Errorf("Expected introspection of %q to be active %v", token, active)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/issuer", nil)
+	req.Header.Set("Authorization", "Bearer "+tr.AccessToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from issuer, got %d", resp.StatusCode)
+	}
+	var token JWTToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = http.Get(server.URL + "/issuer/jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys jwks
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token.Token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyWithKey("ES256", keys.Keys[0], parts[0]+"."+parts[1], signature); err != nil {
+		t.Errorf("Issued token does not verify: %s", err)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/issuer", nil)
+	req.Header.Set("Authorization", "Bearer unknown")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for unknown token, got %d", resp.StatusCode)
+	}
+
+	// A day is more than the sandbox grants
+	cluster := &Cluster{Name: "sandbox", TokenTTL: "24h"}
+	req, _ = http.NewRequest("GET", withTTL(server.URL+"/issuer", tokenTTLSeconds(cluster)), nil)
+	req.Header.Set("Authorization", "Bearer "+tr.AccessToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	if granted := grantedTTL(cluster, token.Token); granted != sandboxMaxTokenTTL {
+		t.Errorf("Expected the sandbox to cap the lifetime at %s, got %s", sandboxMaxTokenTTL, granted)
+	}
+}
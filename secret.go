@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const clientSecretEnv = "KUBED_CLIENT_SECRET"
+
+// validSecretSource checks that the client secret is given as a source
+// and not as the secret itself, so it never ends up in shell history or .kubedconf
+func validSecretSource(source string) error {
+	if source == "" || source == "prompt" ||
+		strings.HasPrefix(source, "env:") || strings.HasPrefix(source, "file:") {
+		return nil
+	}
+	return errors.New("Client secret must be given as \"env:NAME\", \"file:PATH\" or \"prompt\", not as plain value")
+}
+
+// readClientSecret resolves the client secret from the configured source.
+// With an empty source the secret is taken from KUBED_CLIENT_SECRET, if set.
+// It is registered to be scrubbed from logs.
+func readClientSecret(source string) (string, error) {
+	secret, err := clientSecretFrom(source)
+	registerSecrets(secret)
+	return secret, err
+}
+
+func clientSecretFrom(source string) (string, error) {
+	switch {
+	case source == "":
+		return os.Getenv(clientSecretEnv), nil
+
+	case source == "prompt":
+		err := needInteraction("Reading the client secret", "Give it as \"env:NAME\" or \"file:PATH\" instead")
+		if err != nil {
+			return "", err
+		}
+		fmt.Print("Client secret: ")
+		secret, err := terminal.ReadPassword(int(syscall.Stdin))
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(secret)), nil
+
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		secret := os.Getenv(name)
+		if secret == "" {
+			return "", fmt.Errorf("Environment variable %s is not set", name)
+		}
+		return secret, nil
+
+	case strings.HasPrefix(source, "file:"):
+		secret, err := ioutil.ReadFile(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(secret)), nil
+	}
+
+	return "", validSecretSource(source)
+}
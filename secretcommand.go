@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SecretCommands are the shell commands of an external secret store, e.g. a
+// password manager CLI. They get the expanded -secret-path in
+// KUBED_SECRET_PATH, the write command gets the tokens on stdin.
+type SecretCommands struct {
+	Read   string `yaml:"read"`
+	Write  string `yaml:"write"`
+	Remove string `yaml:"remove,omitempty"`
+}
+
+// passCommands use pass, the standard unix password manager
+var passCommands = SecretCommands{
+	Read:   `pass show "$KUBED_SECRET_PATH"`,
+	Write:  `pass insert -m -f "$KUBED_SECRET_PATH" >/dev/null`,
+	Remove: `pass rm -f "$KUBED_SECRET_PATH" >/dev/null`,
+}
+
+// newSecretCommands returns nil when no commands are given
+func newSecretCommands(read string, write string, remove string) *SecretCommands {
+	if read == "" && write == "" && remove == "" {
+		return nil
+	}
+	return &SecretCommands{Read: read, Write: write, Remove: remove}
+}
+
+// commandStore keeps the tokens of a cluster in an external secret store
+type commandStore struct {
+	path     string
+	commands SecretCommands
+}
+
+func (s commandStore) run(ctx context.Context, command string, name string, stdin []byte) ([]byte, error) {
+	path, err := secretPath(s.path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	// The path goes through the environment, so no cluster name is ever
+	// interpreted by the shell
+	cmd.Env = append(os.Environ(), "KUBED_SECRET_PATH="+path, "KUBED_CLUSTER="+name)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(stdin), &stdout, &stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Secret store command failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// get treats a failing read as no tokens stored, secret store CLIs don't
+// tell a missing entry from other failures in a common way
+func (s commandStore) get(ctx context.Context, name string) (CachedToken, bool, error) {
+	out, err := s.run(ctx, s.commands.Read, name, nil)
+	if err != nil {
+		log.Debug("No tokens read from secret store for ", name, ": ", err)
+		return CachedToken{}, false, nil
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return CachedToken{}, false, nil
+	}
+
+	var cached CachedToken
+	err = yaml.Unmarshal(out, &cached)
+	if err != nil {
+		return CachedToken{}, false, errors.Wrap(err, "Failed in parsing tokens from secret store")
+	}
+	return cached, true, nil
+}
+
+func (s commandStore) put(ctx context.Context, name string, token CachedToken) error {
+	data, err := yaml.Marshal(token)
+	if err != nil {
+		return err
+	}
+	_, err = s.run(ctx, s.commands.Write, name, data)
+	return err
+}
+
+func (s commandStore) remove(ctx context.Context, name string) error {
+	if s.commands.Remove == "" {
+		return s.put(ctx, name, CachedToken{})
+	}
+	_, err := s.run(ctx, s.commands.Remove, name, nil)
+	return err
+}
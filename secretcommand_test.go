@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCommandStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test commands need a unix shell")
+	}
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	store := commandStore{
+		path: filepath.Join(dir, "{{.Cluster}}.yaml"),
+		commands: SecretCommands{
+			Read:   `cat "$KUBED_SECRET_PATH"`,
+			Write:  `cat > "$KUBED_SECRET_PATH"`,
+			Remove: `rm "$KUBED_SECRET_PATH"`,
+		},
+	}
+
+	if _, ok, err := store.get(context.Background(), "kubed"); ok || err != nil {
+		t.Fatalf("Expected no tokens, got %v, %v", ok, err)
+	}
+	err := store.put(context.Background(), "kubed", CachedToken{AccessToken: "access", RefreshToken: "refresh"})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	cached, ok, err := store.get(context.Background(), "kubed")
+	if err != nil || !ok || cached.RefreshToken != "refresh" {
+		t.Errorf("Tokens were not stored: %+v, %v, %v", cached, ok, err)
+	}
+	err = store.remove(context.Background(), "kubed")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	if _, ok, _ := store.get(context.Background(), "kubed"); ok {
+		t.Errorf("Tokens were not removed")
+	}
+}
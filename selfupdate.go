@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+const (
+	checksumsFile = "SHA256SUMS"
+
+	// downloadTimeout bounds downloading a release binary, which takes
+	// longer than the API requests -http-timeout is meant for
+	downloadTimeout = 10 * time.Minute
+)
+
+// releaseKey is the base64 encoded Ed25519 public key releases are signed
+// with, set by "make release". Builds without it don't update, nothing at
+// run time can replace it.
+var releaseKey = ""
+
+// release is the part of a GitHub release kubed needs
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func init() {
+	commands["self-update"] = &command{
+		usage: "self-update [-check-only]",
+		help:  "Replace kubed with the latest release, after verifying its checksum and signature",
+		run:   selfUpdate,
+	}
+}
+
+// assetName is the name of the release binary for this platform, as built by the Makefile
+func assetName() string {
+	name := "kubed-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func (r *release) asset(name string) (releaseAsset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+func latestRelease(ctx context.Context) (*release, error) {
+	var latest release
+	resp, errs := endRequest(ctx, gorequest.New().Get(*releaseURL), &latest)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if resp != nil && resp.StatusCode != 200 {
+		return nil, &statusError{"fetching latest release", resp.StatusCode}
+	}
+	if latest.TagName == "" {
+		return nil, errors.New("Release endpoint returned no version")
+	}
+	return &latest, nil
+}
+
+// parseVersion reads the numbers of a version like v0.2.0, ignoring what
+// follows them, e.g. -3-gdeadbeef-dirty of git describe
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+	var numbers []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, true
+}
+
+// newerVersion tells whether latest is newer than current. Builds without a
+// release version are never reported as outdated.
+func newerVersion(latest string, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := 0; i < len(l) || i < len(c); i++ {
+		var a, b int
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(c) {
+			b = c[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+func download(ctx context.Context, rawURL string, what string) ([]byte, error) {
+	var data []byte
+	resp, errs := endRequestTimeout(ctx, gorequest.New().Get(rawURL), &data, downloadTimeout)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if resp != nil && resp.StatusCode != 200 {
+		return nil, &statusError{"downloading " + what, resp.StatusCode}
+	}
+	return data, nil
+}
+
+// checksumOf finds the checksum of name in a sha256sum style list
+func checksumOf(sums []byte, name string) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+	return "", false
+}
+
+// verifyRelease checks the checksum list of the release against its
+// signature, and the binary against the list
+func verifyRelease(ctx context.Context, latest *release, name string, binary []byte) error {
+	if releaseKey == "" {
+		return withHint(errors.New("This kubed was built without a release key, refusing to update"),
+			"Install a release of kubed, builds of your own are updated by building them again")
+	}
+
+	sumsAsset, ok := latest.asset(checksumsFile)
+	if !ok {
+		return errors.New("Release " + latest.TagName + " has no " + checksumsFile + ", refusing to update")
+	}
+	sums, err := download(ctx, sumsAsset.URL, checksumsFile)
+	if err != nil {
+		return err
+	}
+	sigAsset, ok := latest.asset(checksumsFile + ".sig")
+	if !ok {
+		return errors.New("Release " + latest.TagName + " is not signed, refusing to update")
+	}
+	sig, err := download(ctx, sigAsset.URL, checksumsFile+".sig")
+	if err != nil {
+		return err
+	}
+	err = verifyEd25519(releaseKey, sums, sig, "Release")
+	if err != nil {
+		return err
+	}
+
+	want, ok := checksumOf(sums, name)
+	if !ok {
+		return errors.New(checksumsFile + " of release " + latest.TagName + " has no checksum for " + name)
+	}
+	if got := fmt.Sprintf("%x", sha256.Sum256(binary)); got != want {
+		return errors.New("Checksum of " + name + " does not match " + checksumsFile + ", refusing to update")
+	}
+	return nil
+}
+
+// replaceExecutable writes the new binary next to the running one and
+// renames it into place, so kubed is never left half written
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), ".kubed-update")
+	if err != nil {
+		return errors.Wrap(err, "Failed in writing next to "+exe)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(binary)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), 0755)
+	if err != nil {
+		return err
+	}
+
+	// Windows doesn't replace a running executable, but lets it be moved away
+	if runtime.GOOS != "windows" {
+		return os.Rename(tmp.Name(), exe)
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	err = os.Rename(exe, old)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), exe)
+	if err != nil {
+		// Put the running kubed back, or there is none left
+		if restoreErr := os.Rename(old, exe); restoreErr != nil {
+			log.Error("Failed in restoring ", exe, " from ", old, ": ", restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func selfUpdate(ctx context.Context, args []string) error {
+	latest, err := latestRelease(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Failed in checking for updates")
+	}
+	if !newerVersion(latest.TagName, version) {
+		log.Info("kubed ", version, " is up to date, the latest release is ", latest.TagName)
+		return nil
+	}
+	if *checkOnly {
+		fmt.Println("kubed", latest.TagName, "is available, you have", version)
+		return nil
+	}
+
+	name := assetName()
+	asset, ok := latest.asset(name)
+	if !ok {
+		return errors.New("Release " + latest.TagName + " has no binary for " + runtime.GOOS + "/" + runtime.GOARCH)
+	}
+	log.Info("Downloading kubed ", latest.TagName)
+	binary, err := download(ctx, asset.URL, name)
+	if err != nil {
+		return err
+	}
+	err = verifyRelease(ctx, latest, name, binary)
+	if err != nil {
+		return err
+	}
+
+	err = replaceExecutable(binary)
+	if err != nil {
+		return withHint(errors.Wrap(err, "Failed in replacing kubed"),
+			"Rerun with the rights to write where kubed is installed, e.g. with sudo")
+	}
+	log.Info("Updated kubed from ", version, " to ", latest.TagName)
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestNewerVersion(t *testing.T) {
+	var tests = []struct {
+		latest  string
+		current string
+		newer   bool
+	}{
+		{"0.3.0", "0.2.0", true},
+		{"v0.2.1", "0.2.0", true},
+		{"0.2.0", "0.2.0", false},
+		{"0.2.0", "0.10.0", false},
+		{"0.3", "0.2.9", true},
+		{"0.3.0", "0.2.0-4-g1a2b3c4-dirty", true},
+		{"0.3.0", "none", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.latest+" "+test.current, func(t *testing.T) {
+			if newer := newerVersion(test.latest, test.current); newer != test.newer {
+				t.Errorf("Expected %t, got %t", test.newer, newer)
+			}
+		})
+	}
+}
+
+func TestChecksumOf(t *testing.T) {
+	sums := []byte("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  kubed-linux-amd64\n" +
+		"5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03 *kubed-windows-amd64.exe\n")
+	if sum, ok := checksumOf(sums, "kubed-windows-amd64.exe"); !ok || sum[:8] != "5891b5b5" {
+		t.Errorf("Unexpected checksum %q", sum)
+	}
+	if _, ok := checksumOf(sums, "kubed-darwin-amd64"); ok {
+		t.Errorf("Expected no checksum for missing binary")
+	}
+}
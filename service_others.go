@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "context"
+
+// runAsService is only needed with the Windows service manager
+func runAsService(ctx context.Context, run func(ctx context.Context) error) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+)
+
+// service runs the daemon under the Windows service manager
+type service struct {
+	run func(ctx context.Context) error
+	ctx context.Context
+	err error
+}
+
+func (s *service) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.run(ctx) }()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case s.err = <-done:
+			status <- svc.Status{State: svc.Stopped}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// runAsService runs the daemon through the service control handler when
+// kubed was started by the Windows service manager
+func runAsService(ctx context.Context, run func(ctx context.Context) error) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		log.Warn("Failed in detecting whether running as Windows service ", err)
+		return false, nil
+	}
+	if !isService {
+		return false, nil
+	}
+
+	s := &service{run: run, ctx: ctx}
+	err = svc.Run("kubed", s)
+	if err != nil {
+		return true, err
+	}
+	return true, s.err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+// namespacePattern is what Kubernetes accepts as namespace name, a DNS label
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+func init() {
+	commands["set-namespace"] = &command{
+		usage: "set-namespace <cluster> <namespace>",
+		help:  "Change the default namespace of the context of a cluster, also for later renewals",
+		run:   setNamespaceCommand,
+	}
+}
+
+func validNamespace(ns string) error {
+	if ns == "" || (len(ns) <= 63 && namespacePattern.MatchString(ns)) {
+		return nil
+	}
+	return fmt.Errorf("Invalid namespace %q, namespaces are lowercase letters, digits and dashes, at most 63 long", ns)
+}
+
+func setNamespaceCommand(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return withExitCode(exitUsage, errors.New("Please provide the cluster and the namespace, \"\" for none"))
+	}
+	err := validNamespace(args[1])
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	return setNamespace(cluster, args[1])
+}
+
+// setNamespace changes the namespace of the context of the cluster in all its
+// kubeconfig files, and in .kubedconf so renewals keep it
+func setNamespace(cluster *Cluster, ns string) error {
+	for _, filename := range kubeConfigFiles(cluster) {
+		err := kubeconfig.SetContextNamespace(filename, kubeEntries(cluster).Context, ns)
+		if err != nil {
+			return err
+		}
+		audit("namespace", cluster.Name, filename, "", ns)
+	}
+	if ns == "" {
+		log.Info("Context \"", cluster.Name, "\" now uses no namespace")
+	} else {
+		log.Info("Context \"", cluster.Name, "\" now uses namespace ", ns)
+	}
+	return updateCluster(cluster.Name, func(c *Cluster) { c.NameSpace = ns })
+}
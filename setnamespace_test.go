@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func TestValidNamespace(t *testing.T) {
+	for ns, valid := range map[string]bool{
+		"":            true,
+		"course-2018": true,
+		"Course":      false,
+		"-course":     false,
+		"course_2018": false,
+	} {
+		if err := validNamespace(ns); (err == nil) != valid {
+			t.Errorf("Expected validity of %q to be %v, got %v", ns, valid, err)
+		}
+	}
+}
+
+func TestSetNamespace(t *testing.T) {
+	dir, cleanup := tempHome(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "config")
+	cluster := &Cluster{Name: "kubed", APIServer: "https://192.168.1.1:8443", KubeConfig: filename, NameSpace: "spring"}
+	err := kubeconfig.SetupKubeConfig(&kubeconfig.KubeConfigSetup{
+		ClusterName:          cluster.Name,
+		ClusterServerAddress: cluster.APIServer,
+		Token:                "token",
+		NameSpace:            cluster.NameSpace,
+		KubeConfigFile:       filename,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveConfig(cluster); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setNamespace(cluster, "autumn"); err != nil {
+		t.Fatalf("Got unexpected error: %s", err)
+	}
+	config, err := kubeconfig.ReadConfigOrNew(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns := config.Contexts["kubed"].Namespace; ns != "autumn" {
+		t.Errorf("Expected namespace autumn in kubeconfig, got %q", ns)
+	}
+	saved, err := readConfig("kubed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.NameSpace != "autumn" {
+		t.Errorf("Expected namespace autumn in kubed config, got %q", saved.NameSpace)
+	}
+}
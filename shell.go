@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	commands["shell"] = &command{
+		usage: "shell <cluster>",
+		help:  "Log in to a cluster in a subshell with a temporary kubeconfig, wiped on exit",
+		run:   shellCommand,
+	}
+}
+
+// ramDir is a directory in memory, if the system has one
+func ramDir() (string, bool) {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if info, err := os.Stat(dir); dir != "" && err == nil && info.IsDir() {
+			return dir, true
+		}
+	}
+	return os.TempDir(), false
+}
+
+func shellCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please provide the name of the cluster to open a shell for")
+	}
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+
+	base, inMemory := ramDir()
+	if !inMemory {
+		log.Warn("No ramdisk found, the temporary kubeconfig is kept in ", base)
+	}
+	dir, err := ioutil.TempDir(base, "kubed-shell")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(dir, "config")
+	defer wipe(dir, filename)
+
+	// Nothing of the session may stay behind: no cached tokens, no
+	// references to the temporary file in .kubedconf
+	cluster.KubeConfig = filename
+	cluster.ExtraKubeConfigs = nil
+	cluster.KeepContext = false
+	cluster.ExecCredential = false
+	cluster.AuthProvider = false
+	cluster.Ephemeral = true
+	err = login(ctx, cluster)
+	if err != nil {
+		return err
+	}
+
+	shell := os.Getenv("SHELL")
+	if runtime.GOOS == "windows" {
+		shell = os.Getenv("COMSPEC")
+	}
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	log.Info("Starting ", shell, " with KUBECONFIG=", filename, ", the file is wiped when you exit")
+
+	cmd := exec.Command(shell)
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+filename, "KUBED_SHELL="+cluster.Name)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = leaveSignals(cmd.Run)
+	if _, exited := err.(*exec.ExitError); exited {
+		// The exit status of the last command in the shell is none of our business
+		return nil
+	}
+	return err
+}
+
+// wipe overwrites the kubeconfig before removing it, in case the directory is
+// not in memory after all
+func wipe(dir string, filename string) {
+	if info, err := os.Stat(filename); err == nil {
+		err = ioutil.WriteFile(filename, make([]byte, info.Size()), 0600)
+		if err != nil {
+			log.Warn("Failed in overwriting temporary kubeconfig ", err)
+		}
+	}
+	err := os.RemoveAll(dir)
+	if err != nil {
+		log.Warn("Failed in removing temporary kubeconfig ", err)
+		return
+	}
+	log.Info("Wiped temporary kubeconfig")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM,
+// so pending requests and the callback server are shut down cleanly. A
+// second signal while shutting down exits right away.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range sigs {
+			if atomic.LoadInt32(&childSignals) == 1 {
+				continue
+			}
+			if interrupted() {
+				log.Warn("Received ", sig, " again, exiting now")
+				os.Exit(exitInterrupted)
+			}
+			atomic.StoreInt32(&interruptedFlag, 1)
+			log.Warn("Received ", sig, ", shutting down")
+			cancel()
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// interruptedFlag is set once kubed was asked to stop by a signal
+var interruptedFlag int32
+
+func interrupted() bool {
+	return atomic.LoadInt32(&interruptedFlag) == 1
+}
+
+// interruptedError marks a failure caused by stopping kubed with a signal
+// and tells how to pick up where it stopped
+func interruptedError(clusterName string, err error) error {
+	if !interrupted() || err == nil {
+		return err
+	}
+	if clusterName != "" {
+		err = withHintf(err, "Run \"%s -renew %s\" to finish logging in", os.Args[0], clusterName)
+	}
+	return withExitCode(exitInterrupted, err)
+}
+
+// childSignals is set while a child owns the terminal, see leaveSignals
+var childSignals int32
+
+// leaveSignals runs fn, e.g. an interactive subshell, with SIGINT and SIGTERM
+// left to the child, so Ctrl-C in the child doesn't stop kubed
+func leaveSignals(fn func() error) error {
+	atomic.StoreInt32(&childSignals, 1)
+	defer atomic.StoreInt32(&childSignals, 0)
+	return fn()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// silentReauthTimeout is how long kubed waits for the provider to answer a
+// request with prompt=none, which it does without showing a page
+const silentReauthTimeout = 30 * time.Second
+
+// interactionErrors are the errors of OpenID Connect a provider answers
+// prompt=none with when it can't authenticate the user without a page
+var interactionErrors = map[string]bool{
+	"login_required":                    true,
+	"interaction_required":              true,
+	"consent_required":                  true,
+	"account_selection_required":        true,
+	"unmet_authentication_requirements": true,
+}
+
+// wantSilentReauth tells whether to try renewing through the session with the
+// provider first: the cluster asks for it, was logged in to before and has no
+// refresh token to renew with. An explicit prompt wins.
+func wantSilentReauth(ctx context.Context, cluster *Cluster) bool {
+	if !cluster.SilentReauth || cluster.Prompt != "" || cluster.ManualInput || *nonInteractive || cluster.TokenExpiry.IsZero() {
+		return false
+	}
+	cached, ok, err := readCachedToken(ctx, cluster.Name)
+	return err != nil || !ok || cached.RefreshToken == ""
+}
+
+// silentAuthenticate asks the provider for a token with prompt=none in the
+// browser, which holds the session with the provider, so the user only
+// presses Enter. The provider redirects back right away, with the token or
+// one of the interactionErrors when it needs the user to log in.
+func silentAuthenticate(ctx context.Context, cluster *Cluster, responseType string, param string, secret string, nonce string) (*tokenResponse, error) {
+	silent := *cluster
+	silent.Prompt = "none"
+	authURL := authorizationURL(&silent, responseType, nonce)
+
+	fmt.Print(tr("Press Enter to renew the login to %q through your session with the provider: ", cluster.Name))
+	_, err := readLine(ctx, bufio.NewReader(os.Stdin))
+	if err != nil {
+		return nil, err
+	}
+
+	traceRedirect("Silent authorization request", authURL)
+	go func() {
+		err := openBrowser(authURL)
+		if err != nil {
+			log.Warn("Failed in opening browser ", err)
+		}
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, silentReauthTimeout)
+	defer cancel()
+	callback, err := getToken(waitCtx, cluster.Port, param, cluster.HTTPSCallback)
+	if err != nil {
+		return nil, err
+	}
+	providerToken, err := callbackToken(ctx, cluster, callback, param, secret)
+	if err != nil {
+		return nil, err
+	}
+	err = checkNonce(providerToken, nonce, secret)
+	if err != nil {
+		return nil, err
+	}
+	return providerToken, nil
+}
+
+// needsFullLogin tells whether a failed silent renewal should be followed by
+// the usual login: the provider asked for interaction or didn't answer in
+// time. Interrupting kubed doesn't count.
+func needsFullLogin(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	for e := err; e != nil; e = unwrap(e) {
+		if p, ok := e.(*providerError); ok {
+			return interactionErrors[p.code]
+		}
+		if e == context.DeadlineExceeded {
+			return true
+		}
+	}
+	return false
+}
+
+// reauthenticate tries the silent renewal. No token and no error means the
+// usual login has to follow.
+func reauthenticate(ctx context.Context, cluster *Cluster, responseType string, param string, secret string) (*tokenResponse, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in generating nonce")
+	}
+	log.Info(tr("Renewing through the session with the OAuth2 Provider"))
+	providerToken, err := silentAuthenticate(ctx, cluster, responseType, param, secret, nonce)
+	if err == nil {
+		return providerToken, nil
+	}
+	if needsFullLogin(ctx, err) {
+		log.Info(tr("The OAuth2 Provider needs you to log in again"), " ", err)
+		return nil, nil
+	}
+	return nil, errors.Wrap(err, "Failed in renewing through the session with the OAuth2 Provider")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestNeedsFullLogin(t *testing.T) {
+	ctx := context.Background()
+	for err, expected := range map[error]bool{
+		withExitCode(exitAuthDenied, &providerError{"login_required", ""}):       true,
+		withExitCode(exitAuthDenied, &providerError{"interaction_required", ""}): true,
+		withExitCode(exitAuthDenied, &providerError{"access_denied", ""}):        false,
+		errors.Wrap(context.DeadlineExceeded, "Gave up waiting"):                 true,
+		errors.New("Failed in exchanging authorization code"):                    false,
+	} {
+		if needsFullLogin(ctx, err) != expected {
+			t.Errorf("Expected full login %v after %v", expected, err)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if needsFullLogin(cancelled, errors.Wrap(context.DeadlineExceeded, "Gave up waiting")) {
+		t.Error("Expected no full login after an interrupt")
+	}
+}
+
+func TestWantSilentReauth(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	cluster := &Cluster{Name: "lab", SilentReauth: true, TokenExpiry: time.Now()}
+	if !wantSilentReauth(context.Background(), cluster) {
+		t.Error("Expected a silent renewal without a refresh token")
+	}
+	cluster.Prompt = "select_account"
+	if wantSilentReauth(context.Background(), cluster) {
+		t.Error("Expected an explicit prompt to win")
+	}
+	cluster.Prompt = ""
+	err := saveCachedToken(context.Background(), "lab", &tokenResponse{AccessToken: "a", RefreshToken: "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantSilentReauth(context.Background(), cluster) {
+		t.Error("Expected no silent renewal with a refresh token")
+	}
+	if wantSilentReauth(context.Background(), &Cluster{Name: "new", SilentReauth: true}) {
+		t.Error("Expected no silent renewal before the first login")
+	}
+}
+
+func TestAuthorizationURLAsksForIDToken(t *testing.T) {
+	var tests = []struct {
+		cluster Cluster
+		scope   string
+	}{
+		{Cluster{ClientID: "client-id"}, dataportenScopes + " openid"},
+		{Cluster{ClientID: "client-id", Scopes: "groups"}, "groups openid"},
+		{Cluster{ClientID: "client-id", Scopes: "openid profile"}, "openid profile"},
+		{Cluster{ClientID: "client-id", ProviderURL: "https://idp.example.org"}, "openid"},
+	}
+
+	for _, test := range tests {
+		responseType, _ := responseTypeFor("")
+		u, err := url.Parse(authorizationURL(&test.cluster, responseType, "nonce"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		if q.Get("scope") != test.scope || q.Get("nonce") != "nonce" {
+			t.Errorf("Expected the nonce with scope %q, got %s", test.scope, u.RawQuery)
+		}
+		if q.Get("response_type") != "id_token token" {
+			t.Errorf("Expected implicit flow to ask for an ID token, got %s", u.RawQuery)
+		}
+	}
+}
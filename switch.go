@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func init() {
+	commands["switch"] = &command{
+		usage: "switch [cluster]",
+		help:  "Pick one of the clusters managed by kubed as current context",
+		run:   switchContext,
+	}
+}
+
+func switchContext(ctx context.Context, args []string) error {
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+	if len(clusters) == 0 {
+		return errors.New("No clusters configured yet")
+	}
+
+	candidates := clusters
+	if len(args) > 0 {
+		candidates = fuzzyFilter(args[0], clusters)
+		// An exact name or alias wins over other fuzzy matches
+		for _, c := range clusters {
+			if c.matches(args[0]) {
+				candidates = []Cluster{c}
+				break
+			}
+		}
+	}
+
+	if len(candidates) != 1 {
+		err = needInteraction("Picking a cluster", "Give the full name of the cluster")
+		if err != nil {
+			return err
+		}
+	}
+
+	console := bufio.NewReader(os.Stdin)
+	for len(candidates) != 1 {
+		if len(candidates) == 0 {
+			fmt.Println("No cluster matches, showing all")
+			candidates = clusters
+		}
+		for i, c := range candidates {
+			fmt.Printf("%3d) %-30s token expires %s\n", i+1, c.Name, formatExpiry(c.TokenExpiry, time.Now()))
+		}
+		fmt.Print("Select cluster (number or part of the name, empty to cancel): ")
+		answer, err := readLine(ctx, console)
+		if err != nil {
+			return err
+		}
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(candidates) {
+			candidates = candidates[n-1 : n]
+			break
+		}
+		candidates = fuzzyFilter(answer, candidates)
+	}
+
+	return makeCurrent(&candidates[0])
+}
+
+// makeCurrent makes the context of the cluster the current one in kubeconfig
+func makeCurrent(cluster *Cluster) error {
+	context := kubeEntries(cluster).Context
+	err := kubeconfig.SetCurrentContext(expandHome(cluster.KubeConfig), context)
+	if err != nil {
+		return err
+	}
+	audit("switch", cluster.Name, expandHome(cluster.KubeConfig), "", "")
+	log.Info("Switched to context \"", context, "\"")
+	return nil
+}
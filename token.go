@@ -1,18 +1,42 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
 	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
 )
 
+// tokenResponse is returned by the OAuth2 token endpoint
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token,omitempty"`
+
+	// stored is set once authenticate kept the tokens in the token store or
+	// the agent, for the cluster it logged in to only
+	stored bool
+}
+
 func getJS() []byte {
 	return []byte(`
 		<script>
 			var hash = location.hash;
 			if (hash.startsWith("#")) {
-				window.location = "http://localhost:49999/?"+hash.slice(1);
+				window.location = "/?"+hash.slice(1);
 			}
 		</script>
 	`)
@@ -20,9 +44,10 @@ func getJS() []byte {
 
 func getClosingPage() []byte {
 	return []byte(`<!DOCTYPE html>
-		<html style="background: #E5E0DC;">
+		<html lang="` + messageLanguage + `" style="background: #E5E0DC;">
 		<head>
-			<title>Processing response</title>
+			<meta charset="utf-8">
+			<title>` + tr("Processing response") + `</title>
 			<style type="text/css">
 			body {
 				font-family: "Arial", "sans-serif";
@@ -35,46 +60,378 @@ func getClosingPage() []byte {
 			</style>
 		</head>
 		<body>
-				<h1>Kubed has successfully processed response.</h1>
-				<p>Please close this window and return to the command line.</p>
+				<h1>` + tr("Kubed has successfully processed response.") + `</h1>
+				<p>` + tr("Please close this window and return to the command line.") + `</p>
 		</body>
 		</html>`)
 }
 
-func getToken(port int) (string, error) {
+// providerError is an error the provider redirected back with, e.g.
+// access_denied when the user declined consent
+type providerError struct {
+	code        string
+	description string
+}
 
-	done := make(chan string)
+func (e *providerError) Error() string {
+	return tr("The OAuth2 Provider refused the request: %s %s", e.code, e.description)
+}
+
+// getToken waits for the provider redirect carrying the given callback
+// parameter, "access_token" for implicit flow or "code" for code flow, and
+// returns all parameters of the redirect
+func getToken(ctx context.Context, port int, param string, https bool) (url.Values, error) {
+	// The exchanges of the replayed bundle follow the browser flow
+	if replayer != nil {
+		return url.Values{param: {replayedCallback}}, nil
+	}
 
-	// This server waits for the redirect coming back from API server, populates
-	// reqErr and returns the token from that request, and then stops itself.
+	done := make(chan url.Values, 1)
+	denied := make(chan error, 1)
+	failed := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	}
+
+	// This server waits for the redirect coming back from API server, reports
+	// bad requests and returns the token or code from that request, and then
+	// stops itself. The state is its own, logins of the agent run alongside.
 	srv := &http.Server{
-		Addr: fmt.Sprintf("localhost:%d", port),
+		Addr: callbackAddr(port, https),
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceRedirect("Callback received", r.URL.String())
+
 			// This is to handle fragment parsing in implicit code flow
-			if r.RequestURI == "/" {
+			if r.Method == "GET" && r.RequestURI == "/" {
 				w.Write(getJS())
 				return
 			}
 
-			if r.Method != "GET" {
-				reqErr = errors.New("The server made a bad request: Only GET is allowed")
+			// With response_mode=form_post the response is POSTed as form
+			if r.Method != "GET" && r.Method != "POST" {
+				fail(errors.New("The server made a bad request: Only GET and POST are allowed"))
+				return
+			}
+			err := r.ParseForm()
+			if err != nil {
+				fail(errors.Wrap(err, "The server made a bad request"))
+				return
 			}
 
-			token := r.URL.Query().Get("access_token")
+			// The provider reports refusals, like the user declining consent, as error parameters
+			if e := r.Form.Get("error"); e != "" {
+				w.Write(getClosingPage())
+				select {
+				case denied <- &providerError{e, r.Form.Get("error_description")}:
+				default:
+				}
+				return
+			}
+
+			token := r.Form.Get(param)
+			registerSecrets(token, r.Form.Get("id_token"))
 			if token != "" {
 				w.Write(getClosingPage())
-				done <- token
+				select {
+				case done <- r.Form:
+				default:
+				}
 			}
 		}),
 	}
-	go srv.ListenAndServe()
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return nil, withHintf(errors.Wrap(err, tr("Failed in listening for the redirect from the OAuth2 Provider")),
+			"Port %d is busy, perhaps another kubed is logging in. Wait for it, or rerun with a -port registered as redirect URI of the client", port)
+	}
+	if https {
+		cert, err := loopbackCertificate()
+		if err != nil {
+			listener.Close()
+			return nil, errors.Wrap(err, "Failed in generating certificate for the callback server")
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+	go srv.Serve(listener)
+
+	ctx, cancel := context.WithTimeout(ctx, *callbackTimeout)
+	defer cancel()
+
+	var callback url.Values
+	select {
+	case callback = <-done:
+	case deniedErr := <-denied:
+		err = withExitCode(exitAuthDenied, deniedErr)
+	case err = <-failed:
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), tr("Gave up waiting for the redirect from the OAuth2 Provider"))
+	}
+
+	// Let the closing page finish before stopping the server
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		return callback, errors.Wrap(shutdownErr, "Error shutting down server")
+	}
+
+	return callback, err
+}
+
+// redirectURI is where the provider sends the user back after authentication
+func redirectURI(port int, https bool) string {
+	if https {
+		return fmt.Sprintf("https://%s/", callbackAddr(port, true))
+	}
+	return fmt.Sprintf("http://%s/", callbackAddr(port, false))
+}
+
+// callbackAddr is the address of the callback server. Certificates are for
+// an IP address, names like localhost may resolve elsewhere.
+func callbackAddr(port int, https bool) string {
+	if https {
+		return fmt.Sprintf("127.0.0.1:%d", port)
+	}
+	return fmt.Sprintf("localhost:%d", port)
+}
+
+// validPrompt checks the space separated prompt values defined by OpenID Connect
+func validPrompt(prompt string) error {
+	for _, p := range strings.Fields(prompt) {
+		switch p {
+		case "none", "login", "consent", "select_account":
+		default:
+			return fmt.Errorf("Unsupported prompt value %q, use none, login, consent or select_account", p)
+		}
+	}
+	return nil
+}
+
+// validResponseMode checks the response modes of OAuth 2.0 Multiple Response
+// Types and Form Post Response Mode
+func validResponseMode(mode string) error {
+	switch mode {
+	case "", "query", "fragment", "form_post":
+		return nil
+	}
+	return fmt.Errorf("Unsupported response mode %q, use query, fragment or form_post", mode)
+}
+
+// responseTypeFor gives the response type of the authorization request and
+// the callback parameter to wait for. Confidential clients use authorization
+// code flow and redeem the code with their secret, the others implicit flow,
+// asking for an ID token as well so there is a nonce to check.
+func responseTypeFor(secret string) (string, string) {
+	if secret != "" {
+		return "code", "code"
+	}
+	return "id_token token", "access_token"
+}
+
+// authorizationURL builds the URL the user is sent to for authentication
+func authorizationURL(cluster *Cluster, responseType string, nonce string) string {
+	params := url.Values{}
+	params.Set("response_type", responseType)
+	params.Set("client_id", cluster.ClientID)
+	if responseType == "code" || cluster.HTTPSCallback {
+		params.Set("redirect_uri", redirectURI(cluster.Port, cluster.HTTPSCallback))
+	}
+	if cluster.LoginHint != "" {
+		params.Set("login_hint", cluster.LoginHint)
+	}
+	if cluster.Prompt != "" {
+		params.Set("prompt", cluster.Prompt)
+	}
+	if cluster.ACRValues != "" {
+		params.Set("acr_values", cluster.ACRValues)
+	}
+	if cluster.ResponseMode != "" {
+		params.Set("response_mode", cluster.ResponseMode)
+	}
+	// The nonce comes back in the ID token, which needs the openid scope
+	// along with the scopes the token is used for
+	if nonce != "" {
+		params.Set("scope", requestedScopes(cluster))
+		params.Set("nonce", nonce)
+	}
+	return providerEndpoint(cluster, authPath) + "?" + params.Encode()
+}
+
+// requestedScopes are the scopes of -scopes, or those of the Dataporten
+// client with the default provider, with openid added
+func requestedScopes(cluster *Cluster) string {
+	scopes := strings.Fields(cluster.Scopes)
+	if len(scopes) == 0 && cluster.ProviderURL == "" {
+		scopes = strings.Fields(dataportenScopes)
+	}
+	for _, s := range scopes {
+		if s == "openid" {
+			return strings.Join(scopes, " ")
+		}
+	}
+	return strings.Join(append(scopes, "openid"), " ")
+}
+
+// providerEndpoint is the address of an endpoint of the OAuth2 Provider of
+// the cluster, Dataporten unless another one is configured
+func providerEndpoint(cluster *Cluster, path string) string {
+	if cluster.ProviderURL != "" {
+		return strings.TrimRight(cluster.ProviderURL, "/") + path
+	}
+	return defaultProviderURL + path
+}
+
+// newNonce returns a random value binding the ID token to this login
+func newNonce() (string, error) {
+	if replayer != nil {
+		if n := replayer.nonce(); n != "" {
+			return n, nil
+		}
+	}
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	n := base64.RawURLEncoding.EncodeToString(b)
+	if recorder != nil {
+		recorder.nonce(n)
+	}
+	return n, nil
+}
+
+// parseRedirectURL extracts the given parameter from the URL the provider
+// redirected to, looking in the fragment first and then in the query
+func parseRedirectURL(rawURL string, param string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	fragment, err := url.ParseQuery(u.Fragment)
+	if err == nil && fragment.Get(param) != "" {
+		return fragment.Get(param)
+	}
+	return u.Query().Get(param)
+}
+
+// callbackToken gives the provider tokens of the redirect, the access and ID
+// token of implicit flow or those the code of code flow is redeemed for
+func callbackToken(ctx context.Context, cluster *Cluster, callback url.Values, param string, secret string) (*tokenResponse, error) {
+	if secret == "" {
+		return &tokenResponse{AccessToken: callback.Get(param), IDToken: callback.Get("id_token")}, nil
+	}
+	return exchangeCode(ctx, providerEndpoint(cluster, tokenPath), callback.Get(param), cluster.ClientID, secret, redirectURI(cluster.Port, cluster.HTTPSCallback))
+}
+
+// checkNonce refuses provider tokens without an ID token issued for this
+// login. The redirect of a replayed implicit login isn't in the bundle, so
+// there is no ID token to check then.
+func checkNonce(providerToken *tokenResponse, nonce string, secret string) error {
+	if replayer != nil && secret == "" {
+		return nil
+	}
+	err := auth.CheckNonce(providerToken.IDToken, nonce)
+	if err != nil {
+		return withExitCode(exitAuthDenied, err)
+	}
+	return nil
+}
+
+// exchangeCode redeems an authorization code at the token endpoint,
+// authenticating as a confidential client with the client secret
+func exchangeCode(ctx context.Context, tokenURL string, code string, clientID string, clientSecret string, redirect string) (*tokenResponse, error) {
+	var tr tokenResponse
+	registerSecrets(code, clientSecret)
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirect)
+	form.Set("client_id", clientID)
+
+	start := time.Now()
+	resp, err := endRequest(ctx, gorequest.New().Post(tokenURL).
+		SetBasicAuth(clientID, clientSecret).
+		Type("form").
+		Send(form.Encode()), &tr)
+	registerSecrets(tr.AccessToken, tr.RefreshToken, tr.IDToken)
+	traceHTTP("POST", tokenURL, start, resp, err)
+
+	if err != nil {
+		log.Warn("Failed in exchanging authorization code ", err)
+		return nil, err[0]
+	}
+
+	if resp != nil && resp.StatusCode != 200 {
+		log.Warn("Failed in exchanging authorization code, responsecode: ", resp.StatusCode)
+		return nil, errors.New("Failed in exchanging authorization code")
+	}
+
+	return &tr, nil
+}
+
+// refreshAccessToken gets a new access token with a refresh token, which
+// only confidential clients using authorization code flow are given
+func refreshAccessToken(ctx context.Context, tokenURL string, refreshToken string, clientID string, clientSecret string) (*tokenResponse, error) {
+	var tr tokenResponse
+	registerSecrets(refreshToken, clientSecret)
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("client_id", clientID)
 
-	token := <-done
+	start := time.Now()
+	resp, err := endRequest(ctx, gorequest.New().Post(tokenURL).
+		SetBasicAuth(clientID, clientSecret).
+		Type("form").
+		Send(form.Encode()), &tr)
+	registerSecrets(tr.AccessToken, tr.RefreshToken, tr.IDToken)
+	traceHTTP("POST", tokenURL, start, resp, err)
 
-	err := srv.Close()
 	if err != nil {
-		return token, errors.Wrap(err, "Error shutting down server")
+		log.Warn("Failed in refreshing access token ", err)
+		return nil, err[0]
 	}
 
-	return token, nil
+	if resp != nil && resp.StatusCode != 200 {
+		log.Warn("Failed in refreshing access token, responsecode: ", resp.StatusCode)
+		return nil, &statusError{"refreshing access token", resp.StatusCode}
+	}
+
+	// Providers may keep the refresh token as is and not send it again
+	if tr.RefreshToken == "" {
+		tr.RefreshToken = refreshToken
+	}
+	return &tr, nil
+}
+
+// revokeToken revokes an access or refresh token at the provider (RFC 7009).
+// Public clients have no secret and identify themselves with client_id only.
+func revokeToken(ctx context.Context, revocationURL string, token string, hint string, clientID string, clientSecret string) error {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", hint)
+	form.Set("client_id", clientID)
+
+	req := gorequest.New().Post(revocationURL).Type("form")
+	if clientSecret != "" {
+		req = req.SetBasicAuth(clientID, clientSecret)
+	}
+	start := time.Now()
+	resp, err := endRequest(ctx, req.Send(form.Encode()), nil)
+	traceHTTP("POST", revocationURL, start, resp, err)
+
+	if err != nil {
+		log.Warn("Failed in revoking token ", err)
+		return err[0]
+	}
+
+	if resp != nil && resp.StatusCode != 200 {
+		log.Warn("Failed in revoking token, responsecode: ", resp.StatusCode)
+		return errors.New("Failed in revoking token")
+	}
+	return nil
 }
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/auth"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+)
+
+func init() {
+	commands["token"] = &command{
+		usage: "token decode|print|introspect [cluster]",
+		help:  "Show the claims of the token, print the raw token for use outside kubectl, or ask the provider whether it is active",
+		run:   tokenCommand,
+	}
+}
+
+func tokenCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("Missing token command, expected \"decode\", \"print\" or \"introspect\"")
+	}
+	switch args[0] {
+	case "decode":
+		return decodeToken(ctx, args[1:])
+	case "print":
+		return printToken(ctx, args[1:])
+	case "introspect":
+		return introspectCommand(ctx, args[1:])
+	}
+	return errors.Errorf("Unknown token command %q, expected \"decode\", \"print\" or \"introspect\"", args[0])
+}
+
+// clusterToken returns the token kubed stored in kubeconfig for the cluster,
+// or in the cache when kubectl gets it through the exec credential plugin
+func clusterToken(ctx context.Context, name string) (*Cluster, string, error) {
+	cluster, err := readConfig(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if cluster.ExecCredential {
+		cached, ok, err := readCachedToken(ctx, cluster.Name)
+		if err != nil {
+			return cluster, "", err
+		}
+		if !ok || cached.JWT == "" {
+			return cluster, "", errors.Errorf("no token for %q cached, log in to the cluster first", cluster.Name)
+		}
+		return cluster, cached.JWT, nil
+	}
+	token, err := kubeconfig.ReadToken(expandHome(cluster.KubeConfig), kubeEntries(cluster).User)
+	return cluster, token, err
+}
+
+func decodeToken(ctx context.Context, args []string) error {
+	var token, issuer string
+	switch {
+	case *readStdin:
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(data))
+		issuer = *issuerURL
+	case len(args) == 1:
+		cluster, t, err := clusterToken(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		token, issuer = t, cluster.IssuerURL
+	default:
+		return errors.New("Give the name of a cluster, or -stdin to read the token from standard input")
+	}
+
+	header, err := auth.DecodeHeader(token)
+	if err != nil {
+		return err
+	}
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		return err
+	}
+
+	for _, section := range []struct {
+		title  string
+		values map[string]interface{}
+	}{{"Header", header}, {"Claims", claims}} {
+		pretty, err := json.MarshalIndent(section.values, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s:\n%s\n\n", section.title, pretty)
+	}
+
+	now := time.Now()
+	for _, claim := range []struct{ name, title string }{
+		{"iat", "Issued at"}, {"nbf", "Not before"}, {"exp", "Expires"}, {"auth_time", "Authenticated at"},
+	} {
+		if v, ok := claims[claim.name].(float64); ok {
+			t := time.Unix(int64(v), 0)
+			fmt.Printf("%-18s %s (%s)\n", claim.title+":", t.Format(time.RFC1123), formatRelative(t, now))
+		}
+	}
+	if sub, ok := claims["sub"]; ok {
+		fmt.Printf("%-18s %v\n", "Subject:", sub)
+	}
+	fmt.Printf("%-18s %s\n", "Audience:", strings.Join(claimStrings(claims["aud"]), ", "))
+	fmt.Printf("%-18s %s\n", "Groups:", strings.Join(claimStrings(claims["groups"]), ", "))
+
+	if !*verifyToken {
+		return nil
+	}
+	if issuer == "" {
+		// The keys of the issuer the token names itself would make any token
+		// valid, only trust it when it is the issuer of a configured cluster
+		iss, _ := claims["iss"].(string)
+		if iss == "" {
+			return errors.New("Unknown issuer, give it with -issuer to verify the token")
+		}
+		if _, err := clusterByIssuer(iss); err != nil {
+			return errors.Errorf("The token is issued by %s, which is not the issuer of any configured cluster. Give the issuer to trust with -issuer to verify the token", iss)
+		}
+		issuer = iss
+	}
+	err = verifySignature(ctx, token, issuer)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-18s %s\n", "Signature:", "valid, signed by "+issuer)
+	return nil
+}
+
+// printToken writes only the token to stdout, so it can be used with curl,
+// Helm or CI jobs talking to the API server directly
+func printToken(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Give the name of the cluster to print the token of")
+	}
+
+	// Everything but the token goes to stderr, also when logging in again
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = out }()
+	log.SetOutput(os.Stderr)
+
+	token, err := currentToken(ctx, args[0], *renewIfExpired)
+	if err != nil {
+		return err
+	}
+	if tokenExpired(token) {
+		log.Warn("Token has expired, use -renew-if-expired to log in again first")
+	}
+
+	_, err = fmt.Fprintln(out, token)
+	return err
+}
+
+// currentToken returns the token of the cluster, preferring a running agent
+// over kubeconfig. With renew, an expired token is renewed first, with the
+// refresh token if there is one and by logging in again otherwise.
+func currentToken(ctx context.Context, name string, renew bool) (string, error) {
+	return validToken(ctx, name, renew, 0)
+}
+
+// validToken is currentToken renewing tokens that expire within validFor too
+func validToken(ctx context.Context, name string, renew bool, validFor time.Duration) (string, error) {
+	return renewedToken(ctx, name, renew, validFor, true)
+}
+
+// renewedToken is validToken, logging in again only when interactive. Without
+// it, a token the refresh token can't renew fails with exitAuthDenied.
+func renewedToken(ctx context.Context, name string, renew bool, validFor time.Duration, interactive bool) (string, error) {
+	if token, err := agentToken(name); err == nil && !tokenExpiresWithin(token, validFor) {
+		return token, nil
+	} else if err == nil {
+		log.Debug("Token of the agent for \"", name, "\" expires within ", validFor)
+	} else if agentRunning() {
+		log.Debug("Agent has no token for \"", name, "\" ", err)
+	}
+
+	cluster, token, err := clusterToken(ctx, name)
+	if cluster == nil {
+		return "", err
+	}
+	if !renew || (err == nil && !tokenExpiresWithin(token, validFor)) {
+		return token, err
+	}
+
+	lock, err := lockRefresh(ctx, cluster.Name)
+	if err != nil {
+		return "", err
+	}
+	defer lock.unlock()
+
+	// Another kubed may have renewed the token, or failed to, while this
+	// one waited for the lock
+	if _, token, err := clusterToken(ctx, name); err == nil && !tokenExpiresWithin(token, validFor) {
+		return token, nil
+	}
+	if err := lock.recentFailure(time.Now()); err != nil {
+		return "", err
+	}
+
+	if validFor > 0 {
+		log.Info("Token of \"", cluster.Name, "\" expires within ", validFor, ", renewing it")
+	} else {
+		log.Info("Token of \"", cluster.Name, "\" has expired, renewing it")
+	}
+	if err := runHooks(ctx, "pre", cluster); err != nil {
+		return "", err
+	}
+	err = refreshLogin(ctx, cluster)
+	if err != nil && !interactive {
+		// Not recorded, the login this asks for is not to wait for a backoff
+		return "", withExitCode(exitAuthDenied, errors.Wrapf(err, "The token of %q can't be renewed without logging in again, run kubed -renew %s", cluster.Name, cluster.Name))
+	}
+	if err != nil {
+		log.Debug("Renewing with refresh token failed, logging in again ", err)
+		err = loginAgain(ctx, cluster)
+	}
+	lock.record(err)
+	if err != nil {
+		return "", err
+	}
+	_, token, err = clusterToken(ctx, name)
+	return token, err
+}
+
+func tokenExpired(token string) bool {
+	return tokenExpiresWithin(token, 0)
+}
+
+func tokenExpiresWithin(token string, d time.Duration) bool {
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		return true
+	}
+	_, expiry := auth.TokenTimes(claims)
+	return expired(expiry, time.Now().Add(d))
+}
+
+// jwtExpiry returns the expiry of a JWT, zero if it has none or is no JWT
+func jwtExpiry(token string) time.Time {
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		return time.Time{}
+	}
+	_, expiry := auth.TokenTimes(claims)
+	return expiry
+}
+
+// claimStrings returns a claim that may be a single string or a list of strings
+func claimStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, s := range v {
+			values = append(values, fmt.Sprint(s))
+		}
+		return values
+	}
+	return []string{"-"}
+}
+
+func formatRelative(t time.Time, now time.Time) string {
+	if t.Before(now) {
+		return formatDuration(now.Sub(t)) + " ago"
+	}
+	return "in " + formatDuration(t.Sub(now))
+}
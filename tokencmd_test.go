@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestDecodeTokenVerifyRefusesIssuerOfToken(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+	s, err := newSandbox(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.sign(s.claims("kubernetes", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(token)
+	w.Close()
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	os.Stdin = r
+	*readStdin, *verifyToken = true, true
+	defer func() { *readStdin, *verifyToken = false, false }()
+
+	// Without -issuer, the token names its own issuer, which no cluster has
+	if err := decodeToken(context.Background(), nil); err == nil {
+		t.Error("Expected verifying a token of an unknown issuer to fail")
+	}
+	if requests != 0 {
+		t.Errorf("Expected no keys to be fetched from the issuer of the token, got %d requests", requests)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+const (
+	tokenExchangeGrant = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType    = "urn:ietf:params:oauth:token-type:access_token"
+	jwtTokenType       = "urn:ietf:params:oauth:token-type:jwt"
+	idTokenType        = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// exchangeResponse is returned by a token exchange endpoint (RFC 8693)
+type exchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+}
+
+// exchangeToken trades the access token of the OAuth2 Provider for a JWT at a
+// standards-compliant token service, as replacement for the kubed issuer
+func exchangeToken(ctx context.Context, cluster *Cluster, accessToken string) (string, error) {
+	var er exchangeResponse
+
+	form := url.Values{}
+	form.Set("grant_type", tokenExchangeGrant)
+	form.Set("subject_token", accessToken)
+	form.Set("subject_token_type", accessTokenType)
+	form.Set("requested_token_type", jwtTokenType)
+	form.Set("client_id", cluster.ClientID)
+	if cluster.TokenAudience != "" {
+		form.Set("audience", cluster.TokenAudience)
+	}
+	if cluster.TokenTTL != "" {
+		log.Warn("Not requesting -token-ttl ", cluster.TokenTTL, ", token exchange has no parameter for the lifetime")
+	}
+
+	req, reqErr := prepareIssuerRequest(gorequest.New().Post(cluster.IssuerURL).
+		Type("form").
+		Send(form.Encode()), cluster)
+	if reqErr != nil {
+		return "", reqErr
+	}
+	start := time.Now()
+	resp, err := endRequest(ctx, req, &er)
+	traceHTTP("POST", cluster.IssuerURL, start, resp, err)
+
+	if err != nil {
+		log.Warn("Failed in exchanging token ", err)
+		return "", err[0]
+	}
+
+	if resp != nil && resp.StatusCode != 200 {
+		log.Warn("Failed in exchanging token, responsecode: ", resp.StatusCode)
+		return "", &statusError{"exchanging token", resp.StatusCode}
+	}
+
+	if er.IssuedTokenType != "" && er.IssuedTokenType != jwtTokenType && er.IssuedTokenType != idTokenType {
+		return "", errors.Errorf("Token service issued a %s, not a JWT", er.IssuedTokenType)
+	}
+	return er.AccessToken, nil
+}
+
+// clusterJWT gets the JWT for the cluster, from the kubed issuer, through
+// token exchange or from the kubeconfig the issuer hands out, as configured
+func clusterJWT(ctx context.Context, cluster *Cluster, accessToken string) (string, error) {
+	if cluster.IssuerKubeConfig {
+		token, _, err := kubeConfigCredentials(ctx, cluster, accessToken)
+		return token, err
+	}
+	if !cluster.TokenExchange {
+		return getJWTTokenWithRetry(ctx, accessToken, cluster)
+	}
+
+	var token string
+	err := withRetry(ctx, "exchanging token", *retryAttempts, *retryBackoff, func() error {
+		var err error
+		token, err = exchangeToken(ctx, cluster, accessToken)
+		return err
+	})
+	return token, err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// tokenStore keeps the cached tokens of a cluster. The default is the cache
+// file in the data directory, clusters may use an external secret store instead.
+type tokenStore interface {
+	get(ctx context.Context, name string) (CachedToken, bool, error)
+	put(ctx context.Context, name string, token CachedToken) error
+	remove(ctx context.Context, name string) error
+}
+
+// validSecretBackend checks the -secret-backend given for a cluster
+func validSecretBackend(backend string, path string, commands *SecretCommands) error {
+	switch backend {
+	case "", "file":
+		return nil
+	case "command":
+		if commands == nil || commands.Read == "" || commands.Write == "" {
+			return errors.New("Please provide the commands of the secret store with -secret-read-command and -secret-write-command")
+		}
+	case "vault", "pass":
+	default:
+		return errors.Errorf("Unknown secret backend %q, use file, vault, pass or command", backend)
+	}
+	if path == "" {
+		return errors.New("Please provide the path to keep the tokens at with -secret-path")
+	}
+	_, err := template.New("path").Parse(path)
+	return errors.Wrap(err, "Invalid -secret-path")
+}
+
+// storeFor returns the token store configured for the cluster. Clusters not
+// in the kubed config, like those of "kubed shell", use the cache file, but a
+// config that can't be read is an error: the tokens may belong elsewhere.
+func storeFor(name string) (tokenStore, error) {
+	clusters, err := readClusters()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in finding the token store")
+	}
+	for _, cluster := range clusters {
+		if cluster.Name != name {
+			continue
+		}
+		switch cluster.SecretBackend {
+		case "vault":
+			return vaultStore{path: cluster.SecretPath}, nil
+		case "pass":
+			return commandStore{path: cluster.SecretPath, commands: passCommands}, nil
+		case "command":
+			if cluster.SecretCommands != nil {
+				return commandStore{path: cluster.SecretPath, commands: *cluster.SecretCommands}, nil
+			}
+		}
+	}
+	return fileStore{}, nil
+}
+
+// secretPath expands a -secret-path template for the cluster
+func secretPath(path string, name string) (string, error) {
+	t, err := template.New("path").Parse(path)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid secret path")
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, struct{ Cluster string }{name})
+	if err != nil {
+		return "", errors.Wrap(err, "Failed in expanding secret path")
+	}
+	return buf.String(), nil
+}
+
+// fileStore keeps the tokens of all clusters in the kubed cache file
+type fileStore struct{}
+
+func (fileStore) get(ctx context.Context, name string) (CachedToken, bool, error) {
+	tokens, err := readCache()
+	if err != nil {
+		return CachedToken{}, false, err
+	}
+	cached, ok := tokens[name]
+	return cached, ok, nil
+}
+
+func (fileStore) put(ctx context.Context, name string, token CachedToken) error {
+	return updateCache(ctx, func(tokens map[string]CachedToken) bool {
+		tokens[name] = token
+		return true
+	})
+}
+
+func (fileStore) remove(ctx context.Context, name string) error {
+	return updateCache(ctx, func(tokens map[string]CachedToken) bool {
+		if _, ok := tokens[name]; !ok {
+			return false
+		}
+		delete(tokens, name)
+		return true
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestFileStoreKeepsParallelUpdates(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- fileStore{}.put(context.Background(), fmt.Sprint("cluster", i), CachedToken{RefreshToken: fmt.Sprint("refresh", i)})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tokens, err := readCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if tokens[fmt.Sprint("cluster", i)].RefreshToken != fmt.Sprint("refresh", i) {
+			t.Errorf("Refresh token of cluster%d was lost, got %v", i, tokens)
+		}
+	}
+}
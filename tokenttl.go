@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+// validTokenTTL checks the lifetime of -token-ttl, which is up to the issuer
+// anyway, so anything from a minute is accepted
+func validTokenTTL(value string) error {
+	if value == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < time.Minute {
+		return fmt.Errorf("Invalid -token-ttl %q, give a duration of a minute or more like 8h", value)
+	}
+	return nil
+}
+
+// tokenTTLSeconds is the lifetime requested for the tokens of the cluster in
+// seconds, 0 to leave it to the issuer
+func tokenTTLSeconds(cluster *Cluster) int64 {
+	ttl, err := time.ParseDuration(cluster.TokenTTL)
+	if err != nil {
+		return 0
+	}
+	return int64(ttl / time.Second)
+}
+
+// withTTL asks the kubed issuer for tokens of ttl seconds with the ttl query
+// parameter, which issuers that don't support it ignore
+func withTTL(issuerURL string, ttl int64) string {
+	if ttl <= 0 {
+		return issuerURL
+	}
+	separator := "?"
+	if strings.Contains(issuerURL, "?") {
+		separator = "&"
+	}
+	return issuerURL + separator + url.Values{"ttl": {fmt.Sprint(ttl)}}.Encode()
+}
+
+// grantedTTL tells the lifetime the issuer gave the token, from its iat and
+// exp claims, and warns when it isn't the one requested with -token-ttl
+func grantedTTL(cluster *Cluster, token string) time.Duration {
+	claims, err := auth.DecodeClaims(token)
+	if err != nil {
+		return 0
+	}
+	issued, expiry := auth.TokenTimes(claims)
+	if issued.IsZero() || expiry.IsZero() {
+		return 0
+	}
+	granted := expiry.Sub(issued)
+
+	requested := time.Duration(tokenTTLSeconds(cluster)) * time.Second
+	diff := granted - requested
+	if diff < 0 {
+		diff = -diff
+	}
+	switch {
+	case requested == 0:
+		log.Debug("The issuer granted a token for ", granted)
+	case diff > time.Minute:
+		log.Warn("The issuer granted a token for ", granted, " instead of the requested -token-ttl ", requested, ", it caps the lifetime or doesn't support choosing it")
+	default:
+		log.Info("The issuer granted a token for ", granted)
+	}
+	return granted
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidTokenTTL(t *testing.T) {
+	for value, valid := range map[string]bool{"": true, "8h": true, "90m": true, "30s": false, "8": false, "-1h": false} {
+		if err := validTokenTTL(value); (err == nil) != valid {
+			t.Errorf("Expected -token-ttl %q to be valid %v, got %v", value, valid, err)
+		}
+	}
+}
+
+func TestWithTTL(t *testing.T) {
+	for _, c := range []struct {
+		url      string
+		ttl      int64
+		expected string
+	}{
+		{"https://issuer.example.org", 0, "https://issuer.example.org"},
+		{"https://issuer.example.org", 28800, "https://issuer.example.org?ttl=28800"},
+		{"https://issuer.example.org/token?cluster=lab", 3600, "https://issuer.example.org/token?cluster=lab&ttl=3600"},
+	} {
+		if u := withTTL(c.url, c.ttl); u != c.expected {
+			t.Errorf("Expected %q, got %q", c.expected, u)
+		}
+	}
+}
+
+func TestGrantedTTL(t *testing.T) {
+	s, err := newSandbox("http://127.0.0.1:5556")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := s.claims("kubernetes", nil)
+	claims["exp"] = claims["iat"].(int64) + 8*3600
+	token, err := s.sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if granted := grantedTTL(&Cluster{Name: "lab", TokenTTL: "8h"}, token); granted != 8*time.Hour {
+		t.Errorf("Expected 8h to be granted, got %s", granted)
+	}
+	if granted := grantedTTL(&Cluster{Name: "lab"}, "not a jwt"); granted != 0 {
+		t.Errorf("Expected nothing granted for opaque tokens, got %s", granted)
+	}
+}
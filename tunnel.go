@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/uninett/kubed/pkg/kubeconfig"
+	"golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// TunnelConfig is the SSH bastion an API server is reached through
+type TunnelConfig struct {
+	Host      string `yaml:"host"`
+	User      string `yaml:"user,omitempty"`
+	Key       string `yaml:"key,omitempty"`
+	LocalPort int    `yaml:"localport,omitempty"`
+}
+
+func init() {
+	commands["tunnel"] = &command{
+		usage: "tunnel <cluster>",
+		help:  "Forward a local port to the API server over SSH and point kubeconfig at it while running",
+		run:   tunnelCommand,
+	}
+}
+
+// newTunnelConfig returns nil unless a bastion is given
+func newTunnelConfig(host string, user string, key string, localPort int) *TunnelConfig {
+	if host == "" {
+		return nil
+	}
+	if !strings.Contains(host, ":") {
+		host += ":22"
+	}
+	return &TunnelConfig{Host: host, User: user, Key: key, LocalPort: localPort}
+}
+
+func tunnelCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please provide the name of the cluster to tunnel to")
+	}
+	cluster, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	if cluster.Tunnel == nil {
+		return errors.Errorf("No SSH bastion configured for %s, set it up with -tunnel-host", cluster.Name)
+	}
+
+	server, err := url.Parse(cluster.APIServer)
+	if err != nil {
+		return errors.Wrap(err, "Invalid API server address")
+	}
+	target := server.Host
+	if server.Port() == "" {
+		target = net.JoinHostPort(server.Hostname(), "443")
+	}
+
+	client, err := dialBastion(cluster.Tunnel)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", cluster.Tunnel.LocalPort))
+	if err != nil {
+		return errors.Wrap(err, "Failed in listening for the tunnel")
+	}
+	defer listener.Close()
+
+	issuer, err := issuerAddress(cluster)
+	if err != nil {
+		return err
+	}
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Wrap(err, "Failed in listening for the issuer proxy")
+	}
+	defer proxyListener.Close()
+	go serveTunnelProxy(proxyListener, client, issuer)
+
+	local := "https://" + listener.Addr().String()
+	err = pointAtTunnel(cluster, local, "http://"+proxyListener.Addr().String(), server.Hostname())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := pointAtTunnel(cluster, "", "", "")
+		if err != nil {
+			log.Warn("Failed in restoring the API server address in kubeconfig ", err)
+		}
+	}()
+	log.Info("Tunnel to ", target, " through ", cluster.Tunnel.Host, " is up at ", local, ", press Ctrl-C to close it")
+	log.Info("Logins and renewals reach the issuer ", issuer, " through the tunnel as well")
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	var wg sync.WaitGroup
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			forwardConn(client, conn, target)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// pointAtTunnel records the tunnel address, so logins and renewals write it
+// instead of the API server, and the proxy they reach the issuer through.
+// It rewrites kubeconfig, the server certificate is still checked for the
+// real name with tls-server-name. An empty address restores the API server.
+func pointAtTunnel(cluster *Cluster, address string, proxy string, serverName string) error {
+	err := updateCluster(cluster.Name, func(c *Cluster) {
+		c.TunnelAddress, c.TunnelProxy = address, proxy
+	})
+	if err != nil {
+		return err
+	}
+	cluster.TunnelAddress, cluster.TunnelProxy = address, proxy
+
+	filename := expandHome(cluster.KubeConfig)
+	config, err := kubeconfig.ReadConfigOrNew(filename)
+	if err != nil {
+		return err
+	}
+	clusterName := kubeEntries(cluster).Cluster
+	entry, ok := config.Clusters[clusterName]
+	if !ok {
+		return errors.Errorf("cluster %q not found in %s, log in to the cluster first", clusterName, filename)
+	}
+	entry.Server = apiServerAddress(cluster)
+	err = kubeconfig.WriteConfig(config, filename)
+	if err != nil {
+		return err
+	}
+	return kubeconfig.SetClusterField(filename, clusterName, "tls-server-name", serverName)
+}
+
+// dropStaleTunnel points the cluster at the API server again when the
+// tunnel recorded for it is not up, because "kubed tunnel" was killed before
+// it could restore it
+func dropStaleTunnel(cluster *Cluster) *Cluster {
+	if cluster.TunnelAddress == "" {
+		return cluster
+	}
+	if u, err := url.Parse(cluster.TunnelAddress); err == nil {
+		if conn, err := net.DialTimeout("tcp", u.Host, time.Second); err == nil {
+			conn.Close()
+			return cluster
+		}
+	}
+	log.Warn("Tunnel of \"", cluster.Name, "\" is down, pointing kubeconfig at the API server again")
+	err := pointAtTunnel(cluster, "", "", "")
+	if err != nil {
+		log.Warn("Failed in restoring the API server address in kubeconfig ", err)
+		cluster.TunnelAddress, cluster.TunnelProxy = "", ""
+	}
+	return cluster
+}
+
+// issuerAddress is the host and port of the issuer of the cluster
+func issuerAddress(cluster *Cluster) (string, error) {
+	issuer, err := url.Parse(cluster.IssuerURL)
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid issuer address")
+	}
+	if issuer.Port() != "" {
+		return issuer.Host, nil
+	}
+	if issuer.Scheme == "http" {
+		return net.JoinHostPort(issuer.Hostname(), "80"), nil
+	}
+	return net.JoinHostPort(issuer.Hostname(), "443"), nil
+}
+
+// serveTunnelProxy is an HTTP proxy for the issuer, connecting through the
+// bastion. Only CONNECT requests to the issuer are served, so other local
+// processes can't use it to reach anything else behind the bastion.
+func serveTunnelProxy(listener net.Listener, client *ssh.Client, issuer string) {
+	http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.Host != issuer {
+			http.Error(w, "Only CONNECT to "+issuer+" is served", http.StatusForbidden)
+			return
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "Connection can't be taken over", http.StatusInternalServerError)
+			return
+		}
+		remote, err := client.Dial("tcp", issuer)
+		if err != nil {
+			log.Warn("Failed in connecting to ", issuer, " through the tunnel ", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			remote.Close()
+			return
+		}
+		_, err = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		if err == nil {
+			pipeConns(conn, remote)
+		}
+		conn.Close()
+		remote.Close()
+	}))
+}
+
+// apiServerAddress is where kubectl reaches the API server, through the tunnel when it is up
+func apiServerAddress(cluster *Cluster) string {
+	if cluster.TunnelAddress != "" {
+		return cluster.TunnelAddress
+	}
+	return cluster.APIServer
+}
+
+func forwardConn(client *ssh.Client, conn net.Conn, target string) {
+	defer conn.Close()
+	remote, err := client.Dial("tcp", target)
+	if err != nil {
+		log.Warn("Failed in connecting to ", target, " through the tunnel ", err)
+		return
+	}
+	defer remote.Close()
+	pipeConns(conn, remote)
+}
+
+// pipeConns copies between the connections until one of them is done
+func pipeConns(conn net.Conn, remote net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// dialBastion connects with the key given for the cluster or else the keys in
+// the SSH agent, checking the host key against ~/.ssh/known_hosts
+func dialBastion(tunnel *TunnelConfig) (*ssh.Client, error) {
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in reading ~/.ssh/known_hosts, connect to the bastion with ssh once first")
+	}
+
+	var auth []ssh.AuthMethod
+	if tunnel.Key != "" {
+		key, err := ioutil.ReadFile(expandHome(tunnel.Key))
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed in reading SSH key, add keys with a passphrase to ssh-agent instead")
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err == nil {
+			defer conn.Close()
+			auth = append(auth, ssh.PublicKeysCallback(sshagent.NewClient(conn).Signers))
+		}
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("No SSH key for the bastion, give one with -tunnel-key or start ssh-agent")
+	}
+
+	user := tunnel.User
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	client, err := ssh.Dial("tcp", tunnel.Host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         *httpTimeout,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed in connecting to bastion "+tunnel.Host)
+	}
+	return client, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDropStaleTunnel(t *testing.T) {
+	_, cleanup := tempHome(t)
+	defer cleanup()
+
+	err := writeKubedConfig(&KubedConfig{Clusters: []Cluster{{
+		Name:          "prod",
+		APIServer:     "https://192.168.1.1:8443",
+		KubeConfig:    "~/.kube/config",
+		TunnelAddress: "https://127.0.0.1:1",
+		TunnelProxy:   "http://127.0.0.1:2",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster, err := readConfig("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.TunnelAddress != "" || cluster.TunnelProxy != "" {
+		t.Errorf("Expected the stale tunnel to be dropped, got %q %q", cluster.TunnelAddress, cluster.TunnelProxy)
+	}
+	clusters, err := readClusters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clusters[0].TunnelAddress != "" {
+		t.Errorf("Expected the stale tunnel to be dropped from the kubed config, got %q", clusters[0].TunnelAddress)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	uiBarWidth = 20
+	uiLogLines = 8
+	uiHelp     = "up/down select  r renew  s switch  d remove  q quit"
+)
+
+func init() {
+	commands["ui"] = &command{
+		usage: "ui",
+		help:  "Manage the clusters in a terminal UI, with their token expiry and the logs of renewals",
+		run:   runUI,
+	}
+}
+
+// ui is the state of the terminal UI. The keys and the operations they start
+// run in their own goroutines, everything they share is guarded by mutex.
+type ui struct {
+	mutex    sync.Mutex
+	clusters []Cluster
+	selected int
+	busy     string
+	confirm  string
+	logs     []string
+	partial  []byte
+	redraw   chan struct{}
+}
+
+// Write collects the log lines of the operations for the log pane
+func (u *ui) Write(p []byte) (int, error) {
+	u.mutex.Lock()
+	u.partial = append(u.partial, p...)
+	for {
+		i := bytes.IndexByte(u.partial, '\n')
+		if i < 0 {
+			break
+		}
+		u.logs = append(u.logs, string(u.partial[:i]))
+		u.partial = u.partial[i+1:]
+	}
+	if len(u.logs) > uiLogLines {
+		u.logs = u.logs[len(u.logs)-uiLogLines:]
+	}
+	u.mutex.Unlock()
+	u.refresh()
+	return len(p), nil
+}
+
+func (u *ui) refresh() {
+	select {
+	case u.redraw <- struct{}{}:
+	default:
+	}
+}
+
+func (u *ui) reload() error {
+	clusters, err := readClusters()
+	if err != nil {
+		return err
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	name := ""
+	if u.selected < len(u.clusters) {
+		name = u.clusters[u.selected].Name
+	}
+	u.clusters, u.selected = clusters, 0
+	for i, c := range clusters {
+		if c.Name == name {
+			u.selected = i
+		}
+	}
+	return nil
+}
+
+// expiryBar shows how much of the lifetime of the token is left
+func expiryBar(c Cluster, now time.Time, width int) string {
+	expiry := clusterExpiry(&c)
+	lifetime := expiry.Sub(c.LastRenewedAt)
+	if expiry.IsZero() || c.LastRenewedAt.IsZero() || lifetime <= 0 {
+		return strings.Repeat(" ", width)
+	}
+	filled := int(float64(width) * float64(expiry.Sub(now)) / float64(lifetime))
+	if filled < 0 {
+		filled = 0
+	} else if filled > width {
+		filled = width
+	}
+	return strings.Repeat("#", filled) + strings.Repeat(".", width-filled)
+}
+
+// render draws the whole screen, lines cut to width. The terminal is in raw
+// mode, so lines end in \r\n.
+func (u *ui) render(w io.Writer, now time.Time, width int) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("kubed - %d clusters", len(u.clusters)), uiHelp, "")
+	nameWidth := 10
+	for _, c := range u.clusters {
+		if len(c.Name) > nameWidth {
+			nameWidth = len(c.Name)
+		}
+	}
+	for i, c := range u.clusters {
+		marker := "  "
+		if i == u.selected {
+			marker = "> "
+		}
+		lines = append(lines, fmt.Sprintf("%s%-*s  [%s]  %-20s  %s", marker, nameWidth, c.Name,
+			expiryBar(c, now, uiBarWidth), formatExpiry(clusterExpiry(&c), now), c.APIServer))
+	}
+	if len(u.clusters) == 0 {
+		lines = append(lines, "  No clusters configured yet")
+	}
+	lines = append(lines, "")
+	switch {
+	case u.confirm != "":
+		lines = append(lines, fmt.Sprintf("Remove %q and its tokens? [y/N]", u.confirm))
+	case u.busy != "":
+		lines = append(lines, u.busy+"...")
+	default:
+		lines = append(lines, "")
+	}
+	lines = append(lines, strings.Repeat("-", width))
+	lines = append(lines, u.logs...)
+
+	// Home, then each line with the rest of it cleared, then the rest of the screen
+	fmt.Fprint(w, "\x1b[H")
+	for _, line := range lines {
+		if width > 0 && len(line) > width {
+			line = line[:width]
+		}
+		fmt.Fprint(w, line, "\x1b[K\r\n")
+	}
+	fmt.Fprint(w, "\x1b[J")
+}
+
+// start runs an operation on the selected cluster, one at a time
+func (u *ui) start(ctx context.Context, what string, op func(ctx context.Context, c *Cluster) error) {
+	u.mutex.Lock()
+	if u.busy != "" || u.selected >= len(u.clusters) {
+		u.mutex.Unlock()
+		return
+	}
+	c := u.clusters[u.selected]
+	u.busy = what + " " + c.Name
+	u.mutex.Unlock()
+	u.refresh()
+
+	go func() {
+		err := op(ctx, &c)
+		if err != nil {
+			log.Error(err)
+		}
+		if err := u.reload(); err != nil {
+			log.Error(err)
+		}
+		u.mutex.Lock()
+		u.busy = ""
+		u.mutex.Unlock()
+		u.refresh()
+	}()
+}
+
+// uiRenew renews the token with the refresh token, and only falls back to a
+// login in the browser when no input on the console is needed
+func uiRenew(ctx context.Context, c *Cluster) error {
+	err := runHooks(ctx, "pre", c)
+	if err != nil {
+		return err
+	}
+	err = refreshLogin(ctx, c)
+	if err == nil {
+		return nil
+	}
+	if c.ManualInput {
+		return errors.Wrap(err, "Renewing with refresh token failed, log in with kubed -renew "+c.Name)
+	}
+	log.Info("Renewing with refresh token failed, logging in again in the browser")
+	return loginAgain(ctx, c)
+}
+
+func uiRemove(ctx context.Context, c *Cluster) error {
+	err := removeCluster(ctx, c)
+	if err == nil {
+		log.Info("Removed \"", c.Name, "\"")
+	}
+	return err
+}
+
+func uiSwitch(ctx context.Context, c *Cluster) error {
+	return makeCurrent(c)
+}
+
+// key handles a key press, and tells whether to quit
+func (u *ui) key(ctx context.Context, key string) bool {
+	u.mutex.Lock()
+	confirm := u.confirm
+	u.confirm = ""
+	u.mutex.Unlock()
+	if confirm != "" {
+		if key == "y" || key == "Y" {
+			u.start(ctx, "Removing", uiRemove)
+		}
+		u.refresh()
+		return false
+	}
+
+	switch key {
+	case "q", "\x03", "\x1b":
+		return true
+	case "\x1b[A", "k":
+		u.mutex.Lock()
+		if u.selected > 0 {
+			u.selected--
+		}
+		u.mutex.Unlock()
+	case "\x1b[B", "j":
+		u.mutex.Lock()
+		if u.selected < len(u.clusters)-1 {
+			u.selected++
+		}
+		u.mutex.Unlock()
+	case "r":
+		u.start(ctx, "Renewing", uiRenew)
+	case "s":
+		u.start(ctx, "Switching to", uiSwitch)
+	case "d":
+		u.mutex.Lock()
+		if u.busy == "" && u.selected < len(u.clusters) {
+			u.confirm = u.clusters[u.selected].Name
+		}
+		u.mutex.Unlock()
+	}
+	u.refresh()
+	return false
+}
+
+func runUI(ctx context.Context, args []string) error {
+	err := needInteraction("The terminal UI", "Use kubed list and kubed -renew <cluster> instead")
+	if err != nil {
+		return err
+	}
+	if plainOutput() {
+		return withHint(withExitCode(exitUsage, errors.New("kubed ui redraws the screen, which doesn't go with -plain")), "Use kubed list and kubed -renew <cluster> instead")
+	}
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return withHint(withExitCode(exitUsage, errors.New("kubed ui needs a terminal")), "Use kubed list and kubed -renew <cluster> instead")
+	}
+
+	u := &ui{redraw: make(chan struct{}, 1)}
+	err = u.reload()
+	if err != nil {
+		return err
+	}
+
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer terminal.Restore(fd, state)
+
+	// The operations log into the log pane, not over the screen
+	logger := log.StandardLogger()
+	oldOut, oldFormatter := logger.Out, logger.Formatter
+	log.SetOutput(u)
+	setFormatter(&log.TextFormatter{DisableColors: true})
+	defer func() {
+		log.SetOutput(oldOut)
+		log.SetFormatter(oldFormatter)
+	}()
+
+	// Alternate screen without cursor, restored on the way out
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		width, _, err := terminal.GetSize(fd)
+		if err != nil {
+			width = 80
+		}
+		u.render(os.Stdout, time.Now(), width)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case key, ok := <-keys:
+			if !ok || u.key(ctx, key) {
+				return nil
+			}
+		case <-u.redraw:
+		case <-ticker.C:
+		}
+	}
+}
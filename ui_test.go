@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiryBar(t *testing.T) {
+	now := time.Now()
+	c := Cluster{LastRenewedAt: now.Add(-time.Hour), TokenExpiry: now.Add(time.Hour)}
+	if bar := expiryBar(c, now, 10); bar != "#####....." {
+		t.Errorf("Expected half full bar, got %q", bar)
+	}
+	c.TokenExpiry = now.Add(-time.Minute)
+	if bar := expiryBar(c, now, 10); bar != ".........." {
+		t.Errorf("Expected empty bar for expired token, got %q", bar)
+	}
+}
+
+func TestUIKeys(t *testing.T) {
+	u := &ui{
+		clusters: []Cluster{{Name: "course", TokenExpiry: time.Now().Add(time.Hour)}, {Name: "prod"}},
+		redraw:   make(chan struct{}, 1),
+	}
+	ctx := context.Background()
+
+	u.key(ctx, "\x1b[B")
+	if u.selected != 1 {
+		t.Errorf("Expected second cluster selected, got %d", u.selected)
+	}
+	u.key(ctx, "d")
+	if u.confirm != "prod" {
+		t.Errorf("Expected removal to ask for confirmation, got %q", u.confirm)
+	}
+	u.key(ctx, "n")
+	if u.confirm != "" || u.busy != "" {
+		t.Errorf("Removal was not cancelled")
+	}
+	if !u.key(ctx, "q") {
+		t.Errorf("Expected q to quit")
+	}
+
+	var out bytes.Buffer
+	u.Write([]byte("level=info msg=\"Renewed\"\npartial"))
+	u.render(&out, time.Now(), 120)
+	for _, s := range []string{"> prod", "  course", "Renewed"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected %q on the screen:\n%s", s, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "partial") {
+		t.Errorf("Unfinished log line was shown")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	noUpdateCheckEnv = "KUBED_NO_UPDATE_CHECK"
+	updateCheckFile  = "update-check.yaml"
+	// updateCheckEvery limits how often the release endpoint is asked
+	updateCheckEvery = 24 * time.Hour
+)
+
+// updateCheck caches the latest release seen, so most runs do not ask for it
+type updateCheck struct {
+	CheckedAt time.Time `yaml:"checkedat"`
+	Latest    string    `yaml:"latest"`
+}
+
+// updateCheckDisabled tells whether the update notice is turned off, with
+// KUBED_NO_UPDATE_CHECK or noupdatecheck in the kubed config, e.g. on air-gapped sites
+func updateCheckDisabled() bool {
+	if os.Getenv(noUpdateCheckEnv) != "" {
+		return true
+	}
+	if _, ok := parseVersion(version); !ok {
+		// Development builds have nothing to compare with
+		return true
+	}
+	conf, err := readKubedConfig()
+	return err == nil && conf.NoUpdateCheck
+}
+
+// latestKnownRelease returns the cached latest release, asking the release
+// endpoint once the cache is older than a day
+func latestKnownRelease() string {
+	path := filepath.Join(cacheDir(), updateCheckFile)
+	var check updateCheck
+	if data, err := ioutil.ReadFile(path); err == nil {
+		yaml.Unmarshal(data, &check)
+	}
+	if time.Since(check.CheckedAt) < updateCheckEvery {
+		return check.Latest
+	}
+
+	// Don't hold up the user for long, the next run tries again
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	check.CheckedAt = time.Now()
+	if latest, err := latestRelease(ctx); err == nil {
+		check.Latest = latest.TagName
+	}
+	if data, err := yaml.Marshal(check); err == nil {
+		writeDataFile(path, data, 0600)
+	}
+	return check.Latest
+}
+
+// noticeUpdate prints a line on stderr when a newer kubed has been released
+func noticeUpdate() {
+	if *quiet || *nonInteractive || updateCheckDisabled() {
+		return
+	}
+	if latest := latestKnownRelease(); newerVersion(latest, version) {
+		fmt.Fprintf(os.Stderr, "kubed %s is available, you have %s. Update with: kubed self-update\n", latest, version)
+	}
+}
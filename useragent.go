@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+// correlationHeader carries the ID of the run on every outgoing request, so
+// issuer operators can find the requests of a support ticket in their logs
+const correlationHeader = "X-Correlation-Id"
+
+// runID identifies this run of kubed, -debug-http logs it with every request
+var runID = newRunID()
+
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// userAgent names kubed, its version and platform to the servers it talks to
+func userAgent() string {
+	return fmt.Sprintf("kubed/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH)
+}
+
+// identify sets the User-Agent and correlation ID of the request
+func identify(req *gorequest.SuperAgent) *gorequest.SuperAgent {
+	return req.Set("User-Agent", userAgent()).Set(correlationHeader, runID)
+}
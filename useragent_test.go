@@ -0,0 +1,15 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	if ua := userAgent(); !regexp.MustCompile(`^kubed/\S+ \(\w+/\w+\)$`).MatchString(ua) {
+		t.Errorf("Unexpected User-Agent %q", ua)
+	}
+	if len(runID) != 16 || newRunID() == runID {
+		t.Errorf("Expected a random run ID, got %q", runID)
+	}
+}
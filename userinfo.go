@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+	"github.com/uninett/kubed/pkg/auth"
+)
+
+// userinfoPath is the OpenID Connect userinfo endpoint of the provider
+const userinfoPath = "/userinfo"
+
+// providerUserinfo is the answer of the userinfo endpoint for naming the
+// kubeconfig entries, err is kept so a failing endpoint falls back to the
+// names of the last login
+type providerUserinfo struct {
+	claims map[string]interface{}
+	err    error
+}
+
+// needUserinfo tells if the naming templates of the cluster are in use and
+// the issued token has no username for them
+func needUserinfo(cluster *Cluster, token string) bool {
+	if namingTemplates(cluster) == (NamingTemplates{}) {
+		return false
+	}
+	claims, err := auth.DecodeClaims(token)
+	return err != nil || claimedUsername(claims) == ""
+}
+
+// fetchUserinfo gets the claims of the user the access token was issued to
+func fetchUserinfo(ctx context.Context, cluster *Cluster, accessToken string) *providerUserinfo {
+	var claims map[string]interface{}
+
+	userinfoURL := providerEndpoint(cluster, userinfoPath)
+	start := time.Now()
+	resp, errs := endRequest(ctx, gorequest.New().Get(userinfoURL).
+		Set("Authorization", "Bearer "+accessToken), &claims)
+	traceHTTP("GET", userinfoURL, start, resp, errs)
+	if len(errs) > 0 {
+		return &providerUserinfo{err: errs[0]}
+	}
+	if resp != nil && resp.StatusCode != 200 {
+		return &providerUserinfo{err: &statusError{"fetching userinfo", resp.StatusCode}}
+	}
+	return &providerUserinfo{claims: claims}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// clusterNamePattern keeps cluster names usable as kubeconfig cluster, user
+// and context names, and as file names of the token caches
+var clusterNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+
+// validCluster checks the settings of a new cluster, reporting all problems
+// at once. Missing parameters are reported as before, with the flags to add.
+func validCluster(cluster *Cluster) error {
+	err := missingFlags(cluster)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	check(validClusterName(cluster.Name))
+	check(validServiceURL("-api-server", cluster.APIServer))
+	check(validServiceURL("-issuer", cluster.IssuerURL))
+	check(validServiceURL("-issuer-health-url", cluster.IssuerHealthURL))
+	check(validServiceURL("-provider-url", cluster.ProviderURL))
+	check(validServiceURL("-revocation-url", cluster.RevocationURL))
+	check(validServiceURL("-introspection-url", cluster.IntrospectionURL))
+	if cluster.Port < 1 || cluster.Port > 65535 {
+		check(fmt.Errorf("-port %d is out of range, use a port from 1 to 65535", cluster.Port))
+	}
+	check(validProxyURL(cluster.ProxyURL))
+	check(validSecretSource(cluster.ClientSecret))
+	if len(cluster.AsGroups) > 0 && cluster.AsUser == "" {
+		check(errors.New("Impersonating groups needs a user to impersonate, give it with -as-user"))
+	}
+	check(validIssuerAPI(cluster.IssuerAPI))
+	check(validTokenTTL(cluster.TokenTTL))
+	check(validNamingTemplates(cluster.Naming))
+
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return withExitCode(exitUsage, errors.New(problems[0]))
+	}
+	return withExitCode(exitUsage, errors.New("Invalid cluster settings:\n  - "+strings.Join(problems, "\n  - ")))
+}
+
+// validClusterName checks the name of the cluster, which becomes the name of
+// its kubeconfig entries
+func validClusterName(name string) error {
+	if len(name) <= 253 && clusterNamePattern.MatchString(name) {
+		return nil
+	}
+	return fmt.Errorf("Invalid -name %q, use letters, digits, dots, dashes and underscores, starting and ending with a letter or digit", name)
+}
+
+// validServiceURL checks that the URL of flag is absolute and uses https.
+// Plain http is only allowed with -allow-http, or for services on this
+// machine like kubed dev-sandbox.
+func validServiceURL(flag string, rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("Invalid %s %q, give an absolute URL like https://example.com", flag, rawURL)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if *allowHTTP || loopbackHost(u.Hostname()) {
+			return nil
+		}
+		return fmt.Errorf("%s %q must use https, rerun with -allow-http to use http anyway", flag, rawURL)
+	}
+	return fmt.Errorf("%s %q must use https, not %s", flag, rawURL, u.Scheme)
+}
+
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidCluster(t *testing.T) {
+	valid := Cluster{Name: "kubed", APIServer: "https://192.168.1.1:8443", IssuerURL: "https://token.example.com", ClientID: "client-id", Port: 49999}
+
+	var tests = []struct {
+		description string
+		change      func(c *Cluster)
+		problems    []string
+	}{
+		{"valid", func(c *Cluster) {}, nil},
+		{"sandbox on loopback", func(c *Cluster) { c.IssuerURL = "http://127.0.0.1:8002/issuer" }, nil},
+		{"missing", func(c *Cluster) { c.ClientID = "" }, []string{"required parameters"}},
+		{"plain http", func(c *Cluster) { c.IssuerURL = "http://token.example.com" }, []string{"-issuer \"http://token.example.com\" must use https"}},
+		{"relative", func(c *Cluster) { c.APIServer = "192.168.1.1:8443" }, []string{"Invalid -api-server"}},
+		{"all at once", func(c *Cluster) {
+			c.Name = "my cluster"
+			c.APIServer = "ftp://192.168.1.1"
+			c.Port = 70000
+		}, []string{"Invalid -name", "-api-server \"ftp://192.168.1.1\" must use https", "-port 70000 is out of range"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			cluster := valid
+			test.change(&cluster)
+			err := validCluster(&cluster)
+			if test.problems == nil {
+				if err != nil {
+					t.Errorf("Got unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if exitCode(err) != exitUsage {
+				t.Errorf("Expected exit code %d, got %d", exitUsage, exitCode(err))
+			}
+			for _, p := range test.problems {
+				if !strings.Contains(err.Error(), p) {
+					t.Errorf("Expected %q in %q", p, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowHTTP(t *testing.T) {
+	*allowHTTP = true
+	defer func() { *allowHTTP = false }()
+	if err := validServiceURL("-issuer", "http://token.example.com"); err != nil {
+		t.Errorf("Expected -allow-http to allow http, got %s", err)
+	}
+}
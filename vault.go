@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+// vaultStore keeps the tokens of a cluster in a Vault KV version 2 engine,
+// addressed like the Vault CLI with VAULT_ADDR and VAULT_TOKEN or ~/.vault-token
+type vaultStore struct {
+	path string
+}
+
+type vaultSecret struct {
+	Data struct {
+		Data map[string]string `json:"data"`
+	} `json:"data"`
+}
+
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", errors.New("No Vault token, log in with \"vault login\" or set VAULT_TOKEN")
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// vaultURL maps the path, e.g. secret/kubed/prod, to the API path of the
+// engine mounted at its first element
+func (v vaultStore) vaultURL(name string, kind string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	path, err := secretPath(v.path, name)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	if len(parts) != 2 {
+		return "", errors.Errorf("Vault path %q has no secrets engine mount", path)
+	}
+	return strings.TrimRight(addr, "/") + "/v1/" + parts[0] + "/" + kind + "/" + parts[1], nil
+}
+
+func (v vaultStore) request(ctx context.Context, method string, name string, kind string, send interface{}, out interface{}) (int, error) {
+	u, err := v.vaultURL(name, kind)
+	if err != nil {
+		return 0, err
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return 0, err
+	}
+
+	req := gorequest.New().CustomMethod(method, u).Set("X-Vault-Token", token)
+	if send != nil {
+		req = req.Type("json").Send(send)
+	}
+	start := time.Now()
+	resp, errs := endRequest(ctx, req, out)
+	traceHTTP(method, u, start, resp, errs)
+	if errs != nil {
+		// The callers tell what the status means, e.g. no tokens for 404
+		if se, ok := errs[0].(*statusError); ok {
+			return se.code, nil
+		}
+		log.Warn("Failed in talking to Vault ", errs)
+		return 0, errs[0]
+	}
+	if resp == nil {
+		return 0, errors.New("No response from Vault")
+	}
+	return resp.StatusCode, nil
+}
+
+func (v vaultStore) get(ctx context.Context, name string) (CachedToken, bool, error) {
+	var secret vaultSecret
+	status, err := v.request(ctx, "GET", name, "data", nil, &secret)
+	if err != nil {
+		return CachedToken{}, false, err
+	}
+	if status == 404 {
+		return CachedToken{}, false, nil
+	}
+	if status != 200 {
+		return CachedToken{}, false, &statusError{"reading tokens from Vault", status}
+	}
+
+	data := secret.Data.Data
+	cached := CachedToken{
+		AccessToken:  data["accesstoken"],
+		RefreshToken: data["refreshtoken"],
+		JWT:          data["jwt"],
+		IDToken:      data["idtoken"],
+	}
+	if expiry, err := time.Parse(time.RFC3339, data["expiry"]); err == nil {
+		cached.Expiry = expiry
+	}
+	return cached, true, nil
+}
+
+func (v vaultStore) put(ctx context.Context, name string, token CachedToken) error {
+	data := map[string]string{
+		"accesstoken":  token.AccessToken,
+		"refreshtoken": token.RefreshToken,
+		"jwt":          token.JWT,
+		"idtoken":      token.IDToken,
+	}
+	if !token.Expiry.IsZero() {
+		data["expiry"] = token.Expiry.Format(time.RFC3339)
+	}
+	status, err := v.request(ctx, "POST", name, "data", map[string]interface{}{"data": data}, nil)
+	if err != nil {
+		return err
+	}
+	if status != 200 && status != 204 {
+		return &statusError{"writing tokens to Vault", status}
+	}
+	return nil
+}
+
+// remove deletes all versions, so no old refresh token stays behind
+func (v vaultStore) remove(ctx context.Context, name string) error {
+	status, err := v.request(ctx, "DELETE", name, "metadata", nil, nil)
+	if err != nil {
+		return err
+	}
+	if status != 204 && status != 404 {
+		return &statusError{"removing tokens from Vault", status}
+	}
+	return nil
+}
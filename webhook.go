@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/parnurzeal/gorequest"
+	"github.com/pkg/errors"
+)
+
+// renewalEvent is posted to the webhook after each renewal. The text field
+// makes it show up as is in Slack and Teams.
+type renewalEvent struct {
+	Text    string     `json:"text"`
+	Event   string     `json:"event"`
+	Cluster string     `json:"cluster"`
+	Expiry  *time.Time `json:"expiry,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// validWebhookURL makes sure events, which name clusters, only go over HTTPS
+func validWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "Invalid webhook URL")
+	}
+	if u.Scheme != "https" {
+		return errors.New("Webhook URL must use https")
+	}
+	return nil
+}
+
+// notifyWebhook posts the outcome of renewing a cluster to -webhook, if given.
+// Failures are only logged, they must not stop the renewals.
+func notifyWebhook(ctx context.Context, clusterName string, renewErr error) {
+	if *webhookURL == "" {
+		return
+	}
+
+	event := renewalEvent{Event: "renewal_succeeded", Cluster: clusterName}
+	if renewErr != nil {
+		event.Event = "renewal_failed"
+		event.Error = renewErr.Error()
+		event.Text = fmt.Sprintf("kubed failed to renew the token of %s: %s", clusterName, renewErr)
+	} else {
+		event.Text = fmt.Sprintf("kubed renewed the token of %s", clusterName)
+		if c, err := readConfig(clusterName); err == nil && !c.TokenExpiry.IsZero() {
+			event.Expiry = &c.TokenExpiry
+			event.Text += ", valid until " + c.TokenExpiry.Format(time.RFC1123)
+		}
+	}
+
+	start := time.Now()
+	resp, errs := endRequest(ctx, gorequest.New().Post(*webhookURL).Type("json").Send(event), nil)
+	traceHTTP("POST", *webhookURL, start, resp, errs)
+
+	if len(errs) > 0 {
+		log.Warn("Failed in posting to webhook ", errs[0])
+	} else if resp != nil && resp.StatusCode/100 != 2 {
+		log.Warn("Failed in posting to webhook, responsecode: ", resp.StatusCode)
+	}
+}